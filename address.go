@@ -0,0 +1,71 @@
+package gopcap
+
+// This file contains helpers for classifying IPv4 and IPv6 addresses into the standard ranges
+// defined by the various RFCs. The address functions operate on the byte arrays used to store
+// addresses in the parsed packets. The packet methods check the destination address for
+// multicast and broadcast, since only a destination can be a group address, and check both
+// addresses for the other ranges.
+
+// IPv4IsMulticast returns whether the address is in the multicast range 224.0.0.0/4 (RFC 5771).
+func IPv4IsMulticast(addr [4]byte) bool {
+	return addr[0]&0xF0 == 0xE0
+}
+
+// IPv4IsBroadcast returns whether the address is the limited broadcast address 255.255.255.255.
+func IPv4IsBroadcast(addr [4]byte) bool {
+	return addr == [4]byte{255, 255, 255, 255}
+}
+
+// IPv4IsPrivate returns whether the address is in one of the private ranges 10.0.0.0/8,
+// 172.16.0.0/12 or 192.168.0.0/16 (RFC 1918).
+func IPv4IsPrivate(addr [4]byte) bool {
+	return addr[0] == 10 ||
+		(addr[0] == 172 && addr[1]&0xF0 == 16) ||
+		(addr[0] == 192 && addr[1] == 168)
+}
+
+// IPv6IsMulticast returns whether the address is in the multicast range ff00::/8 (RFC 4291).
+func IPv6IsMulticast(addr [16]byte) bool {
+	return addr[0] == 0xFF
+}
+
+// IPv6IsLinkLocal returns whether the address is in the link-local unicast range fe80::/10
+// (RFC 4291).
+func IPv6IsLinkLocal(addr [16]byte) bool {
+	return addr[0] == 0xFE && addr[1]&0xC0 == 0x80
+}
+
+// IPv6IsUniqueLocal returns whether the address is in the unique local range fc00::/7 (RFC 4193).
+func IPv6IsUniqueLocal(addr [16]byte) bool {
+	return addr[0]&0xFE == 0xFC
+}
+
+// IsMulticast returns whether the packet is sent to a multicast group.
+func (p *IPv4Packet) IsMulticast() bool {
+	return IPv4IsMulticast(p.DestAddress)
+}
+
+// IsBroadcast returns whether the packet is sent to the limited broadcast address.
+func (p *IPv4Packet) IsBroadcast() bool {
+	return IPv4IsBroadcast(p.DestAddress)
+}
+
+// IsPrivate returns whether both the source and destination addresses are private.
+func (p *IPv4Packet) IsPrivate() bool {
+	return IPv4IsPrivate(p.SourceAddress) && IPv4IsPrivate(p.DestAddress)
+}
+
+// IsMulticast returns whether the packet is sent to a multicast group.
+func (p *IPv6Packet) IsMulticast() bool {
+	return IPv6IsMulticast(p.DestinationAddress)
+}
+
+// IsLinkLocal returns whether both the source and destination addresses are link-local.
+func (p *IPv6Packet) IsLinkLocal() bool {
+	return IPv6IsLinkLocal(p.SourceAddress) && IPv6IsLinkLocal(p.DestinationAddress)
+}
+
+// IsUniqueLocal returns whether both the source and destination addresses are unique local.
+func (p *IPv6Packet) IsUniqueLocal() bool {
+	return IPv6IsUniqueLocal(p.SourceAddress) && IPv6IsUniqueLocal(p.DestinationAddress)
+}
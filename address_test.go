@@ -0,0 +1,80 @@
+package gopcap
+
+import "testing"
+
+func TestIPv4Classification(t *testing.T) {
+	in := [][4]byte{
+		{192, 168, 1, 2},
+		{172, 31, 255, 1},
+		{172, 32, 0, 1},
+		{10, 0, 0, 1},
+		{224, 0, 0, 251},
+		{239, 255, 255, 250},
+		{255, 255, 255, 255},
+		{212, 204, 214, 114},
+	}
+
+	multicast := []bool{false, false, false, false, true, true, false, false}
+	broadcast := []bool{false, false, false, false, false, false, true, false}
+	private := []bool{true, true, false, true, false, false, false, false}
+
+	for i, addr := range in {
+		if IPv4IsMulticast(addr) != multicast[i] {
+			t.Errorf("Unexpected multicast classification of %v: expected %v", addr, multicast[i])
+		}
+		if IPv4IsBroadcast(addr) != broadcast[i] {
+			t.Errorf("Unexpected broadcast classification of %v: expected %v", addr, broadcast[i])
+		}
+		if IPv4IsPrivate(addr) != private[i] {
+			t.Errorf("Unexpected private classification of %v: expected %v", addr, private[i])
+		}
+	}
+
+	pkt := &IPv4Packet{SourceAddress: [4]byte{192, 168, 1, 2}, DestAddress: [4]byte{224, 0, 0, 251}}
+	if !pkt.IsMulticast() {
+		t.Errorf("Expected packet to be multicast.")
+	}
+	if pkt.IsBroadcast() {
+		t.Errorf("Expected packet not to be broadcast.")
+	}
+	if pkt.IsPrivate() {
+		t.Errorf("Expected packet not to be private.")
+	}
+}
+
+func TestIPv6Classification(t *testing.T) {
+	in := [][16]byte{
+		{0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e},
+		{0xfe, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		{0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c},
+		{0xfd, 0x12, 0x34, 0x56, 0x78, 0x9a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+	}
+
+	multicast := []bool{false, false, true, false, false}
+	linkLocal := []bool{true, false, false, false, false}
+	uniqueLocal := []bool{false, false, false, true, false}
+
+	for i, addr := range in {
+		if IPv6IsMulticast(addr) != multicast[i] {
+			t.Errorf("Unexpected multicast classification of %v: expected %v", addr, multicast[i])
+		}
+		if IPv6IsLinkLocal(addr) != linkLocal[i] {
+			t.Errorf("Unexpected link-local classification of %v: expected %v", addr, linkLocal[i])
+		}
+		if IPv6IsUniqueLocal(addr) != uniqueLocal[i] {
+			t.Errorf("Unexpected unique local classification of %v: expected %v", addr, uniqueLocal[i])
+		}
+	}
+
+	pkt := &IPv6Packet{SourceAddress: in[0], DestinationAddress: in[2]}
+	if !pkt.IsMulticast() {
+		t.Errorf("Expected packet to be multicast.")
+	}
+	if pkt.IsLinkLocal() {
+		t.Errorf("Expected packet not to be link-local.")
+	}
+	if pkt.IsUniqueLocal() {
+		t.Errorf("Expected packet not to be unique local.")
+	}
+}
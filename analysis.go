@@ -0,0 +1,264 @@
+package gopcap
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Window buckets the packets in the file into consecutive time windows of the given size. The first
+// window starts at the timestamp of the first packet, and any packets timestamped before that are
+// placed in the first window. If includeEmpty is set, windows that contain no packets are included
+// in the result as empty slices; otherwise they are skipped. Within each window, packets are kept
+// in file order.
+func (file *PcapFile) Window(size time.Duration, includeEmpty bool) [][]Packet {
+	windows := make([][]Packet, 0)
+	if len(file.Packets) == 0 || size <= 0 {
+		return windows
+	}
+
+	start := file.Packets[0].Timestamp
+
+	// Gather the packets by the window they belong in.
+	buckets := make(map[int][]Packet)
+	last := 0
+	for _, pkt := range file.Packets {
+		index := 0
+		if pkt.Timestamp > start {
+			index = int((pkt.Timestamp - start) / size)
+		}
+		buckets[index] = append(buckets[index], pkt)
+		if index > last {
+			last = index
+		}
+	}
+
+	if includeEmpty {
+		for index := 0; index <= last; index++ {
+			bucket, ok := buckets[index]
+			if !ok {
+				bucket = make([]Packet, 0)
+			}
+			windows = append(windows, bucket)
+		}
+		return windows
+	}
+
+	// Otherwise only the windows with packets in are visited, since a single outlying timestamp
+	// can put billions of empty ones between them.
+	indexes := make([]int, 0, len(buckets))
+	for index := range buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		windows = append(windows, buckets[index])
+	}
+	return windows
+}
+
+// Duration returns how long the capture lasted: the time between its earliest and latest packets.
+// Packets aren't always in chronological order, so these aren't necessarily the first and last. A
+// capture with fewer than two packets has no duration.
+func (file *PcapFile) Duration() time.Duration {
+	if len(file.Packets) == 0 {
+		return 0
+	}
+
+	earliest, latest := file.Packets[0].Timestamp, file.Packets[0].Timestamp
+	for _, pkt := range file.Packets[1:] {
+		if pkt.Timestamp < earliest {
+			earliest = pkt.Timestamp
+		}
+		if pkt.Timestamp > latest {
+			latest = pkt.Timestamp
+		}
+	}
+	return latest - earliest
+}
+
+// PacketWarning records a problem with a packet that didn't stop it from being parsed.
+type PacketWarning struct {
+	Index int // The index of the packet in the capture.
+	Err   error
+}
+
+// CheckMartianSources returns a MartianSourceAddress warning for each IPv4 packet in the file
+// whose source address should never be seen on the wire. See IPv4Packet.HasMartianSource.
+func (file *PcapFile) CheckMartianSources() []PacketWarning {
+	warnings := make([]PacketWarning, 0)
+
+	for i, pkt := range file.Packets {
+		if pkt.Data == nil {
+			continue
+		}
+		ip, ok := pkt.Data.LinkData().(*IPv4Packet)
+		if ok && ip.HasMartianSource() {
+			warnings = append(warnings, PacketWarning{Index: i, Err: MartianSourceAddress})
+		}
+	}
+
+	return warnings
+}
+
+// DefaultSizeBuckets are the packet size buckets used by SizeHistogram if none are given: the
+// usual powers of two, the largest untagged Ethernet frame, and jumbo frames.
+var DefaultSizeBuckets = []uint32{64, 128, 256, 512, 1024, 1518, 9216}
+
+// SizeHistogramOverflow is the key SizeHistogram counts packets under if they're larger than every
+// bucket.
+const SizeHistogramOverflow uint32 = math.MaxUint32
+
+// SizeHistogram tallies the packets in the file by size, as they were on the wire (ActualLen). Each
+// bucket is the largest size it holds, and each packet is counted under the smallest bucket it
+// fits in, so with buckets of 64 and 128 a 100-byte packet is counted under 128. Packets larger
+// than every bucket are counted under SizeHistogramOverflow. The buckets needn't be sorted; if
+// there are none, DefaultSizeBuckets are used. Every bucket has an entry, even if it's zero.
+func (file *PcapFile) SizeHistogram(buckets []uint32) map[uint32]int {
+	if len(buckets) == 0 {
+		buckets = DefaultSizeBuckets
+	}
+
+	sorted := append([]uint32(nil), buckets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	histogram := make(map[uint32]int, len(sorted))
+	for _, bucket := range sorted {
+		histogram[bucket] = 0
+	}
+
+	for _, pkt := range file.Packets {
+		if pkt.Data == nil {
+			continue
+		}
+
+		i := sort.Search(len(sorted), func(i int) bool { return sorted[i] >= pkt.ActualLen })
+		if i == len(sorted) {
+			histogram[SizeHistogramOverflow]++
+		} else {
+			histogram[sorted[i]]++
+		}
+	}
+
+	return histogram
+}
+
+// ChecksumError records a packet whose checksum didn't match its contents.
+type ChecksumError struct {
+	Index    int // The index of the packet in the capture.
+	Checksum ChecksumType
+}
+
+// checksumNames are the names ChecksumError uses for each checksum.
+var checksumNames = map[ChecksumType]string{
+	CHECKSUM_IPV4: "IPv4 header",
+	CHECKSUM_TCP:  "TCP",
+	CHECKSUM_UDP:  "UDP",
+}
+
+func (e ChecksumError) Error() string {
+	return fmt.Sprintf("Invalid %v checksum in packet %v.", checksumNames[e.Checksum], e.Index)
+}
+
+// VerifyChecksums validates the IPv4 header, TCP and UDP checksums of every packet in the file,
+// over IPv4 and IPv6, and returns an error for each one that doesn't match. A packet can have more
+// than one. Checksums can only be checked over whole packets, so packets cut short by the snaplen
+// and IPv4 fragments are skipped, apart from their IPv4 header checksums. Packets sent by the
+// capturing host often fail, because their checksums are left for the network card to fill in.
+func (file *PcapFile) VerifyChecksums() []ChecksumError {
+	failures := make([]ChecksumError, 0)
+
+	for i, pkt := range file.Packets {
+		if pkt.Data == nil {
+			continue
+		}
+		complete := pkt.IncludedLen >= pkt.ActualLen
+
+		var pseudoHeader func(protocol IPProtocol, length int) []byte
+		switch ip := pkt.Data.LinkData().(type) {
+		case *IPv4Packet:
+			if ip.ValidateChecksum() != nil {
+				failures = append(failures, ChecksumError{Index: i, Checksum: CHECKSUM_IPV4})
+			}
+			if ip.MoreFragments || ip.FragmentOffset != 0 {
+				complete = false
+			}
+			pseudoHeader = func(protocol IPProtocol, length int) []byte {
+				return ip.PseudoHeader(protocol, uint16(length))
+			}
+		case *IPv6Packet:
+			pseudoHeader = func(protocol IPProtocol, length int) []byte {
+				return ip.PseudoHeader(protocol, uint32(length))
+			}
+		default:
+			continue
+		}
+		if !complete {
+			continue
+		}
+
+		switch trans := pkt.Data.LinkData().InternetData().(type) {
+		case *TCPSegment:
+			length := trans.HeaderBytes() + len(trans.TransportData())
+			if trans.ValidateChecksum(pseudoHeader(IPP_TCP, length)) != nil {
+				failures = append(failures, ChecksumError{Index: i, Checksum: CHECKSUM_TCP})
+			}
+		case *UDPDatagram:
+			length := udpHeaderLength + len(trans.TransportData())
+			if trans.ValidateChecksum(pseudoHeader(IPP_UDP, length)) != nil {
+				failures = append(failures, ChecksumError{Index: i, Checksum: CHECKSUM_UDP})
+			}
+		}
+	}
+
+	return failures
+}
+
+// ProtocolCounts breaks the packets of a capture down by protocol at each layer.
+type ProtocolCounts struct {
+	LinkTypes   map[Link]int       // Every packet, by the link type of the file.
+	EtherTypes  map[EtherType]int  // Ethernet and Linux cooked frames, by the EtherType of their payload.
+	IPProtocols map[IPProtocol]int // IPv4 and IPv6 packets, by the protocol of their payload.
+	Transports  map[string]int     // Decoded transport layers, by the name of their type, e.g. "TCPSegment".
+}
+
+// ProtocolCounts counts the packets in the file by the protocol they use at each layer. A packet
+// is counted once at every layer it has.
+func (file *PcapFile) ProtocolCounts() ProtocolCounts {
+	counts := ProtocolCounts{
+		LinkTypes:   make(map[Link]int),
+		EtherTypes:  make(map[EtherType]int),
+		IPProtocols: make(map[IPProtocol]int),
+		Transports:  make(map[string]int),
+	}
+
+	for i := range file.Packets {
+		pkt := &file.Packets[i]
+		counts.LinkTypes[file.LinkType]++
+
+		switch link := pkt.Data.(type) {
+		case *EthernetFrame:
+			if !link.Truncated {
+				counts.EtherTypes[link.EtherType]++
+			}
+		case *SLLFrame:
+			counts.EtherTypes[link.Protocol]++
+		}
+
+		switch ip := pkt.Network().(type) {
+		case *IPv4Packet:
+			counts.IPProtocols[ip.Protocol]++
+		case *IPv6Packet:
+			counts.IPProtocols[ip.NextHeader]++
+		}
+
+		if transport := pkt.Transport(); transport != nil {
+			counts.Transports[reflect.Indirect(reflect.ValueOf(transport)).Type().Name()]++
+		}
+	}
+
+	return counts
+}
@@ -0,0 +1,96 @@
+package gopcap
+
+import (
+	"time"
+)
+
+// FlowStats summarises the packets of one flow: a conversation between two endpoints over TCP,
+// UDP, UDP-Lite or SCTP, in both directions.
+type FlowStats struct {
+	Tuple    Tuple // The tuple of the first packet of the flow, so Forward is from whoever sent it.
+	Forward  FlowDirection
+	Reverse  FlowDirection
+	First    time.Duration // The timestamp of the first packet.
+	Last     time.Duration // The timestamp of the last packet.
+	TCPFlags TCPFlags      // Every flag set on the flow's TCP segments, in either direction.
+}
+
+// FlowDirection counts the packets sent in one direction of a flow, and their bytes as they were on
+// the wire, including any lost to the snaplen.
+type FlowDirection struct {
+	Packets int
+	Bytes   uint64
+}
+
+// Duration returns the time between the first and last packets of the flow.
+func (f *FlowStats) Duration() time.Duration {
+	return f.Last - f.First
+}
+
+// Flows aggregates the packets in the file into flows, merging both directions of each one. The
+// flows are keyed by their canonical tuple (see Tuple.Canonical). Packets without a tuple, such as
+// ARP or ICMP, aren't part of any flow.
+func (file *PcapFile) Flows() map[Tuple]*FlowStats {
+	flows := make(map[Tuple]*FlowStats)
+
+	for i := range file.Packets {
+		pkt := &file.Packets[i]
+		tuple, ok := pkt.FiveTuple()
+		if !ok {
+			continue
+		}
+
+		key := tuple.Canonical()
+		flow, seen := flows[key]
+		if !seen {
+			flow = &FlowStats{Tuple: tuple, First: pkt.Timestamp, Last: pkt.Timestamp}
+			flows[key] = flow
+		}
+
+		direction := &flow.Forward
+		if tuple != flow.Tuple {
+			direction = &flow.Reverse
+		}
+		direction.Packets++
+		direction.Bytes += uint64(pkt.ActualLen)
+
+		if pkt.Timestamp < flow.First {
+			flow.First = pkt.Timestamp
+		}
+		if pkt.Timestamp > flow.Last {
+			flow.Last = pkt.Timestamp
+		}
+		if segment, isTCP := pkt.Transport().(*TCPSegment); isTCP {
+			flow.TCPFlags |= segment.Flags
+		}
+	}
+
+	return flows
+}
+
+// SplitFlows partitions the packets in the file by flow, for isolating a single conversation from a
+// busy capture. Each flow is returned as a file of its own, with the header of the original and
+// the packets of both directions in their original order, keyed by its canonical tuple as Flows
+// keys them. Packets without a tuple are left out. Each file can be saved with WriteTo.
+func (file *PcapFile) SplitFlows() map[Tuple]*PcapFile {
+	flows := make(map[Tuple]*PcapFile)
+
+	for i := range file.Packets {
+		tuple, ok := file.Packets[i].FiveTuple()
+		if !ok {
+			continue
+		}
+
+		key := tuple.Canonical()
+		flow, seen := flows[key]
+		if !seen {
+			flow = new(PcapFile)
+			*flow = *file
+			flow.Packets = make([]Packet, 0)
+			flows[key] = flow
+		}
+		flow.Packets = append(flow.Packets, file.Packets[i])
+	}
+
+	return flows
+}
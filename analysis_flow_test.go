@@ -0,0 +1,114 @@
+package gopcap
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFlows(t *testing.T) {
+	client := [4]byte{10, 0, 0, 1}
+	server := [4]byte{10, 0, 0, 2}
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(time.Second, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(2*time.Second, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(3*time.Second, client, server, 40000, 80, 1001, 5001, "PA", []byte("GET /")),
+		tcpTestPacket(5*time.Second, server, client, 80, 40000, 5001, 1006, "FA", nil),
+		tcpTestPacket(4*time.Second, client, server, 40001, 80, 2000, 0, "S", nil),
+		{Data: &EthernetFrame{EtherType: ARP, data: new(ARPPacket)}},
+	}}
+	for i := range file.Packets {
+		file.Packets[i].ActualLen = uint32(100 * (i + 1))
+	}
+
+	flows := file.Flows()
+	if len(flows) != 2 {
+		t.Fatalf("Unexpected number of flows: expected %v, got %v", 2, len(flows))
+	}
+
+	tuple, _ := file.Packets[0].FiveTuple()
+	flow := flows[tuple.Canonical()]
+	if flow == nil {
+		t.Fatalf("Missing flow for %v", tuple)
+	}
+	if flow.Tuple != tuple {
+		t.Errorf("Unexpected flow tuple: expected %v, got %v", tuple, flow.Tuple)
+	}
+	if flow.Forward != (FlowDirection{Packets: 2, Bytes: 400}) || flow.Reverse != (FlowDirection{Packets: 2, Bytes: 600}) {
+		t.Errorf("Unexpected directions: %+v and %+v", flow.Forward, flow.Reverse)
+	}
+	if flow.First != time.Second || flow.Last != 5*time.Second || flow.Duration() != 4*time.Second {
+		t.Errorf("Unexpected times: %v to %v", flow.First, flow.Last)
+	}
+	if flow.TCPFlags != TCP_FLAG_SYN|TCP_FLAG_ACK|TCP_FLAG_PSH|TCP_FLAG_FIN {
+		t.Errorf("Unexpected flags: %v", flow.TCPFlags)
+	}
+
+	// Every packet with a tuple in the capture falls in exactly one flow.
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	expected := 0
+	for i := range parsed.Packets {
+		if _, ok := parsed.Packets[i].FiveTuple(); ok {
+			expected++
+		}
+	}
+	total := 0
+	for _, flow := range parsed.Flows() {
+		total += flow.Forward.Packets + flow.Reverse.Packets
+	}
+	if total != expected {
+		t.Errorf("Unexpected number of packets in flows: expected %v, got %v", expected, total)
+	}
+}
+
+func TestSplitFlows(t *testing.T) {
+	client := [4]byte{10, 0, 0, 1}
+	server := [4]byte{10, 0, 0, 2}
+	file := PcapFile{LinkType: ETHERNET, MaxLen: 65535, Packets: []Packet{
+		tcpTestPacket(time.Second, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(2*time.Second, client, server, 40001, 80, 2000, 0, "S", nil),
+		tcpTestPacket(3*time.Second, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		{Data: &EthernetFrame{EtherType: ARP, data: new(ARPPacket)}},
+		tcpTestPacket(4*time.Second, client, server, 40000, 80, 1001, 5001, "A", nil),
+	}}
+
+	flows := file.SplitFlows()
+	if len(flows) != 2 {
+		t.Fatalf("Unexpected number of flows: expected %v, got %v", 2, len(flows))
+	}
+
+	// Both directions are kept, in their original order.
+	tuple, _ := file.Packets[0].FiveTuple()
+	flow := flows[tuple.Canonical()]
+	if flow == nil {
+		t.Fatalf("Missing flow for %v", tuple)
+	}
+	if flow.LinkType != ETHERNET || flow.MaxLen != 65535 {
+		t.Errorf("Unexpected header: %+v", flow)
+	}
+	expected := []time.Duration{time.Second, 3 * time.Second, 4 * time.Second}
+	if len(flow.Packets) != len(expected) {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v", len(expected), len(flow.Packets))
+	}
+	for i, ts := range expected {
+		if flow.Packets[i].Timestamp != ts {
+			t.Errorf("Unexpected packet %v: expected timestamp %v, got %v", i, ts, flow.Packets[i].Timestamp)
+		}
+	}
+
+	// The split agrees with the flow statistics.
+	for key, stats := range file.Flows() {
+		if len(flows[key].Packets) != stats.Forward.Packets+stats.Reverse.Packets {
+			t.Errorf("Unexpected number of packets for %v: expected %v, got %v", key, stats.Forward.Packets+stats.Reverse.Packets, len(flows[key].Packets))
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package gopcap
+
+import (
+	"bytes"
+)
+
+// Flags carried by SCTP DATA chunks.
+const (
+	sctpDataEnding    uint8 = 0x01
+	sctpDataBeginning uint8 = 0x02
+	sctpDataUnordered uint8 = 0x04
+)
+
+// SCTPReassembler rebuilds the user messages sent on each SCTP stream from the DATA chunks in a
+// capture. Fragmented messages are joined back together, ordered messages are delivered in stream
+// sequence number order, and unordered messages are delivered as soon as they're complete.
+type SCTPReassembler struct {
+	associations map[Tuple]*sctpAssociation
+}
+
+// SCTPStream holds the messages reassembled from a single stream in one direction of an
+// association.
+type SCTPStream struct {
+	Ordered   []SCTPMessage
+	Unordered []SCTPMessage
+	started   bool
+	nextSSN   uint16
+	pending   map[uint16]SCTPMessage
+}
+
+// SCTPMessage is a single complete user message.
+type SCTPMessage struct {
+	StreamIdentifier          uint16
+	StreamSequenceNumber      uint16 // Meaningless for unordered messages.
+	PayloadProtocolIdentifier uint32
+	Unordered                 bool
+	Data                      []byte
+}
+
+// sctpAssociation holds the reassembly state for one direction of an association.
+type sctpAssociation struct {
+	streams   map[uint16]*SCTPStream
+	fragments map[uint32]*SCTPChunkData
+	seen      map[uint32]bool
+}
+
+// NewSCTPReassembler creates an empty SCTPReassembler.
+func NewSCTPReassembler() *SCTPReassembler {
+	return &SCTPReassembler{associations: make(map[Tuple]*sctpAssociation)}
+}
+
+// ReassembleSCTP runs an SCTPReassembler over every packet in the file.
+func (file *PcapFile) ReassembleSCTP() *SCTPReassembler {
+	reassembler := NewSCTPReassembler()
+	for i := range file.Packets {
+		tuple, ok := file.Packets[i].FiveTuple()
+		if !ok {
+			continue
+		}
+		segment, ok := file.Packets[i].Data.LinkData().InternetData().(*SCTPSegment)
+		if ok {
+			reassembler.Add(tuple, segment)
+		}
+	}
+	return reassembler
+}
+
+// Add passes the DATA chunks from a segment to the reassembler. The tuple identifies the direction
+// of the association the segment was sent in.
+func (r *SCTPReassembler) Add(tuple Tuple, segment *SCTPSegment) {
+	assoc, exists := r.associations[tuple]
+	if !exists {
+		assoc = &sctpAssociation{
+			streams:   make(map[uint16]*SCTPStream),
+			fragments: make(map[uint32]*SCTPChunkData),
+			seen:      make(map[uint32]bool),
+		}
+		r.associations[tuple] = assoc
+	}
+
+	for _, chunk := range segment.Chunks {
+		data, isData := chunk.(*SCTPChunkData)
+		if isData {
+			assoc.add(data)
+		}
+	}
+}
+
+// Stream returns the messages reassembled for a stream in the given direction of an association,
+// or nil if no data has been seen on that stream.
+func (r *SCTPReassembler) Stream(tuple Tuple, stream uint16) *SCTPStream {
+	assoc, exists := r.associations[tuple]
+	if !exists {
+		return nil
+	}
+	return assoc.streams[stream]
+}
+
+// add handles a single DATA chunk, delivering any message it completes.
+func (a *sctpAssociation) add(chunk *SCTPChunkData) {
+	// Ignore retransmissions of chunks we've already had.
+	if a.seen[chunk.TSN] {
+		return
+	}
+	a.seen[chunk.TSN] = true
+	a.fragments[chunk.TSN] = chunk
+
+	// Fragments of a message have consecutive TSNs, so look backwards for the first fragment
+	// and forwards for the last one.
+	first := chunk.TSN
+	for a.fragments[first].Flags&sctpDataBeginning == 0 {
+		if a.fragments[first-1] == nil {
+			return
+		}
+		first--
+	}
+	last := chunk.TSN
+	for a.fragments[last].Flags&sctpDataEnding == 0 {
+		if a.fragments[last+1] == nil {
+			return
+		}
+		last++
+	}
+
+	// The message is complete.
+	message := SCTPMessage{
+		StreamIdentifier:          a.fragments[first].StreamIdentifier,
+		StreamSequenceNumber:      a.fragments[first].StreamSequenceNumber,
+		PayloadProtocolIdentifier: a.fragments[first].PayloadProtocolIdentifier,
+		Unordered:                 a.fragments[first].Flags&sctpDataUnordered != 0,
+		Data:                      make([]byte, 0),
+	}
+	for tsn := first; ; tsn++ {
+		message.Data = append(message.Data, a.fragments[tsn].Data...)
+		delete(a.fragments, tsn)
+		if tsn == last {
+			break
+		}
+	}
+
+	stream, exists := a.streams[message.StreamIdentifier]
+	if !exists {
+		stream = &SCTPStream{
+			Ordered:   make([]SCTPMessage, 0),
+			Unordered: make([]SCTPMessage, 0),
+			pending:   make(map[uint16]SCTPMessage),
+		}
+		a.streams[message.StreamIdentifier] = stream
+	}
+	stream.deliver(message)
+}
+
+// deliver adds a complete message to the stream. Unordered messages are delivered immediately,
+// while ordered messages wait until every message before them has been delivered. The capture may
+// start part way through an association, so the first ordered message seen sets the starting
+// sequence number.
+func (s *SCTPStream) deliver(message SCTPMessage) {
+	if message.Unordered {
+		s.Unordered = append(s.Unordered, message)
+		return
+	}
+
+	if !s.started {
+		s.started = true
+		s.nextSSN = message.StreamSequenceNumber
+	}
+
+	s.pending[message.StreamSequenceNumber] = message
+	for {
+		next, ready := s.pending[s.nextSSN]
+		if !ready {
+			break
+		}
+		s.Ordered = append(s.Ordered, next)
+		delete(s.pending, s.nextSSN)
+		s.nextSSN++
+	}
+}
+
+// SCTPCookieExchange pairs the state cookie offered in an INIT ACK chunk with the COOKIE ECHO chunk
+// that sent it back. The cookie must be echoed unchanged, so a mismatch suggests a corrupt or
+// forged COOKIE ECHO, or one meant for a different association.
+type SCTPCookieExchange struct {
+	Tuple           Tuple // The direction the INIT ACK was sent in.
+	InitAckIndex    int   // The index of the packet carrying the INIT ACK.
+	CookieEchoIndex int   // The index of the packet carrying the COOKIE ECHO, or -1 if none was seen.
+	Cookie          []byte
+	Err             error // SCTPCookieMismatch if the echoed cookie differs from the one offered.
+}
+
+// SCTPCookieExchanges finds every INIT ACK chunk in the file and pairs its state cookie with the
+// next COOKIE ECHO chunk sent in the opposite direction, in the order the INIT ACKs were seen.
+func (file *PcapFile) SCTPCookieExchanges() []SCTPCookieExchange {
+	exchanges := make([]SCTPCookieExchange, 0)
+	pending := make(map[Tuple]int)
+
+	for i := range file.Packets {
+		tuple, ok := file.Packets[i].FiveTuple()
+		if !ok {
+			continue
+		}
+		segment, ok := file.Packets[i].Data.LinkData().InternetData().(*SCTPSegment)
+		if !ok {
+			continue
+		}
+
+		for _, chunk := range segment.Chunks {
+			switch c := chunk.(type) {
+			case *SCTPChunkInitAck:
+				cookie, _ := c.StateCookie()
+				pending[tuple.Reverse()] = len(exchanges)
+				exchanges = append(exchanges, SCTPCookieExchange{
+					Tuple:           tuple,
+					InitAckIndex:    i,
+					CookieEchoIndex: -1,
+					Cookie:          cookie,
+				})
+			case *SCTPChunkCookieEcho:
+				index, ok := pending[tuple]
+				if !ok {
+					continue
+				}
+				delete(pending, tuple)
+
+				exchanges[index].CookieEchoIndex = i
+				if !bytes.Equal(c.Cookie, exchanges[index].Cookie) {
+					exchanges[index].Err = SCTPCookieMismatch
+				}
+			}
+		}
+	}
+
+	return exchanges
+}
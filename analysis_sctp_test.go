@@ -0,0 +1,133 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+// sctpTestDataChunk builds a DATA chunk for reassembly tests.
+func sctpTestDataChunk(tsn uint32, flags uint8, ssn uint16, data string) *SCTPChunkData {
+	return &SCTPChunkData{
+		SCTPChunkHeader:      SCTPChunkHeader{Type: SCTP_CHUNK_DATA, Flags: flags, Length: uint16(16 + len(data))},
+		TSN:                  tsn,
+		StreamIdentifier:     1,
+		StreamSequenceNumber: ssn,
+		Data:                 []byte(data),
+	}
+}
+
+// sctpTestPacket builds an Ethernet/IPv4/SCTP packet carrying the chunks.
+func sctpTestPacket(src, dst [4]byte, srcPort, dstPort uint16, chunks ...SCTPChunk) Packet {
+	segment := &SCTPSegment{SourcePort: srcPort, DestinationPort: dstPort, Chunks: chunks}
+	ip := &IPv4Packet{IHL: 5, TTL: 64, Protocol: IPP_SCTP, SourceAddress: src, DestAddress: dst, data: segment}
+	return Packet{Data: &EthernetFrame{EtherType: ETHERTYPE_IPV4, data: ip}}
+}
+
+// sctpTestInitAck builds an INIT ACK chunk offering the cookie.
+func sctpTestInitAck(cookie string) *SCTPChunkInitAck {
+	initAck := new(SCTPChunkInitAck)
+	initAck.Type = SCTP_CHUNK_INIT_ACK
+	initAck.Parameters = []SCTPChunkParameter{&SCTPChunkParameterStateCookie{
+		SCTPChunkParameterHeader: SCTPChunkParameterHeader{Type: SCTP_CHUNK_PARAMETER_STATE_COOKIE, Length: uint16(4 + len(cookie))},
+		Cookie:                   []byte(cookie),
+	}}
+	return initAck
+}
+
+func TestSCTPCookieExchanges(t *testing.T) {
+	client := [4]byte{10, 0, 0, 1}
+	server := [4]byte{10, 0, 0, 2}
+	cookieEcho := func(cookie string) *SCTPChunkCookieEcho {
+		return &SCTPChunkCookieEcho{SCTPChunkHeader: SCTPChunkHeader{Type: SCTP_CHUNK_COOKIE_ECHO}, Cookie: []byte(cookie)}
+	}
+
+	// The first association echoes its cookie correctly, the second echoes a corrupted cookie, and
+	// the third never echoes its cookie at all.
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		sctpTestPacket(server, client, 3868, 40000, sctpTestInitAck("first")),
+		sctpTestPacket(server, client, 3868, 40001, sctpTestInitAck("second")),
+		sctpTestPacket(client, server, 40000, 3868, cookieEcho("first")),
+		sctpTestPacket(client, server, 40001, 3868, cookieEcho("secomd")),
+		sctpTestPacket(server, client, 3868, 40002, sctpTestInitAck("third")),
+	}}
+
+	exchanges := file.SCTPCookieExchanges()
+	if len(exchanges) != 3 {
+		t.Fatalf("Unexpected number of exchanges: expected %v, got %v", 3, len(exchanges))
+	}
+
+	expected := []struct {
+		initAck    int
+		cookieEcho int
+		cookie     string
+		err        error
+	}{
+		{0, 2, "first", nil},
+		{1, 3, "second", SCTPCookieMismatch},
+		{4, -1, "third", nil},
+	}
+	for i, e := range expected {
+		exchange := exchanges[i]
+		if exchange.InitAckIndex != e.initAck || exchange.CookieEchoIndex != e.cookieEcho {
+			t.Errorf("Unexpected packets for exchange %v: expected %v and %v, got %v and %v", i, e.initAck, e.cookieEcho, exchange.InitAckIndex, exchange.CookieEchoIndex)
+		}
+		if string(exchange.Cookie) != e.cookie {
+			t.Errorf("Unexpected cookie for exchange %v: expected %q, got %q", i, e.cookie, exchange.Cookie)
+		}
+		if exchange.Err != e.err {
+			t.Errorf("Unexpected error for exchange %v: expected %v, got %v", i, e.err, exchange.Err)
+		}
+	}
+	if exchanges[0].Tuple.SourcePort != 3868 || exchanges[0].Tuple.DestinationPort != 40000 {
+		t.Errorf("Unexpected tuple for exchange 0: %v", exchanges[0].Tuple)
+	}
+}
+
+func TestSCTPOrderedAndUnordered(t *testing.T) {
+	tuple := Tuple{SourcePort: 2905, DestinationPort: 3565, Protocol: IPP_SCTP}
+	reassembler := NewSCTPReassembler()
+
+	// SSN 0 arrives first, then an unordered message, then SSN 2 ahead of the two fragments of
+	// SSN 1. A retransmission of the unordered message is ignored.
+	segments := [][]SCTPChunk{
+		{sctpTestDataChunk(10, sctpDataBeginning|sctpDataEnding, 0, "zero")},
+		{sctpTestDataChunk(11, sctpDataBeginning|sctpDataEnding|sctpDataUnordered, 0, "urgent")},
+		{sctpTestDataChunk(14, sctpDataBeginning|sctpDataEnding, 2, "two")},
+		{sctpTestDataChunk(13, sctpDataEnding, 1, "ne"), sctpTestDataChunk(11, sctpDataBeginning|sctpDataEnding|sctpDataUnordered, 0, "urgent")},
+		{sctpTestDataChunk(12, sctpDataBeginning, 1, "o")},
+	}
+
+	for i, chunks := range segments {
+		reassembler.Add(tuple, &SCTPSegment{SourcePort: 2905, DestinationPort: 3565, Chunks: chunks})
+
+		// Until SSN 1 is complete, only SSN 0 can have been delivered in order.
+		stream := reassembler.Stream(tuple, 1)
+		if i < len(segments)-1 && len(stream.Ordered) != 1 {
+			t.Errorf("Unexpected number of ordered messages after segment %v: expected %v, got %v", i, 1, len(stream.Ordered))
+		}
+	}
+
+	stream := reassembler.Stream(tuple, 1)
+	expectedOrdered := []string{"zero", "one", "two"}
+
+	if len(stream.Ordered) != len(expectedOrdered) {
+		t.Fatalf("Unexpected number of ordered messages: expected %v, got %v", len(expectedOrdered), len(stream.Ordered))
+	}
+	for i, message := range stream.Ordered {
+		if !bytes.Equal(message.Data, []byte(expectedOrdered[i])) {
+			t.Errorf("Unexpected ordered message %v: expected %v, got %v", i, expectedOrdered[i], string(message.Data))
+		}
+		if message.StreamSequenceNumber != uint16(i) {
+			t.Errorf("Unexpected SSN: expected %v, got %v", i, message.StreamSequenceNumber)
+		}
+	}
+	if len(stream.Unordered) != 1 {
+		t.Fatalf("Unexpected number of unordered messages: expected %v, got %v", 1, len(stream.Unordered))
+	}
+	if !stream.Unordered[0].Unordered || string(stream.Unordered[0].Data) != "urgent" {
+		t.Errorf("Unexpected unordered message: %v", stream.Unordered[0])
+	}
+	if reassembler.Stream(tuple.Reverse(), 1) != nil {
+		t.Errorf("Unexpected stream in the reverse direction.")
+	}
+}
@@ -0,0 +1,385 @@
+package gopcap
+
+import (
+	"sort"
+	"time"
+)
+
+// TCPAnalyzer tracks the state of each TCP connection in a capture as packets are added to it, and
+// records events of interest about each connection. Packets should be added in capture order.
+type TCPAnalyzer struct {
+	connections map[Tuple]*TCPConnection
+	order       []*TCPConnection
+}
+
+// TCPConnection holds the analysis state for a single TCP connection. The Tuple is the direction
+// of the first packet seen on the connection.
+type TCPConnection struct {
+	Tuple           Tuple
+	DuplicateACKs   []DuplicateACK
+	Retransmissions []RetransmissionEvent
+	RTTSamples      []RTTSample
+	SmoothedRTT     time.Duration // The RFC 6298 smoothed round-trip time between the two ends, or zero.
+	CloseReason     CloseReason
+	CloseIndex      int // The index of the packet that closed the connection, if it's been closed.
+	directions      [2]tcpDirection
+}
+
+// DuplicateACK records a pure ACK that repeated the previous acknowledgment number sent in the
+// same direction. Several in a row suggest the receiver is missing the segment starting at
+// AckNumber.
+type DuplicateACK struct {
+	Index     int   // The index of the duplicate ACK in the capture.
+	Tuple     Tuple // The direction the duplicate ACK was sent in.
+	AckNumber uint32
+	Count     int // How many duplicates of AckNumber have been seen in a row, including this one.
+}
+
+// RetransmissionEvent records a segment that resent sequence space already seen in the same
+// direction, which suggests that the segment first carrying it, or the acknowledgment for it, was
+// lost. The range is the part of the segment that had been seen before.
+type RetransmissionEvent struct {
+	Index int    // The index of the retransmitted segment in the capture.
+	Tuple Tuple  // The direction the segment was sent in.
+	Start uint32 // The first sequence number resent.
+	End   uint32 // The sequence number following the last one resent.
+}
+
+// RTTSample records a single round-trip time measurement. Times are measured at the capture point,
+// so a sample covers the round trip from the capture point to the sender of the acknowledgment that
+// completed it and back, rather than the full path between the two ends.
+type RTTSample struct {
+	Index int   // The index of the acknowledgment that completed the sample.
+	Tuple Tuple // The direction of the acknowledgment that completed the sample.
+	RTT   time.Duration
+}
+
+// tcpDirection holds the state for one direction of a connection.
+type tcpDirection struct {
+	seenAck          bool
+	lastAck          uint32
+	duplicate        int
+	tsvals           map[uint32]*tcpTSval
+	synSent          bool
+	synRetransmitted bool
+	synAcked         bool
+	synTime          time.Duration
+	synEnd           uint32
+	sampled          bool
+	smoothedRTT      time.Duration
+	finSent          bool
+	finEnd           uint32
+	finAcked         bool
+	seqBase          uint32        // The sequence number of the first segment seen, which seen is relative to.
+	seen             []tcpSeqRange // The sequence space seen so far, sorted and merged.
+}
+
+// tcpSeqRange is a range of sequence space, from start up to but not including end, relative to
+// the first sequence number seen in its direction. The offsets are unwrapped, so they keep growing
+// past the end of the sequence space, and signed, so that segments arriving before the first one
+// seen can be placed too.
+type tcpSeqRange struct {
+	start, end int64
+}
+
+// tcpTSval records when a timestamp value was first sent, the sequence number following the
+// segment that carried it, and whether it has been echoed yet.
+type tcpTSval struct {
+	sent   time.Duration
+	end    uint32
+	echoed bool
+}
+
+// NewTCPAnalyzer creates an empty TCPAnalyzer.
+func NewTCPAnalyzer() *TCPAnalyzer {
+	return &TCPAnalyzer{
+		connections: make(map[Tuple]*TCPConnection),
+		order:       make([]*TCPConnection, 0),
+	}
+}
+
+// AnalyzeTCP runs a TCPAnalyzer over every packet in the file.
+func (file *PcapFile) AnalyzeTCP() *TCPAnalyzer {
+	analyzer := NewTCPAnalyzer()
+	for i := range file.Packets {
+		analyzer.Add(i, file.Packets[i])
+	}
+	return analyzer
+}
+
+// Add updates the analysis with a single packet. The index is the position of the packet in the
+// capture, and is used to identify the packet in any events recorded. Packets that aren't TCP are
+// ignored.
+func (a *TCPAnalyzer) Add(index int, pkt Packet) {
+	tuple, ok := pkt.FiveTuple()
+	if !ok || tuple.Protocol != IPP_TCP {
+		return
+	}
+	segment, ok := pkt.Data.LinkData().InternetData().(*TCPSegment)
+	if !ok {
+		return
+	}
+
+	key := tuple.Canonical()
+	conn, exists := a.connections[key]
+	if !exists {
+		conn = &TCPConnection{Tuple: tuple, DuplicateACKs: make([]DuplicateACK, 0), Retransmissions: make([]RetransmissionEvent, 0), RTTSamples: make([]RTTSample, 0)}
+		a.connections[key] = conn
+		a.order = append(a.order, conn)
+	}
+
+	direction := 0
+	if tuple != conn.Tuple {
+		direction = 1
+	}
+
+	conn.checkDuplicateACK(index, tuple, &conn.directions[direction], segment)
+	conn.checkRetransmission(index, tuple, &conn.directions[direction], segment)
+	conn.sampleRTT(index, tuple, direction, pkt.Timestamp, segment)
+	conn.trackClose(index, direction, segment)
+}
+
+// Connections returns every connection seen, in the order they were first seen.
+func (a *TCPAnalyzer) Connections() []*TCPConnection {
+	return a.order
+}
+
+// Connection returns the connection with the given tuple, in either direction, or nil if no such
+// connection has been seen.
+func (a *TCPAnalyzer) Connection(tuple Tuple) *TCPConnection {
+	return a.connections[tuple.Canonical()]
+}
+
+// checkDuplicateACK records a duplicate ACK if the segment is a pure ACK repeating the last
+// acknowledgment number sent in its direction.
+func (c *TCPConnection) checkDuplicateACK(index int, tuple Tuple, state *tcpDirection, segment *TCPSegment) {
+	if !segment.HasACK() {
+		return
+	}
+
+	// Only segments without data or connection control flags can be duplicate ACKs; anything else
+	// ends the current run of duplicates.
+	pure := len(segment.TransportData()) == 0 && !segment.HasSYN() && !segment.HasFIN() && !segment.HasRST()
+
+	if pure && state.seenAck && segment.AckNumber == state.lastAck {
+		state.duplicate++
+		c.DuplicateACKs = append(c.DuplicateACKs, DuplicateACK{
+			Index:     index,
+			Tuple:     tuple,
+			AckNumber: segment.AckNumber,
+			Count:     state.duplicate,
+		})
+		return
+	}
+
+	state.seenAck = true
+	state.lastAck = segment.AckNumber
+	state.duplicate = 0
+}
+
+// checkRetransmission records a retransmission if the segment overlaps sequence space already seen
+// in its direction. Segments arriving out of order only fill gaps, so they aren't retransmissions.
+// Neither are keep-alives, which resend the last byte seen, with at most a byte of data, to prompt
+// an acknowledgment.
+func (c *TCPConnection) checkRetransmission(index int, tuple Tuple, state *tcpDirection, segment *TCPSegment) {
+	data := len(segment.TransportData())
+	length := int64(data)
+	if segment.HasSYN() || segment.HasFIN() {
+		length++
+	}
+
+	// Segments that don't consume sequence space, such as pure ACKs, can't be retransmissions.
+	if length == 0 {
+		return
+	}
+
+	if state.seen == nil {
+		state.seqBase = segment.SequenceNumber
+		state.seen = []tcpSeqRange{{0, length}}
+		return
+	}
+
+	// Sequence numbers wrap, so the segment is placed by how far it is from the highest seen, which
+	// keeps flows longer than the sequence space from landing on offsets they've already covered.
+	highest := state.seen[len(state.seen)-1].end
+	start := highest + int64(int32(segment.SequenceNumber-(state.seqBase+uint32(highest))))
+	end := start + length
+
+	keepAlive := !segment.HasSYN() && !segment.HasFIN() && data <= 1 && start == highest-1
+
+	var overlap tcpSeqRange
+	state.seen, overlap = addSeqRange(state.seen, tcpSeqRange{start, end})
+	if overlap.end > overlap.start && !keepAlive {
+		c.Retransmissions = append(c.Retransmissions, RetransmissionEvent{
+			Index: index,
+			Tuple: tuple,
+			Start: state.seqBase + uint32(overlap.start),
+			End:   state.seqBase + uint32(overlap.end),
+		})
+	}
+}
+
+// addSeqRange adds a range to a sorted list of merged ranges, returning the new list and the part
+// of the range that was already covered, which is empty if none of it was. If the range overlaps
+// more than one, the covered part runs from the start of the first overlap to the end of the last.
+func addSeqRange(ranges []tcpSeqRange, r tcpSeqRange) ([]tcpSeqRange, tcpSeqRange) {
+	// The ranges from i up to j touch or overlap the new one, so they're merged with it.
+	i := sort.Search(len(ranges), func(k int) bool { return ranges[k].end >= r.start })
+	j := sort.Search(len(ranges), func(k int) bool { return ranges[k].start > r.end })
+
+	var overlap tcpSeqRange
+	for _, existing := range ranges[i:j] {
+		start, end := existing.start, existing.end
+		if start < r.start {
+			start = r.start
+		}
+		if end > r.end {
+			end = r.end
+		}
+		if start >= end {
+			continue
+		}
+		if overlap.end <= overlap.start {
+			overlap.start = start
+		}
+		overlap.end = end
+	}
+
+	if i == j {
+		ranges = append(ranges, tcpSeqRange{})
+		copy(ranges[i+1:], ranges[i:])
+		ranges[i] = r
+		return ranges, overlap
+	}
+
+	merged := r
+	if ranges[i].start < merged.start {
+		merged.start = ranges[i].start
+	}
+	if ranges[j-1].end > merged.end {
+		merged.end = ranges[j-1].end
+	}
+	ranges[i] = merged
+	return append(ranges[:i+1], ranges[j:]...), overlap
+}
+
+// sampleRTT records a round-trip time sample if the segment completes one. A sample is the time
+// from a segment passing the capture point to the acknowledgment for it passing back, so it only
+// covers the half of the path between the capture point and the end sending the acknowledgment.
+//
+// With the timestamp option, a sample is taken when a segment both echoes the TSval of a segment
+// sent the other way and acknowledges it. Segments that don't consume sequence space, such as pure
+// ACKs, are never timed, as they aren't acknowledged and would otherwise time idle periods. Without
+// the option, only the handshake is timed: the SYN to the SYN-ACK, and the SYN-ACK to the ACK. As
+// with Karn's algorithm, a retransmitted SYN isn't timed, since the reply is ambiguous.
+func (c *TCPConnection) sampleRTT(index int, tuple Tuple, direction int, timestamp time.Duration, segment *TCPSegment) {
+	sent := &c.directions[direction]
+	other := &c.directions[1-direction]
+	tsval, tsecr, hasTimestamps := segment.Timestamps()
+
+	if segment.HasSYN() {
+		if sent.synSent {
+			sent.synRetransmitted = true
+		} else {
+			sent.synSent = true
+			sent.synTime = timestamp
+			sent.synEnd = segment.SequenceNumber + 1
+		}
+	}
+
+	end := segment.SequenceNumber + uint32(len(segment.TransportData()))
+	if segment.HasSYN() || segment.HasFIN() {
+		end++
+	}
+
+	if hasTimestamps && end != segment.SequenceNumber {
+		if sent.tsvals == nil {
+			sent.tsvals = make(map[uint32]*tcpTSval)
+		}
+		if _, seen := sent.tsvals[tsval]; !seen {
+			sent.tsvals[tsval] = &tcpTSval{sent: timestamp, end: end}
+		}
+	}
+
+	// Resets are often sent by middleboxes, or only after a timeout, so they aren't timed.
+	if !segment.HasACK() || segment.HasRST() {
+		return
+	}
+
+	if hasTimestamps {
+		echoed, ok := other.tsvals[tsecr]
+		if ok && !echoed.echoed && int32(segment.AckNumber-echoed.end) >= 0 {
+			echoed.echoed = true
+			c.addRTTSample(index, tuple, direction, timestamp-echoed.sent)
+		}
+		return
+	}
+
+	if other.synSent && !other.synRetransmitted && !other.synAcked && segment.AckNumber == other.synEnd {
+		other.synAcked = true
+		c.addRTTSample(index, tuple, direction, timestamp-other.synTime)
+	}
+}
+
+// addRTTSample records a sample and updates the smoothed round-trip time. Each direction's samples
+// are smoothed separately, as they time different halves of the path, and the halves are added
+// together for the connection's estimate.
+func (c *TCPConnection) addRTTSample(index int, tuple Tuple, direction int, rtt time.Duration) {
+	state := &c.directions[direction]
+	if !state.sampled {
+		state.sampled = true
+		state.smoothedRTT = rtt
+	} else {
+		state.smoothedRTT += (rtt - state.smoothedRTT) / 8
+	}
+
+	c.SmoothedRTT = c.directions[0].smoothedRTT + c.directions[1].smoothedRTT
+	c.RTTSamples = append(c.RTTSamples, RTTSample{Index: index, Tuple: tuple, RTT: rtt})
+}
+
+// trackClose records how the connection ended. A reset closes it at once, while a FIN handshake
+// only closes it once both ends have sent a FIN and had it acknowledged. Whichever happens first
+// is kept: a reset after the handshake is just the end rejecting a stray segment.
+func (c *TCPConnection) trackClose(index int, direction int, segment *TCPSegment) {
+	if c.CloseReason != TCP_CLOSE_OPEN {
+		return
+	}
+
+	if segment.HasRST() {
+		c.CloseReason = TCP_CLOSE_RST
+		c.CloseIndex = index
+		return
+	}
+
+	sent := &c.directions[direction]
+	other := &c.directions[1-direction]
+
+	if segment.HasFIN() && !sent.finSent {
+		sent.finSent = true
+		sent.finEnd = segment.SequenceNumber + uint32(len(segment.TransportData())) + 1
+		if segment.HasSYN() {
+			sent.finEnd++
+		}
+	}
+
+	if segment.HasACK() && other.finSent && int32(segment.AckNumber-other.finEnd) >= 0 {
+		other.finAcked = true
+	}
+
+	if sent.finAcked && other.finAcked {
+		c.CloseReason = TCP_CLOSE_FIN
+		c.CloseIndex = index
+	}
+}
+
+// TCPRetransmissions runs a TCPAnalyzer over the file and returns the retransmissions seen on every
+// connection, in capture order. See TCPConnection.Retransmissions.
+func (file *PcapFile) TCPRetransmissions() []RetransmissionEvent {
+	events := make([]RetransmissionEvent, 0)
+	for _, conn := range file.AnalyzeTCP().Connections() {
+		events = append(events, conn.Retransmissions...)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Index < events[j].Index })
+	return events
+}
@@ -0,0 +1,230 @@
+package gopcap
+
+import (
+	"sort"
+)
+
+// tcpStreamSegment is a single segment's worth of data in one direction of a connection.
+type tcpStreamSegment struct {
+	sequence uint32
+	data     []byte
+}
+
+// tcpStreamBuilder collects the data sent in one direction of a connection, and puts it back into
+// sequence order.
+type tcpStreamBuilder struct {
+	synSeen  bool
+	initial  uint32 // The sequence number of the first byte of data, if synSeen.
+	segments []tcpStreamSegment
+}
+
+// add records a segment sent in this direction.
+func (b *tcpStreamBuilder) add(segment *TCPSegment) {
+	if segment.HasSYN() {
+		b.synSeen = true
+		b.initial = segment.SequenceNumber + 1
+	}
+
+	// The SYN takes up the first sequence number, so data sent with it, as TCP Fast Open sends it,
+	// starts at the one after.
+	sequence := segment.SequenceNumber
+	if segment.HasSYN() {
+		sequence++
+	}
+
+	data := segment.TransportData()
+	if len(data) > 0 {
+		b.segments = append(b.segments, tcpStreamSegment{sequence: sequence, data: data})
+	}
+}
+
+// start returns the sequence number the stream starts at. If the SYN wasn't captured, this is the
+// earliest sequence number seen.
+func (b *tcpStreamBuilder) start() uint32 {
+	if b.synSeen || len(b.segments) == 0 {
+		return b.initial
+	}
+
+	start := b.segments[0].sequence
+	for _, segment := range b.segments[1:] {
+		// Compare sequence numbers with wraparound.
+		if int32(segment.sequence-start) < 0 {
+			start = segment.sequence
+		}
+	}
+	return start
+}
+
+// sorted returns the segments sorted by their offset into the stream, which starts at start.
+func (b *tcpStreamBuilder) sorted(start uint32) []tcpStreamSegment {
+	segments := make([]tcpStreamSegment, len(b.segments))
+	copy(segments, b.segments)
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].sequence-start < segments[j].sequence-start
+	})
+	return segments
+}
+
+// bytes returns the contiguous data from the start of the stream. Retransmitted and overlapping
+// data is only included once. If data is missing, the stream up to the gap is returned along with
+// MissingStreamData.
+func (b *tcpStreamBuilder) bytes() ([]byte, error) {
+	start := b.start()
+
+	stream := make([]byte, 0)
+	for _, segment := range b.sorted(start) {
+		offset := int64(segment.sequence - start)
+		end := offset + int64(len(segment.data))
+
+		switch {
+		case offset > int64(len(stream)):
+			return stream, MissingStreamData
+		case end > int64(len(stream)):
+			stream = append(stream, segment.data[int64(len(stream))-offset:]...)
+		}
+	}
+
+	return stream, nil
+}
+
+// gaps returns the ranges of the stream missing from the capture, between the data that was seen.
+func (b *tcpStreamBuilder) gaps() []TCPStreamGap {
+	start := b.start()
+	gaps := make([]TCPStreamGap, 0)
+
+	end := int64(0)
+	for _, segment := range b.sorted(start) {
+		offset := int64(segment.sequence - start)
+		if offset > end {
+			gaps = append(gaps, TCPStreamGap{Sequence: start + uint32(end), Length: int(offset - end)})
+		}
+		if segmentEnd := offset + int64(len(segment.data)); segmentEnd > end {
+			end = segmentEnd
+		}
+	}
+
+	return gaps
+}
+
+// TCPStream reassembles the data sent in both directions of a single TCP connection. The tuple
+// identifies the connection, and its source is taken to be the client. If either direction has
+// data missing from the capture, the data up to the gap is returned along with MissingStreamData.
+func (file *PcapFile) TCPStream(tuple Tuple) (clientToServer, serverToClient []byte, err error) {
+	var client, server tcpStreamBuilder
+	found := false
+
+	for i := range file.Packets {
+		pktTuple, ok := file.Packets[i].FiveTuple()
+		if !ok || pktTuple.Protocol != IPP_TCP {
+			continue
+		}
+		segment, ok := file.Packets[i].Data.LinkData().InternetData().(*TCPSegment)
+		if !ok {
+			continue
+		}
+
+		switch pktTuple {
+		case tuple:
+			client.add(segment)
+		case tuple.Reverse():
+			server.add(segment)
+		default:
+			continue
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, nil, NoSuchConnection
+	}
+
+	clientToServer, clientErr := client.bytes()
+	serverToClient, serverErr := server.bytes()
+	if clientErr != nil {
+		return clientToServer, serverToClient, clientErr
+	}
+	return clientToServer, serverToClient, serverErr
+}
+
+//-----------------------------------------------------------------------------
+// TCPReassembler
+//-----------------------------------------------------------------------------
+
+// TCPReassembler rebuilds the byte stream sent in each direction of every TCP connection from the
+// segments in a capture. Segments may be added in any order: they're put back into sequence order,
+// and retransmitted or overlapping data is only included once. Data missing from the capture
+// leaves a gap in the stream, which Gaps reports.
+type TCPReassembler struct {
+	streams map[Tuple]*tcpStreamBuilder
+	order   []Tuple
+}
+
+// TCPStreamGap records a range of a stream missing from the capture.
+type TCPStreamGap struct {
+	Sequence uint32 // The sequence number of the first missing byte.
+	Length   int
+}
+
+// NewTCPReassembler creates an empty TCPReassembler.
+func NewTCPReassembler() *TCPReassembler {
+	return &TCPReassembler{
+		streams: make(map[Tuple]*tcpStreamBuilder),
+		order:   make([]Tuple, 0),
+	}
+}
+
+// ReassembleTCP runs a TCPReassembler over every packet in the file.
+func (file *PcapFile) ReassembleTCP() *TCPReassembler {
+	reassembler := NewTCPReassembler()
+	for i := range file.Packets {
+		tuple, ok := file.Packets[i].FiveTuple()
+		if !ok || tuple.Protocol != IPP_TCP {
+			continue
+		}
+		segment, ok := file.Packets[i].Data.LinkData().InternetData().(*TCPSegment)
+		if ok {
+			reassembler.Add(tuple, segment)
+		}
+	}
+	return reassembler
+}
+
+// Add passes a segment to the reassembler. The tuple identifies the direction of the connection
+// the segment was sent in.
+func (r *TCPReassembler) Add(tuple Tuple, segment *TCPSegment) {
+	stream, exists := r.streams[tuple]
+	if !exists {
+		stream = new(tcpStreamBuilder)
+		r.streams[tuple] = stream
+		r.order = append(r.order, tuple)
+	}
+	stream.add(segment)
+}
+
+// Tuples returns the direction of every stream seen, in the order they were first seen. Each
+// direction of a connection is a separate stream.
+func (r *TCPReassembler) Tuples() []Tuple {
+	return r.order
+}
+
+// Stream returns the contiguous data sent in the given direction of a connection. If data is
+// missing from the capture, the stream up to the first gap is returned along with
+// MissingStreamData. If no segments were seen in that direction, NoSuchConnection is returned.
+func (r *TCPReassembler) Stream(tuple Tuple) ([]byte, error) {
+	stream, exists := r.streams[tuple]
+	if !exists {
+		return nil, NoSuchConnection
+	}
+	return stream.bytes()
+}
+
+// Gaps returns the ranges missing from the stream sent in the given direction of a connection, in
+// sequence order. It returns nil if no segments were seen in that direction. Data missing from the
+// end of the stream can't be detected.
+func (r *TCPReassembler) Gaps(tuple Tuple) []TCPStreamGap {
+	stream, exists := r.streams[tuple]
+	if !exists {
+		return nil
+	}
+	return stream.gaps()
+}
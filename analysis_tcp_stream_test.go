@@ -0,0 +1,152 @@
+package gopcap
+
+import (
+	"testing"
+)
+
+func TestTCPStream(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(1, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, client, server, 40000, 80, 1001, 5001, "A", nil),
+		tcpTestPacket(3, client, server, 40000, 80, 1001, 5001, "PA", []byte(request)),
+		// The response arrives out of order, and the first half is retransmitted.
+		tcpTestPacket(4, server, client, 80, 40000, 5020, 1039, "PA", []byte(response[19:])),
+		tcpTestPacket(5, server, client, 80, 40000, 5001, 1039, "A", []byte(response[:19])),
+		tcpTestPacket(6, server, client, 80, 40000, 5001, 1039, "A", []byte(response[:19])),
+		// Unrelated traffic on another connection.
+		tcpTestPacket(7, client, server, 40001, 80, 9000, 0, "PA", []byte("other")),
+		tcpTestPacket(8, client, server, 40000, 80, 1039, 5043, "FA", nil),
+	}}
+
+	tuple := Tuple{
+		SourceAddress:      mappedIPv4(client),
+		DestinationAddress: mappedIPv4(server),
+		SourcePort:         40000,
+		DestinationPort:    80,
+		Protocol:           IPP_TCP,
+	}
+
+	clientToServer, serverToClient, err := file.TCPStream(tuple)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if string(clientToServer) != request {
+		t.Errorf("Unexpected client data: expected %q, got %q", request, string(clientToServer))
+	}
+	if string(serverToClient) != response {
+		t.Errorf("Unexpected server data: expected %q, got %q", response, string(serverToClient))
+	}
+
+	// Following the connection from the server's side swaps the directions.
+	serverToClient, clientToServer, err = file.TCPStream(tuple.Reverse())
+	if err != nil || string(clientToServer) != request || string(serverToClient) != response {
+		t.Errorf("Unexpected reversed stream: %q, %q, %v", clientToServer, serverToClient, err)
+	}
+
+	tuple.SourcePort = 40002
+	if _, _, err := file.TCPStream(tuple); err != NoSuchConnection {
+		t.Errorf("Unexpected error: expected %v, got %v", NoSuchConnection, err)
+	}
+}
+
+func TestTCPStreamFastOpen(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+
+	// With TCP Fast Open, the start of the request is sent along with the SYN.
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", []byte("GET ")),
+		tcpTestPacket(1, server, client, 80, 40000, 5000, 1005, "SA", nil),
+		tcpTestPacket(2, client, server, 40000, 80, 1005, 5001, "PA", []byte("/ HTTP/1.1\r\n\r\n")),
+	}}
+
+	tuple, _ := file.Packets[0].FiveTuple()
+	clientToServer, _, err := file.TCPStream(tuple)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if string(clientToServer) != "GET / HTTP/1.1\r\n\r\n" {
+		t.Errorf("Unexpected client data: expected %q, got %q", "GET / HTTP/1.1\r\n\r\n", string(clientToServer))
+	}
+}
+
+func TestTCPStreamMissingData(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(1, client, server, 40000, 80, 1001, 0, "PA", []byte("abc")),
+		tcpTestPacket(2, client, server, 40000, 80, 1007, 0, "PA", []byte("ghi")),
+	}}
+
+	tuple, _ := file.Packets[0].FiveTuple()
+	clientToServer, _, err := file.TCPStream(tuple)
+	if err != MissingStreamData {
+		t.Errorf("Unexpected error: expected %v, got %v", MissingStreamData, err)
+	}
+	if string(clientToServer) != "abc" {
+		t.Errorf("Unexpected client data: expected %q, got %q", "abc", string(clientToServer))
+	}
+}
+
+func TestTCPReassembler(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(1, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		// The client's data arrives out of order, with an overlapping retransmission, and the
+		// segment carrying "jkl" is never captured.
+		tcpTestPacket(2, client, server, 40000, 80, 1004, 5001, "PA", []byte("def")),
+		tcpTestPacket(3, client, server, 40000, 80, 1001, 5001, "PA", []byte("abc")),
+		tcpTestPacket(4, client, server, 40000, 80, 1003, 5001, "PA", []byte("cdefghi")),
+		tcpTestPacket(5, client, server, 40000, 80, 1013, 5001, "PA", []byte("mno")),
+		tcpTestPacket(6, server, client, 80, 40000, 5001, 1004, "PA", []byte("ok")),
+	}}
+
+	reassembler := file.ReassembleTCP()
+	toServer, _ := file.Packets[0].FiveTuple()
+	toClient := toServer.Reverse()
+
+	tuples := reassembler.Tuples()
+	if len(tuples) != 2 || tuples[0] != toServer || tuples[1] != toClient {
+		t.Errorf("Unexpected tuples: %v", tuples)
+	}
+
+	stream, err := reassembler.Stream(toServer)
+	if err != MissingStreamData {
+		t.Errorf("Unexpected error: expected %v, got %v", MissingStreamData, err)
+	}
+	if string(stream) != "abcdefghi" {
+		t.Errorf("Unexpected client data: expected %q, got %q", "abcdefghi", string(stream))
+	}
+
+	gaps := reassembler.Gaps(toServer)
+	if len(gaps) != 1 {
+		t.Fatalf("Unexpected number of gaps: expected %v, got %v", 1, len(gaps))
+	}
+	if gaps[0].Sequence != 1010 || gaps[0].Length != 3 {
+		t.Errorf("Unexpected gap: expected %v, got %v", TCPStreamGap{Sequence: 1010, Length: 3}, gaps[0])
+	}
+
+	stream, err = reassembler.Stream(toClient)
+	if err != nil || string(stream) != "ok" {
+		t.Errorf("Unexpected server data: %q, %v", stream, err)
+	}
+	if gaps := reassembler.Gaps(toClient); len(gaps) != 0 {
+		t.Errorf("Unexpected gaps: %v", gaps)
+	}
+
+	toServer.SourcePort = 40001
+	if _, err := reassembler.Stream(toServer); err != NoSuchConnection {
+		t.Errorf("Unexpected error: expected %v, got %v", NoSuchConnection, err)
+	}
+}
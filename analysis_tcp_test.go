@@ -0,0 +1,421 @@
+package gopcap
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tcpTestPacket builds an Ethernet/IPv4/TCP packet for analysis tests. The flags are given as a
+// string of tcpdump-style flag letters, e.g. "S", "SA" or "PA".
+func tcpTestPacket(ts time.Duration, src, dst [4]byte, srcPort, dstPort uint16, seq, ack uint32, flags string, payload []byte) Packet {
+	segment := &TCPSegment{
+		SourcePort:      srcPort,
+		DestinationPort: dstPort,
+		SequenceNumber:  seq,
+		AckNumber:       ack,
+		HeaderSize:      5,
+		SYN:             strings.Contains(flags, "S"),
+		FIN:             strings.Contains(flags, "F"),
+		RST:             strings.Contains(flags, "R"),
+		PSH:             strings.Contains(flags, "P"),
+		ACK:             strings.Contains(flags, "A"),
+		data:            payload,
+	}
+	for _, f := range []struct {
+		set  bool
+		flag TCPFlags
+	}{{segment.SYN, TCP_FLAG_SYN}, {segment.FIN, TCP_FLAG_FIN}, {segment.RST, TCP_FLAG_RST}, {segment.PSH, TCP_FLAG_PSH}, {segment.ACK, TCP_FLAG_ACK}} {
+		if f.set {
+			segment.Flags |= f.flag
+		}
+	}
+	ip := &IPv4Packet{
+		IHL:           5,
+		TotalLength:   uint16(40 + len(payload)),
+		TTL:           64,
+		Protocol:      IPP_TCP,
+		SourceAddress: src,
+		DestAddress:   dst,
+		data:          segment,
+	}
+	frame := &EthernetFrame{EtherType: ETHERTYPE_IPV4, data: ip}
+	return Packet{
+		Timestamp:   ts,
+		IncludedLen: uint32(54 + len(payload)),
+		ActualLen:   uint32(54 + len(payload)),
+		Data:        frame,
+	}
+}
+
+func TestTCPDuplicateACKs(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(1, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, client, server, 40000, 80, 1001, 5001, "A", nil),
+		tcpTestPacket(3, server, client, 80, 40000, 5001, 1001, "A", []byte("data1")),
+		tcpTestPacket(4, client, server, 40000, 80, 1001, 5006, "A", nil),
+		// The next segment from the server is lost, so the client keeps acknowledging 5006.
+		tcpTestPacket(5, server, client, 80, 40000, 5011, 1001, "A", []byte("data3")),
+		tcpTestPacket(6, client, server, 40000, 80, 1001, 5006, "A", nil),
+		tcpTestPacket(7, server, client, 80, 40000, 5016, 1001, "A", []byte("data4")),
+		tcpTestPacket(8, client, server, 40000, 80, 1001, 5006, "A", nil),
+		tcpTestPacket(9, server, client, 80, 40000, 5021, 1001, "A", []byte("data5")),
+		tcpTestPacket(10, client, server, 40000, 80, 1001, 5006, "A", nil),
+		tcpTestPacket(11, server, client, 80, 40000, 5006, 1001, "A", []byte("data2")),
+		tcpTestPacket(12, client, server, 40000, 80, 1001, 5026, "A", nil),
+	}}
+
+	analyzer := file.AnalyzeTCP()
+	connections := analyzer.Connections()
+
+	if len(connections) != 1 {
+		t.Fatalf("Unexpected number of connections: expected %v, got %v", 1, len(connections))
+	}
+
+	conn := connections[0]
+	if conn.Tuple.SourcePort != uint16(40000) {
+		t.Errorf("Unexpected connection source port: expected %v, got %v", 40000, conn.Tuple.SourcePort)
+	}
+	if analyzer.Connection(conn.Tuple.Reverse()) != conn {
+		t.Errorf("Failed to look up the connection by its reverse tuple.")
+	}
+	if len(conn.DuplicateACKs) != 3 {
+		t.Fatalf("Unexpected number of duplicate ACKs: expected %v, got %v", 3, len(conn.DuplicateACKs))
+	}
+
+	expectedIndexes := []int{6, 8, 10}
+	for i, dup := range conn.DuplicateACKs {
+		if dup.Index != expectedIndexes[i] {
+			t.Errorf("Unexpected duplicate ACK index: expected %v, got %v", expectedIndexes[i], dup.Index)
+		}
+		if dup.AckNumber != uint32(5006) {
+			t.Errorf("Unexpected duplicate ACK number: expected %v, got %v", 5006, dup.AckNumber)
+		}
+		if dup.Count != i+1 {
+			t.Errorf("Unexpected duplicate ACK count: expected %v, got %v", i+1, dup.Count)
+		}
+		if dup.Tuple.SourcePort != uint16(40000) {
+			t.Errorf("Unexpected duplicate ACK direction: %v", dup.Tuple)
+		}
+	}
+}
+
+func TestTCPRetransmissions(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+	other := [4]byte{10, 0, 0, 2}
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		// The SYN-ACK is slow, so the client sends its SYN again.
+		tcpTestPacket(1, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(2, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(3, client, server, 40000, 80, 1001, 5001, "A", nil),
+		tcpTestPacket(4, client, server, 40000, 80, 1001, 5001, "PA", []byte("0123456789")),
+		tcpTestPacket(5, client, server, 40000, 80, 1011, 5001, "PA", []byte("0123456789")),
+		// The first data segment is resent whole.
+		tcpTestPacket(6, client, server, 40000, 80, 1001, 5001, "PA", []byte("0123456789")),
+		// These two arrive out of order, which isn't a retransmission.
+		tcpTestPacket(7, client, server, 40000, 80, 1031, 5001, "PA", []byte("0123456789")),
+		tcpTestPacket(8, client, server, 40000, 80, 1021, 5001, "PA", []byte("0123456789")),
+		// This one resends the second half of the last segment along with new data.
+		tcpTestPacket(9, client, server, 40000, 80, 1036, 5001, "PA", []byte("0123456789")),
+		// A keep-alive resends the last byte.
+		tcpTestPacket(10, client, server, 40000, 80, 1045, 5001, "A", []byte("9")),
+		// Another connection, whose retransmission is interleaved with the first's.
+		tcpTestPacket(11, client, other, 40001, 80, 7000, 0, "S", nil),
+		tcpTestPacket(12, other, client, 80, 40001, 9000, 7001, "SA", nil),
+		tcpTestPacket(13, other, client, 80, 40001, 9001, 7001, "PA", []byte("abcdef")),
+		tcpTestPacket(14, client, server, 40000, 80, 1046, 5001, "FA", nil),
+		tcpTestPacket(15, other, client, 80, 40001, 9001, 7001, "PA", []byte("abc")),
+		tcpTestPacket(16, client, server, 40000, 80, 1046, 5001, "FA", nil),
+	}}
+
+	expected := []RetransmissionEvent{
+		{Index: 1, Start: 1000, End: 1001},
+		{Index: 6, Start: 1001, End: 1011},
+		{Index: 9, Start: 1036, End: 1041},
+		{Index: 15, Start: 9001, End: 9004},
+		{Index: 16, Start: 1046, End: 1047},
+	}
+
+	events := file.TCPRetransmissions()
+	if len(events) != len(expected) {
+		t.Fatalf("Unexpected number of retransmissions: expected %v, got %v", len(expected), len(events))
+	}
+
+	for i, event := range events {
+		if event.Index != expected[i].Index {
+			t.Errorf("Unexpected retransmission index: expected %v, got %v", expected[i].Index, event.Index)
+		}
+		if event.Start != expected[i].Start || event.End != expected[i].End {
+			t.Errorf("Unexpected retransmitted range: expected %v-%v, got %v-%v", expected[i].Start, expected[i].End, event.Start, event.End)
+		}
+
+		tuple, _ := file.Packets[event.Index].FiveTuple()
+		if event.Tuple != tuple {
+			t.Errorf("Unexpected retransmission direction: expected %v, got %v", tuple, event.Tuple)
+		}
+	}
+
+	analyzer := file.AnalyzeTCP()
+	if n := len(analyzer.Connections()[0].Retransmissions); n != 4 {
+		t.Errorf("Unexpected number of retransmissions on the first connection: expected %v, got %v", 4, n)
+	}
+}
+
+// withFlagsOnly clears the deprecated flag booleans of a packet built by tcpTestPacket, leaving
+// only Flags set.
+
+func TestTCPRetransmissionsWraparound(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+
+	// Segments far enough apart that the ninth wraps around to the first's sequence number, after
+	// 2^32 bytes, is new data rather than a retransmission. Only the resent tenth is one.
+	var packets []Packet
+	for i := 0; i < 9; i++ {
+		seq := uint32(1000 + i<<29)
+		packets = append(packets, tcpTestPacket(time.Duration(i), client, server, 40000, 80, seq, 0, "PA", []byte("0123456789")))
+	}
+	packets = append(packets, tcpTestPacket(9, client, server, 40000, 80, 1000, 0, "PA", []byte("0123456789")))
+	file := PcapFile{LinkType: ETHERNET, Packets: packets}
+
+	events := file.TCPRetransmissions()
+	if len(events) != 1 || events[0].Index != 9 || events[0].Start != 1000 || events[0].End != 1010 {
+		t.Errorf("Unexpected retransmissions: %+v", events)
+	}
+}
+
+func withFlagsOnly(pkt Packet) Packet {
+	segment := pkt.Data.LinkData().InternetData().(*TCPSegment)
+	segment.SYN, segment.ACK, segment.FIN, segment.RST, segment.PSH = false, false, false, false, false
+	return pkt
+}
+
+func TestTCPAnalysisFlagsOnly(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+	ms := time.Millisecond
+
+	// A connection with a duplicate ACK and retransmissions of data and of a FIN, closed by a FIN
+	// handshake, built twice: once as usual, and once with only Flags set, which must be analyzed
+	// the same way.
+	build := func(flagsOnly bool) PcapFile {
+		packets := []Packet{
+			tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+			tcpTestPacket(10*ms, server, client, 80, 40000, 5000, 1001, "SA", nil),
+			tcpTestPacket(11*ms, client, server, 40000, 80, 1001, 5001, "A", nil),
+			tcpTestPacket(12*ms, server, client, 80, 40000, 5006, 1001, "PA", []byte("world")),
+			tcpTestPacket(13*ms, client, server, 40000, 80, 1001, 5001, "A", nil),
+			tcpTestPacket(14*ms, server, client, 80, 40000, 5001, 1001, "PA", []byte("hello")),
+			tcpTestPacket(15*ms, server, client, 80, 40000, 5001, 1001, "PA", []byte("hello")),
+			tcpTestPacket(16*ms, client, server, 40000, 80, 1001, 5011, "A", nil),
+			tcpTestPacket(17*ms, client, server, 40000, 80, 1001, 5011, "FA", nil),
+			tcpTestPacket(18*ms, server, client, 80, 40000, 5011, 1002, "FA", nil),
+			tcpTestPacket(18*ms+ms/2, server, client, 80, 40000, 5011, 1002, "FA", nil),
+			tcpTestPacket(19*ms, client, server, 40000, 80, 1002, 5012, "A", nil),
+		}
+		if flagsOnly {
+			for i := range packets {
+				packets[i] = withFlagsOnly(packets[i])
+			}
+		}
+		return PcapFile{LinkType: ETHERNET, Packets: packets}
+	}
+
+	expected, flagsOnly := build(false), build(true)
+	want, got := expected.AnalyzeTCP().Connections()[0], flagsOnly.AnalyzeTCP().Connections()[0]
+	if len(want.DuplicateACKs) == 0 || len(got.DuplicateACKs) != len(want.DuplicateACKs) {
+		t.Errorf("Unexpected duplicate ACKs: expected %v, got %v", want.DuplicateACKs, got.DuplicateACKs)
+	}
+	if len(want.RTTSamples) == 0 || len(got.RTTSamples) != len(want.RTTSamples) {
+		t.Errorf("Unexpected RTT samples: expected %v, got %v", want.RTTSamples, got.RTTSamples)
+	}
+	if len(want.Retransmissions) == 0 || len(got.Retransmissions) != len(want.Retransmissions) {
+		t.Errorf("Unexpected retransmissions: expected %v, got %v", want.Retransmissions, got.Retransmissions)
+	}
+	if want.CloseReason != TCP_CLOSE_FIN || got.CloseReason != want.CloseReason || got.CloseIndex != want.CloseIndex {
+		t.Errorf("Unexpected close: expected %v at %v, got %v at %v", want.CloseReason, want.CloseIndex, got.CloseReason, got.CloseIndex)
+	}
+
+	tuple, _ := expected.Packets[0].FiveTuple()
+	_, wantData, _ := expected.TCPStream(tuple)
+	_, gotData, err := flagsOnly.TCPStream(tuple)
+	if err != nil || string(gotData) != string(wantData) {
+		t.Errorf("Unexpected server data: expected %q, got %q, %v", wantData, gotData, err)
+	}
+}
+
+// withTCPTimestamps adds a timestamp option to a packet built by tcpTestPacket.
+func withTCPTimestamps(pkt Packet, tsval, tsecr uint32) Packet {
+	segment := pkt.Data.LinkData().InternetData().(*TCPSegment)
+	segment.HeaderSize = 8
+	segment.OptionData = []byte{
+		0x01, 0x01, 0x08, 0x0A,
+		byte(tsval >> 24), byte(tsval >> 16), byte(tsval >> 8), byte(tsval),
+		byte(tsecr >> 24), byte(tsecr >> 16), byte(tsecr >> 8), byte(tsecr),
+	}
+	return pkt
+}
+
+func TestTCPRTTTimestamps(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+	ms := time.Millisecond
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		withTCPTimestamps(tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil), 100, 0),
+		withTCPTimestamps(tcpTestPacket(20*ms, server, client, 80, 40000, 5000, 1001, "SA", nil), 900, 100),
+		withTCPTimestamps(tcpTestPacket(21*ms, client, server, 40000, 80, 1001, 5001, "A", nil), 101, 900),
+		withTCPTimestamps(tcpTestPacket(22*ms, client, server, 40000, 80, 1001, 5001, "PA", []byte("data1")), 102, 900),
+		// A duplicate echo of the same TSval mustn't be sampled twice.
+		withTCPTimestamps(tcpTestPacket(50*ms, server, client, 80, 40000, 5001, 1006, "A", nil), 901, 102),
+		withTCPTimestamps(tcpTestPacket(60*ms, server, client, 80, 40000, 5001, 1006, "A", nil), 901, 102),
+		// After an idle period, an echo of a pure ACK mustn't time the idle period.
+		withTCPTimestamps(tcpTestPacket(100*ms, client, server, 40000, 80, 1006, 5001, "A", nil), 103, 901),
+		withTCPTimestamps(tcpTestPacket(5000*ms, server, client, 80, 40000, 5001, 1006, "PA", []byte("data2")), 950, 103),
+	}}
+
+	conn := file.AnalyzeTCP().Connections()[0]
+	expected := []time.Duration{20 * ms, 1 * ms, 28 * ms}
+
+	if len(conn.RTTSamples) != len(expected) {
+		t.Fatalf("Unexpected number of RTT samples: expected %v, got %v", len(expected), len(conn.RTTSamples))
+	}
+	for i, rtt := range expected {
+		if conn.RTTSamples[i].RTT != rtt {
+			t.Errorf("Unexpected RTT sample %v: expected %v, got %v", i, rtt, conn.RTTSamples[i].RTT)
+		}
+	}
+	if conn.RTTSamples[0].Index != 1 || conn.RTTSamples[0].Tuple.SourcePort != uint16(80) {
+		t.Errorf("Unexpected first RTT sample: %v", conn.RTTSamples[0])
+	}
+
+	// The server's half is 20ms smoothed with 28ms, and the client's half is 1ms.
+	smoothed := 20*ms + (28*ms-20*ms)/8 + 1*ms
+	if conn.SmoothedRTT != smoothed {
+		t.Errorf("Unexpected smoothed RTT: expected %v, got %v", smoothed, conn.SmoothedRTT)
+	}
+}
+
+func TestTCPRTTHandshake(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+	ms := time.Millisecond
+
+	// Without timestamps only the handshake can be timed.
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(30*ms, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(31*ms, client, server, 40000, 80, 1001, 5001, "A", nil),
+		tcpTestPacket(40*ms, client, server, 40000, 80, 1001, 5001, "PA", []byte("data1")),
+		tcpTestPacket(80*ms, server, client, 80, 40000, 5001, 1006, "A", nil),
+	}}
+
+	conn := file.AnalyzeTCP().Connections()[0]
+	if len(conn.RTTSamples) != 2 {
+		t.Fatalf("Unexpected number of RTT samples: expected %v, got %v", 2, len(conn.RTTSamples))
+	}
+	if conn.RTTSamples[0].RTT != 30*ms || conn.RTTSamples[1].RTT != 1*ms {
+		t.Errorf("Unexpected RTT samples: expected %v and %v, got %v", 30*ms, 1*ms, conn.RTTSamples)
+	}
+	if conn.SmoothedRTT != 31*ms {
+		t.Errorf("Unexpected smoothed RTT: expected %v, got %v", 31*ms, conn.SmoothedRTT)
+	}
+
+	// A retransmitted SYN can't be timed, but the SYN-ACK still can.
+	file = PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(1000*ms, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(1030*ms, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(1031*ms, client, server, 40000, 80, 1001, 5001, "A", nil),
+	}}
+
+	conn = file.AnalyzeTCP().Connections()[0]
+	if len(conn.RTTSamples) != 1 {
+		t.Fatalf("Unexpected number of RTT samples: expected %v, got %v", 1, len(conn.RTTSamples))
+	}
+	if conn.RTTSamples[0].RTT != 1*ms || conn.RTTSamples[0].Tuple.SourcePort != uint16(40000) {
+		t.Errorf("Unexpected RTT sample: %v", conn.RTTSamples[0])
+	}
+}
+
+func TestTCPRTTCapture(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	sampled := 0
+	for _, conn := range parsed.AnalyzeTCP().Connections() {
+		if len(conn.RTTSamples) == 0 {
+			continue
+		}
+		sampled++
+
+		// Anything from a LAN round trip to an intercontinental one is plausible.
+		if conn.SmoothedRTT <= 0 || conn.SmoothedRTT > 2*time.Second {
+			t.Errorf("Implausible smoothed RTT for %v: %v", conn.Tuple, conn.SmoothedRTT)
+		}
+	}
+	if sampled == 0 {
+		t.Errorf("No RTT samples taken from the capture.")
+	}
+}
+
+func TestTCPCloseReason(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		// The first connection is closed by a FIN from each end.
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(1, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, client, server, 40000, 80, 1001, 5001, "A", nil),
+		tcpTestPacket(3, client, server, 40000, 80, 1001, 5001, "FA", nil),
+		tcpTestPacket(4, server, client, 80, 40000, 5001, 1002, "FA", nil),
+		tcpTestPacket(5, client, server, 40000, 80, 1002, 5002, "A", nil),
+
+		// The second connection is reset by the server.
+		tcpTestPacket(6, client, server, 40001, 80, 2000, 0, "S", nil),
+		tcpTestPacket(7, server, client, 80, 40001, 6000, 2001, "SA", nil),
+		tcpTestPacket(8, client, server, 40001, 80, 2001, 6001, "PA", []byte("GET")),
+		tcpTestPacket(9, server, client, 80, 40001, 6001, 2004, "RA", nil),
+
+		// The third connection has only sent one FIN by the end of the capture.
+		tcpTestPacket(10, client, server, 40002, 80, 3000, 0, "S", nil),
+		tcpTestPacket(11, server, client, 80, 40002, 7000, 3001, "SA", nil),
+		tcpTestPacket(12, client, server, 40002, 80, 3001, 7001, "FA", nil),
+		tcpTestPacket(13, server, client, 80, 40002, 7001, 3002, "A", nil),
+	}}
+
+	connections := file.AnalyzeTCP().Connections()
+	if len(connections) != 3 {
+		t.Fatalf("Unexpected number of connections: expected %v, got %v", 3, len(connections))
+	}
+
+	expected := []struct {
+		reason CloseReason
+		index  int
+	}{{TCP_CLOSE_FIN, 5}, {TCP_CLOSE_RST, 9}, {TCP_CLOSE_OPEN, 0}}
+	for i, e := range expected {
+		if connections[i].CloseReason != e.reason {
+			t.Errorf("Unexpected close reason for connection %v: expected %v, got %v", i, e.reason, connections[i].CloseReason)
+		}
+		if connections[i].CloseIndex != e.index {
+			t.Errorf("Unexpected close index for connection %v: expected %v, got %v", i, e.index, connections[i].CloseIndex)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package gopcap
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	// The capture covers a little over five minutes and twenty-two seconds.
+	windows := parsed.Window(time.Second, true)
+	if len(windows) != 323 {
+		t.Errorf("Unexpected number of windows: expected %v, got %v", 323, len(windows))
+	}
+
+	total := 0
+	empty := 0
+	for i, window := range windows {
+		total += len(window)
+		if len(window) == 0 {
+			empty++
+		}
+
+		// Every packet after the first window must fall inside its window.
+		start := parsed.Packets[0].Timestamp + time.Duration(i)*time.Second
+		for _, pkt := range window {
+			if i > 0 && (pkt.Timestamp < start || pkt.Timestamp >= start+time.Second) {
+				t.Errorf("Packet at %v placed in window %v starting at %v", pkt.Timestamp, i, start)
+			}
+		}
+	}
+	if total != len(parsed.Packets) {
+		t.Errorf("Unexpected number of windowed packets: expected %v, got %v", len(parsed.Packets), total)
+	}
+
+	// Skipping empty windows should drop exactly the empty ones.
+	nonEmpty := parsed.Window(time.Second, false)
+	if len(nonEmpty) != len(windows)-empty {
+		t.Errorf("Unexpected number of non-empty windows: expected %v, got %v", len(windows)-empty, len(nonEmpty))
+	}
+	for i, window := range nonEmpty {
+		if len(window) == 0 {
+			t.Errorf("Window %v is unexpectedly empty", i)
+		}
+	}
+
+	// A single outlying timestamp, billions of windows later, doesn't create the ones in between.
+	outlier := PcapFile{Packets: []Packet{{Timestamp: 0}, {Timestamp: 100 * 365 * 24 * time.Hour}, {Timestamp: time.Nanosecond}}}
+	windows = outlier.Window(time.Nanosecond, false)
+	if len(windows) != 3 {
+		t.Fatalf("Unexpected number of windows: expected %v, got %v", 3, len(windows))
+	}
+	for i, expected := range []time.Duration{0, time.Nanosecond, 100 * 365 * 24 * time.Hour} {
+		if len(windows[i]) != 1 || windows[i][0].Timestamp != expected {
+			t.Errorf("Unexpected window %v: expected a packet at %v, got %v", i, expected, windows[i])
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	file := PcapFile{}
+	if duration := file.Duration(); duration != 0 {
+		t.Errorf("Unexpected duration of empty capture: expected %v, got %v", 0, duration)
+	}
+
+	file.Packets = []Packet{{Timestamp: 5 * time.Second}}
+	if duration := file.Duration(); duration != 0 {
+		t.Errorf("Unexpected duration of single packet: expected %v, got %v", 0, duration)
+	}
+
+	// The earliest and latest packets are in the middle.
+	file.Packets = []Packet{{Timestamp: 5 * time.Second}, {Timestamp: 2 * time.Second}, {Timestamp: 9 * time.Second}, {Timestamp: 7 * time.Second}}
+	if duration := file.Duration(); duration != 7*time.Second {
+		t.Errorf("Unexpected duration: expected %v, got %v", 7*time.Second, duration)
+	}
+}
+
+func TestCheckMartianSources(t *testing.T) {
+	loopback := [4]byte{127, 0, 0, 1}
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(1, loopback, server, 40001, 80, 2000, 0, "S", nil),
+		tcpTestPacket(2, server, client, 80, 40000, 5000, 1001, "SA", nil),
+	}}
+
+	warnings := file.CheckMartianSources()
+	if len(warnings) != 1 {
+		t.Fatalf("Unexpected number of warnings: expected %v, got %v", 1, len(warnings))
+	}
+	if warnings[0].Index != 1 || warnings[0].Err != MartianSourceAddress {
+		t.Errorf("Unexpected warning: expected %v, got %v", PacketWarning{Index: 1, Err: MartianSourceAddress}, warnings[0])
+	}
+}
+
+func TestSizeHistogram(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	file, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	expected := map[uint32]int{64: 316, 128: 1551, 256: 202, 512: 54, 1024: 19, 1518: 121, 9216: 0}
+	histogram := file.SizeHistogram(nil)
+	if len(histogram) != len(expected) {
+		t.Errorf("Unexpected number of buckets: expected %v, got %v", len(expected), len(histogram))
+	}
+	for bucket, count := range expected {
+		if histogram[bucket] != count {
+			t.Errorf("Unexpected count for bucket %v: expected %v, got %v", bucket, count, histogram[bucket])
+		}
+	}
+
+	// Unsorted buckets work too, and packets too large for any of them overflow.
+	histogram = file.SizeHistogram([]uint32{128, 64})
+	if histogram[64] != 316 || histogram[128] != 1551 || histogram[SizeHistogramOverflow] != 396 {
+		t.Errorf("Unexpected histogram: %v", histogram)
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	// The capturing host, 192.168.1.2, left its checksums to the network card, so only the
+	// packets it received have correct checksums.
+	file := PcapFile{LinkType: parsed.LinkType, Packets: make([]Packet, 0)}
+	for _, pkt := range parsed.Packets {
+		if pkt.Data == nil {
+			continue
+		}
+		ip, isIPv4 := pkt.Data.LinkData().(*IPv4Packet)
+		if isIPv4 && ip.SourceAddress != [4]byte{192, 168, 1, 2} {
+			file.Packets = append(file.Packets, pkt)
+		}
+	}
+
+	if failures := file.VerifyChecksums(); len(failures) != 0 {
+		t.Fatalf("Unexpected checksum errors: %v", failures)
+	}
+	if failures := parsed.VerifyChecksums(); len(failures) == 0 {
+		t.Errorf("Unexpectedly found no checksum errors in packets from the capturing host.")
+	}
+
+	// Corrupt the TCP checksum of one packet, and the IPv4 header checksum of another.
+	tcpIndex, udpIndex := -1, -1
+	for i, pkt := range file.Packets {
+		switch trans := pkt.Data.LinkData().InternetData().(type) {
+		case *TCPSegment:
+			if tcpIndex < 0 {
+				tcpIndex = i
+				trans.Checksum++
+			}
+		case *UDPDatagram:
+			if udpIndex < 0 {
+				udpIndex = i
+				pkt.Data.LinkData().(*IPv4Packet).Checksum++
+			}
+		}
+	}
+
+	expected := []ChecksumError{
+		{Index: tcpIndex, Checksum: CHECKSUM_TCP},
+		{Index: udpIndex, Checksum: CHECKSUM_IPV4},
+	}
+	if tcpIndex > udpIndex {
+		expected[0], expected[1] = expected[1], expected[0]
+	}
+
+	failures := file.VerifyChecksums()
+	if len(failures) != len(expected) {
+		t.Fatalf("Unexpected number of checksum errors: expected %v, got %v", len(expected), failures)
+	}
+	for i := range expected {
+		if failures[i] != expected[i] {
+			t.Errorf("Unexpected checksum error: expected %v, got %v", expected[i], failures[i])
+		}
+	}
+}
+
+func TestProtocolCounts(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	counts := parsed.ProtocolCounts()
+
+	if !reflect.DeepEqual(counts.LinkTypes, map[Link]int{ETHERNET: 2263}) {
+		t.Errorf("Unexpected link types: %v", counts.LinkTypes)
+	}
+	if !reflect.DeepEqual(counts.EtherTypes, map[EtherType]int{ETHERTYPE_IPV4: 2247, ARP: 10, 0x88a2: 6}) {
+		t.Errorf("Unexpected EtherTypes: %v", counts.EtherTypes)
+	}
+	if !reflect.DeepEqual(counts.IPProtocols, map[IPProtocol]int{IPP_ICMP: 23, IPProtocol(2): 2, IPP_TCP: 1150, IPP_UDP: 1072}) {
+		t.Errorf("Unexpected IP protocols: %v", counts.IPProtocols)
+	}
+
+	// IGMP isn't decoded, and neither is whatever the frames with an unknown EtherType carry.
+	expected := map[string]int{"ICMPSegment": 23, "TCPSegment": 1150, "UDPDatagram": 1072, "UnknownTransport": 8}
+	if !reflect.DeepEqual(counts.Transports, expected) {
+		t.Errorf("Unexpected transports: expected %v, got %v", expected, counts.Transports)
+	}
+}
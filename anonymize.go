@@ -0,0 +1,226 @@
+package gopcap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// Anonymizer rewrites the addresses in packets, so that captures can be shared without revealing
+// who was talking. The mapping is prefix-preserving, in the manner of Crypto-PAn: two addresses
+// that share their first n bits are mapped to addresses that also share their first n bits, and no
+// more, so subnets and vendor prefixes survive while the addresses themselves don't. Each bit of
+// the address is flipped or not according to a keyed hash of the bits before it, so the mapping
+// is fixed by the seed: the same seed maps the same address the same way in every capture.
+type Anonymizer struct {
+	seed  []byte
+	cache map[string][]byte
+}
+
+// NewAnonymizer returns an Anonymizer whose mapping is keyed by seed, which should be kept secret:
+// anyone who knows it can map addresses the same way, and so match them up with the originals.
+func NewAnonymizer(seed []byte) *Anonymizer {
+	return &Anonymizer{seed: append([]byte(nil), seed...), cache: make(map[string][]byte)}
+}
+
+// Anonymize rewrites the addresses of every packet in the file in place, with an Anonymizer keyed
+// by seed. See Anonymizer.AnonymizePacket.
+func (file *PcapFile) Anonymize(seed []byte) {
+	a := NewAnonymizer(seed)
+	for i := range file.Packets {
+		a.AnonymizePacket(&file.Packets[i])
+	}
+}
+
+// AnonymizePacket rewrites the packet's addresses in place: the MAC addresses of Ethernet frames,
+// the addresses of IPv4 and IPv6 packets, and the hardware and protocol addresses of ARP packets.
+// IPv4 header checksums, and TCP, UDP, UDP-Lite and ICMPv6 checksums, whose pseudo-headers cover
+// the addresses, are adjusted to match, so a checksum that was correct stays correct. Transport
+// checksums are only adjusted in the first fragment of a fragmented IPv4 packet, which is the one
+// that carries them. Addresses carried in payloads, such as in DNS answers, DHCP options or the
+// headers quoted by ICMP errors, are left as they are.
+//
+// Raw is replaced with the packet rebuilt from its rewritten layers, so that the original
+// addresses don't survive in it. A packet with layers that can't be rebuilt has the rewritten
+// link, network and transport headers patched into a copy of Raw instead, or is left with no Raw
+// if they can't be found in it. See PcapFile.WriteTo.
+func (a *Anonymizer) AnonymizePacket(pkt *Packet) {
+	if pkt.Data == nil {
+		return
+	}
+
+	// The headers as they were and as they're rewritten, for patching into Raw.
+	var patches [][2][]byte
+
+	if frame, ok := pkt.Data.(*EthernetFrame); ok {
+		original := append(append([]byte(nil), frame.MACDestination[:]...), frame.MACSource[:]...)
+		copy(frame.MACSource[:], a.address(frame.MACSource[:]))
+		copy(frame.MACDestination[:], a.address(frame.MACDestination[:]))
+		patches = append(patches, [2][]byte{original, append(append([]byte(nil), frame.MACDestination[:]...), frame.MACSource[:]...)})
+	}
+
+	switch network := pkt.Data.LinkData().(type) {
+	case *IPv4Packet:
+		header := network.encodeHeader(0)
+		original := append(append([]byte(nil), network.SourceAddress[:]...), network.DestAddress[:]...)
+		copy(network.SourceAddress[:], a.address(network.SourceAddress[:]))
+		copy(network.DestAddress[:], a.address(network.DestAddress[:]))
+		addresses := append(append([]byte(nil), network.SourceAddress[:]...), network.DestAddress[:]...)
+
+		network.Checksum = adjustChecksum(network.Checksum, original, addresses)
+		patches = append(patches, [2][]byte{header, network.encodeHeader(0)})
+
+		// Later fragments are still decoded as if they began with a transport header, but what's
+		// there is really payload, so there's no checksum in it to adjust.
+		if network.FragmentOffset == 0 {
+			patches = append(patches, patchTransportChecksum(network.InternetData(), original, addresses, false))
+		}
+	case *IPv6Packet:
+		header := network.encodeHeader(0)
+		original := append(append([]byte(nil), network.SourceAddress[:]...), network.DestinationAddress[:]...)
+		copy(network.SourceAddress[:], a.address(network.SourceAddress[:]))
+		copy(network.DestinationAddress[:], a.address(network.DestinationAddress[:]))
+		addresses := append(append([]byte(nil), network.SourceAddress[:]...), network.DestinationAddress[:]...)
+
+		patches = append(patches, [2][]byte{header, network.encodeHeader(0)})
+		patches = append(patches, patchTransportChecksum(network.InternetData(), original, addresses, true))
+	case *ARPPacket:
+		header, _ := network.Serialize()
+
+		// The addresses may refer to Raw, so they're replaced rather than overwritten.
+		network.SenderHardwareAddress = a.address(network.SenderHardwareAddress)
+		network.SenderProtocolAddress = a.address(network.SenderProtocolAddress)
+		network.TargetHardwareAddress = a.address(network.TargetHardwareAddress)
+		network.TargetProtocolAddress = a.address(network.TargetProtocolAddress)
+
+		rewritten, _ := network.Serialize()
+		patches = append(patches, [2][]byte{header, rewritten})
+	}
+
+	raw, err := serializeLayer(pkt.Data)
+	if err == nil {
+		pkt.Raw = raw
+		return
+	}
+	pkt.Raw = patchHeaders(pkt.Raw, patches)
+}
+
+// patchHeaders returns a copy of raw with each header replaced by its rewritten form, or nil if
+// any of them can't be found. Each header is looked for after the one before, and the outermost
+// comes first, so a header quoted in a payload isn't mistaken for the real one. Empty headers are
+// left out.
+func patchHeaders(raw []byte, patches [][2][]byte) []byte {
+	if raw == nil {
+		return nil
+	}
+
+	patched := append([]byte(nil), raw...)
+	offset := 0
+	for _, patch := range patches {
+		if len(patch[0]) == 0 {
+			continue
+		}
+		i := bytes.Index(patched[offset:], patch[0])
+		if i < 0 || len(patch[0]) != len(patch[1]) {
+			return nil
+		}
+		copy(patched[offset+i:], patch[1])
+		offset += i + len(patch[0])
+	}
+	return patched
+}
+
+// patchTransportChecksum adjusts the checksum of a transport layer as adjustTransportChecksum
+// does, returning its header as it was and as it's rewritten, for patching into Raw. Transport
+// layers without a checksum to adjust have no header returned.
+func patchTransportChecksum(transport TransportLayer, original, addresses []byte, ipv6 bool) [2][]byte {
+	header := transportHeader(transport)
+	adjustTransportChecksum(transport, original, addresses, ipv6)
+	return [2][]byte{header, transportHeader(transport)}
+}
+
+// transportHeader returns the header of a transport layer whose checksum covers the addresses, or
+// nil for any other.
+func transportHeader(transport TransportLayer) []byte {
+	switch t := transport.(type) {
+	case *TCPSegment:
+		return t.encodeHeader()
+	case *UDPDatagram:
+		return t.encodeHeader()
+	case *UDPLiteDatagram, *ICMPSegment:
+		// Both have eight-byte headers, followed by their data.
+		segment, err := serializeLayer(t)
+		if err != nil || len(segment) < 8 {
+			return nil
+		}
+		return segment[:8]
+	}
+	return nil
+}
+
+// adjustTransportChecksum adjusts the checksum of a transport layer whose pseudo-header covers
+// addresses that have changed from original. A UDP checksum of zero over IPv4 means there isn't
+// one, so it's left alone.
+func adjustTransportChecksum(transport TransportLayer, original, addresses []byte, ipv6 bool) {
+	switch t := transport.(type) {
+	case *TCPSegment:
+		t.Checksum = adjustChecksum(t.Checksum, original, addresses)
+	case *UDPDatagram:
+		if t.Checksum == 0 && !ipv6 {
+			return
+		}
+		t.Checksum = adjustChecksum(t.Checksum, original, addresses)
+
+		// A checksum that comes to zero is sent as all ones, since zero means there isn't one.
+		if t.Checksum == 0 {
+			t.Checksum = 0xFFFF
+		}
+	case *UDPLiteDatagram:
+		t.Checksum = adjustChecksum(t.Checksum, original, addresses)
+	case *ICMPSegment:
+		// Only ICMPv6 has a pseudo-header.
+		if t.ipv6 {
+			t.Checksum = adjustChecksum(t.Checksum, original, addresses)
+		}
+	}
+}
+
+// address maps an address of any length, returning a new slice.
+func (a *Anonymizer) address(addr []byte) []byte {
+	if len(addr) == 0 {
+		return addr
+	}
+
+	mapped, ok := a.cache[string(addr)]
+	if !ok {
+		mapped = a.mapAddress(addr)
+		a.cache[string(addr)] = mapped
+	}
+	return append([]byte(nil), mapped...)
+}
+
+// mapAddress works out the mapping of an address one bit at a time, from the most significant. Each
+// bit is flipped if the first bit of a keyed hash of the bits before it is set, so addresses that
+// share a prefix have their prefixes mapped the same way. The length and position are hashed
+// along with the prefix, so that addresses of different lengths are mapped independently.
+func (a *Anonymizer) mapAddress(addr []byte) []byte {
+	mapped := make([]byte, len(addr))
+	prefix := make([]byte, len(addr))
+	mac := hmac.New(sha256.New, a.seed)
+
+	for i := 0; i < len(addr)*8; i++ {
+		byteIndex, bit := i/8, byte(0x80)>>uint(i%8)
+
+		mac.Reset()
+		mac.Write([]byte{byte(len(addr)), byte(i)})
+		mac.Write(prefix)
+		flip := mac.Sum(nil)[0]&0x80 != 0
+
+		mapped[byteIndex] |= (addr[byteIndex] & bit)
+		if flip {
+			mapped[byteIndex] ^= bit
+		}
+		prefix[byteIndex] |= addr[byteIndex] & bit
+	}
+	return mapped
+}
@@ -0,0 +1,218 @@
+package gopcap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// commonPrefix returns the number of leading bits two addresses share.
+func commonPrefix(a, b []byte) int {
+	for i := range a {
+		if diff := a[i] ^ b[i]; diff != 0 {
+			n := i * 8
+			for diff&0x80 == 0 {
+				diff <<= 1
+				n++
+			}
+			return n
+		}
+	}
+	return len(a) * 8
+}
+
+func TestAnonymize(t *testing.T) {
+	data, err := ioutil.ReadFile("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+
+	original, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	anonymized, _ := Parse(bytes.NewReader(data))
+	anonymized.Anonymize([]byte("seed"))
+
+	// Every address is mapped, in the same way each time it appears.
+	mapping := make(map[[4]byte][4]byte)
+	macs := make(map[[6]byte][6]byte)
+	for i := range original.Packets {
+		before, after := &original.Packets[i], &anonymized.Packets[i]
+		frame, afterFrame := before.Data.(*EthernetFrame), after.Data.(*EthernetFrame)
+		macs[frame.MACSource] = afterFrame.MACSource
+		if afterFrame.MACSource == frame.MACSource {
+			t.Errorf("Unexpected MAC address for packet %v: %v wasn't mapped", i, frame.MACSource)
+		}
+
+		ip, ok := before.Data.LinkData().(*IPv4Packet)
+		if !ok {
+			continue
+		}
+		afterIP := after.Data.LinkData().(*IPv4Packet)
+		for _, pair := range [][2][4]byte{{ip.SourceAddress, afterIP.SourceAddress}, {ip.DestAddress, afterIP.DestAddress}} {
+			if mapped, seen := mapping[pair[0]]; seen && mapped != pair[1] {
+				t.Errorf("Inconsistent mapping for %v: %v and %v", pair[0], mapped, pair[1])
+			}
+			if pair[0] == pair[1] {
+				t.Errorf("Unexpected address for packet %v: %v wasn't mapped", i, pair[0])
+			}
+			mapping[pair[0]] = pair[1]
+		}
+
+		// Checksums that were correct stay correct, and ones that weren't stay wrong.
+		if (ip.ValidateChecksum() == nil) != (afterIP.ValidateChecksum() == nil) {
+			t.Errorf("Unexpected header checksum for packet %v", i)
+		}
+		if segment, ok := ip.InternetData().(*TCPSegment); ok {
+			afterSegment := afterIP.InternetData().(*TCPSegment)
+			valid := segment.ValidateChecksum(ip.PseudoHeader(IPP_TCP, ip.TotalLength-uint16(ip.IHL)*4)) == nil
+			afterValid := afterSegment.ValidateChecksum(afterIP.PseudoHeader(IPP_TCP, afterIP.TotalLength-uint16(afterIP.IHL)*4)) == nil
+			if valid != afterValid {
+				t.Errorf("Unexpected TCP checksum for packet %v: was valid %v, now %v", i, valid, afterValid)
+			}
+		}
+		if datagram, ok := ip.InternetData().(*UDPDatagram); ok {
+			afterDatagram := afterIP.InternetData().(*UDPDatagram)
+			valid := datagram.ValidateChecksum(ip.PseudoHeader(IPP_UDP, datagram.Length)) == nil
+			afterValid := afterDatagram.ValidateChecksum(afterIP.PseudoHeader(IPP_UDP, afterDatagram.Length)) == nil
+			if valid != afterValid {
+				t.Errorf("Unexpected UDP checksum for packet %v: was valid %v, now %v", i, valid, afterValid)
+			}
+		}
+
+		// Raw no longer holds the original addresses in its headers. Payloads, such as the headers
+		// quoted by ICMP errors, are left alone.
+		headers := after.Raw[:14+int(ip.IHL)*4]
+		if bytes.Contains(headers, ip.SourceAddress[:]) || bytes.Contains(headers, ip.DestAddress[:]) || bytes.Contains(headers, frame.MACSource[:]) {
+			t.Errorf("Unexpected original address in raw bytes of packet %v", i)
+		}
+	}
+	if len(mapping) < 10 || len(macs) < 2 {
+		t.Fatalf("Too few addresses: %v IPv4, %v MAC", len(mapping), len(macs))
+	}
+
+	// Subnets survive: mapped addresses share exactly as long a prefix as the originals.
+	for a, mappedA := range mapping {
+		for b, mappedB := range mapping {
+			if commonPrefix(a[:], b[:]) != commonPrefix(mappedA[:], mappedB[:]) {
+				t.Errorf("Unexpected prefix: %v and %v share %v bits, but %v and %v share %v", a, b, commonPrefix(a[:], b[:]), mappedA, mappedB, commonPrefix(mappedA[:], mappedB[:]))
+			}
+		}
+	}
+
+	// The same seed maps addresses the same way, while another seed doesn't.
+	a, b := NewAnonymizer([]byte("seed")), NewAnonymizer([]byte("other"))
+	for address, mapped := range mapping {
+		if got := a.address(address[:]); !bytes.Equal(got, mapped[:]) {
+			t.Errorf("Unexpected mapping for %v: expected %v, got %v", address, mapped, got)
+		}
+		if got := b.address(address[:]); bytes.Equal(got, mapped[:]) {
+			t.Errorf("Unexpected mapping for %v with another seed: got %v again", address, got)
+		}
+	}
+
+	// The anonymized capture can be written out and read back.
+	var buf bytes.Buffer
+	if _, err := anonymized.WriteTo(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	reparsed, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	for i := range reparsed.Packets {
+		if !bytes.Equal(reparsed.Packets[i].Raw, anonymized.Packets[i].Raw) {
+			t.Errorf("Unexpected packet %v after writing: expected %x, got %x", i, anonymized.Packets[i].Raw, reparsed.Packets[i].Raw)
+			break
+		}
+	}
+}
+
+func TestAnonymizeFragment(t *testing.T) {
+	// The start of the payload looks like a UDP header, with "ab" where its checksum would be.
+	payload := append([]byte{0x00, 0x35, 0x00, 0x35, 0x00, 0x18}, "abcdefghijklmnopqr"...)
+	data := []byte{
+		// File header: version 2.4, snaplen 65535, link type RAW.
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+		// A UDP datagram's second fragment, at offset 24.
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2C, 0x00, 0x00, 0x00, 0x2C, 0x00, 0x00, 0x00,
+		0x45, 0x00, 0x00, 0x2C, 0x00, 0x01, 0x00, 0x03, 0x40, 0x11, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+	}
+	data = append(data, payload...)
+
+	file, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	file.Anonymize([]byte("seed"))
+
+	// The fragment's payload decodes as a UDP header, but it isn't one, so it's left untouched.
+	pkt := file.Packets[0]
+	if !bytes.Equal(pkt.Raw[20:], payload) {
+		t.Errorf("Unexpected fragment payload: expected %q, got %q", payload, pkt.Raw[20:])
+	}
+	if bytes.Equal(pkt.Raw[12:16], []byte{0x0A, 0x00, 0x00, 0x01}) {
+		t.Errorf("Unexpected source address: %v wasn't mapped", pkt.Raw[12:16])
+	}
+}
+
+func TestAnonymizeUnserializable(t *testing.T) {
+	data := []byte{
+		// File header: version 2.4, snaplen 65535, link type RAW.
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+		// A GRE packet, which can't be rebuilt from its layers, carrying four bytes of an unknown protocol.
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00,
+		0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x2F, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x88, 0xB5, 0x01, 0x02, 0x03, 0x04,
+	}
+
+	file, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	file.Anonymize([]byte("seed"))
+
+	// The rewritten header is patched into Raw, and the rest is left as it was.
+	ip := file.Packets[0].Data.LinkData().(*IPv4Packet)
+	raw := file.Packets[0].Raw
+	if !bytes.Equal(raw[:20], ip.encodeHeader(0)) {
+		t.Errorf("Unexpected header in raw bytes: expected %x, got %x", ip.encodeHeader(0), raw[:20])
+	}
+	if !bytes.Equal(raw[20:], data[len(data)-8:]) {
+		t.Errorf("Unexpected payload in raw bytes: expected %x, got %x", data[len(data)-8:], raw[20:])
+	}
+	if bytes.Equal(ip.SourceAddress[:], []byte{0x0A, 0x00, 0x00, 0x01}) {
+		t.Errorf("Unexpected source address: %v wasn't mapped", ip.SourceAddress)
+	}
+
+	var buf bytes.Buffer
+	if _, err := file.WriteTo(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), raw) {
+		t.Errorf("Unexpected packet after writing: expected %x, got %x", raw, buf.Bytes())
+	}
+}
+
+func TestAnonymizeUnserializableTransport(t *testing.T) {
+	// A UDP datagram with a checksum, under a link layer that can't be rebuilt.
+	data := []byte{0x2A, 0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00,
+		0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02, 0x04, 0xD2, 0x16, 0x2E, 0x00, 0x08, 0x12, 0x34}
+	link := new(testUserLink)
+	if err := link.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pkt := Packet{Data: link, Raw: data}
+
+	NewAnonymizer([]byte("seed")).AnonymizePacket(&pkt)
+
+	// The adjusted checksum is patched into Raw along with the addresses.
+	datagram := link.LinkData().InternetData().(*UDPDatagram)
+	if datagram.Checksum == 0x1234 {
+		t.Errorf("Unexpected checksum: %#x wasn't adjusted", datagram.Checksum)
+	}
+	if pkt.Raw == nil || !bytes.Equal(pkt.Raw[21:], datagram.encodeHeader()) {
+		t.Errorf("Unexpected transport header in raw bytes: expected %x, got %x", datagram.encodeHeader(), pkt.Raw)
+	}
+}
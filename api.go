@@ -7,8 +7,13 @@ functionality in as clear an API as possible.
 package gopcap
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
 	"errors"
 	"io"
+	"net"
 	"time"
 )
 
@@ -17,6 +22,16 @@ var NotAPcapFile error = errors.New("Not a pcap file.")
 var InsufficientLength error = errors.New("Insufficient length.")
 var UnexpectedEOF error = io.ErrUnexpectedEOF
 var IncorrectPacket error = errors.New("Incorrect packet type.")
+var UnknownIPVersion error = errors.New("Unknown IP version.")
+var NoSuchConnection error = errors.New("No such connection.")
+var MissingStreamData error = errors.New("Stream has missing data.")
+var InconsistentUrgentPointer error = errors.New("Urgent pointer inconsistent with URG flag.")
+var InvalidChecksum error = errors.New("Checksum doesn't match the data.")
+var MartianSourceAddress error = errors.New("Source address is reserved.")
+var SCTPCookieMismatch error = errors.New("Echoed SCTP state cookie doesn't match.")
+var UnserializableLayer error = errors.New("Layer can't be serialized.")
+var InvalidIndex error = errors.New("Invalid packet index.")
+var MismatchedLinkTypes error = errors.New("Captures have different link types.")
 
 // Link encodes a given Link-Layer header type. See http://www.tcpdump.org/linktypes.html for a more-full
 // explanation of each header type.
@@ -103,42 +118,80 @@ const (
 type EtherType uint16
 
 const (
-	ETHERTYPE_IPV4    EtherType = 0x0800
-	ARP               EtherType = 0x0806
-	WAKE_ON_LAN       EtherType = 0x0842
-	TRILL             EtherType = 0x22F3
-	DECNET_PHASE_4    EtherType = 0x6003
-	REVERSE_ARP       EtherType = 0x8035
-	APPLETALK         EtherType = 0x809B
-	APPLETALK_ARP     EtherType = 0x80F3
-	IPX1              EtherType = 0x8137
-	IPX2              EtherType = 0x8138
-	QNET              EtherType = 0x8204
-	ETHERTYPE_IPV6    EtherType = 0x86DD
-	FLOWCONTROL       EtherType = 0x8808
-	SLOW              EtherType = 0x8809
-	COBRANET          EtherType = 0x8819
-	MPLS_UNICAST      EtherType = 0x8847
-	MPLS_MULTICAST    EtherType = 0x8848
-	PPPOE_DISCOVERY   EtherType = 0x8863
-	PPPOE_SESSION     EtherType = 0x8864
-	JUMBO_FRAMES      EtherType = 0x8870
-	HOMEPLUG          EtherType = 0x887B
-	EAP_OVER_LAN      EtherType = 0x888E
-	PROFINET          EtherType = 0x8892
-	HYPERSCSI         EtherType = 0x889A
-	ATA_OVER_ETHERNET EtherType = 0x88A2
-	ETHERCAT          EtherType = 0x88A4
-	POWERLINK         EtherType = 0x88AB
-	LLDP              EtherType = 0x88CC
-	SERCOS3           EtherType = 0x88CD
-	MRP               EtherType = 0x88E3
-	MAC_SECURITY      EtherType = 0x88E5
-	IEEE1588          EtherType = 0x88F7
-	FCOE              EtherType = 0x8906
-	FCOE_INIT         EtherType = 0x8914
-	ROCE              EtherType = 0x8915
-	HSR               EtherType = 0x892F
+	ETHERTYPE_IPV4        EtherType = 0x0800
+	ETHERTYPE_VLAN        EtherType = 0x8100
+	ETHERTYPE_QINQ        EtherType = 0x88A8
+	ETHERTYPE_QINQ_LEGACY EtherType = 0x9100
+	ARP                   EtherType = 0x0806
+	WAKE_ON_LAN           EtherType = 0x0842
+	TRILL                 EtherType = 0x22F3
+	DECNET_PHASE_4        EtherType = 0x6003
+	REVERSE_ARP           EtherType = 0x8035
+	APPLETALK             EtherType = 0x809B
+	APPLETALK_ARP         EtherType = 0x80F3
+	IPX1                  EtherType = 0x8137
+	IPX2                  EtherType = 0x8138
+	QNET                  EtherType = 0x8204
+	ETHERTYPE_IPV6        EtherType = 0x86DD
+	FLOWCONTROL           EtherType = 0x8808
+	SLOW                  EtherType = 0x8809
+	COBRANET              EtherType = 0x8819
+	MPLS_UNICAST          EtherType = 0x8847
+	MPLS_MULTICAST        EtherType = 0x8848
+	PPPOE_DISCOVERY       EtherType = 0x8863
+	PPPOE_SESSION         EtherType = 0x8864
+	JUMBO_FRAMES          EtherType = 0x8870
+	HOMEPLUG              EtherType = 0x887B
+	EAP_OVER_LAN          EtherType = 0x888E
+	PROFINET              EtherType = 0x8892
+	HYPERSCSI             EtherType = 0x889A
+	ATA_OVER_ETHERNET     EtherType = 0x88A2
+	ETHERCAT              EtherType = 0x88A4
+	POWERLINK             EtherType = 0x88AB
+	LLDP                  EtherType = 0x88CC
+	SERCOS3               EtherType = 0x88CD
+	MRP                   EtherType = 0x88E3
+	MAC_SECURITY          EtherType = 0x88E5
+	IEEE1588              EtherType = 0x88F7
+	FCOE                  EtherType = 0x8906
+	FCOE_INIT             EtherType = 0x8914
+	ROCE                  EtherType = 0x8915
+	HSR                   EtherType = 0x892F
+	ERSPAN_TYPE_II        EtherType = 0x88BE
+	ERSPAN_TYPE_III       EtherType = 0x22EB
+	ETHERTYPE_TEB         EtherType = 0x6558 // Transparent Ethernet bridging, for Ethernet over GRE.
+	ETHERTYPE_PPP         EtherType = 0x880B
+)
+
+// PPPProtocol identifies the protocol carried in a PPP frame.
+type PPPProtocol uint16
+
+const (
+	PPP_PROTOCOL_IPV4 PPPProtocol = 0x0021
+	PPP_PROTOCOL_IPV6 PPPProtocol = 0x0057
+	PPP_PROTOCOL_IPCP PPPProtocol = 0x8021
+	PPP_PROTOCOL_LCP  PPPProtocol = 0xC021
+	PPP_PROTOCOL_PAP  PPPProtocol = 0xC023
+	PPP_PROTOCOL_CHAP PPPProtocol = 0xC223
+)
+
+// ARPOperation defines the operation an ARP packet performs.
+type ARPOperation uint16
+
+const (
+	ARP_REQUEST ARPOperation = 1
+	ARP_REPLY   ARPOperation = 2
+)
+
+// SLLPacketType defines who a packet in a Linux cooked capture was sent to or by.
+type SLLPacketType uint16
+
+const (
+	SLL_HOST      SLLPacketType = 0 // Sent to us.
+	SLL_BROADCAST SLLPacketType = 1 // Broadcast by somebody else.
+	SLL_MULTICAST SLLPacketType = 2 // Multicast by somebody else.
+	SLL_OTHERHOST SLLPacketType = 3 // Sent by somebody else to somebody else.
+	SLL_OUTGOING  SLLPacketType = 4 // Sent by us.
 )
 
 // IPProtocol defines the potential protocols enclosed by an IP packet. Some representative
@@ -149,9 +202,57 @@ const (
 	IPP_ICMP      IPProtocol = 0x01
 	IPP_TCP       IPProtocol = 0x06
 	IPP_UDP       IPProtocol = 0x11
+	IPP_GRE       IPProtocol = 0x2F
 	IPP_TLSP      IPProtocol = 0x38
 	IPP_IPV6_ICMP IPProtocol = 0x3A
 	IPP_SCTP      IPProtocol = 0x84
+	IPP_UDPLITE   IPProtocol = 0x88
+)
+
+// TCPFlags holds the nine TCP control flags, in the positions they take in the low nine bits of
+// the data offset and flags field.
+type TCPFlags uint16
+
+const (
+	TCP_FLAG_FIN TCPFlags = 0x001
+	TCP_FLAG_SYN TCPFlags = 0x002
+	TCP_FLAG_RST TCPFlags = 0x004
+	TCP_FLAG_PSH TCPFlags = 0x008
+	TCP_FLAG_ACK TCPFlags = 0x010
+	TCP_FLAG_URG TCPFlags = 0x020
+	TCP_FLAG_ECE TCPFlags = 0x040
+	TCP_FLAG_CWR TCPFlags = 0x080
+	TCP_FLAG_NS  TCPFlags = 0x100
+)
+
+// TCPOptionKind identifies the type of a TCP option. Only some of the many option kinds have
+// constants defined here.
+type TCPOptionKind uint8
+
+const (
+	TCP_OPTION_EOL            TCPOptionKind = 0
+	TCP_OPTION_NOP            TCPOptionKind = 1
+	TCP_OPTION_MSS            TCPOptionKind = 2
+	TCP_OPTION_WINDOW_SCALE   TCPOptionKind = 3
+	TCP_OPTION_SACK_PERMITTED TCPOptionKind = 4
+	TCP_OPTION_SACK           TCPOptionKind = 5
+	TCP_OPTION_TIMESTAMPS     TCPOptionKind = 8
+)
+
+// ICMPType defines the type of an ICMP or ICMPv6 message. The two protocols number their messages
+// differently, so the ICMPv6 types have their own constants.
+type ICMPType uint8
+
+const (
+	ICMP_ECHO_REPLY         ICMPType = 0
+	ICMP_DEST_UNREACHABLE   ICMPType = 3
+	ICMP_ECHO_REQUEST       ICMPType = 8
+	ICMP_TIME_EXCEEDED      ICMPType = 11
+	ICMPV6_DEST_UNREACHABLE ICMPType = 1
+	ICMPV6_PACKET_TOO_BIG   ICMPType = 2
+	ICMPV6_TIME_EXCEEDED    ICMPType = 3
+	ICMPV6_ECHO_REQUEST     ICMPType = 128
+	ICMPV6_ECHO_REPLY       ICMPType = 129
 )
 
 type SCTPChunkType uint8
@@ -169,6 +270,8 @@ const (
 	SCTP_CHUNK_ERROR             SCTPChunkType = 9
 	SCTP_CHUNK_COOKIE_ECHO       SCTPChunkType = 10
 	SCTP_CHUNK_COOKIE_ACK        SCTPChunkType = 11
+	SCTP_CHUNK_ECNE              SCTPChunkType = 12
+	SCTP_CHUNK_CWR               SCTPChunkType = 13
 	SCTP_CHUNK_SHUTDOWN_COMPLETE SCTPChunkType = 14
 )
 
@@ -177,10 +280,340 @@ type SCTPChunkParameterType uint16
 const (
 	SCTP_CHUNK_PARAMETER_IPV4_SENDER               SCTPChunkParameterType = 5
 	SCTP_CHUNK_PARAMETER_IPV6_SENDER               SCTPChunkParameterType = 6
+	SCTP_CHUNK_PARAMETER_STATE_COOKIE              SCTPChunkParameterType = 7
 	SCTP_CHUNK_PARAMETER_COOKIE_LIFESPAN_INCREMENT SCTPChunkParameterType = 9
 	SCTP_CHUNK_PARAMETER_HEARTBEAT_INFO            SCTPChunkParameterType = 1
 )
 
+// ModbusFunctionCode identifies the operation requested by a Modbus PDU. Responses carrying an
+// exception have the high bit of the function code set.
+type ModbusFunctionCode uint8
+
+const (
+	MODBUS_READ_COILS               ModbusFunctionCode = 1
+	MODBUS_READ_DISCRETE_INPUTS     ModbusFunctionCode = 2
+	MODBUS_READ_HOLDING_REGISTERS   ModbusFunctionCode = 3
+	MODBUS_READ_INPUT_REGISTERS     ModbusFunctionCode = 4
+	MODBUS_WRITE_SINGLE_COIL        ModbusFunctionCode = 5
+	MODBUS_WRITE_SINGLE_REGISTER    ModbusFunctionCode = 6
+	MODBUS_WRITE_MULTIPLE_COILS     ModbusFunctionCode = 15
+	MODBUS_WRITE_MULTIPLE_REGISTERS ModbusFunctionCode = 16
+	MODBUS_EXCEPTION                ModbusFunctionCode = 0x80
+)
+
+// BGPMessageType identifies the type of a BGP message.
+type BGPMessageType uint8
+
+const (
+	BGP_OPEN          BGPMessageType = 1
+	BGP_UPDATE        BGPMessageType = 2
+	BGP_NOTIFICATION  BGPMessageType = 3
+	BGP_KEEPALIVE     BGPMessageType = 4
+	BGP_ROUTE_REFRESH BGPMessageType = 5
+)
+
+// BGPPathAttributeType identifies the type of a path attribute in a BGP UPDATE message.
+type BGPPathAttributeType uint8
+
+const (
+	BGP_ATTR_ORIGIN           BGPPathAttributeType = 1
+	BGP_ATTR_AS_PATH          BGPPathAttributeType = 2
+	BGP_ATTR_NEXT_HOP         BGPPathAttributeType = 3
+	BGP_ATTR_MULTI_EXIT_DISC  BGPPathAttributeType = 4
+	BGP_ATTR_LOCAL_PREF       BGPPathAttributeType = 5
+	BGP_ATTR_ATOMIC_AGGREGATE BGPPathAttributeType = 6
+	BGP_ATTR_AGGREGATOR       BGPPathAttributeType = 7
+	BGP_ATTR_COMMUNITIES      BGPPathAttributeType = 8
+)
+
+// MQTTPacketType identifies the type of an MQTT control packet.
+type MQTTPacketType uint8
+
+const (
+	MQTT_CONNECT     MQTTPacketType = 1
+	MQTT_CONNACK     MQTTPacketType = 2
+	MQTT_PUBLISH     MQTTPacketType = 3
+	MQTT_PUBACK      MQTTPacketType = 4
+	MQTT_PUBREC      MQTTPacketType = 5
+	MQTT_PUBREL      MQTTPacketType = 6
+	MQTT_PUBCOMP     MQTTPacketType = 7
+	MQTT_SUBSCRIBE   MQTTPacketType = 8
+	MQTT_SUBACK      MQTTPacketType = 9
+	MQTT_UNSUBSCRIBE MQTTPacketType = 10
+	MQTT_UNSUBACK    MQTTPacketType = 11
+	MQTT_PINGREQ     MQTTPacketType = 12
+	MQTT_PINGRESP    MQTTPacketType = 13
+	MQTT_DISCONNECT  MQTTPacketType = 14
+)
+
+// KafkaAPIKey identifies the type of a Kafka request, and of the response to it. Only some of the
+// many API keys have constants defined here.
+type KafkaAPIKey int16
+
+const (
+	KAFKA_PRODUCE          KafkaAPIKey = 0
+	KAFKA_FETCH            KafkaAPIKey = 1
+	KAFKA_LIST_OFFSETS     KafkaAPIKey = 2
+	KAFKA_METADATA         KafkaAPIKey = 3
+	KAFKA_OFFSET_COMMIT    KafkaAPIKey = 8
+	KAFKA_OFFSET_FETCH     KafkaAPIKey = 9
+	KAFKA_FIND_COORDINATOR KafkaAPIKey = 10
+	KAFKA_JOIN_GROUP       KafkaAPIKey = 11
+	KAFKA_HEARTBEAT        KafkaAPIKey = 12
+	KAFKA_LEAVE_GROUP      KafkaAPIKey = 13
+	KAFKA_SYNC_GROUP       KafkaAPIKey = 14
+	KAFKA_API_VERSIONS     KafkaAPIKey = 18
+)
+
+// RESPType identifies the type of a Redis RESP value, by the byte that starts it.
+type RESPType uint8
+
+const (
+	RESP_SIMPLE_STRING RESPType = '+'
+	RESP_ERROR         RESPType = '-'
+	RESP_INTEGER       RESPType = ':'
+	RESP_BULK_STRING   RESPType = '$'
+	RESP_ARRAY         RESPType = '*'
+)
+
+// TelnetCommand identifies a Telnet command, sent after an IAC byte.
+type TelnetCommand uint8
+
+const (
+	TELNET_SE   TelnetCommand = 240
+	TELNET_NOP  TelnetCommand = 241
+	TELNET_DM   TelnetCommand = 242
+	TELNET_BRK  TelnetCommand = 243
+	TELNET_IP   TelnetCommand = 244
+	TELNET_AO   TelnetCommand = 245
+	TELNET_AYT  TelnetCommand = 246
+	TELNET_EC   TelnetCommand = 247
+	TELNET_EL   TelnetCommand = 248
+	TELNET_GA   TelnetCommand = 249
+	TELNET_SB   TelnetCommand = 250
+	TELNET_WILL TelnetCommand = 251
+	TELNET_WONT TelnetCommand = 252
+	TELNET_DO   TelnetCommand = 253
+	TELNET_DONT TelnetCommand = 254
+	TELNET_IAC  TelnetCommand = 255
+)
+
+// TelnetOption identifies an option negotiated by a Telnet DO, DONT, WILL or WONT command, or
+// configured by a subnegotiation.
+type TelnetOption uint8
+
+const (
+	TELNET_OPTION_BINARY            TelnetOption = 0
+	TELNET_OPTION_ECHO              TelnetOption = 1
+	TELNET_OPTION_SUPPRESS_GO_AHEAD TelnetOption = 3
+	TELNET_OPTION_STATUS            TelnetOption = 5
+	TELNET_OPTION_TIMING_MARK       TelnetOption = 6
+	TELNET_OPTION_TERMINAL_TYPE     TelnetOption = 24
+	TELNET_OPTION_NAWS              TelnetOption = 31
+	TELNET_OPTION_TERMINAL_SPEED    TelnetOption = 32
+	TELNET_OPTION_LINEMODE          TelnetOption = 34
+	TELNET_OPTION_NEW_ENVIRON       TelnetOption = 39
+)
+
+// OpenFlowVersion identifies the version of the OpenFlow protocol a message was sent with.
+type OpenFlowVersion uint8
+
+const (
+	OPENFLOW_1_0 OpenFlowVersion = 0x01
+	OPENFLOW_1_1 OpenFlowVersion = 0x02
+	OPENFLOW_1_2 OpenFlowVersion = 0x03
+	OPENFLOW_1_3 OpenFlowVersion = 0x04
+	OPENFLOW_1_4 OpenFlowVersion = 0x05
+	OPENFLOW_1_5 OpenFlowVersion = 0x06
+)
+
+// OpenFlowType identifies the type of an OpenFlow message. The types up to PACKET_OUT are numbered
+// the same in every version; later types vary, and aren't listed.
+type OpenFlowType uint8
+
+const (
+	OPENFLOW_HELLO              OpenFlowType = 0
+	OPENFLOW_ERROR              OpenFlowType = 1
+	OPENFLOW_ECHO_REQUEST       OpenFlowType = 2
+	OPENFLOW_ECHO_REPLY         OpenFlowType = 3
+	OPENFLOW_EXPERIMENTER       OpenFlowType = 4 // VENDOR in OpenFlow 1.0.
+	OPENFLOW_FEATURES_REQUEST   OpenFlowType = 5
+	OPENFLOW_FEATURES_REPLY     OpenFlowType = 6
+	OPENFLOW_GET_CONFIG_REQUEST OpenFlowType = 7
+	OPENFLOW_GET_CONFIG_REPLY   OpenFlowType = 8
+	OPENFLOW_SET_CONFIG         OpenFlowType = 9
+	OPENFLOW_PACKET_IN          OpenFlowType = 10
+	OPENFLOW_FLOW_REMOVED       OpenFlowType = 11
+	OPENFLOW_PORT_STATUS        OpenFlowType = 12
+	OPENFLOW_PACKET_OUT         OpenFlowType = 13
+)
+
+// ChecksumType identifies which of a packet's checksums failed, as reported by VerifyChecksums.
+type ChecksumType uint8
+
+const (
+	CHECKSUM_IPV4 ChecksumType = 1 // The IPv4 header checksum.
+	CHECKSUM_TCP  ChecksumType = 2
+	CHECKSUM_UDP  ChecksumType = 3
+)
+
+// CloseReason describes how a TCP connection ended, as seen by TCPAnalyzer.
+type CloseReason uint8
+
+const (
+	TCP_CLOSE_OPEN CloseReason = 0 // Still open at the end of the capture.
+	TCP_CLOSE_FIN  CloseReason = 1 // Closed by both ends sending a FIN that was acknowledged.
+	TCP_CLOSE_RST  CloseReason = 2 // Reset by either end.
+)
+
+// WireGuardMessageType identifies the type of a WireGuard message.
+type WireGuardMessageType uint8
+
+const (
+	WIREGUARD_HANDSHAKE_INITIATION WireGuardMessageType = 1
+	WIREGUARD_HANDSHAKE_RESPONSE   WireGuardMessageType = 2
+	WIREGUARD_COOKIE_REPLY         WireGuardMessageType = 3
+	WIREGUARD_TRANSPORT_DATA       WireGuardMessageType = 4
+)
+
+// DiameterCommandCode identifies the command of a Diameter message. Requests and answers share
+// the same command code. Only some of the many command codes have constants defined here.
+type DiameterCommandCode uint32
+
+const (
+	DIAMETER_CAPABILITIES_EXCHANGE DiameterCommandCode = 257
+	DIAMETER_RE_AUTH               DiameterCommandCode = 258
+	DIAMETER_ACCOUNTING            DiameterCommandCode = 271
+	DIAMETER_CREDIT_CONTROL        DiameterCommandCode = 272
+	DIAMETER_ABORT_SESSION         DiameterCommandCode = 274
+	DIAMETER_SESSION_TERMINATION   DiameterCommandCode = 275
+	DIAMETER_DEVICE_WATCHDOG       DiameterCommandCode = 280
+	DIAMETER_DISCONNECT_PEER       DiameterCommandCode = 282
+)
+
+// DiameterAVPCode identifies the type of a Diameter attribute-value pair. Only some of the many
+// AVP codes from the base protocol have constants defined here.
+type DiameterAVPCode uint32
+
+const (
+	DIAMETER_AVP_HOST_IP_ADDRESS                DiameterAVPCode = 257
+	DIAMETER_AVP_AUTH_APPLICATION_ID            DiameterAVPCode = 258
+	DIAMETER_AVP_ACCT_APPLICATION_ID            DiameterAVPCode = 259
+	DIAMETER_AVP_VENDOR_SPECIFIC_APPLICATION_ID DiameterAVPCode = 260
+	DIAMETER_AVP_SESSION_ID                     DiameterAVPCode = 263
+	DIAMETER_AVP_ORIGIN_HOST                    DiameterAVPCode = 264
+	DIAMETER_AVP_SUPPORTED_VENDOR_ID            DiameterAVPCode = 265
+	DIAMETER_AVP_VENDOR_ID                      DiameterAVPCode = 266
+	DIAMETER_AVP_FIRMWARE_REVISION              DiameterAVPCode = 267
+	DIAMETER_AVP_RESULT_CODE                    DiameterAVPCode = 268
+	DIAMETER_AVP_PRODUCT_NAME                   DiameterAVPCode = 269
+	DIAMETER_AVP_DESTINATION_REALM              DiameterAVPCode = 283
+	DIAMETER_AVP_DESTINATION_HOST               DiameterAVPCode = 293
+	DIAMETER_AVP_ORIGIN_REALM                   DiameterAVPCode = 296
+)
+
+// DNSType identifies the type of a DNS resource record or question. Only some of the many types
+// have constants defined here.
+type DNSType uint16
+
+const (
+	DNS_TYPE_A     DNSType = 1
+	DNS_TYPE_NS    DNSType = 2
+	DNS_TYPE_CNAME DNSType = 5
+	DNS_TYPE_SOA   DNSType = 6
+	DNS_TYPE_PTR   DNSType = 12
+	DNS_TYPE_MX    DNSType = 15
+	DNS_TYPE_TXT   DNSType = 16
+	DNS_TYPE_AAAA  DNSType = 28
+	DNS_TYPE_SRV   DNSType = 33
+	DNS_TYPE_OPT   DNSType = 41
+	DNS_TYPE_ANY   DNSType = 255
+)
+
+// DNSClass identifies the class of a DNS resource record or question. Nearly everything is IN.
+type DNSClass uint16
+
+const (
+	DNS_CLASS_IN  DNSClass = 1
+	DNS_CLASS_CH  DNSClass = 3
+	DNS_CLASS_ANY DNSClass = 255
+)
+
+// DHCPv4MessageType identifies the type of a DHCPv4 message, from its message type option.
+type DHCPv4MessageType uint8
+
+const (
+	DHCPV4_DISCOVER DHCPv4MessageType = 1
+	DHCPV4_OFFER    DHCPv4MessageType = 2
+	DHCPV4_REQUEST  DHCPv4MessageType = 3
+	DHCPV4_DECLINE  DHCPv4MessageType = 4
+	DHCPV4_ACK      DHCPv4MessageType = 5
+	DHCPV4_NAK      DHCPv4MessageType = 6
+	DHCPV4_RELEASE  DHCPv4MessageType = 7
+	DHCPV4_INFORM   DHCPv4MessageType = 8
+)
+
+// DHCPv4OptionCode identifies the type of a DHCPv4 option. Only some of the many option codes
+// have constants defined here.
+type DHCPv4OptionCode uint8
+
+const (
+	DHCPV4_OPTION_PAD            DHCPv4OptionCode = 0
+	DHCPV4_OPTION_SUBNET_MASK    DHCPv4OptionCode = 1
+	DHCPV4_OPTION_ROUTER         DHCPv4OptionCode = 3
+	DHCPV4_OPTION_DNS_SERVERS    DHCPv4OptionCode = 6
+	DHCPV4_OPTION_HOSTNAME       DHCPv4OptionCode = 12
+	DHCPV4_OPTION_DOMAIN_NAME    DHCPv4OptionCode = 15
+	DHCPV4_OPTION_REQUESTED_IP   DHCPv4OptionCode = 50
+	DHCPV4_OPTION_LEASE_TIME     DHCPv4OptionCode = 51
+	DHCPV4_OPTION_MESSAGE_TYPE   DHCPv4OptionCode = 53
+	DHCPV4_OPTION_SERVER_ID      DHCPv4OptionCode = 54
+	DHCPV4_OPTION_PARAMETER_LIST DHCPv4OptionCode = 55
+	DHCPV4_OPTION_RENEWAL_TIME   DHCPv4OptionCode = 58
+	DHCPV4_OPTION_REBINDING_TIME DHCPv4OptionCode = 59
+	DHCPV4_OPTION_CLIENT_ID      DHCPv4OptionCode = 61
+	DHCPV4_OPTION_END            DHCPv4OptionCode = 255
+)
+
+// DHCPv6MessageType identifies the type of a DHCPv6 message.
+type DHCPv6MessageType uint8
+
+const (
+	DHCPV6_SOLICIT             DHCPv6MessageType = 1
+	DHCPV6_ADVERTISE           DHCPv6MessageType = 2
+	DHCPV6_REQUEST             DHCPv6MessageType = 3
+	DHCPV6_CONFIRM             DHCPv6MessageType = 4
+	DHCPV6_RENEW               DHCPv6MessageType = 5
+	DHCPV6_REBIND              DHCPv6MessageType = 6
+	DHCPV6_REPLY               DHCPv6MessageType = 7
+	DHCPV6_RELEASE             DHCPv6MessageType = 8
+	DHCPV6_DECLINE             DHCPv6MessageType = 9
+	DHCPV6_RECONFIGURE         DHCPv6MessageType = 10
+	DHCPV6_INFORMATION_REQUEST DHCPv6MessageType = 11
+	DHCPV6_RELAY_FORW          DHCPv6MessageType = 12
+	DHCPV6_RELAY_REPL          DHCPv6MessageType = 13
+)
+
+// DHCPv6OptionCode identifies the type of a DHCPv6 option. Only some of the many option codes
+// have constants defined here.
+type DHCPv6OptionCode uint16
+
+const (
+	DHCPV6_OPTION_CLIENTID     DHCPv6OptionCode = 1
+	DHCPV6_OPTION_SERVERID     DHCPv6OptionCode = 2
+	DHCPV6_OPTION_IA_NA        DHCPv6OptionCode = 3
+	DHCPV6_OPTION_IA_TA        DHCPv6OptionCode = 4
+	DHCPV6_OPTION_IAADDR       DHCPv6OptionCode = 5
+	DHCPV6_OPTION_ORO          DHCPv6OptionCode = 6
+	DHCPV6_OPTION_ELAPSED_TIME DHCPv6OptionCode = 8
+	DHCPV6_OPTION_RELAY_MSG    DHCPv6OptionCode = 9
+	DHCPV6_OPTION_STATUS_CODE  DHCPv6OptionCode = 13
+	DHCPV6_OPTION_DNS_SERVERS  DHCPv6OptionCode = 23
+	DHCPV6_OPTION_DOMAIN_LIST  DHCPv6OptionCode = 24
+	DHCPV6_OPTION_IA_PD        DHCPv6OptionCode = 25
+	DHCPV6_OPTION_IAPREFIX     DHCPv6OptionCode = 26
+)
+
 // PcapFile represents the parsed form of a single .pcap file. The structure
 // contains some details about the file itself, but is mostly a container for
 // the parsed Packets.
@@ -192,6 +625,15 @@ type PcapFile struct {
 	MaxLen       uint32
 	LinkType     Link
 	Packets      []Packet
+
+	// TimestampResolution is the unit of the fractional part of each packet's timestamp:
+	// time.Microsecond for classic pcap files, including those in the modified format, or
+	// time.Nanosecond for files with the nanosecond magic number. Packet timestamps are already
+	// converted to time.Duration, so it's only needed to know how precise they are.
+	TimestampResolution time.Duration
+	timestamps          timestampDecoder
+	order               binary.ByteOrder
+	modified            bool // Whether the file is in the modified format, with longer packet headers.
 }
 
 // Packet is a representation of a single network packet. The structure
@@ -202,6 +644,42 @@ type Packet struct {
 	IncludedLen uint32
 	ActualLen   uint32
 	Data        LinkLayer
+	Raw         []byte // The bytes of the packet as captured, starting with the link-layer header. The layers' data refers to it.
+
+	// Packets from files in the modified format written by some older builds of tcpdump, which have
+	// the magic number 0xa1b2cd34, also record how the kernel received them. These fields are zero
+	// for packets from any other file.
+	InterfaceIndex int32     // The index of the interface the packet was captured on.
+	Protocol       EtherType // The protocol of the packet, as the kernel saw it.
+	PacketType     uint8     // Who the packet was for, as in Linux's PACKET_HOST, PACKET_BROADCAST and so on.
+
+	tzCorrection int32 // The TZCorrection of the file the packet was read from.
+}
+
+// Network returns the packet's internet layer, or nil if it doesn't have one.
+func (pkt *Packet) Network() InternetLayer {
+	if pkt.Data == nil {
+		return nil
+	}
+	return pkt.Data.LinkData()
+}
+
+// Transport returns the packet's transport layer, or nil if it doesn't have one.
+func (pkt *Packet) Transport() TransportLayer {
+	network := pkt.Network()
+	if network == nil {
+		return nil
+	}
+	return network.InternetData()
+}
+
+// Payload returns the data carried by the packet's transport layer, or nil if it doesn't have one.
+func (pkt *Packet) Payload() []byte {
+	transport := pkt.Transport()
+	if transport == nil {
+		return nil
+	}
+	return transport.TransportData()
 }
 
 // LinkLayer is a non-specific representation of a single link-layer level datagram, e.g. an Ethernet
@@ -220,6 +698,15 @@ type InternetLayer interface {
 	ReadFrom(src io.Reader) error
 }
 
+// IPLayer is an internet layer that's a version of IP, so that IPv4 and IPv6 packets can be handled
+// together: code holding an InternetLayer can check for IPLayer, rather than asserting each type.
+type IPLayer interface {
+	InternetLayer
+	Version() uint8
+	Source() net.IP
+	Destination() net.IP
+}
+
 // TransportLayer is a non-specific representation of a single transport-layer level datagram, e.g. a
 // TCP segment. It provides an abstract interface for pulling the higher layers out without specific
 // knowledge of the structure of the transport-layer protocol in question.
@@ -228,39 +715,286 @@ type TransportLayer interface {
 	ReadFrom(src io.Reader) error
 }
 
+// ApplicationLayer is a non-specific representation of a single application-layer message, e.g. a
+// DNS query, decoded from the data carried by a transport-layer segment. Unlike the lower layers it
+// is decoded from the bytes returned by TransportData, since application messages are often carried
+// across several segments and have to be put back together first.
+type ApplicationLayer interface {
+	FromBytes(data []byte) error
+}
+
+// Every layer decodes itself with ReadFrom, so that packets can be read straight from a file; only
+// application-layer messages are decoded with FromBytes. Make sure each layer keeps to its interface.
+var (
+	_ LinkLayer = (*UnknownLink)(nil)
+	_ LinkLayer = (*NullLink)(nil)
+	_ LinkLayer = (*RawLink)(nil)
+	_ LinkLayer = (*EthernetFrame)(nil)
+	_ LinkLayer = (*SLLFrame)(nil)
+	_ LinkLayer = (*ERSPANPacket)(nil)
+	_ LinkLayer = (*PPPFrame)(nil)
+
+	_ InternetLayer = (*UnknownINet)(nil)
+	_ InternetLayer = (*IPv4Packet)(nil)
+	_ InternetLayer = (*IPv6Packet)(nil)
+	_ InternetLayer = (*ARPPacket)(nil)
+	_ InternetLayer = (*PPPoESession)(nil)
+	_ InternetLayer = (*MPLSPacket)(nil)
+	_ InternetLayer = (*LLCPacket)(nil)
+
+	_ TransportLayer = (*UnknownTransport)(nil)
+	_ TransportLayer = (*GREHeader)(nil)
+	_ TransportLayer = (*ICMPSegment)(nil)
+	_ TransportLayer = (*SCTPSegment)(nil)
+	_ TransportLayer = (*TCPSegment)(nil)
+	_ TransportLayer = (*UDPDatagram)(nil)
+	_ TransportLayer = (*UDPLiteDatagram)(nil)
+)
+
 // Parse is the external API of gopcap. It takes anything that implements the
 // io.Reader interface, but will mostly expect a file produced by anything that
 // produces .pcap files. It will attempt to parse the entire file. If an error
 // is encountered, as much of the parsed content as is possible will be returned,
-// along with an error value.
+// along with an error value. An error reading a packet is returned as a *ParseError, saying which
+// packet failed and where it starts in the file.
+//
+// Gzip-compressed files, such as .pcap.gz files, are recognised by their first two bytes and
+// decompressed as they're read. To read the source exactly as it is, use a Parser with
+// DisableDecompression set.
+//
+// Files that have been concatenated, such as with cat, are read as one: where another file's header
+// is found in place of a packet header, the packets after it are read with that header's byte
+// ordering, timestamp resolution and link type. The returned header is the first file's.
 func Parse(src io.Reader) (PcapFile, error) {
-	file := new(PcapFile)
+	return Parser{}.Parse(src)
+}
 
-	// Check whether this is a libpcap file at all, and if so what byte ordering it has.
-	_, order, err := checkMagicNum(src)
+// Parse behaves like the package's Parse, reading the source with the parser's options.
+func (p Parser) Parse(src io.Reader) (PcapFile, error) {
+	src, err := p.source(src)
 	if err != nil {
-		return *file, err
+		return PcapFile{}, err
+	}
+	return parseFile(src)
+}
+
+// gzipMagic is the pair of bytes every gzip file starts with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompress returns a reader that decompresses the source if it's gzip-compressed, and otherwise
+// reads it as it is, buffered with a buffer of the given size. The buffer lets the first bytes be
+// checked without losing them; without one, they're read and then put back in front of the rest.
+// The decompressed data is buffered too, since it's also read a field at a time.
+func decompress(src io.Reader, size int) (io.Reader, error) {
+	var start []byte
+	if size > 0 {
+		buffered := bufio.NewReaderSize(src, size)
+		start, _ = buffered.Peek(len(gzipMagic))
+		src = buffered
+	} else {
+		start = make([]byte, len(gzipMagic))
+		n, _ := io.ReadFull(src, start)
+		start = start[:n]
+		src = io.MultiReader(bytes.NewReader(start), src)
+	}
+
+	// A source too short to check is left for checkMagicNum to reject.
+	if !bytes.Equal(start, gzipMagic) {
+		return src, nil
+	}
+
+	reader, err := gzip.NewReader(src)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, InsufficientLength
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bufferSource(reader, size), nil
+}
+
+// bufferSource wraps the source in a buffer of the given size, or returns it as it is if the size
+// is zero or less.
+func bufferSource(src io.Reader, size int) io.Reader {
+	if size <= 0 {
+		return src
 	}
+	return bufio.NewReaderSize(src, size)
+}
+
+// DefaultBufferSize is the size of the buffer sources are wrapped in, unless a Parser says
+// otherwise.
+const DefaultBufferSize = 64 * 1024
+
+// Parser holds options for reading pcap files. Its methods behave like the package's functions of
+// the same names, which read with the zero Parser.
+//
+// Each header field is read separately, so an unbuffered source would cost a system call per
+// field, and sources are wrapped in a buffer of BufferSize bytes. Reading the source directly is
+// only worthwhile if it's already buffered or in memory.
+//
+// Gzip-compressed sources are recognised by their first two bytes and decompressed as they're
+// read, unless DisableDecompression is set, in which case the source is read exactly as it is.
+type Parser struct {
+	BufferSize           int  // Zero means DefaultBufferSize, and a negative size reads the source directly.
+	DisableDecompression bool // Whether to read gzip-compressed sources without decompressing them.
+}
 
-	// Then populate the file header.
-	err = file.readFileHeader(src, order)
+// bufferSize returns the size of the buffer to wrap sources in, or zero for none.
+func (p Parser) bufferSize() int {
+	switch {
+	case p.BufferSize == 0:
+		return DefaultBufferSize
+	case p.BufferSize < 0:
+		return 0
+	default:
+		return p.BufferSize
+	}
+}
+
+// source prepares a source for reading, buffering it and, unless decompression is disabled,
+// decompressing it if it's gzip-compressed.
+func (p Parser) source(src io.Reader) (io.Reader, error) {
+	if p.DisableDecompression {
+		return bufferSource(src, p.bufferSize()), nil
+	}
+	return decompress(src, p.bufferSize())
+}
+
+// ParseWithBufferSize behaves like Parse, but wraps the source in a buffer of the given size. Each
+// header field is read separately, so an unbuffered file would otherwise cost a system call per
+// field. A size of zero or less reads from the source directly, which is only worthwhile if it's
+// already buffered or in memory. Unlike Parse, it doesn't decompress gzip-compressed sources.
+//
+// It's the same as Parse with a Parser whose DisableDecompression is set.
+func ParseWithBufferSize(src io.Reader, size int) (PcapFile, error) {
+	if size <= 0 {
+		size = -1
+	}
+	return Parser{BufferSize: size, DisableDecompression: true}.Parse(src)
+}
+
+// parseFile parses a file from a source that's ready to be read, as Parse does.
+func parseFile(src io.Reader) (PcapFile, error) {
+	file := new(PcapFile)
+
+	_, err := file.readHeader(src)
 	if err != nil {
 		return *file, err
 	}
 
+	// The packets are read with the header of the file they're in, which for concatenated files
+	// isn't necessarily the first, but the first is the one returned.
+	section := *file
+
 	// Whatever remains now are packets. Parse the rest of the file.
 	file.Packets = make([]Packet, 0)
+	offset := int64(fileHeaderLength)
 
-	for err == nil {
+	for {
 		pkt := new(Packet)
-		err = pkt.ReadFrom(src, order, file.LinkType)
+		skipped, err := section.nextPacketHeader(pkt, src)
+		offset += skipped
+
+		// EOF before a packet header means the file has ended cleanly, and there's no packet to keep.
+		if err == io.EOF {
+			return *file, nil
+		}
+		if err == nil {
+			err = pkt.readData(src, section.order, section.LinkType, 0)
+		}
+
+		// A packet that failed to decode is kept, decoded as far as possible, with the error.
 		file.Packets = append(file.Packets, *pkt)
+		if err != nil {
+			return *file, &ParseError{Index: len(file.Packets) - 1, Offset: offset, Err: err}
+		}
+		offset += section.packetHeaderSize() + int64(pkt.IncludedLen)
+	}
+}
+
+// ParseInto reads a pcap file packet by packet without keeping the packets, for captures too big to
+// hold in memory or where allocation matters. Each packet is decoded into pkt, which is then passed
+// to fn. The same Packet, and where possible the same layers below it, are reused for every packet:
+// fields are reset rather than reallocated, and Raw and the data of the higher layers refer to a
+// buffer that's overwritten by the next packet. fn therefore must not retain pkt, or anything reached
+// from it, once it returns; copy out whatever it needs to keep. Ethernet frames carrying IPv4 or
+// IPv6 with TCP or UDP are decoded without allocating, while other packets are decoded as Parse
+// would decode them. Application-layer messages, such as DNS, are still decoded into new values.
+//
+// Like Parse, gzip-compressed sources are decompressed as they're read, unless a Parser with
+// DisableDecompression set is used. If pkt is nil a new Packet is used. Parsing stops at the first
+// error, including one returned by fn, and that error is returned along with the file header; as
+// with Parse, an error reading a packet is returned as a *ParseError, while one from fn is returned
+// as it is. The returned PcapFile has no Packets.
+func ParseInto(src io.Reader, pkt *Packet, fn func(pkt *Packet) error) (PcapFile, error) {
+	return Parser{}.ParseInto(src, pkt, fn)
+}
+
+// ParseInto behaves like the package's ParseInto, reading the source with the parser's options.
+func (p Parser) ParseInto(src io.Reader, pkt *Packet, fn func(pkt *Packet) error) (PcapFile, error) {
+	file := new(PcapFile)
+
+	src, err := p.source(src)
+	if err != nil {
+		return *file, err
 	}
 
-	// EOF is a safe error, so switch that to nil.
-	if err == io.EOF {
-		err = nil
+	_, err = file.readHeader(src)
+	if err != nil {
+		return *file, err
 	}
 
-	return *file, err
+	if pkt == nil {
+		pkt = new(Packet)
+	}
+
+	layers := new(packetLayers)
+	var data []byte
+
+	// As with Parse, concatenated files are read with their own headers.
+	section := *file
+
+	offset := int64(fileHeaderLength)
+	for index := 0; ; index++ {
+		skipped, err := section.nextPacketHeader(pkt, src)
+		offset += skipped
+		if err == io.EOF {
+			return *file, nil
+		}
+		if err != nil {
+			return *file, &ParseError{Index: index, Offset: offset, Err: err}
+		}
+
+		// Only grow the buffer when a packet doesn't fit, and then only as the data arrives.
+		data, err = readFull(src, data, int(pkt.IncludedLen))
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = InsufficientLength
+		}
+		if err == nil {
+			err = pkt.decode(data, section.order, section.LinkType, layers)
+		}
+		if err != nil {
+			return *file, &ParseError{Index: index, Offset: offset, Err: err}
+		}
+
+		err = fn(pkt)
+		if err != nil {
+			return *file, err
+		}
+		offset += section.packetHeaderSize() + int64(pkt.IncludedLen)
+	}
+}
+
+// ParseHexPacket decodes a single packet from a hex dump, such as one pasted from a log or printed
+// by xxd, tcpdump -X or Wireshark. The dump may be a bare run of hex digits or spread over several
+// lines, and the digits may be grouped in any even number. Offsets at the start of each line, and
+// ASCII columns at the end of each, are skipped. The link type says what the packet starts with,
+// as the LinkType of a file would.
+func ParseHexPacket(hex string, linkType Link) (LinkLayer, error) {
+	data, err := decodeHexDump(hex)
+	if err != nil {
+		return nil, err
+	}
+	return readLinkData(bytes.NewReader(data), networkByteOrder, linkType)
 }
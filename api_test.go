@@ -2,7 +2,14 @@ package gopcap
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -40,8 +47,11 @@ func TestParse(t *testing.T) {
 	if parsed.LinkType != ETHERNET {
 		t.Errorf("Incorrect link type: expected %v, got %v.", ETHERNET, parsed.LinkType)
 	}
-	if len(parsed.Packets) != 2264 {
-		t.Errorf("Unexpected number of packets: expected %v, got %v.", 2264, len(parsed.Packets))
+	if parsed.TimestampResolution != time.Microsecond {
+		t.Errorf("Incorrect timestamp resolution: expected %v, got %v.", time.Microsecond, parsed.TimestampResolution)
+	}
+	if len(parsed.Packets) != 2263 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v.", 2263, len(parsed.Packets))
 	}
 
 	// Check the packet header from the first packet. Including the raw data is a lousy way to test, but
@@ -190,3 +200,720 @@ func TestParse(t *testing.T) {
 		t.Errorf("Unexpected length of transport data: expected %v, got %v", 30, len(segment.TransportData()))
 	}
 }
+
+// Test parsing a capture with the RAW link type, as produced by capturing on a tun device.
+func TestParseRaw(t *testing.T) {
+	data := []byte{
+		// File header: version 2.4, snaplen 65535, link type RAW.
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+		// An IPv4 echo request.
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00,
+		0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+		// An IPv6 UDP datagram.
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x11, 0x01,
+		0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0xdb, 0x3d, 0x07, 0x6c, 0x00, 0x0c, 0x50, 0x26, 0x01, 0x02, 0x03, 0x04,
+	}
+
+	parsed, err := Parse(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Received unexpected error: %v", err)
+	}
+	if parsed.LinkType != RAW {
+		t.Errorf("Incorrect link type: expected %v, got %v.", RAW, parsed.LinkType)
+	}
+	if len(parsed.Packets) != 2 {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v.", 2, len(parsed.Packets))
+	}
+	if _, isICMP := parsed.Packets[0].Data.LinkData().InternetData().(*ICMPSegment); !isICMP {
+		t.Errorf("Unexpected first packet: expected an ICMP segment, got %v", parsed.Packets[0].Data.LinkData().InternetData())
+	}
+	if _, isUDP := parsed.Packets[1].Data.LinkData().InternetData().(*UDPDatagram); !isUDP {
+		t.Errorf("Unexpected second packet: expected a UDP datagram, got %v", parsed.Packets[1].Data.LinkData().InternetData())
+	}
+}
+
+func TestParseKeepsRawBytes(t *testing.T) {
+	data, err := ioutil.ReadFile("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+
+	parsed, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	// Walk the packet headers to find each packet's bytes in the file.
+	offset := 24
+	for i, pkt := range parsed.Packets {
+		if pkt.Data == nil {
+			continue
+		}
+		offset += packetHeaderLength
+		expected := data[offset : offset+int(pkt.IncludedLen)]
+		offset += int(pkt.IncludedLen)
+
+		if !bytes.Equal(pkt.Raw, expected) {
+			t.Fatalf("Unexpected raw bytes for packet %v: expected %x, got %x", i, expected, pkt.Raw)
+		}
+	}
+
+	// Ethernet padding isn't part of any layer, but it's kept in the raw bytes.
+	padded := parsed.Packets[2070]
+	if len(padded.Raw) != 60 || padded.Data.LinkData().(*IPv4Packet).TotalLength != 39 {
+		t.Errorf("Unexpected padded packet: %v raw bytes, %+v", len(padded.Raw), padded.Data.LinkData())
+	}
+
+	// The payloads of the layers refer to the raw bytes rather than to copies of them, and each
+	// packet has raw bytes of its own.
+	for _, i := range []int{0, 2} {
+		pkt := parsed.Packets[i]
+		payload := pkt.Payload()
+		if len(payload) == 0 || &payload[0] != &pkt.Raw[len(pkt.Raw)-len(payload)] {
+			t.Errorf("Payload of packet %v doesn't refer to its raw bytes", i)
+		}
+	}
+	parsed.Packets[0].Raw[0] ^= 0xff
+	if parsed.Packets[1].Raw[0] != data[24+2*packetHeaderLength+int(parsed.Packets[0].IncludedLen)] {
+		t.Errorf("Raw bytes of packet %v changed by a change to packet %v", 1, 0)
+	}
+}
+
+func TestParseGzip(t *testing.T) {
+	data, err := ioutil.ReadFile("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(data)
+	writer.Close()
+
+	parsed, err := Parse(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Errorf("Received unexpected error: %v", err)
+	}
+	if parsed.LinkType != ETHERNET || len(parsed.Packets) != 2263 {
+		t.Errorf("Unexpected file: link type %v with %v packets", parsed.LinkType, len(parsed.Packets))
+	}
+
+	count := 0
+	_, err = ParseInto(bytes.NewReader(compressed.Bytes()), nil, func(pkt *Packet) error {
+		count++
+		return nil
+	})
+	if err != nil || count != 2263 {
+		t.Errorf("Unexpected ParseInto result: %v packets, %v", count, err)
+	}
+
+	// ParseWithBufferSize reads the source as it is.
+	_, err = ParseWithBufferSize(bytes.NewReader(compressed.Bytes()), DefaultBufferSize)
+	if err != NotAPcapFile {
+		t.Errorf("Unexpected error: expected %v, got %v", NotAPcapFile, err)
+	}
+
+	// So does a Parser with decompression disabled, whatever its buffer size.
+	for _, size := range []int{0, -1} {
+		parser := Parser{BufferSize: size, DisableDecompression: true}
+		if _, err = parser.Parse(bytes.NewReader(compressed.Bytes())); err != NotAPcapFile {
+			t.Errorf("Unexpected Parse error: expected %v, got %v", NotAPcapFile, err)
+		}
+		_, err = parser.ParseInto(bytes.NewReader(compressed.Bytes()), nil, func(*Packet) error { return nil })
+		if err != NotAPcapFile {
+			t.Errorf("Unexpected ParseInto error: expected %v, got %v", NotAPcapFile, err)
+		}
+		if _, err = parser.NewReader(bytes.NewReader(compressed.Bytes())); err != NotAPcapFile {
+			t.Errorf("Unexpected NewReader error: expected %v, got %v", NotAPcapFile, err)
+		}
+	}
+
+	// Decompression works without a buffer as well.
+	parsed, err = Parser{BufferSize: -1}.Parse(bytes.NewReader(compressed.Bytes()))
+	if err != nil || len(parsed.Packets) != 2263 {
+		t.Errorf("Unexpected unbuffered result: %v packets, %v", len(parsed.Packets), err)
+	}
+
+	// A gzip header cut short can't be decompressed.
+	_, err = Parse(bytes.NewReader(compressed.Bytes()[:5]))
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+}
+
+func TestParseNanosecondTimestamps(t *testing.T) {
+	// The same raw IPv4 packet, stamped 1.000000123s, in files of each byte order with the
+	// nanosecond magic number.
+	files := map[string][]byte{
+		"little endian": {
+			0x4d, 0x3c, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+			0x01, 0x00, 0x00, 0x00, 0x7b, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00,
+		},
+		"big endian": {
+			0xa1, 0xb2, 0x3c, 0x4d, 0x00, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x00, 0x65,
+			0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x7b, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20,
+		},
+	}
+	packet := []byte{
+		0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00, 0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01,
+		0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+	}
+	expected := time.Second + 123*time.Nanosecond
+
+	for name, header := range files {
+		data := append(append([]byte{}, header...), packet...)
+		parsed, err := Parse(bytes.NewReader(data))
+
+		if err != nil {
+			t.Errorf("Received unexpected error for %v file: %v", name, err)
+		}
+		if parsed.TimestampResolution != time.Nanosecond {
+			t.Errorf("Unexpected resolution for %v file: expected %v, got %v", name, time.Nanosecond, parsed.TimestampResolution)
+		}
+		if parsed.LinkType != RAW || parsed.MajorVersion != 2 || parsed.MinorVersion != 4 {
+			t.Errorf("Unexpected file header for %v file: %+v", name, parsed)
+		}
+		if len(parsed.Packets) < 1 {
+			t.Fatalf("Unexpected number of packets for %v file: expected at least %v, got %v", name, 1, len(parsed.Packets))
+		}
+		if parsed.Packets[0].Timestamp != expected {
+			t.Errorf("Unexpected timestamp for %v file: expected %v, got %v", name, expected, parsed.Packets[0].Timestamp)
+		}
+
+		var timestamp time.Duration
+		_, err = ParseInto(bytes.NewReader(data), nil, func(pkt *Packet) error {
+			timestamp = pkt.Timestamp
+			return nil
+		})
+		if err != nil || timestamp != expected {
+			t.Errorf("Unexpected ParseInto result for %v file: %v, %v", name, timestamp, err)
+		}
+	}
+}
+
+func TestParseHexPacket(t *testing.T) {
+	// An Ethernet frame carrying a UDP datagram with four bytes of data, as Wireshark and xxd would
+	// print it.
+	dumps := map[string]string{
+		"wireshark": `
+0000   ff ff ff ff ff ff 00 11 22 33 44 55 08 00 45 00   ........"3DU..E.
+0010   00 20 00 01 00 00 40 11 00 00 c0 a8 01 02 c0 a8   . ....@.........
+0020   01 01 0f a0 13 88 00 0c 00 00 61 62 63 64         ..........abcd
+`,
+		"xxd": `
+00000000: ffff ffff ffff 0011 2233 4455 0800 4500  ........"3DU..E.
+00000010: 0020 0001 0000 4011 0000 c0a8 0102 c0a8  . ....@.........
+00000020: 0101 0fa0 1388 000c 0000 6162 6364       ..........abcd
+`,
+		"bare": "ffffffffffff00112233445508004500002000010000401100" +
+			"00c0a80102c0a801010fa01388000c000061626364",
+	}
+
+	for name, dump := range dumps {
+		link, err := ParseHexPacket(dump, ETHERNET)
+		if err != nil {
+			t.Errorf("Unexpected error decoding %v dump: %v", name, err)
+			continue
+		}
+
+		frame, isEthernet := link.(*EthernetFrame)
+		if !isEthernet {
+			t.Errorf("Unexpected link layer decoding %v dump: %v", name, link)
+			continue
+		}
+		if frame.Src().String() != "00:11:22:33:44:55" {
+			t.Errorf("Unexpected source decoding %v dump: expected %v, got %v", name, "00:11:22:33:44:55", frame.Src())
+		}
+
+		ip, isIPv4 := frame.LinkData().(*IPv4Packet)
+		if !isIPv4 {
+			t.Errorf("Unexpected internet layer decoding %v dump: %v", name, frame.LinkData())
+			continue
+		}
+		if ip.SourceAddress != [4]byte{192, 168, 1, 2} {
+			t.Errorf("Unexpected source address decoding %v dump: got %v", name, ip.SourceAddress)
+		}
+
+		udp, isUDP := ip.InternetData().(*UDPDatagram)
+		if !isUDP {
+			t.Errorf("Unexpected transport layer decoding %v dump: %v", name, ip.InternetData())
+			continue
+		}
+		if udp.SourcePort != 4000 || udp.DestinationPort != 5000 {
+			t.Errorf("Unexpected ports decoding %v dump: got %v, %v", name, udp.SourcePort, udp.DestinationPort)
+		}
+		if string(udp.TransportData()) != "abcd" {
+			t.Errorf("Unexpected data decoding %v dump: expected %q, got %q", name, "abcd", udp.TransportData())
+		}
+	}
+
+	if _, err := ParseHexPacket("not hex", ETHERNET); err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
+
+// benchmarkParseSkypeIRC parses the packaged capture, reporting the allocations made for each
+// packet as well as for each parse.
+func benchmarkParseSkypeIRC(b *testing.B, size int) {
+	b.ReportAllocs()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	mallocs := stats.Mallocs
+
+	packets := 0
+	for i := 0; i < b.N; i++ {
+		src, err := os.Open("SkypeIRC.cap")
+		if err != nil {
+			b.Fatal("Missing pcap file.")
+		}
+
+		file, err := ParseWithBufferSize(src, size)
+		src.Close()
+		if err != nil {
+			b.Fatalf("Received unexpected error: %v", err)
+		}
+		packets += len(file.Packets)
+	}
+
+	b.StopTimer()
+	runtime.ReadMemStats(&stats)
+	b.ReportMetric(float64(stats.Mallocs-mallocs)/float64(packets), "allocs/packet")
+}
+
+func BenchmarkParseBuffered(b *testing.B) {
+	benchmarkParseSkypeIRC(b, DefaultBufferSize)
+}
+
+func BenchmarkParseUnbuffered(b *testing.B) {
+	benchmarkParseSkypeIRC(b, 0)
+}
+
+func TestParseTruncatedEthernet(t *testing.T) {
+	data := []byte{
+		// File header: version 2.4, snaplen 65535, link type ETHERNET.
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+		// An IPv4 UDP datagram.
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2A, 0x00, 0x00, 0x00, 0x2A, 0x00, 0x00, 0x00,
+		0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDB, 0x08, 0x00,
+		0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+		0x04, 0xD2, 0x16, 0x2E, 0x00, 0x08, 0x00, 0x00,
+		// A frame truncated part way through the source MAC address.
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x00, 0x2A, 0x00, 0x00, 0x00,
+		0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x00, 0x04, 0x76, 0x96,
+		// Another IPv4 UDP datagram.
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2A, 0x00, 0x00, 0x00, 0x2A, 0x00, 0x00, 0x00,
+		0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDB, 0x08, 0x00,
+		0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+		0x04, 0xD2, 0x16, 0x2E, 0x00, 0x08, 0x00, 0x00,
+	}
+
+	parsed, err := Parse(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Received unexpected error: %v", err)
+	}
+	if len(parsed.Packets) != 3 {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v.", 3, len(parsed.Packets))
+	}
+
+	frame := parsed.Packets[1].Data.(*EthernetFrame)
+	if !frame.Truncated {
+		t.Errorf("Truncated frame not flagged as truncated.")
+	}
+	if frame.MACDestination != [6]byte{0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA} {
+		t.Errorf("Unexpected destination MAC: %v", frame.MACDestination)
+	}
+	if frame.LinkData() != nil {
+		t.Errorf("Unexpected link data in truncated frame: %v", frame.LinkData())
+	}
+
+	for _, i := range []int{0, 2} {
+		frame := parsed.Packets[i].Data.(*EthernetFrame)
+		if frame.Truncated {
+			t.Errorf("Packet %v unexpectedly flagged as truncated.", i)
+		}
+		if _, isUDP := frame.LinkData().InternetData().(*UDPDatagram); !isUDP {
+			t.Errorf("Unexpected packet %v: expected a UDP datagram, got %v", i, frame.LinkData().InternetData())
+		}
+	}
+}
+
+func TestParseCorruptLength(t *testing.T) {
+	data := []byte{
+		// File header: version 2.4, snaplen 65535, link type ETHERNET.
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+		// A packet claiming to be 3.5 GiB long, followed by only a few bytes.
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xE0, 0x00, 0x00, 0x00, 0xE0,
+		0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x00, 0x04, 0x76, 0x96,
+	}
+
+	parsers := map[string]func(){
+		"Parse":     func() { Parse(bytes.NewReader(data)) },
+		"ParseInto": func() { ParseInto(bytes.NewReader(data), nil, func(pkt *Packet) error { return nil }) },
+		"ParseEach": func() { ParseEach(bytes.NewReader(data), func(pkt Packet) error { return nil }) },
+	}
+
+	for name, parse := range parsers {
+		if allocated := allocatedBy(parse); allocated > 16<<20 {
+			t.Errorf("%v: unexpected allocation for a corrupt length: %v bytes", name, allocated)
+		}
+	}
+}
+
+// packetSummary describes the decoded fields of a packet, so that packets decoded by Parse and
+// ParseInto can be compared.
+func packetSummary(pkt *Packet) string {
+	summary := fmt.Sprintf("%v %v %v", pkt.Timestamp, pkt.IncludedLen, pkt.ActualLen)
+
+	frame, isEthernet := pkt.Data.(*EthernetFrame)
+	if !isEthernet {
+		return summary + fmt.Sprintf(" %T", pkt.Data)
+	}
+	summary += fmt.Sprintf(" %v %v %v %v %v", frame.MACSource, frame.MACDestination, frame.VLANTags, frame.EtherType, frame.Truncated)
+
+	switch inet := frame.LinkData().(type) {
+	case *IPv4Packet:
+		summary += fmt.Sprintf(" %v %v %v %v %v %v %v", inet.SourceAddress, inet.DestAddress, inet.Protocol, inet.TotalLength, inet.ID, inet.FragmentOffset, inet.Options)
+	case *IPv6Packet:
+		summary += fmt.Sprintf(" %v %v %v %v", inet.SourceAddress, inet.DestinationAddress, inet.NextHeader, inet.Length)
+	default:
+		return summary + fmt.Sprintf(" %T", inet)
+	}
+
+	switch trans := frame.LinkData().InternetData().(type) {
+	case *TCPSegment:
+		summary += fmt.Sprintf(" %v %v %v %v %v %v %v %v %v", trans.SourcePort, trans.DestinationPort, trans.SequenceNumber, trans.AckNumber, trans.SYN, trans.ACK, trans.FIN, trans.OptionData, trans.Options)
+	case *UDPDatagram:
+		summary += fmt.Sprintf(" %v %v %v %+v", trans.SourcePort, trans.DestinationPort, trans.Length, trans.ApplicationData())
+	default:
+		summary += fmt.Sprintf(" %T", trans)
+	}
+
+	return summary + fmt.Sprintf(" %v", frame.LinkData().InternetData().TransportData())
+}
+
+func TestParseInto(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	expected, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	_, err = src.Seek(0, 0)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	pkt := new(Packet)
+	count := 0
+	file, err := ParseInto(src, pkt, func(p *Packet) error {
+		if p != pkt {
+			t.Fatalf("Packet %v not decoded into the given Packet.", count)
+		}
+		if packetSummary(p) != packetSummary(&expected.Packets[count]) {
+			t.Errorf("Unexpected packet %v: expected %v, got %v", count, packetSummary(&expected.Packets[count]), packetSummary(p))
+		}
+		if !bytes.Equal(p.Raw, expected.Packets[count].Raw) {
+			t.Errorf("Unexpected raw bytes for packet %v", count)
+		}
+		count++
+		return nil
+	})
+
+	if err != nil {
+		t.Errorf("Received unexpected error: %v", err)
+	}
+	if file.LinkType != ETHERNET {
+		t.Errorf("Unexpected link type: expected %v, got %v", ETHERNET, file.LinkType)
+	}
+	if count != 2263 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v", 2263, count)
+	}
+}
+
+func TestParseIntoStopsOnError(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	count := 0
+	_, err = ParseInto(src, nil, func(p *Packet) error {
+		count++
+		if count == 10 {
+			return IncorrectPacket
+		}
+		return nil
+	})
+
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+	if count != 10 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v", 10, count)
+	}
+}
+
+// readSizeRecorder records the largest read made from a source.
+type readSizeRecorder struct {
+	src     io.Reader
+	largest int
+}
+
+func (r *readSizeRecorder) Read(p []byte) (int, error) {
+	if len(p) > r.largest {
+		r.largest = len(p)
+	}
+	return r.src.Read(p)
+}
+
+func TestParserBufferSize(t *testing.T) {
+	capture := tcpCapture(200)
+
+	entryPoints := map[string]func(Parser, io.Reader) error{
+		"Parse": func(p Parser, src io.Reader) error {
+			_, err := p.Parse(src)
+			return err
+		},
+		"ParseInto": func(p Parser, src io.Reader) error {
+			_, err := p.ParseInto(src, nil, func(*Packet) error { return nil })
+			return err
+		},
+		"NewReader": func(p Parser, src io.Reader) error {
+			r, err := p.NewReader(src)
+			if err != nil {
+				return err
+			}
+			_, err = r.readAll(context.Background())
+			return err
+		},
+		"ParseEach": func(p Parser, src io.Reader) error {
+			return p.ParseEach(src, func(Packet) error { return nil })
+		},
+		"CountPackets": func(p Parser, src io.Reader) error {
+			_, err := p.CountPackets(src)
+			return err
+		},
+		"ParseContext": func(p Parser, src io.Reader) error {
+			_, err := p.ParseContext(context.Background(), src)
+			return err
+		},
+		"ParseLenient": func(p Parser, src io.Reader) error {
+			_, _, err := p.ParseLenient(src)
+			return err
+		},
+	}
+
+	for name, parse := range entryPoints {
+		for _, size := range []int{0, 4096, -1} {
+			src := &readSizeRecorder{src: bytes.NewReader(capture)}
+			if err := parse(Parser{BufferSize: size}, src); err != nil {
+				t.Errorf("%v with buffer size %v: received unexpected error: %v", name, size, err)
+			}
+
+			switch {
+			case size == 0 && src.largest != DefaultBufferSize:
+				t.Errorf("%v: unexpected largest read: expected %v, got %v", name, DefaultBufferSize, src.largest)
+			case size > 0 && src.largest != size:
+				t.Errorf("%v: unexpected largest read: expected %v, got %v", name, size, src.largest)
+			case size < 0 && src.largest >= 4096:
+				t.Errorf("%v: unexpected largest read reading directly: %v", name, src.largest)
+			}
+		}
+	}
+}
+
+// tcpCapture builds a capture holding count copies of a single Ethernet frame carrying an IPv4
+// TCP segment.
+func tcpCapture(count int) []byte {
+	capture := []byte{
+		// File header: version 2.4, snaplen 65535, link type ETHERNET.
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+	}
+	packet := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x3A, 0x00, 0x00, 0x00, 0x3A, 0x00, 0x00, 0x00,
+		0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDB, 0x08, 0x00,
+		0x45, 0x00, 0x00, 0x2C, 0x00, 0x00, 0x40, 0x00, 0x40, 0x06, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+		0x04, 0xD2, 0x1A, 0x0B, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x50, 0x18, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x02, 0x03, 0x04,
+	}
+
+	for i := 0; i < count; i++ {
+		capture = append(capture, packet...)
+	}
+	return capture
+}
+
+// BenchmarkParseInto decodes a capture of 1000 TCP segments. The few allocations it reports are
+// made once per capture, for the read buffer and the reused layers: decoding the packets
+// themselves allocates nothing.
+func BenchmarkParseInto(b *testing.B) {
+	capture := tcpCapture(1000)
+	pkt := new(Packet)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := ParseInto(bytes.NewReader(capture), pkt, func(*Packet) error { return nil })
+		if err != nil {
+			b.Fatalf("Received unexpected error: %v", err)
+		}
+	}
+}
+
+// BenchmarkParseIntoSkypeIRC decodes the packaged capture for comparison with BenchmarkParseBuffered.
+// Most of its allocations come from decoding the DNS messages in the capture.
+func BenchmarkParseIntoSkypeIRC(b *testing.B) {
+	b.ReportAllocs()
+	pkt := new(Packet)
+	for i := 0; i < b.N; i++ {
+		src, err := os.Open("SkypeIRC.cap")
+		if err != nil {
+			b.Fatal("Missing pcap file.")
+		}
+
+		_, err = ParseInto(src, pkt, func(*Packet) error { return nil })
+		src.Close()
+		if err != nil {
+			b.Fatalf("Received unexpected error: %v", err)
+		}
+	}
+}
+
+func TestPacketTime(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	expected := time.Date(2006, time.August, 25, 19, 31, 6, 654692000, time.UTC)
+	if ts := parsed.Packets[0].Time(); !ts.Equal(expected) || ts.Location() != time.UTC {
+		t.Errorf("Unexpected time: expected %v, got %v", expected, ts)
+	}
+
+	// A capture taken an hour east of UTC records its timestamps an hour ahead.
+	data := []byte{
+		// File header: version 2.4, a correction of 3600 seconds, snaplen 65535, link type RAW.
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x10, 0x0e, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+		// An IPv4 echo request at 7200 seconds local time.
+		0x20, 0x1c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00,
+		0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+	}
+
+	check := func(name string, pkt *Packet) {
+		ts := pkt.Time()
+		if _, offset := ts.Zone(); !ts.Equal(time.Unix(3600, 0)) || offset != 3600 {
+			t.Errorf("Unexpected time from %v: expected %v, got %v", name, time.Unix(3600, 0), ts)
+		}
+	}
+
+	parsed, err = Parse(bytes.NewReader(data))
+	if err != nil || len(parsed.Packets) != 1 {
+		t.Fatalf("Unexpected file: %v packets, %v", len(parsed.Packets), err)
+	}
+	check("Parse", &parsed.Packets[0])
+
+	_, err = ParseInto(bytes.NewReader(data), nil, func(pkt *Packet) error {
+		check("ParseInto", pkt)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Received unexpected error: %v", err)
+	}
+
+	reader, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	pkt, err := reader.Next()
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	check("Reader", pkt)
+}
+
+func TestPacketSince(t *testing.T) {
+	first := Packet{Timestamp: 10 * time.Second}
+	second := Packet{Timestamp: 10*time.Second + 250*time.Millisecond}
+
+	if delta := second.Since(first); delta != 250*time.Millisecond {
+		t.Errorf("Unexpected delta: expected %v, got %v", 250*time.Millisecond, delta)
+	}
+
+	// Out of order, the packet comes before the other.
+	if delta := first.Since(second); delta != -250*time.Millisecond {
+		t.Errorf("Unexpected delta: expected %v, got %v", -250*time.Millisecond, delta)
+	}
+}
+
+func TestPacketLayers(t *testing.T) {
+	pkt := tcpTestPacket(0, [4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, 1234, 80, 1, 0, "PA", []byte("GET /"))
+	if _, isIPv4 := pkt.Network().(*IPv4Packet); !isIPv4 {
+		t.Errorf("Unexpected network layer: %v", pkt.Network())
+	}
+	if segment, isTCP := pkt.Transport().(*TCPSegment); !isTCP || segment.DestinationPort != 80 {
+		t.Errorf("Unexpected transport layer: %v", pkt.Transport())
+	}
+	if string(pkt.Payload()) != "GET /" {
+		t.Errorf("Unexpected payload: expected %q, got %q", "GET /", pkt.Payload())
+	}
+
+	// Each missing layer stops the walk without panicking.
+	missing := map[string]Packet{
+		"no data":         {},
+		"truncated frame": {Data: &EthernetFrame{Truncated: true}},
+		"ARP":             {Data: &EthernetFrame{EtherType: ARP, data: new(ARPPacket)}},
+	}
+	for name, pkt := range missing {
+		if pkt.Transport() != nil || pkt.Payload() != nil {
+			t.Errorf("Unexpected layers for %v: %v, %v", name, pkt.Transport(), pkt.Payload())
+		}
+	}
+	if pkt := missing["truncated frame"]; pkt.Network() != nil {
+		t.Errorf("Unexpected network layer: %v", pkt.Network())
+	}
+}
+
+func TestParseError(t *testing.T) {
+	// Three packets of 74 bytes each, the last cut short.
+	capture := tcpCapture(3)
+	data := capture[:len(capture)-5]
+
+	check := func(name string, err error) {
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("Unexpected error from %v: expected a *ParseError, got %v", name, err)
+		}
+		if parseErr.Index != 2 || parseErr.Offset != 0xac || !errors.Is(err, InsufficientLength) {
+			t.Errorf("Unexpected error from %v: %+v", name, parseErr)
+		}
+		if err.Error() != "Packet 2 at offset 0xac: Insufficient length." {
+			t.Errorf("Unexpected message from %v: %v", name, err)
+		}
+	}
+
+	parsed, err := Parse(bytes.NewReader(data))
+	check("Parse", err)
+	if len(parsed.Packets) != 3 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v", 3, len(parsed.Packets))
+	}
+
+	_, err = ParseInto(bytes.NewReader(data), nil, func(pkt *Packet) error { return nil })
+	check("ParseInto", err)
+
+	err = ParseEach(bytes.NewReader(data), func(pkt Packet) error { return nil })
+	check("ParseEach", err)
+}
@@ -0,0 +1,59 @@
+package gopcap
+
+import (
+	"sync"
+)
+
+// applicationPort identifies the protocol running on a well-known port.
+type applicationPort struct {
+	protocol IPProtocol
+	port     uint16
+}
+
+// applicationParsers holds the parsers for the application protocols decoded automatically from
+// TCP and UDP payloads.
+var (
+	applicationParsers = map[applicationPort]func() ApplicationLayer{
+		{IPP_UDP, DNSPort}: func() ApplicationLayer { return new(DNSMessage) },
+	}
+	applicationParsersLock sync.RWMutex
+)
+
+// RegisterApplicationParser registers a parser for the application protocol running on a TCP or
+// UDP port. Segments to or from that port have their payload decoded while parsing, and the result
+// is available from their ApplicationData method. The factory is called once per segment, and must
+// return a fresh ApplicationLayer. Registering a second factory for the same port replaces the
+// first, including the ones gopcap registers itself. It is safe to call from init(), and
+// concurrently with parsing.
+func RegisterApplicationParser(protocol IPProtocol, port uint16, factory func() ApplicationLayer) {
+	applicationParsersLock.Lock()
+	defer applicationParsersLock.Unlock()
+	applicationParsers[applicationPort{protocol, port}] = factory
+}
+
+// readApplicationLayer decodes the payload of a segment, if a parser is registered for either of
+// its ports. The destination port is checked first, as the source port of a request is usually
+// ephemeral. Payloads that fail to decode are left undecoded, as they're often just another
+// protocol that happens to share the port, or a message split across segments.
+func readApplicationLayer(protocol IPProtocol, srcPort, dstPort uint16, data []byte) ApplicationLayer {
+	if len(data) == 0 {
+		return nil
+	}
+
+	applicationParsersLock.RLock()
+	factory, ok := applicationParsers[applicationPort{protocol, dstPort}]
+	if !ok {
+		factory, ok = applicationParsers[applicationPort{protocol, srcPort}]
+	}
+	applicationParsersLock.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	app := factory()
+	if app.FromBytes(data) != nil {
+		return nil
+	}
+	return app
+}
@@ -0,0 +1,322 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// The well-known TCP port for BGP.
+const BGPPort uint16 = 179
+
+// The bounds on the length of a BGP message, including the 19-byte header.
+const (
+	bgpHeaderLength     = 19
+	bgpMaxMessageLength = 4096
+)
+
+// bgpAttributeExtendedLength is the path attribute flag indicating a two-byte length field.
+const bgpAttributeExtendedLength uint8 = 0x10
+
+//-----------------------------------------------------------------------------
+// BGPMessage
+//-----------------------------------------------------------------------------
+
+// BGPMessage represents a single BGP message. BGP runs over TCP, so messages are not aligned to
+// segments: read them from a reassembled stream (for example, from PcapFile.TCPStream) using
+// ReadFrom or ReadBGPMessages. Exactly one of Open, Update and Notification is set for those
+// message types. KEEPALIVE messages have no body, and the bodies of other types are left in Data.
+type BGPMessage struct {
+	Marker       [16]byte
+	Length       uint16 // The length of the whole message, including the header.
+	Type         BGPMessageType
+	Open         *BGPOpen
+	Update       *BGPUpdate
+	Notification *BGPNotification
+	Data         []byte // The undecoded message body.
+}
+
+// BGPOpen represents the body of a BGP OPEN message.
+type BGPOpen struct {
+	Version            uint8
+	MyAS               uint16
+	HoldTime           uint16
+	Identifier         [4]byte
+	OptionalParameters []BGPOptionalParameter
+}
+
+// BGPOptionalParameter represents a single optional parameter from an OPEN message.
+type BGPOptionalParameter struct {
+	Type uint8
+	Data []byte
+}
+
+// BGPUpdate represents the body of a BGP UPDATE message.
+type BGPUpdate struct {
+	WithdrawnRoutes []BGPPrefix
+	PathAttributes  []BGPPathAttribute
+	NLRI            []BGPPrefix
+}
+
+// BGPPathAttribute represents a single path attribute from an UPDATE message.
+type BGPPathAttribute struct {
+	Flags uint8
+	Type  BGPPathAttributeType
+	Data  []byte
+}
+
+// BGPPrefix represents an IPv4 prefix, as carried in the withdrawn routes and NLRI of an UPDATE.
+type BGPPrefix struct {
+	Length uint8
+	Prefix [4]byte
+}
+
+// BGPNotification represents the body of a BGP NOTIFICATION message.
+type BGPNotification struct {
+	ErrorCode    uint8
+	ErrorSubcode uint8
+	Data         []byte
+}
+
+// ReadFrom reads a single BGP message from the source, leaving it positioned at the start of the
+// next message.
+func (m *BGPMessage) ReadFrom(src io.Reader) error {
+	err := readFields(src, networkByteOrder, []interface{}{
+		&m.Marker,
+		&m.Length,
+		&m.Type,
+	})
+
+	if err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	// The marker is always all ones.
+	for _, b := range m.Marker {
+		if b != 0xFF {
+			return IncorrectPacket
+		}
+	}
+	if m.Length < bgpHeaderLength || m.Length > bgpMaxMessageLength {
+		return IncorrectPacket
+	}
+
+	m.Data = make([]byte, m.Length-bgpHeaderLength)
+	_, err = io.ReadFull(src, m.Data)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	switch m.Type {
+	case BGP_OPEN:
+		m.Open = new(BGPOpen)
+		err = m.Open.readFrom(m.Data)
+	case BGP_UPDATE:
+		m.Update = new(BGPUpdate)
+		err = m.Update.readFrom(m.Data)
+	case BGP_NOTIFICATION:
+		m.Notification = new(BGPNotification)
+		err = m.Notification.readFrom(m.Data)
+	case BGP_KEEPALIVE:
+		if len(m.Data) != 0 {
+			err = IncorrectPacket
+		}
+	}
+
+	return err
+}
+
+// ReadBGPMessages reads every BGP message from one direction of a reassembled TCP stream. If the
+// stream ends part way through a message, the complete messages are returned along with
+// InsufficientLength.
+func ReadBGPMessages(data []byte) ([]BGPMessage, error) {
+	messages := make([]BGPMessage, 0)
+	src := bytes.NewReader(data)
+
+	for src.Len() > 0 {
+		msg := new(BGPMessage)
+		err := msg.ReadFrom(src)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, nil
+}
+
+func (o *BGPOpen) readFrom(data []byte) error {
+	src := bytes.NewReader(data)
+
+	var paramLength uint8
+	err := readFields(src, networkByteOrder, []interface{}{
+		&o.Version,
+		&o.MyAS,
+		&o.HoldTime,
+		&o.Identifier,
+		&paramLength,
+	})
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	params := data[len(data)-src.Len():]
+	if len(params) != int(paramLength) {
+		return IncorrectPacket
+	}
+
+	o.OptionalParameters = make([]BGPOptionalParameter, 0)
+	for len(params) > 0 {
+		if len(params) < 2 || len(params) < int(params[1])+2 {
+			return InsufficientLength
+		}
+
+		length := int(params[1])
+		o.OptionalParameters = append(o.OptionalParameters, BGPOptionalParameter{
+			Type: params[0],
+			Data: params[2 : length+2],
+		})
+		params = params[length+2:]
+	}
+
+	return nil
+}
+
+func (u *BGPUpdate) readFrom(data []byte) error {
+	// Withdrawn routes and path attributes are each preceded by their total length, while the
+	// NLRI takes up whatever is left.
+	if len(data) < 2 {
+		return InsufficientLength
+	}
+	withdrawnLength := int(binary.BigEndian.Uint16(data[0:2]))
+	data = data[2:]
+	if len(data) < withdrawnLength+2 {
+		return InsufficientLength
+	}
+
+	var err error
+	u.WithdrawnRoutes, err = readBGPPrefixes(data[:withdrawnLength])
+	if err != nil {
+		return err
+	}
+	data = data[withdrawnLength:]
+
+	attributesLength := int(binary.BigEndian.Uint16(data[0:2]))
+	data = data[2:]
+	if len(data) < attributesLength {
+		return InsufficientLength
+	}
+
+	u.PathAttributes, err = readBGPPathAttributes(data[:attributesLength])
+	if err != nil {
+		return err
+	}
+
+	u.NLRI, err = readBGPPrefixes(data[attributesLength:])
+	return err
+}
+
+// readBGPPrefixes reads a sequence of length-prefixed IPv4 prefixes. Each prefix only carries as
+// many bytes as its length needs.
+func readBGPPrefixes(data []byte) ([]BGPPrefix, error) {
+	prefixes := make([]BGPPrefix, 0)
+
+	for len(data) > 0 {
+		prefix := BGPPrefix{Length: data[0]}
+		if prefix.Length > 32 {
+			return prefixes, IncorrectPacket
+		}
+
+		size := int(prefix.Length+7) / 8
+		if len(data) < size+1 {
+			return prefixes, InsufficientLength
+		}
+
+		copy(prefix.Prefix[:], data[1:size+1])
+		prefixes = append(prefixes, prefix)
+		data = data[size+1:]
+	}
+
+	return prefixes, nil
+}
+
+func readBGPPathAttributes(data []byte) ([]BGPPathAttribute, error) {
+	attributes := make([]BGPPathAttribute, 0)
+
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return attributes, InsufficientLength
+		}
+
+		attribute := BGPPathAttribute{Flags: data[0], Type: BGPPathAttributeType(data[1])}
+		data = data[2:]
+
+		var length int
+		if attribute.Flags&bgpAttributeExtendedLength != 0 {
+			if len(data) < 2 {
+				return attributes, InsufficientLength
+			}
+			length = int(binary.BigEndian.Uint16(data[0:2]))
+			data = data[2:]
+		} else {
+			length = int(data[0])
+			data = data[1:]
+		}
+
+		if len(data) < length {
+			return attributes, InsufficientLength
+		}
+
+		attribute.Data = data[:length]
+		attributes = append(attributes, attribute)
+		data = data[length:]
+	}
+
+	return attributes, nil
+}
+
+// Attribute returns the first path attribute of the given type, and whether it was present.
+func (u *BGPUpdate) Attribute(t BGPPathAttributeType) (BGPPathAttribute, bool) {
+	for _, attribute := range u.PathAttributes {
+		if attribute.Type == t {
+			return attribute, true
+		}
+	}
+	return BGPPathAttribute{}, false
+}
+
+// NextHop returns the address from the NEXT_HOP attribute.
+func (u *BGPUpdate) NextHop() ([4]byte, error) {
+	var nextHop [4]byte
+
+	attribute, present := u.Attribute(BGP_ATTR_NEXT_HOP)
+	if !present {
+		return nextHop, IncorrectPacket
+	}
+	if len(attribute.Data) != 4 {
+		return nextHop, IncorrectPacket
+	}
+
+	copy(nextHop[:], attribute.Data)
+	return nextHop, nil
+}
+
+func (n *BGPNotification) readFrom(data []byte) error {
+	if len(data) < 2 {
+		return InsufficientLength
+	}
+
+	n.ErrorCode = data[0]
+	n.ErrorSubcode = data[1]
+	n.Data = data[2:]
+	return nil
+}
@@ -0,0 +1,165 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+// bgpTestMessage builds a BGP message of the given type around the body.
+func bgpTestMessage(msgType BGPMessageType, body []byte) []byte {
+	msg := bytes.Repeat([]byte{0xFF}, 16)
+	length := len(body) + 19
+	msg = append(msg, byte(length>>8), byte(length), byte(msgType))
+	return append(msg, body...)
+}
+
+func TestBGPOpenAndKeepalive(t *testing.T) {
+	speaker := [4]byte{192, 168, 0, 1}
+	peer := [4]byte{192, 168, 0, 2}
+
+	// AS 65001, hold time 180, with a single capabilities parameter advertising 4-byte ASNs.
+	open := bgpTestMessage(BGP_OPEN, []byte{
+		0x04, 0xFD, 0xE9, 0x00, 0xB4, 0xC0, 0xA8, 0x00, 0x01, 0x08,
+		0x02, 0x06, 0x41, 0x04, 0x00, 0x00, 0xFD, 0xE9,
+	})
+	keepalive := bgpTestMessage(BGP_KEEPALIVE, nil)
+
+	// The OPEN is split across two segments, and the KEEPALIVE shares the second one.
+	second := append(append([]byte{}, open[20:]...), keepalive...)
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, speaker, peer, 40000, BGPPort, 1000, 0, "S", nil),
+		tcpTestPacket(1, peer, speaker, BGPPort, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, speaker, peer, 40000, BGPPort, 1001, 5001, "A", nil),
+		tcpTestPacket(3, speaker, peer, 40000, BGPPort, 1001, 5001, "PA", open[:20]),
+		tcpTestPacket(4, speaker, peer, 40000, BGPPort, 1021, 5001, "PA", second),
+	}}
+
+	tuple := Tuple{
+		SourceAddress:      mappedIPv4(speaker),
+		DestinationAddress: mappedIPv4(peer),
+		SourcePort:         40000,
+		DestinationPort:    BGPPort,
+		Protocol:           IPP_TCP,
+	}
+	stream, _, err := file.TCPStream(tuple)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	messages, err := ReadBGPMessages(stream)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Unexpected number of messages: expected %v, got %v", 2, len(messages))
+	}
+
+	msg := messages[0]
+	if msg.Type != BGP_OPEN {
+		t.Errorf("Unexpected message type: expected %v, got %v", BGP_OPEN, msg.Type)
+	}
+	if msg.Length != uint16(len(open)) {
+		t.Errorf("Unexpected length: expected %v, got %v", len(open), msg.Length)
+	}
+	if msg.Open == nil {
+		t.Fatalf("Missing OPEN body.")
+	}
+	if msg.Open.Version != uint8(4) {
+		t.Errorf("Unexpected version: expected %v, got %v", 4, msg.Open.Version)
+	}
+	if msg.Open.MyAS != uint16(65001) {
+		t.Errorf("Unexpected AS: expected %v, got %v", 65001, msg.Open.MyAS)
+	}
+	if msg.Open.HoldTime != uint16(180) {
+		t.Errorf("Unexpected hold time: expected %v, got %v", 180, msg.Open.HoldTime)
+	}
+	if msg.Open.Identifier != speaker {
+		t.Errorf("Unexpected identifier: expected %v, got %v", speaker, msg.Open.Identifier)
+	}
+	if len(msg.Open.OptionalParameters) != 1 || msg.Open.OptionalParameters[0].Type != 2 || len(msg.Open.OptionalParameters[0].Data) != 6 {
+		t.Errorf("Unexpected optional parameters: %v", msg.Open.OptionalParameters)
+	}
+
+	msg = messages[1]
+	if msg.Type != BGP_KEEPALIVE {
+		t.Errorf("Unexpected message type: expected %v, got %v", BGP_KEEPALIVE, msg.Type)
+	}
+	if msg.Length != uint16(19) {
+		t.Errorf("Unexpected length: expected %v, got %v", 19, msg.Length)
+	}
+
+	// A stream that ends part way through a message still yields the complete ones.
+	messages, err = ReadBGPMessages(stream[:len(stream)-5])
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(messages) != 1 {
+		t.Errorf("Unexpected number of messages: expected %v, got %v", 1, len(messages))
+	}
+}
+
+func TestBGPUpdate(t *testing.T) {
+	data := bgpTestMessage(BGP_UPDATE, []byte{
+		// Withdraw 10.1.0.0/16.
+		0x00, 0x03, 0x10, 0x0A, 0x01,
+		// ORIGIN IGP, AS_PATH 65001, and NEXT_HOP 192.168.0.1.
+		0x00, 0x13,
+		0x40, 0x01, 0x01, 0x00,
+		0x50, 0x02, 0x00, 0x04, 0x02, 0x01, 0xFD, 0xE9,
+		0x40, 0x03, 0x04, 0xC0, 0xA8, 0x00, 0x01,
+		// Announce 172.16.0.0/12 and 192.0.2.0/24.
+		0x0C, 0xAC, 0x10, 0x18, 0xC0, 0x00, 0x02,
+	})
+	msg := new(BGPMessage)
+	err := msg.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if msg.Update == nil {
+		t.Fatalf("Missing UPDATE body.")
+	}
+
+	withdrawn := []BGPPrefix{{Length: 16, Prefix: [4]byte{10, 1, 0, 0}}}
+	if len(msg.Update.WithdrawnRoutes) != 1 || msg.Update.WithdrawnRoutes[0] != withdrawn[0] {
+		t.Errorf("Unexpected withdrawn routes: expected %v, got %v", withdrawn, msg.Update.WithdrawnRoutes)
+	}
+
+	if len(msg.Update.PathAttributes) != 3 {
+		t.Errorf("Unexpected number of path attributes: expected %v, got %v", 3, len(msg.Update.PathAttributes))
+	}
+	asPath, present := msg.Update.Attribute(BGP_ATTR_AS_PATH)
+	if !present || len(asPath.Data) != 4 {
+		t.Errorf("Unexpected AS_PATH: %v", asPath)
+	}
+	nextHop, err := msg.Update.NextHop()
+	if err != nil || nextHop != [4]byte{192, 168, 0, 1} {
+		t.Errorf("Unexpected next hop: %v %v", nextHop, err)
+	}
+
+	nlri := []BGPPrefix{{Length: 12, Prefix: [4]byte{172, 16, 0, 0}}, {Length: 24, Prefix: [4]byte{192, 0, 2, 0}}}
+	if len(msg.Update.NLRI) != 2 || msg.Update.NLRI[0] != nlri[0] || msg.Update.NLRI[1] != nlri[1] {
+		t.Errorf("Unexpected NLRI: expected %v, got %v", nlri, msg.Update.NLRI)
+	}
+}
+
+func TestBGPNotification(t *testing.T) {
+	// Hold timer expired.
+	data := bgpTestMessage(BGP_NOTIFICATION, []byte{0x04, 0x00})
+	msg := new(BGPMessage)
+	err := msg.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if msg.Notification == nil || msg.Notification.ErrorCode != 4 || msg.Notification.ErrorSubcode != 0 {
+		t.Errorf("Unexpected notification: %v", msg.Notification)
+	}
+
+	// A corrupt marker is rejected.
+	data[0] = 0x00
+	err = new(BGPMessage).ReadFrom(bytes.NewReader(data))
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
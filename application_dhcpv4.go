@@ -0,0 +1,177 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+)
+
+// The well-known UDP ports for DHCPv4 servers and clients.
+const (
+	DHCPv4ServerPort uint16 = 67
+	DHCPv4ClientPort uint16 = 68
+)
+
+// dhcpv4MagicCookie marks the start of the options, following the fixed BOOTP fields.
+var dhcpv4MagicCookie = []byte{0x63, 0x82, 0x53, 0x63}
+
+//-----------------------------------------------------------------------------
+// DHCPv4Message
+//-----------------------------------------------------------------------------
+
+// DHCPv4Message represents a single DHCPv4 message: the fixed BOOTP fields, followed by options.
+// Options are keyed by their code. An option that appears more than once has its data
+// concatenated, as RFC 3396 describes for long options. The helper methods decode the options
+// needed to follow a lease from offer to acknowledgement.
+type DHCPv4Message struct {
+	Op                    uint8 // 1 for a request from a client, 2 for a reply from a server.
+	HardwareType          uint8 // 1 for Ethernet.
+	HardwareLength        uint8
+	Hops                  uint8
+	TransactionID         uint32
+	Seconds               uint16
+	Flags                 uint16
+	ClientAddress         [4]byte // ciaddr: the client's current address, if it has one.
+	YourAddress           [4]byte // yiaddr: the address being assigned to the client.
+	ServerAddress         [4]byte // siaddr: the next server to use while booting.
+	GatewayAddress        [4]byte // giaddr: the relay agent's address.
+	ClientHardwareAddress [16]byte
+	ServerName            string
+	BootFile              string
+	Options               map[DHCPv4OptionCode][]byte
+}
+
+func (m *DHCPv4Message) ReadFrom(src io.Reader) error {
+	var serverName [64]byte
+	var bootFile [128]byte
+	var cookie [4]byte
+
+	err := readFields(src, networkByteOrder, []interface{}{
+		&m.Op,
+		&m.HardwareType,
+		&m.HardwareLength,
+		&m.Hops,
+		&m.TransactionID,
+		&m.Seconds,
+		&m.Flags,
+		&m.ClientAddress,
+		&m.YourAddress,
+		&m.ServerAddress,
+		&m.GatewayAddress,
+		&m.ClientHardwareAddress,
+		&serverName,
+		&bootFile,
+		&cookie,
+	})
+
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(cookie[:], dhcpv4MagicCookie) {
+		return IncorrectPacket
+	}
+	m.ServerName = dhcpv4String(serverName[:])
+	m.BootFile = dhcpv4String(bootFile[:])
+
+	// All that remains is options.
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	m.Options, err = parseDHCPv4Options(data)
+	return err
+}
+
+// dhcpv4String returns the contents of a fixed-length field holding a NUL-terminated string.
+func dhcpv4String(field []byte) string {
+	if end := bytes.IndexByte(field, 0); end >= 0 {
+		field = field[:end]
+	}
+	return string(field)
+}
+
+// parseDHCPv4Options parses the options up to the end option, or the end of the data. Pad options
+// have no length, and are skipped.
+func parseDHCPv4Options(data []byte) (map[DHCPv4OptionCode][]byte, error) {
+	options := make(map[DHCPv4OptionCode][]byte)
+
+	for len(data) > 0 {
+		code := DHCPv4OptionCode(data[0])
+		if code == DHCPV4_OPTION_END {
+			break
+		}
+		if code == DHCPV4_OPTION_PAD {
+			data = data[1:]
+			continue
+		}
+
+		if len(data) < 2 {
+			return options, InsufficientLength
+		}
+		length := int(data[1])
+		if len(data) < length+2 {
+			return options, InsufficientLength
+		}
+
+		options[code] = append(options[code], data[2:length+2]...)
+		data = data[length+2:]
+	}
+
+	return options, nil
+}
+
+// MessageType returns the type of the message, and whether it was present. Plain BOOTP messages
+// don't have one.
+func (m *DHCPv4Message) MessageType() (DHCPv4MessageType, bool) {
+	data := m.Options[DHCPV4_OPTION_MESSAGE_TYPE]
+	if len(data) != 1 {
+		return 0, false
+	}
+	return DHCPv4MessageType(data[0]), true
+}
+
+// HardwareAddress returns the client's hardware address, trimmed to the hardware address length.
+func (m *DHCPv4Message) HardwareAddress() net.HardwareAddr {
+	length := int(m.HardwareLength)
+	if length > len(m.ClientHardwareAddress) {
+		length = len(m.ClientHardwareAddress)
+	}
+	return net.HardwareAddr(append([]byte(nil), m.ClientHardwareAddress[:length]...))
+}
+
+// RequestedIP returns the address the client asked for, and whether it was present.
+func (m *DHCPv4Message) RequestedIP() ([4]byte, bool) {
+	return m.addressOption(DHCPV4_OPTION_REQUESTED_IP)
+}
+
+// ServerID returns the address identifying the server, and whether it was present.
+func (m *DHCPv4Message) ServerID() ([4]byte, bool) {
+	return m.addressOption(DHCPV4_OPTION_SERVER_ID)
+}
+
+// LeaseTime returns the lease time in seconds, and whether it was present.
+func (m *DHCPv4Message) LeaseTime() (uint32, bool) {
+	data := m.Options[DHCPV4_OPTION_LEASE_TIME]
+	if len(data) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(data), true
+}
+
+// addressOption returns the data of an option holding a single IPv4 address.
+func (m *DHCPv4Message) addressOption(code DHCPv4OptionCode) ([4]byte, bool) {
+	var address [4]byte
+	data := m.Options[code]
+	if len(data) != 4 {
+		return address, false
+	}
+	copy(address[:], data)
+	return address, true
+}
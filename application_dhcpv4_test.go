@@ -0,0 +1,102 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+// dhcpv4TestMessage builds a DHCPv4 message from a server with the given options, assigning
+// 192.168.1.100 to 00:04:76:96:7B:DA.
+func dhcpv4TestMessage(options []byte) []byte {
+	data := []byte{
+		0x02, 0x01, 0x06, 0x00, 0xDE, 0xAD, 0xBE, 0xEF, 0x00, 0x00, 0x80, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0xC0, 0xA8, 0x01, 0x64, 0xC0, 0xA8, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	serverName := make([]byte, 64)
+	copy(serverName, "dhcp.local")
+	data = append(data, serverName...)
+	data = append(data, make([]byte, 128)...)
+	data = append(data, 0x63, 0x82, 0x53, 0x63)
+	return append(data, options...)
+}
+
+func TestDHCPv4Ack(t *testing.T) {
+	data := dhcpv4TestMessage([]byte{
+		// Message type: ACK.
+		0x35, 0x01, 0x05,
+		// Server ID.
+		0x36, 0x04, 0xC0, 0xA8, 0x01, 0x01,
+		// Lease time: one day.
+		0x33, 0x04, 0x00, 0x01, 0x51, 0x80,
+		// A pad, then a host name split across two options.
+		0x00, 0x0C, 0x03, 'h', 'o', 's', 0x0C, 0x01, 't',
+		// End, followed by padding.
+		0xFF, 0x00, 0x00,
+	})
+	m := new(DHCPv4Message)
+	err := m.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.Op != uint8(2) || m.HardwareType != uint8(1) || m.HardwareLength != uint8(6) {
+		t.Errorf("Unexpected header: %v %v %v", m.Op, m.HardwareType, m.HardwareLength)
+	}
+	if m.TransactionID != uint32(0xDEADBEEF) {
+		t.Errorf("Unexpected transaction ID: expected %v, got %v", 0xDEADBEEF, m.TransactionID)
+	}
+	if m.Flags != uint16(0x8000) {
+		t.Errorf("Unexpected flags: expected %v, got %v", 0x8000, m.Flags)
+	}
+	if m.YourAddress != [4]byte{192, 168, 1, 100} {
+		t.Errorf("Unexpected assigned address: expected %v, got %v", [4]byte{192, 168, 1, 100}, m.YourAddress)
+	}
+	if m.ServerAddress != [4]byte{192, 168, 1, 1} {
+		t.Errorf("Unexpected server address: expected %v, got %v", [4]byte{192, 168, 1, 1}, m.ServerAddress)
+	}
+	if m.HardwareAddress().String() != "00:04:76:96:7b:da" {
+		t.Errorf("Unexpected hardware address: expected %v, got %v", "00:04:76:96:7b:da", m.HardwareAddress())
+	}
+	if m.ServerName != "dhcp.local" || m.BootFile != "" {
+		t.Errorf("Unexpected server name and boot file: %q %q", m.ServerName, m.BootFile)
+	}
+
+	if len(m.Options) != 4 {
+		t.Errorf("Unexpected number of options: expected %v, got %v", 4, len(m.Options))
+	}
+	if msgType, ok := m.MessageType(); !ok || msgType != DHCPV4_ACK {
+		t.Errorf("Unexpected message type: expected %v, got %v", DHCPV4_ACK, msgType)
+	}
+	if server, ok := m.ServerID(); !ok || server != [4]byte{192, 168, 1, 1} {
+		t.Errorf("Unexpected server ID: expected %v, got %v", [4]byte{192, 168, 1, 1}, server)
+	}
+	if lease, ok := m.LeaseTime(); !ok || lease != uint32(86400) {
+		t.Errorf("Unexpected lease time: expected %v, got %v", 86400, lease)
+	}
+	if _, ok := m.RequestedIP(); ok {
+		t.Errorf("Unexpected requested IP option.")
+	}
+	if string(m.Options[DHCPV4_OPTION_HOSTNAME]) != "host" {
+		t.Errorf("Unexpected host name: expected %v, got %v", "host", string(m.Options[DHCPV4_OPTION_HOSTNAME]))
+	}
+}
+
+func TestDHCPv4BadCookie(t *testing.T) {
+	data := dhcpv4TestMessage(nil)
+	data[len(data)-1] = 0x00
+
+	err := new(DHCPv4Message).ReadFrom(bytes.NewReader(data))
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
+
+func TestDHCPv4TruncatedOption(t *testing.T) {
+	data := dhcpv4TestMessage([]byte{0x35, 0x01, 0x05, 0x33, 0x04, 0x00, 0x01})
+
+	err := new(DHCPv4Message).ReadFrom(bytes.NewReader(data))
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+}
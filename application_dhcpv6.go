@@ -0,0 +1,234 @@
+package gopcap
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// The well-known UDP ports for DHCPv6 clients and servers.
+const (
+	DHCPv6ClientPort uint16 = 546
+	DHCPv6ServerPort uint16 = 547
+)
+
+//-----------------------------------------------------------------------------
+// DHCPv6Message
+//-----------------------------------------------------------------------------
+
+// DHCPv6Message represents a single DHCPv6 message. Client and server messages carry a transaction
+// ID, while relay messages carry a hop count and the link and peer addresses instead. Both are
+// followed by a sequence of options, which are kept in the order they appear. The helper methods
+// decode the common options.
+type DHCPv6Message struct {
+	MessageType   DHCPv6MessageType
+	TransactionID uint32   // Client and server messages only. Only the low 24 bits are used.
+	HopCount      uint8    // Relay messages only.
+	LinkAddress   [16]byte // Relay messages only.
+	PeerAddress   [16]byte // Relay messages only.
+	Options       []DHCPv6Option
+}
+
+// DHCPv6Option represents a single DHCPv6 option.
+type DHCPv6Option struct {
+	Code DHCPv6OptionCode
+	Data []byte
+}
+
+// DHCPv6IA represents an identity association for non-temporary addresses (IA_NA) or for prefix
+// delegation (IA_PD). Both share the same layout.
+type DHCPv6IA struct {
+	IAID    uint32
+	T1      uint32
+	T2      uint32
+	Options []DHCPv6Option
+}
+
+// DHCPv6Prefix represents a prefix delegated in an IA_PD.
+type DHCPv6Prefix struct {
+	PreferredLifetime uint32
+	ValidLifetime     uint32
+	Length            uint8
+	Prefix            [16]byte
+}
+
+func (m *DHCPv6Message) ReadFrom(src io.Reader) error {
+	err := binary.Read(src, networkByteOrder, &m.MessageType)
+	if err != nil {
+		return err
+	}
+
+	if m.MessageType == DHCPV6_RELAY_FORW || m.MessageType == DHCPV6_RELAY_REPL {
+		err = readFields(src, networkByteOrder, []interface{}{
+			&m.HopCount,
+			&m.LinkAddress,
+			&m.PeerAddress,
+		})
+	} else {
+		// The transaction ID is only three bytes long.
+		var transactionID [3]byte
+		err = binary.Read(src, networkByteOrder, &transactionID)
+		m.TransactionID = uint32(transactionID[0])<<16 | uint32(transactionID[1])<<8 | uint32(transactionID[2])
+	}
+
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	// All that remains is options.
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	m.Options, err = parseDHCPv6Options(data)
+	return err
+}
+
+// parseDHCPv6Options parses a sequence of options. Options are also nested inside other options,
+// such as IA_NA, so this works on a buffer rather than a reader.
+func parseDHCPv6Options(data []byte) ([]DHCPv6Option, error) {
+	options := make([]DHCPv6Option, 0)
+
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return options, InsufficientLength
+		}
+
+		code := DHCPv6OptionCode(binary.BigEndian.Uint16(data[0:2]))
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if len(data) < length+4 {
+			return options, InsufficientLength
+		}
+
+		options = append(options, DHCPv6Option{Code: code, Data: data[4 : length+4]})
+		data = data[length+4:]
+	}
+
+	return options, nil
+}
+
+// Option returns the data of the first option with the given code, and whether it was present.
+func (m *DHCPv6Message) Option(code DHCPv6OptionCode) ([]byte, bool) {
+	for _, option := range m.Options {
+		if option.Code == code {
+			return option.Data, true
+		}
+	}
+	return nil, false
+}
+
+// ClientID returns the client's DUID, or nil if it isn't present.
+func (m *DHCPv6Message) ClientID() []byte {
+	data, _ := m.Option(DHCPV6_OPTION_CLIENTID)
+	return data
+}
+
+// ServerID returns the server's DUID, or nil if it isn't present.
+func (m *DHCPv6Message) ServerID() []byte {
+	data, _ := m.Option(DHCPV6_OPTION_SERVERID)
+	return data
+}
+
+// IANA returns every identity association for non-temporary addresses in the message.
+func (m *DHCPv6Message) IANA() ([]DHCPv6IA, error) {
+	return m.identityAssociations(DHCPV6_OPTION_IA_NA)
+}
+
+// IAPD returns every identity association for prefix delegation in the message.
+func (m *DHCPv6Message) IAPD() ([]DHCPv6IA, error) {
+	return m.identityAssociations(DHCPV6_OPTION_IA_PD)
+}
+
+func (m *DHCPv6Message) identityAssociations(code DHCPv6OptionCode) ([]DHCPv6IA, error) {
+	associations := make([]DHCPv6IA, 0)
+
+	for _, option := range m.Options {
+		if option.Code != code {
+			continue
+		}
+		if len(option.Data) < 12 {
+			return associations, InsufficientLength
+		}
+
+		options, err := parseDHCPv6Options(option.Data[12:])
+		if err != nil {
+			return associations, err
+		}
+
+		associations = append(associations, DHCPv6IA{
+			IAID:    binary.BigEndian.Uint32(option.Data[0:4]),
+			T1:      binary.BigEndian.Uint32(option.Data[4:8]),
+			T2:      binary.BigEndian.Uint32(option.Data[8:12]),
+			Options: options,
+		})
+	}
+
+	return associations, nil
+}
+
+// StatusCode returns the status code and message from the message's status code option. A message
+// without one is successful.
+func (m *DHCPv6Message) StatusCode() (uint16, string, error) {
+	data, present := m.Option(DHCPV6_OPTION_STATUS_CODE)
+	if !present {
+		return 0, "", nil
+	}
+	if len(data) < 2 {
+		return 0, "", InsufficientLength
+	}
+
+	return binary.BigEndian.Uint16(data[0:2]), string(data[2:]), nil
+}
+
+// DNSServers returns the addresses from the DNS recursive name server option.
+func (m *DHCPv6Message) DNSServers() ([][16]byte, error) {
+	data, _ := m.Option(DHCPV6_OPTION_DNS_SERVERS)
+	if len(data)%16 != 0 {
+		return nil, IncorrectPacket
+	}
+
+	servers := make([][16]byte, len(data)/16)
+	for i := range servers {
+		copy(servers[i][:], data[i*16:])
+	}
+
+	return servers, nil
+}
+
+// Addresses returns the addresses assigned in an IA_NA.
+func (ia *DHCPv6IA) Addresses() [][16]byte {
+	addresses := make([][16]byte, 0)
+
+	for _, option := range ia.Options {
+		if option.Code == DHCPV6_OPTION_IAADDR && len(option.Data) >= 16 {
+			var address [16]byte
+			copy(address[:], option.Data)
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// Prefixes returns the prefixes delegated in an IA_PD.
+func (ia *DHCPv6IA) Prefixes() []DHCPv6Prefix {
+	prefixes := make([]DHCPv6Prefix, 0)
+
+	for _, option := range ia.Options {
+		if option.Code == DHCPV6_OPTION_IAPREFIX && len(option.Data) >= 25 {
+			prefix := DHCPv6Prefix{
+				PreferredLifetime: binary.BigEndian.Uint32(option.Data[0:4]),
+				ValidLifetime:     binary.BigEndian.Uint32(option.Data[4:8]),
+				Length:            option.Data[8],
+			}
+			copy(prefix.Prefix[:], option.Data[9:25])
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes
+}
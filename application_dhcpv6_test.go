@@ -0,0 +1,107 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDHCPv6Solicit(t *testing.T) {
+	data := []byte{
+		// Solicit, transaction ID 0x123456.
+		0x01, 0x12, 0x34, 0x56,
+		// Client ID: a DUID-LL for an Ethernet address.
+		0x00, 0x01, 0x00, 0x0A, 0x00, 0x03, 0x00, 0x01, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA,
+		// Option request: DNS servers and domain list.
+		0x00, 0x06, 0x00, 0x04, 0x00, 0x17, 0x00, 0x18,
+		// Elapsed time.
+		0x00, 0x08, 0x00, 0x02, 0x00, 0x00,
+		// IA_NA with IAID 1, and a hint for an address.
+		0x00, 0x03, 0x00, 0x28, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x00, 0x15, 0x18,
+		0x00, 0x05, 0x00, 0x18, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	expectedClientID := []byte{0x00, 0x03, 0x00, 0x01, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA}
+	expectedAddress := [16]byte{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+	m := new(DHCPv6Message)
+	err := m.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if m.MessageType != DHCPV6_SOLICIT {
+		t.Errorf("Unexpected message type: expected %v, got %v", DHCPV6_SOLICIT, m.MessageType)
+	}
+	if m.TransactionID != uint32(0x123456) {
+		t.Errorf("Unexpected transaction ID: expected %v, got %v", 0x123456, m.TransactionID)
+	}
+	if len(m.Options) != 4 {
+		t.Errorf("Unexpected number of options: expected %v, got %v", 4, len(m.Options))
+	}
+	if !bytes.Equal(m.ClientID(), expectedClientID) {
+		t.Errorf("Unexpected client ID: expected %v, got %v", expectedClientID, m.ClientID())
+	}
+	if m.ServerID() != nil {
+		t.Errorf("Unexpected server ID: %v", m.ServerID())
+	}
+
+	ias, err := m.IANA()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(ias) != 1 {
+		t.Fatalf("Unexpected number of IA_NAs: expected %v, got %v", 1, len(ias))
+	}
+	if ias[0].IAID != uint32(1) || ias[0].T1 != uint32(3600) || ias[0].T2 != uint32(5400) {
+		t.Errorf("Unexpected IA_NA: %v", ias[0])
+	}
+	addresses := ias[0].Addresses()
+	if len(addresses) != 1 || addresses[0] != expectedAddress {
+		t.Errorf("Unexpected IA_NA addresses: expected %v, got %v", expectedAddress, addresses)
+	}
+
+	code, message, err := m.StatusCode()
+	if code != 0 || message != "" || err != nil {
+		t.Errorf("Unexpected status code: %v %v %v", code, message, err)
+	}
+}
+
+func TestDHCPv6Reply(t *testing.T) {
+	data := []byte{
+		// Reply, transaction ID 0x123456.
+		0x07, 0x12, 0x34, 0x56,
+		// Status code: NoAddrsAvail.
+		0x00, 0x0D, 0x00, 0x06, 0x00, 0x02, 0x6E, 0x6F, 0x6E, 0x65,
+		// DNS servers.
+		0x00, 0x17, 0x00, 0x10, 0x20, 0x01, 0x48, 0x60, 0x48, 0x60, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x88, 0x88,
+		// IA_PD delegating 2001:db8:1::/48.
+		0x00, 0x19, 0x00, 0x29, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x1A, 0x00, 0x19, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x00, 0x1C, 0x20, 0x30, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	expectedPrefix := [16]byte{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01}
+	m := new(DHCPv6Message)
+	err := m.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	code, message, err := m.StatusCode()
+	if code != 2 || message != "none" || err != nil {
+		t.Errorf("Unexpected status code: %v %v %v", code, message, err)
+	}
+
+	servers, err := m.DNSServers()
+	if err != nil || len(servers) != 1 || servers[0][15] != 0x88 {
+		t.Errorf("Unexpected DNS servers: %v %v", servers, err)
+	}
+
+	pds, err := m.IAPD()
+	if err != nil || len(pds) != 1 {
+		t.Fatalf("Unexpected IA_PDs: %v %v", pds, err)
+	}
+	prefixes := pds[0].Prefixes()
+	if len(prefixes) != 1 || prefixes[0].Length != 48 || prefixes[0].Prefix != expectedPrefix {
+		t.Errorf("Unexpected prefixes: %v", prefixes)
+	}
+}
@@ -0,0 +1,213 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// The well-known port for Diameter, over both SCTP and TCP.
+const DiameterPort uint16 = 3868
+
+// The lengths of the fixed Diameter headers.
+const (
+	diameterHeaderLength          = 20
+	diameterAVPHeaderLength       = 8
+	diameterAVPVendorHeaderLength = 12
+)
+
+// The bits of the Diameter command flags.
+const (
+	diameterFlagRequest       uint8 = 0x80
+	diameterFlagProxiable     uint8 = 0x40
+	diameterFlagError         uint8 = 0x20
+	diameterFlagRetransmitted uint8 = 0x10
+)
+
+// The bits of the Diameter AVP flags.
+const (
+	diameterAVPFlagVendor    uint8 = 0x80
+	diameterAVPFlagMandatory uint8 = 0x40
+)
+
+//-----------------------------------------------------------------------------
+// DiameterMessage
+//-----------------------------------------------------------------------------
+
+// DiameterMessage represents a single Diameter request or answer. Over SCTP each DATA chunk
+// carries a whole message, so messages can be read from the data reassembled by SCTPReassembler.
+// Over TCP messages are not aligned to segments: read them from a reassembled stream (for example,
+// from PcapFile.TCPStream) using ReadFrom or ReadDiameterMessages.
+type DiameterMessage struct {
+	Version       uint8
+	Length        uint32 // The length of the whole message, including the header.
+	CommandFlags  uint8
+	CommandCode   DiameterCommandCode
+	ApplicationID uint32
+	HopByHopID    uint32
+	EndToEndID    uint32
+	AVPs          []DiameterAVP
+}
+
+// DiameterAVP represents a single attribute-value pair. The data is left uninterpreted, as its
+// type depends on the AVP code. Grouped AVPs hold further AVPs, which Grouped decodes.
+type DiameterAVP struct {
+	Code     DiameterAVPCode
+	Flags    uint8
+	Length   uint32 // The length of the AVP, including its header but not its padding.
+	VendorID uint32 // Only present if the vendor flag is set.
+	Data     []byte
+}
+
+// ReadFrom reads a single Diameter message from the source, leaving it positioned at the start of
+// the next message.
+func (m *DiameterMessage) ReadFrom(src io.Reader) error {
+	var header [diameterHeaderLength]byte
+	_, err := io.ReadFull(src, header[:])
+	if err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	m.Version = header[0]
+	m.Length = uint32(header[1])<<16 | uint32(header[2])<<8 | uint32(header[3])
+	m.CommandFlags = header[4]
+	m.CommandCode = DiameterCommandCode(uint32(header[5])<<16 | uint32(header[6])<<8 | uint32(header[7]))
+	m.ApplicationID = binary.BigEndian.Uint32(header[8:12])
+	m.HopByHopID = binary.BigEndian.Uint32(header[12:16])
+	m.EndToEndID = binary.BigEndian.Uint32(header[16:20])
+
+	if m.Version != 1 || m.Length < diameterHeaderLength {
+		return IncorrectPacket
+	}
+
+	// The length is 24 bits from the wire, so the buffer is grown only as the data arrives.
+	data, err := readFull(src, nil, int(m.Length)-diameterHeaderLength)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	m.AVPs, err = parseDiameterAVPs(data)
+	return err
+}
+
+// ReadDiameterMessages reads every Diameter message from one direction of a reassembled TCP
+// stream. If the stream ends part way through a message, the complete messages are returned along
+// with InsufficientLength.
+func ReadDiameterMessages(data []byte) ([]DiameterMessage, error) {
+	messages := make([]DiameterMessage, 0)
+	src := bytes.NewReader(data)
+
+	for src.Len() > 0 {
+		msg := new(DiameterMessage)
+		err := msg.ReadFrom(src)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, nil
+}
+
+// parseDiameterAVPs parses a sequence of AVPs. AVPs are also nested inside grouped AVPs, so this
+// works on a buffer rather than a reader. Each AVP is padded to a multiple of four bytes, although
+// the padding isn't included in its length.
+func parseDiameterAVPs(data []byte) ([]DiameterAVP, error) {
+	avps := make([]DiameterAVP, 0)
+
+	for len(data) > 0 {
+		if len(data) < diameterAVPHeaderLength {
+			return avps, InsufficientLength
+		}
+
+		avp := DiameterAVP{
+			Code:   DiameterAVPCode(binary.BigEndian.Uint32(data[0:4])),
+			Flags:  data[4],
+			Length: uint32(data[5])<<16 | uint32(data[6])<<8 | uint32(data[7]),
+		}
+
+		headerLength := diameterAVPHeaderLength
+		if avp.HasVendorID() {
+			headerLength = diameterAVPVendorHeaderLength
+		}
+		if avp.Length < uint32(headerLength) {
+			return avps, IncorrectPacket
+		}
+		if uint32(len(data)) < avp.Length {
+			return avps, InsufficientLength
+		}
+
+		if avp.HasVendorID() {
+			avp.VendorID = binary.BigEndian.Uint32(data[8:12])
+		}
+		avp.Data = data[headerLength:avp.Length]
+		avps = append(avps, avp)
+
+		end := int(avp.Length) + (4-int(avp.Length)%4)%4
+		if end > len(data) {
+			end = len(data)
+		}
+		data = data[end:]
+	}
+
+	return avps, nil
+}
+
+// IsRequest returns whether the message is a request, rather than an answer.
+func (m *DiameterMessage) IsRequest() bool {
+	return m.CommandFlags&diameterFlagRequest != 0
+}
+
+// IsProxiable returns whether the message may be proxied, relayed or redirected.
+func (m *DiameterMessage) IsProxiable() bool {
+	return m.CommandFlags&diameterFlagProxiable != 0
+}
+
+// IsError returns whether the message is an answer reporting a protocol error.
+func (m *DiameterMessage) IsError() bool {
+	return m.CommandFlags&diameterFlagError != 0
+}
+
+// IsRetransmitted returns whether the message is a request that may have been sent before.
+func (m *DiameterMessage) IsRetransmitted() bool {
+	return m.CommandFlags&diameterFlagRetransmitted != 0
+}
+
+// AVP returns the first top-level AVP with the given code, and whether it was present.
+func (m *DiameterMessage) AVP(code DiameterAVPCode) (*DiameterAVP, bool) {
+	for i := range m.AVPs {
+		if m.AVPs[i].Code == code {
+			return &m.AVPs[i], true
+		}
+	}
+	return nil, false
+}
+
+// HasVendorID returns whether the AVP has a vendor ID, making its code specific to that vendor.
+func (a *DiameterAVP) HasVendorID() bool {
+	return a.Flags&diameterAVPFlagVendor != 0
+}
+
+// IsMandatory returns whether the receiver must support the AVP.
+func (a *DiameterAVP) IsMandatory() bool {
+	return a.Flags&diameterAVPFlagMandatory != 0
+}
+
+// Grouped decodes the data of a grouped AVP into the AVPs it holds.
+func (a *DiameterAVP) Grouped() ([]DiameterAVP, error) {
+	return parseDiameterAVPs(a.Data)
+}
+
+// Uint32 decodes the data of an Unsigned32 or Enumerated AVP.
+func (a *DiameterAVP) Uint32() (uint32, error) {
+	if len(a.Data) != 4 {
+		return 0, IncorrectPacket
+	}
+	return binary.BigEndian.Uint32(a.Data), nil
+}
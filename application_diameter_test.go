@@ -0,0 +1,167 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+// diameterTestAVP builds an AVP without a vendor ID, padded to a multiple of four bytes.
+func diameterTestAVP(code DiameterAVPCode, flags uint8, data []byte) []byte {
+	length := 8 + len(data)
+	avp := []byte{
+		byte(code >> 24), byte(code >> 16), byte(code >> 8), byte(code),
+		flags, byte(length >> 16), byte(length >> 8), byte(length),
+	}
+	avp = append(avp, data...)
+	return append(avp, make([]byte, (4-length%4)%4)...)
+}
+
+// diameterTestMessage builds a Diameter message around the AVPs.
+func diameterTestMessage(flags uint8, code DiameterCommandCode, avps ...[]byte) []byte {
+	body := bytes.Join(avps, nil)
+	length := 20 + len(body)
+	msg := []byte{
+		0x01, byte(length >> 16), byte(length >> 8), byte(length),
+		flags, byte(code >> 16), byte(code >> 8), byte(code),
+		0x00, 0x00, 0x00, 0x00, // Application ID: common messages.
+		0x11, 0x22, 0x33, 0x44, // Hop-by-hop ID.
+		0x55, 0x66, 0x77, 0x88, // End-to-end ID.
+	}
+	return append(msg, body...)
+}
+
+func TestDiameterCapabilitiesExchangeRequest(t *testing.T) {
+	cer := diameterTestMessage(0x80, DIAMETER_CAPABILITIES_EXCHANGE,
+		diameterTestAVP(DIAMETER_AVP_ORIGIN_HOST, 0x40, []byte("client.example.com")),
+		diameterTestAVP(DIAMETER_AVP_ORIGIN_REALM, 0x40, []byte("example.com")),
+		diameterTestAVP(DIAMETER_AVP_VENDOR_ID, 0x40, []byte{0x00, 0x00, 0x28, 0xAF}),
+		diameterTestAVP(DIAMETER_AVP_PRODUCT_NAME, 0x00, []byte("gopcap")),
+		diameterTestAVP(DIAMETER_AVP_VENDOR_SPECIFIC_APPLICATION_ID, 0x40, bytes.Join([][]byte{
+			diameterTestAVP(DIAMETER_AVP_VENDOR_ID, 0x40, []byte{0x00, 0x00, 0x28, 0xAF}),
+			diameterTestAVP(DIAMETER_AVP_AUTH_APPLICATION_ID, 0x40, []byte{0x01, 0x00, 0x00, 0x23}),
+		}, nil)),
+	)
+
+	msg := new(DiameterMessage)
+	err := msg.ReadFrom(bytes.NewReader(cer))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if msg.Version != 1 {
+		t.Errorf("Unexpected version: expected %v, got %v", 1, msg.Version)
+	}
+	if msg.Length != uint32(len(cer)) {
+		t.Errorf("Unexpected length: expected %v, got %v", len(cer), msg.Length)
+	}
+	if msg.CommandCode != DIAMETER_CAPABILITIES_EXCHANGE {
+		t.Errorf("Unexpected command code: expected %v, got %v", DIAMETER_CAPABILITIES_EXCHANGE, msg.CommandCode)
+	}
+	if !msg.IsRequest() || msg.IsProxiable() || msg.IsError() || msg.IsRetransmitted() {
+		t.Errorf("Unexpected command flags: %#x", msg.CommandFlags)
+	}
+	if msg.HopByHopID != 0x11223344 {
+		t.Errorf("Unexpected hop-by-hop ID: expected %#x, got %#x", 0x11223344, msg.HopByHopID)
+	}
+	if msg.EndToEndID != 0x55667788 {
+		t.Errorf("Unexpected end-to-end ID: expected %#x, got %#x", 0x55667788, msg.EndToEndID)
+	}
+	if len(msg.AVPs) != 5 {
+		t.Fatalf("Unexpected number of AVPs: expected %v, got %v", 5, len(msg.AVPs))
+	}
+
+	host, ok := msg.AVP(DIAMETER_AVP_ORIGIN_HOST)
+	if !ok || string(host.Data) != "client.example.com" {
+		t.Errorf("Unexpected Origin-Host: %v", host)
+	}
+	if !host.IsMandatory() || host.HasVendorID() {
+		t.Errorf("Unexpected Origin-Host flags: %#x", host.Flags)
+	}
+	product, ok := msg.AVP(DIAMETER_AVP_PRODUCT_NAME)
+	if !ok || string(product.Data) != "gopcap" || product.IsMandatory() {
+		t.Errorf("Unexpected Product-Name: %v", product)
+	}
+
+	app, ok := msg.AVP(DIAMETER_AVP_VENDOR_SPECIFIC_APPLICATION_ID)
+	if !ok {
+		t.Fatalf("Missing Vendor-Specific-Application-Id")
+	}
+	grouped, err := app.Grouped()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(grouped) != 2 {
+		t.Fatalf("Unexpected number of grouped AVPs: expected %v, got %v", 2, len(grouped))
+	}
+	vendor, err := grouped[0].Uint32()
+	if err != nil || vendor != 10415 {
+		t.Errorf("Unexpected Vendor-Id: expected %v, got %v (%v)", 10415, vendor, err)
+	}
+	appID, err := grouped[1].Uint32()
+	if err != nil || appID != 0x01000023 {
+		t.Errorf("Unexpected Auth-Application-Id: expected %v, got %v (%v)", 0x01000023, appID, err)
+	}
+}
+
+func TestDiameterVendorAVP(t *testing.T) {
+	// A vendor-specific AVP carries the vendor ID after its length, and is counted in it.
+	avp := []byte{
+		0x00, 0x00, 0x02, 0xBC, 0xC0, 0x00, 0x00, 0x0E,
+		0x00, 0x00, 0x28, 0xAF, 0xAB, 0xCD, 0x00, 0x00,
+	}
+	avps, err := parseDiameterAVPs(avp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(avps) != 1 {
+		t.Fatalf("Unexpected number of AVPs: expected %v, got %v", 1, len(avps))
+	}
+	if !avps[0].HasVendorID() || avps[0].VendorID != 10415 {
+		t.Errorf("Unexpected vendor ID: expected %v, got %v", 10415, avps[0].VendorID)
+	}
+	if !bytes.Equal(avps[0].Data, []byte{0xAB, 0xCD}) {
+		t.Errorf("Unexpected data: expected %v, got %v", []byte{0xAB, 0xCD}, avps[0].Data)
+	}
+}
+
+func TestReadDiameterMessages(t *testing.T) {
+	dwr := diameterTestMessage(0x80, DIAMETER_DEVICE_WATCHDOG,
+		diameterTestAVP(DIAMETER_AVP_ORIGIN_HOST, 0x40, []byte("peer")))
+	dwa := diameterTestMessage(0x00, DIAMETER_DEVICE_WATCHDOG,
+		diameterTestAVP(DIAMETER_AVP_RESULT_CODE, 0x40, []byte{0x00, 0x00, 0x07, 0xD1}))
+	stream := append(append(append([]byte{}, dwr...), dwa...), dwr[:10]...)
+
+	messages, err := ReadDiameterMessages(stream)
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Unexpected number of messages: expected %v, got %v", 2, len(messages))
+	}
+	if messages[1].IsRequest() {
+		t.Errorf("Unexpected request flag on answer")
+	}
+	result, ok := messages[1].AVP(DIAMETER_AVP_RESULT_CODE)
+	if !ok {
+		t.Fatalf("Missing Result-Code")
+	}
+	if code, _ := result.Uint32(); code != 2001 {
+		t.Errorf("Unexpected result code: expected %v, got %v", 2001, code)
+	}
+}
+
+func TestDiameterCorruptLength(t *testing.T) {
+	// A message claiming to be almost 16 MiB long, followed by only its header.
+	msg := diameterTestMessage(0x80, DIAMETER_DEVICE_WATCHDOG)
+	msg[1], msg[2], msg[3] = 0xFF, 0xFF, 0xFF
+
+	var err error
+	allocated := allocatedBy(func() { err = new(DiameterMessage).ReadFrom(bytes.NewReader(msg)) })
+
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if allocated > 1<<20 {
+		t.Errorf("Unexpected allocation for a corrupt length: %v bytes", allocated)
+	}
+}
@@ -0,0 +1,294 @@
+package gopcap
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+)
+
+// The well-known port for DNS, over both UDP and TCP.
+const DNSPort uint16 = 53
+
+// The bits of the DNS header flags field.
+const (
+	dnsFlagResponse           uint16 = 0x8000
+	dnsFlagAuthoritative      uint16 = 0x0400
+	dnsFlagTruncated          uint16 = 0x0200
+	dnsFlagRecursionDesired   uint16 = 0x0100
+	dnsFlagRecursionAvailable uint16 = 0x0080
+)
+
+// dnsHeaderLength is the length of the fixed DNS header.
+const dnsHeaderLength = 12
+
+// dnsRecordHeaderLength is the length of the fields following a resource record's name.
+const dnsRecordHeaderLength = 10
+
+//-----------------------------------------------------------------------------
+// DNSMessage
+//-----------------------------------------------------------------------------
+
+// DNSMessage represents a single DNS query or response. It implements ApplicationLayer, and is
+// decoded automatically from UDP datagrams to or from DNSPort. Over TCP each message is preceded
+// by its length, and messages aren't aligned to segments, so read them from a reassembled stream
+// using ReadDNSMessages.
+type DNSMessage struct {
+	ID          uint16
+	Flags       uint16
+	QDCount     uint16
+	ANCount     uint16
+	NSCount     uint16
+	ARCount     uint16
+	Questions   []DNSQuestion
+	Answers     []DNSResourceRecord
+	Authorities []DNSResourceRecord
+	Additionals []DNSResourceRecord
+}
+
+// DNSQuestion represents a single entry in the question section of a DNS message.
+type DNSQuestion struct {
+	Name  string // The name, without a trailing dot. The root is "".
+	Type  DNSType
+	Class DNSClass
+}
+
+// DNSResourceRecord represents a single resource record from the answer, authority or additional
+// section of a DNS message. The record data is kept uninterpreted in Data. For the common types
+// it's also decoded: the address of A and AAAA records into IP, and the name in NS, CNAME, PTR and
+// MX records into Host, with any compression pointers followed.
+type DNSResourceRecord struct {
+	Name       string // The name, without a trailing dot. The root is "".
+	Type       DNSType
+	Class      DNSClass // For OPT records, the sender's UDP payload size.
+	TTL        uint32   // For OPT records, the extended response code and flags.
+	Data       []byte
+	IP         net.IP // A and AAAA records only.
+	Host       string // NS, CNAME, PTR and MX records only.
+	Preference uint16 // MX records only.
+}
+
+func (m *DNSMessage) FromBytes(data []byte) error {
+	if len(data) < dnsHeaderLength {
+		return InsufficientLength
+	}
+
+	m.ID = binary.BigEndian.Uint16(data[0:2])
+	m.Flags = binary.BigEndian.Uint16(data[2:4])
+	m.QDCount = binary.BigEndian.Uint16(data[4:6])
+	m.ANCount = binary.BigEndian.Uint16(data[6:8])
+	m.NSCount = binary.BigEndian.Uint16(data[8:10])
+	m.ARCount = binary.BigEndian.Uint16(data[10:12])
+
+	offset := dnsHeaderLength
+	m.Questions = make([]DNSQuestion, 0, m.QDCount)
+	for i := 0; i < int(m.QDCount); i++ {
+		name, next, err := readDNSName(data, offset)
+		if err != nil {
+			return err
+		}
+		if len(data) < next+4 {
+			return InsufficientLength
+		}
+
+		m.Questions = append(m.Questions, DNSQuestion{
+			Name:  name,
+			Type:  DNSType(binary.BigEndian.Uint16(data[next : next+2])),
+			Class: DNSClass(binary.BigEndian.Uint16(data[next+2 : next+4])),
+		})
+		offset = next + 4
+	}
+
+	var err error
+	m.Answers, offset, err = readDNSRecords(data, offset, m.ANCount)
+	if err != nil {
+		return err
+	}
+	m.Authorities, offset, err = readDNSRecords(data, offset, m.NSCount)
+	if err != nil {
+		return err
+	}
+	m.Additionals, _, err = readDNSRecords(data, offset, m.ARCount)
+	return err
+}
+
+// ReadDNSMessages reads every DNS message from one direction of a reassembled TCP stream, where each
+// message is preceded by its two-byte length. If the stream ends part way through a message, the
+// complete messages are returned along with InsufficientLength.
+func ReadDNSMessages(data []byte) ([]DNSMessage, error) {
+	messages := make([]DNSMessage, 0)
+
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return messages, InsufficientLength
+		}
+		length := int(binary.BigEndian.Uint16(data[0:2]))
+		if len(data) < 2+length {
+			return messages, InsufficientLength
+		}
+
+		msg := new(DNSMessage)
+		err := msg.FromBytes(data[2 : 2+length])
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, *msg)
+		data = data[2+length:]
+	}
+
+	return messages, nil
+}
+
+// readDNSRecords reads count resource records starting at the offset into the message. It returns
+// the records and the offset of the first byte after them.
+func readDNSRecords(data []byte, offset int, count uint16) ([]DNSResourceRecord, int, error) {
+	records := make([]DNSResourceRecord, 0)
+
+	for i := 0; i < int(count); i++ {
+		name, next, err := readDNSName(data, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(data) < next+dnsRecordHeaderLength {
+			return nil, 0, InsufficientLength
+		}
+
+		record := DNSResourceRecord{
+			Name:  name,
+			Type:  DNSType(binary.BigEndian.Uint16(data[next : next+2])),
+			Class: DNSClass(binary.BigEndian.Uint16(data[next+2 : next+4])),
+			TTL:   binary.BigEndian.Uint32(data[next+4 : next+8]),
+		}
+
+		start := next + dnsRecordHeaderLength
+		end := start + int(binary.BigEndian.Uint16(data[next+8:next+10]))
+		if len(data) < end {
+			return nil, 0, InsufficientLength
+		}
+		record.Data = append([]byte(nil), data[start:end]...)
+
+		err = record.decodeData(data, start)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		records = append(records, record)
+		offset = end
+	}
+
+	return records, offset, nil
+}
+
+// decodeData decodes the record data of the common record types. Names in the record data may be
+// compressed, so they're read from the whole message, starting at the offset of the data.
+func (r *DNSResourceRecord) decodeData(data []byte, offset int) error {
+	var err error
+
+	switch r.Type {
+	case DNS_TYPE_A:
+		if len(r.Data) != net.IPv4len {
+			return IncorrectPacket
+		}
+		r.IP = net.IP(r.Data)
+	case DNS_TYPE_AAAA:
+		if len(r.Data) != net.IPv6len {
+			return IncorrectPacket
+		}
+		r.IP = net.IP(r.Data)
+	case DNS_TYPE_NS, DNS_TYPE_CNAME, DNS_TYPE_PTR:
+		r.Host, _, err = readDNSName(data, offset)
+	case DNS_TYPE_MX:
+		if len(r.Data) < 2 {
+			return IncorrectPacket
+		}
+		r.Preference = binary.BigEndian.Uint16(r.Data[0:2])
+		r.Host, _, err = readDNSName(data, offset+2)
+	}
+
+	return err
+}
+
+// readDNSName reads the domain name starting at the offset into the message, following any
+// compression pointers. It returns the name and the offset of the first byte after it. Pointers
+// always refer to a name earlier in the message, so a pointer that doesn't point before the labels
+// being read would loop forever, and is rejected.
+func readDNSName(data []byte, offset int) (string, int, error) {
+	labels := make([]string, 0)
+	start, next := offset, -1
+
+	for {
+		if offset >= len(data) {
+			return "", 0, InsufficientLength
+		}
+		length := int(data[offset])
+
+		// The top two bits mark a pointer to the rest of the name elsewhere in the message.
+		if length&0xC0 == 0xC0 {
+			if offset+1 >= len(data) {
+				return "", 0, InsufficientLength
+			}
+			pointer := int(binary.BigEndian.Uint16(data[offset:offset+2]) & 0x3FFF)
+			if pointer >= start {
+				return "", 0, IncorrectPacket
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			start, offset = pointer, pointer
+			continue
+		}
+		if length&0xC0 != 0 {
+			return "", 0, IncorrectPacket
+		}
+
+		offset++
+		if length == 0 {
+			break
+		}
+		if offset+length > len(data) {
+			return "", 0, InsufficientLength
+		}
+
+		labels = append(labels, string(data[offset:offset+length]))
+		offset += length
+	}
+
+	if next < 0 {
+		next = offset
+	}
+	return strings.Join(labels, "."), next, nil
+}
+
+// IsResponse returns whether the message is a response, rather than a query.
+func (m *DNSMessage) IsResponse() bool {
+	return m.Flags&dnsFlagResponse != 0
+}
+
+// Opcode returns the kind of query: 0 for a standard query.
+func (m *DNSMessage) Opcode() uint8 {
+	return uint8(m.Flags>>11) & 0x0F
+}
+
+// IsAuthoritative returns whether the responding server is an authority for the name.
+func (m *DNSMessage) IsAuthoritative() bool {
+	return m.Flags&dnsFlagAuthoritative != 0
+}
+
+// IsTruncated returns whether the message was truncated to fit the transport.
+func (m *DNSMessage) IsTruncated() bool {
+	return m.Flags&dnsFlagTruncated != 0
+}
+
+// RecursionDesired returns whether the query asked for recursive resolution.
+func (m *DNSMessage) RecursionDesired() bool {
+	return m.Flags&dnsFlagRecursionDesired != 0
+}
+
+// RecursionAvailable returns whether the responding server supports recursion.
+func (m *DNSMessage) RecursionAvailable() bool {
+	return m.Flags&dnsFlagRecursionAvailable != 0
+}
+
+// Rcode returns the response code: 0 for no error, 3 for a name that doesn't exist.
+func (m *DNSMessage) Rcode() uint8 {
+	return uint8(m.Flags) & 0x0F
+}
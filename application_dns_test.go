@@ -0,0 +1,132 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDNSQueryOverUDP(t *testing.T) {
+	// A UDP datagram carrying a PTR query for 2.1.168.192.in-addr.arpa.
+	data := []byte{
+		0x08, 0x50, 0x00, 0x35, 0x00, 0x32, 0x83, 0x97, 0x31, 0x1f, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x32, 0x01, 0x31,
+		0x03, 0x31, 0x36, 0x38, 0x03, 0x31, 0x39, 0x32, 0x07, 0x69, 0x6e, 0x2d, 0x61, 0x64, 0x64, 0x72, 0x04, 0x61, 0x72, 0x70, 0x61, 0x00, 0x00, 0x0c,
+		0x00, 0x01,
+	}
+	dgram := new(UDPDatagram)
+	err := dgram.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	m, isDNS := dgram.ApplicationData().(*DNSMessage)
+	if !isDNS {
+		t.Fatalf("Unexpected application layer: expected a DNS message, got %T", dgram.ApplicationData())
+	}
+	if m.ID != uint16(0x311f) {
+		t.Errorf("Unexpected ID: expected %v, got %v", 0x311f, m.ID)
+	}
+	if m.IsResponse() || m.Opcode() != 0 || !m.RecursionDesired() {
+		t.Errorf("Unexpected flags: %#04x", m.Flags)
+	}
+	if m.QDCount != 1 || m.ANCount != 0 || m.NSCount != 0 || m.ARCount != 0 {
+		t.Errorf("Unexpected counts: %v %v %v %v", m.QDCount, m.ANCount, m.NSCount, m.ARCount)
+	}
+
+	expected := DNSQuestion{Name: "2.1.168.192.in-addr.arpa", Type: DNS_TYPE_PTR, Class: DNS_CLASS_IN}
+	if len(m.Questions) != 1 || m.Questions[0] != expected {
+		t.Errorf("Unexpected questions: expected %v, got %v", expected, m.Questions)
+	}
+}
+
+func TestDNSNamePointerLoop(t *testing.T) {
+	// A question whose name is a pointer to itself.
+	data := []byte{0x00, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x0C, 0x00, 0x01, 0x00, 0x01}
+	err := new(DNSMessage).FromBytes(data)
+
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
+
+// dnsPTRResponse is a response to the PTR query in TestDNSQueryOverUDP. The answer's name is a
+// pointer to the question, and the additional A record's name is a pointer into the answer.
+var dnsPTRResponse = []byte{
+	0x31, 0x1f, 0x81, 0x80, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	// Question: 2.1.168.192.in-addr.arpa PTR IN.
+	0x01, 0x32, 0x01, 0x31, 0x03, 0x31, 0x36, 0x38, 0x03, 0x31, 0x39, 0x32, 0x07, 0x69, 0x6e, 0x2d, 0x61, 0x64, 0x64, 0x72,
+	0x04, 0x61, 0x72, 0x70, 0x61, 0x00, 0x00, 0x0c, 0x00, 0x01,
+	// Answer: PTR router.local, TTL 3600.
+	0xC0, 0x0C, 0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x0E,
+	0x06, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x72, 0x05, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x00,
+	// Additional: router.local A 192.168.1.2, TTL 3600.
+	0xC0, 0x36, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0E, 0x10, 0x00, 0x04, 0xC0, 0xA8, 0x01, 0x02,
+}
+
+func TestDNSResponseRecords(t *testing.T) {
+	m := new(DNSMessage)
+	err := m.FromBytes(dnsPTRResponse)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !m.IsResponse() || !m.RecursionAvailable() || m.Rcode() != 0 {
+		t.Errorf("Unexpected flags: %#04x", m.Flags)
+	}
+	if len(m.Answers) != 1 || len(m.Authorities) != 0 || len(m.Additionals) != 1 {
+		t.Fatalf("Unexpected records: %v %v %v", m.Answers, m.Authorities, m.Additionals)
+	}
+
+	answer := m.Answers[0]
+	if answer.Name != "2.1.168.192.in-addr.arpa" {
+		t.Errorf("Unexpected answer name: expected %v, got %v", "2.1.168.192.in-addr.arpa", answer.Name)
+	}
+	if answer.Type != DNS_TYPE_PTR || answer.Class != DNS_CLASS_IN || answer.TTL != 3600 {
+		t.Errorf("Unexpected answer: %v", answer)
+	}
+	if answer.Host != "router.local" {
+		t.Errorf("Unexpected answer host: expected %v, got %v", "router.local", answer.Host)
+	}
+	if len(answer.Data) != 14 {
+		t.Errorf("Unexpected answer data length: expected %v, got %v", 14, len(answer.Data))
+	}
+
+	additional := m.Additionals[0]
+	if additional.Name != "router.local" || additional.Type != DNS_TYPE_A {
+		t.Errorf("Unexpected additional record: %v", additional)
+	}
+	if additional.IP.String() != "192.168.1.2" {
+		t.Errorf("Unexpected address: expected %v, got %v", "192.168.1.2", additional.IP)
+	}
+}
+
+func TestDNSTruncatedRecord(t *testing.T) {
+	err := new(DNSMessage).FromBytes(dnsPTRResponse[:len(dnsPTRResponse)-2])
+
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+}
+
+func TestReadDNSMessages(t *testing.T) {
+	// Two length-prefixed responses, followed by the start of a third.
+	stream := []byte{0x00, byte(len(dnsPTRResponse))}
+	stream = append(stream, dnsPTRResponse...)
+	stream = append(stream, 0x00, byte(len(dnsPTRResponse)))
+	stream = append(stream, dnsPTRResponse...)
+	stream = append(stream, 0x00, byte(len(dnsPTRResponse)), 0x31, 0x1f)
+
+	messages, err := ReadDNSMessages(stream)
+
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Unexpected number of messages: expected %v, got %v", 2, len(messages))
+	}
+	for i, m := range messages {
+		if m.ID != 0x311f || len(m.Answers) != 1 || m.Answers[0].Host != "router.local" {
+			t.Errorf("Unexpected message %v: %v", i, m)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package gopcap
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// The parsers in this file handle the text message format that HTTP introduced, and that other
+// protocols such as SIP and SSDP reuse: a start line, then "Name: value" header lines, then a
+// blank line and an optional body.
+
+// httpStartLine holds the parts of a request line or a status line.
+type httpStartLine struct {
+	Method     string // Requests only.
+	RequestURI string // Requests only.
+	StatusCode int    // Responses only.
+	Reason     string // Responses only.
+	Version    string
+}
+
+// splitHTTPMessage splits a message into its start line, its header lines and its body. Header
+// lines starting with whitespace continue the previous header, and are joined onto it.
+func splitHTTPMessage(data []byte) (string, []string, []byte) {
+	// Split the headers from the body at the first blank line.
+	head, body := data, []byte(nil)
+	if end := bytes.Index(data, []byte("\r\n\r\n")); end >= 0 {
+		head, body = data[:end], data[end+4:]
+	} else if end := bytes.Index(data, []byte("\n\n")); end >= 0 {
+		head, body = data[:end], data[end+2:]
+	}
+
+	lines := strings.Split(strings.Replace(string(head), "\r\n", "\n", -1), "\n")
+
+	headers := make([]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		headers = append(headers, line)
+	}
+
+	return lines[0], headers, body
+}
+
+// parseHTTPHeader splits a header line into its lower-case name and its value.
+func parseHTTPHeader(line string) (string, string, error) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return "", "", IncorrectPacket
+	}
+
+	return strings.ToLower(strings.TrimSpace(line[:colon])), strings.TrimSpace(line[colon+1:]), nil
+}
+
+// parseHTTPStartLine parses a request line or status line. The version must start with the given
+// protocol prefix, such as "HTTP/" or "SIP/".
+func parseHTTPStartLine(line string, protocol string) (httpStartLine, error) {
+	var start httpStartLine
+
+	parts := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(parts) < 3 {
+		return start, IncorrectPacket
+	}
+
+	// Responses start with the version, requests end with it.
+	if strings.HasPrefix(parts[0], protocol) {
+		code, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return start, IncorrectPacket
+		}
+		start.Version = parts[0]
+		start.StatusCode = code
+		start.Reason = parts[2]
+		return start, nil
+	}
+
+	if !strings.HasPrefix(parts[2], protocol) {
+		return start, IncorrectPacket
+	}
+	start.Method = parts[0]
+	start.RequestURI = parts[1]
+	start.Version = parts[2]
+	return start, nil
+}
@@ -0,0 +1,154 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// The well-known TCP port for Kafka.
+const KafkaPort uint16 = 9092
+
+// The lengths of the fixed parts of the Kafka headers, following the length prefix. A request
+// header is followed by the client ID.
+const (
+	kafkaRequestHeaderLength  = 8
+	kafkaResponseHeaderLength = 4
+)
+
+//-----------------------------------------------------------------------------
+// KafkaMessage
+//-----------------------------------------------------------------------------
+
+// KafkaMessage represents a single Kafka request or response. Kafka runs over TCP, so messages are
+// not aligned to segments: read them from a reassembled stream (for example, from
+// PcapFile.TCPStream) using ReadKafkaRequests on the client's side and ReadKafkaResponses on the
+// server's. A response doesn't say what it's responding to, other than by its correlation ID, so
+// its API key and version are taken from the matching request. The body is left undecoded in Data,
+// along with the tagged fields that end the headers of newer API versions.
+type KafkaMessage struct {
+	Length        int32 // The length of the message, not including the length itself.
+	IsRequest     bool
+	APIKey        KafkaAPIKey
+	APIVersion    int16
+	CorrelationID int32
+	ClientID      string // Requests only. A null client ID is "".
+	Data          []byte
+}
+
+// ReadRequestFrom reads a single Kafka request from the source, leaving it positioned at the start
+// of the next request.
+func (m *KafkaMessage) ReadRequestFrom(src io.Reader) error {
+	data, err := m.readFrame(src, kafkaRequestHeaderLength)
+	if err != nil {
+		return err
+	}
+
+	m.IsRequest = true
+	m.APIKey = KafkaAPIKey(binary.BigEndian.Uint16(data[0:2]))
+	m.APIVersion = int16(binary.BigEndian.Uint16(data[2:4]))
+	m.CorrelationID = int32(binary.BigEndian.Uint32(data[4:8]))
+	data = data[kafkaRequestHeaderLength:]
+
+	// The client ID is a nullable string, with a length of -1 for null.
+	if len(data) < 2 {
+		return InsufficientLength
+	}
+	length := int16(binary.BigEndian.Uint16(data[0:2]))
+	data = data[2:]
+	if length > 0 {
+		if len(data) < int(length) {
+			return InsufficientLength
+		}
+		m.ClientID = string(data[:length])
+		data = data[length:]
+	}
+
+	m.Data = data
+	return nil
+}
+
+// ReadResponseFrom reads a single Kafka response from the source, leaving it positioned at the
+// start of the next response.
+func (m *KafkaMessage) ReadResponseFrom(src io.Reader) error {
+	data, err := m.readFrame(src, kafkaResponseHeaderLength)
+	if err != nil {
+		return err
+	}
+
+	m.CorrelationID = int32(binary.BigEndian.Uint32(data[0:4]))
+	m.Data = data[kafkaResponseHeaderLength:]
+	return nil
+}
+
+// readFrame reads the length prefix and the message following it, which must be at least as long
+// as the fixed part of its header.
+func (m *KafkaMessage) readFrame(src io.Reader, headerLength int) ([]byte, error) {
+	err := readFields(src, networkByteOrder, []interface{}{
+		&m.Length,
+	})
+	if err == io.ErrUnexpectedEOF {
+		return nil, InsufficientLength
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Length < int32(headerLength) {
+		return nil, IncorrectPacket
+	}
+
+	// The length comes from the packet, so the buffer only grows as far as the data that's there.
+	data, err := readFull(src, nil, int(m.Length))
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return nil, InsufficientLength
+	}
+	return data, err
+}
+
+// ReadKafkaRequests reads every Kafka request from the client's side of a reassembled TCP stream.
+// If the stream ends part way through a request, the complete requests are returned along with
+// InsufficientLength.
+func ReadKafkaRequests(data []byte) ([]KafkaMessage, error) {
+	requests := make([]KafkaMessage, 0)
+	src := bytes.NewReader(data)
+
+	for src.Len() > 0 {
+		msg := new(KafkaMessage)
+		err := msg.ReadRequestFrom(src)
+		if err != nil {
+			return requests, err
+		}
+		requests = append(requests, *msg)
+	}
+
+	return requests, nil
+}
+
+// ReadKafkaResponses reads every Kafka response from the server's side of a reassembled TCP
+// stream. Each response is given the API key and version of the request with the same correlation
+// ID, if there is one. If the stream ends part way through a response, the complete responses are
+// returned along with InsufficientLength.
+func ReadKafkaResponses(data []byte, requests []KafkaMessage) ([]KafkaMessage, error) {
+	responses := make([]KafkaMessage, 0)
+	src := bytes.NewReader(data)
+
+	for src.Len() > 0 {
+		msg := new(KafkaMessage)
+		err := msg.ReadResponseFrom(src)
+		if err != nil {
+			return responses, err
+		}
+
+		for _, request := range requests {
+			if request.CorrelationID == msg.CorrelationID {
+				msg.APIKey = request.APIKey
+				msg.APIVersion = request.APIVersion
+				break
+			}
+		}
+		responses = append(responses, *msg)
+	}
+
+	return responses, nil
+}
@@ -0,0 +1,131 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+// kafkaTestFrame prefixes the message with its length.
+func kafkaTestFrame(msg []byte) []byte {
+	length := len(msg)
+	return append([]byte{byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)}, msg...)
+}
+
+func TestKafkaMetadataRequest(t *testing.T) {
+	client := [4]byte{192, 168, 0, 1}
+	broker := [4]byte{192, 168, 0, 2}
+
+	// A version 1 Metadata request, with correlation ID 7 and client ID "producer-1", for the
+	// single topic "events". The response carries no brokers or topics.
+	body := []byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 'e', 'v', 'e', 'n', 't', 's'}
+	request := kafkaTestFrame(append([]byte{
+		0x00, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x07,
+		0x00, 0x0A, 'p', 'r', 'o', 'd', 'u', 'c', 'e', 'r', '-', '1',
+	}, body...))
+	response := kafkaTestFrame([]byte{
+		0x00, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00,
+	})
+
+	// The request is split across two segments.
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, broker, 40000, KafkaPort, 1000, 0, "S", nil),
+		tcpTestPacket(1, broker, client, KafkaPort, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, client, broker, 40000, KafkaPort, 1001, 5001, "A", nil),
+		tcpTestPacket(3, client, broker, 40000, KafkaPort, 1001, 5001, "PA", request[:10]),
+		tcpTestPacket(4, client, broker, 40000, KafkaPort, 1011, 5001, "PA", request[10:]),
+		tcpTestPacket(5, broker, client, KafkaPort, 40000, 5001, uint32(1001+len(request)), "PA", response),
+	}}
+
+	tuple := Tuple{
+		SourceAddress:      mappedIPv4(client),
+		DestinationAddress: mappedIPv4(broker),
+		SourcePort:         40000,
+		DestinationPort:    KafkaPort,
+		Protocol:           IPP_TCP,
+	}
+	clientToBroker, brokerToClient, err := file.TCPStream(tuple)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	requests, err := ReadKafkaRequests(clientToBroker)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Unexpected number of requests: expected %v, got %v", 1, len(requests))
+	}
+
+	msg := requests[0]
+	if !msg.IsRequest {
+		t.Errorf("Expected request to be a request and it wasn't.")
+	}
+	if msg.Length != int32(len(request)-4) {
+		t.Errorf("Unexpected length: expected %v, got %v", len(request)-4, msg.Length)
+	}
+	if msg.APIKey != KAFKA_METADATA {
+		t.Errorf("Unexpected API key: expected %v, got %v", KAFKA_METADATA, msg.APIKey)
+	}
+	if msg.APIVersion != 1 {
+		t.Errorf("Unexpected API version: expected %v, got %v", 1, msg.APIVersion)
+	}
+	if msg.CorrelationID != 7 {
+		t.Errorf("Unexpected correlation ID: expected %v, got %v", 7, msg.CorrelationID)
+	}
+	if msg.ClientID != "producer-1" {
+		t.Errorf("Unexpected client ID: expected %q, got %q", "producer-1", msg.ClientID)
+	}
+	if !bytes.Equal(msg.Data, body) {
+		t.Errorf("Unexpected data: expected %v, got %v", body, msg.Data)
+	}
+
+	responses, err := ReadKafkaResponses(brokerToClient, requests)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(responses) != 1 {
+		t.Fatalf("Unexpected number of responses: expected %v, got %v", 1, len(responses))
+	}
+	if responses[0].IsRequest || responses[0].CorrelationID != 7 {
+		t.Errorf("Unexpected response: %+v", responses[0])
+	}
+	if responses[0].APIKey != KAFKA_METADATA || responses[0].APIVersion != 1 {
+		t.Errorf("Unexpected response API: expected %v version %v, got %v version %v", KAFKA_METADATA, 1, responses[0].APIKey, responses[0].APIVersion)
+	}
+}
+
+func TestKafkaTruncatedRequest(t *testing.T) {
+	// A null client ID, followed by the start of a second request.
+	request := kafkaTestFrame([]byte{0x00, 0x12, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xFF, 0xFF})
+	stream := append(append([]byte{}, request...), request[:6]...)
+
+	requests, err := ReadKafkaRequests(stream)
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Unexpected number of requests: expected %v, got %v", 1, len(requests))
+	}
+	if requests[0].APIKey != KAFKA_API_VERSIONS || requests[0].ClientID != "" {
+		t.Errorf("Unexpected request: %+v", requests[0])
+	}
+}
+
+func TestKafkaCorruptLength(t *testing.T) {
+	// A request claiming to be 2 GiB long, followed by only its header.
+	stream := []byte{0x7F, 0xFF, 0xFF, 0xFF, 0x00, 0x12, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xFF, 0xFF}
+
+	var requests []KafkaMessage
+	var err error
+	allocated := allocatedBy(func() { requests, err = ReadKafkaRequests(stream) })
+
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(requests) != 0 {
+		t.Errorf("Unexpected number of requests: expected %v, got %v", 0, len(requests))
+	}
+	if allocated > 16<<20 {
+		t.Errorf("Unexpected allocation for a corrupt length: %v bytes", allocated)
+	}
+}
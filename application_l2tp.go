@@ -0,0 +1,136 @@
+package gopcap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// The well-known UDP port for L2TP.
+const L2TPPort uint16 = 1701
+
+// The bits of the L2TP flags and version field.
+const (
+	l2tpFlagType     uint16 = 0x8000
+	l2tpFlagLength   uint16 = 0x4000
+	l2tpFlagSequence uint16 = 0x0800
+	l2tpFlagOffset   uint16 = 0x0200
+	l2tpFlagPriority uint16 = 0x0100
+	l2tpVersionMask  uint16 = 0x000F
+)
+
+//-----------------------------------------------------------------------------
+// L2TPPacket
+//-----------------------------------------------------------------------------
+
+// L2TPPacket represents a single L2TPv2 packet. The length, sequence numbers and offset are all
+// optional, and are only meaningful if the matching flag is set. Control messages keep their
+// attribute-value pairs uninterpreted in Data, while data messages have their PPP payload decoded
+// into PPP.
+type L2TPPacket struct {
+	Flags      uint16 // The raw flags and version field.
+	Version    uint8
+	Length     uint16
+	TunnelID   uint16
+	SessionID  uint16
+	Ns         uint16
+	Nr         uint16
+	OffsetSize uint16
+	Data       []byte
+	PPP        *PPPFrame
+}
+
+// IsControl returns whether this is a control message, rather than a data message.
+func (l *L2TPPacket) IsControl() bool {
+	return l.Flags&l2tpFlagType != 0
+}
+
+// HasLength returns whether the Length field is present.
+func (l *L2TPPacket) HasLength() bool {
+	return l.Flags&l2tpFlagLength != 0
+}
+
+// HasSequence returns whether the Ns and Nr fields are present.
+func (l *L2TPPacket) HasSequence() bool {
+	return l.Flags&l2tpFlagSequence != 0
+}
+
+// IsPriority returns whether a data message asked for priority treatment.
+func (l *L2TPPacket) IsPriority() bool {
+	return l.Flags&l2tpFlagPriority != 0
+}
+
+func (l *L2TPPacket) ReadFrom(src io.Reader) error {
+	err := readFields(src, networkByteOrder, []interface{}{&l.Flags})
+	if err != nil {
+		return shortReadError(err)
+	}
+
+	l.Version = uint8(l.Flags & l2tpVersionMask)
+	if l.Version != 2 {
+		return IncorrectPacket
+	}
+
+	fields := make([]interface{}, 0, 6)
+	if l.HasLength() {
+		fields = append(fields, &l.Length)
+	}
+	fields = append(fields, &l.TunnelID, &l.SessionID)
+	if l.HasSequence() {
+		fields = append(fields, &l.Ns, &l.Nr)
+	}
+	if l.Flags&l2tpFlagOffset != 0 {
+		fields = append(fields, &l.OffsetSize)
+	}
+
+	err = readFields(src, networkByteOrder, fields)
+	if err != nil {
+		return shortReadError(err)
+	}
+
+	// Skip the offset padding.
+	if l.OffsetSize > 0 {
+		_, err = io.ReadFull(src, make([]byte, l.OffsetSize))
+		if err != nil {
+			return shortReadError(err)
+		}
+	}
+
+	l.Data, err = ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	// If the length is present it covers the whole packet, and anything beyond it is padding.
+	if l.HasLength() {
+		headerLength := 2 * (len(fields) + 1)
+		bodyLength := int(l.Length) - headerLength - int(l.OffsetSize)
+		if bodyLength < 0 {
+			return IncorrectPacket
+		}
+		if bodyLength > len(l.Data) {
+			return InsufficientLength
+		}
+		l.Data = l.Data[:bodyLength]
+	}
+
+	if l.IsControl() {
+		return nil
+	}
+
+	l.PPP = new(PPPFrame)
+	return l.PPP.ReadFrom(bytes.NewReader(l.Data))
+}
+
+// L2TP decodes the datagram's payload as L2TP, if either port is L2TPPort. Datagrams on other ports
+// return IncorrectPacket, so L2TP running on a non-standard port has to be decoded directly with
+// L2TPPacket.ReadFrom.
+func (u *UDPDatagram) L2TP() (*L2TPPacket, error) {
+	if u.SourcePort != L2TPPort && u.DestinationPort != L2TPPort {
+		return nil, IncorrectPacket
+	}
+
+	pkt := new(L2TPPacket)
+	err := pkt.ReadFrom(bytes.NewReader(u.data))
+	return pkt, err
+}
@@ -0,0 +1,93 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestL2TPData(t *testing.T) {
+	data := []byte{
+		// UDP header, from and to the L2TP port.
+		0x06, 0xA5, 0x06, 0xA5, 0x00, 0x30, 0x00, 0x00,
+		// L2TP data message with a length, tunnel ID 1 and session ID 2.
+		0x40, 0x02, 0x00, 0x28, 0x00, 0x01, 0x00, 0x02,
+		// PPP carrying IPv4.
+		0xFF, 0x03, 0x00, 0x21,
+		0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+		0x04, 0xD2, 0x16, 0x2E, 0x00, 0x08, 0x00, 0x00,
+	}
+	udp := new(UDPDatagram)
+	err := udp.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pkt, err := udp.L2TP()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if pkt.IsControl() {
+		t.Errorf("Data message decoded as a control message.")
+	}
+	if pkt.Version != uint8(2) {
+		t.Errorf("Unexpected version: expected %v, got %v", 2, pkt.Version)
+	}
+	if !pkt.HasLength() || pkt.Length != uint16(40) {
+		t.Errorf("Unexpected length: expected %v, got %v", 40, pkt.Length)
+	}
+	if pkt.HasSequence() {
+		t.Errorf("Unexpected sequence numbers.")
+	}
+	if pkt.TunnelID != uint16(1) {
+		t.Errorf("Unexpected tunnel ID: expected %v, got %v", 1, pkt.TunnelID)
+	}
+	if pkt.SessionID != uint16(2) {
+		t.Errorf("Unexpected session ID: expected %v, got %v", 2, pkt.SessionID)
+	}
+	if pkt.PPP == nil {
+		t.Fatalf("Missing PPP frame.")
+	}
+	if pkt.PPP.Address != uint8(0xFF) || pkt.PPP.Control != uint8(0x03) {
+		t.Errorf("Unexpected PPP address and control: %v %v", pkt.PPP.Address, pkt.PPP.Control)
+	}
+	if pkt.PPP.Protocol != PPP_PROTOCOL_IPV4 {
+		t.Errorf("Unexpected PPP protocol: expected %v, got %v", PPP_PROTOCOL_IPV4, pkt.PPP.Protocol)
+	}
+
+	ip, ok := pkt.PPP.LinkData().(*IPv4Packet)
+	if !ok {
+		t.Fatalf("Unexpected internet layer: %T", pkt.PPP.LinkData())
+	}
+	if ip.DestAddress != [4]byte{10, 0, 0, 2} {
+		t.Errorf("Unexpected inner destination: %v", ip.DestAddress)
+	}
+	if inner, ok := ip.InternetData().(*UDPDatagram); !ok || inner.DestinationPort != uint16(5678) {
+		t.Errorf("Unexpected inner transport layer: %v", ip.InternetData())
+	}
+}
+
+func TestL2TPControl(t *testing.T) {
+	// A zero-length body acknowledgement.
+	data := []byte{0xC8, 0x02, 0x00, 0x0C, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x00, 0x04}
+	pkt := new(L2TPPacket)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !pkt.IsControl() {
+		t.Errorf("Control message decoded as a data message.")
+	}
+	if pkt.Ns != uint16(3) || pkt.Nr != uint16(4) {
+		t.Errorf("Unexpected sequence numbers: expected %v %v, got %v %v", 3, 4, pkt.Ns, pkt.Nr)
+	}
+	if len(pkt.Data) != 0 || pkt.PPP != nil {
+		t.Errorf("Unexpected body: %v %v", pkt.Data, pkt.PPP)
+	}
+
+	// Datagrams on other ports aren't decoded.
+	udp := &UDPDatagram{SourcePort: 1234, DestinationPort: 5678, data: data}
+	if _, err := udp.L2TP(); err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
@@ -0,0 +1,200 @@
+package gopcap
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// The well-known TCP port for Modbus/TCP.
+const ModbusTCPPort uint16 = 502
+
+//-----------------------------------------------------------------------------
+// ModbusTCPPacket
+//-----------------------------------------------------------------------------
+
+// ModbusTCPPacket represents a single Modbus/TCP application data unit: the MBAP header followed
+// by the Modbus PDU. The PDU data is kept uninterpreted, and the helper methods below decode it
+// for the common coil and register function codes. Because the same function code is used for
+// both the request and the response, the caller is responsible for knowing which one it has (for
+// example, by checking whether the packet was sent to ModbusTCPPort).
+type ModbusTCPPacket struct {
+	TransactionID uint16
+	ProtocolID    uint16
+	Length        uint16 // The number of bytes following this field, including the unit ID.
+	UnitID        uint8
+	FunctionCode  ModbusFunctionCode
+	Data          []byte
+}
+
+func (m *ModbusTCPPacket) ReadFrom(src io.Reader) error {
+	err := readFields(src, networkByteOrder, []interface{}{
+		&m.TransactionID,
+		&m.ProtocolID,
+		&m.Length,
+		&m.UnitID,
+		&m.FunctionCode,
+	})
+
+	if err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	// The protocol ID is always zero for Modbus, and the length must at least cover the unit ID
+	// and function code.
+	if m.ProtocolID != 0 || m.Length < 2 {
+		return IncorrectPacket
+	}
+
+	m.Data = make([]byte, m.Length-2)
+	_, err = io.ReadFull(src, m.Data)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+
+	return err
+}
+
+// IsException returns whether this packet is an exception response.
+func (m *ModbusTCPPacket) IsException() bool {
+	return m.FunctionCode&MODBUS_EXCEPTION != 0
+}
+
+// ExceptionCode returns the exception code carried by an exception response.
+func (m *ModbusTCPPacket) ExceptionCode() (uint8, error) {
+	if !m.IsException() {
+		return 0, IncorrectPacket
+	}
+	if len(m.Data) < 1 {
+		return 0, InsufficientLength
+	}
+
+	return m.Data[0], nil
+}
+
+// ReadRequest decodes a read coils, discrete inputs, holding registers or input registers request
+// into the starting address and the number of items to read.
+func (m *ModbusTCPPacket) ReadRequest() (address, quantity uint16, err error) {
+	if !m.isRead() {
+		return 0, 0, IncorrectPacket
+	}
+	if len(m.Data) < 4 {
+		return 0, 0, InsufficientLength
+	}
+
+	address = binary.BigEndian.Uint16(m.Data[0:2])
+	quantity = binary.BigEndian.Uint16(m.Data[2:4])
+
+	return address, quantity, nil
+}
+
+// ReadResponse returns the raw values carried by a response to one of the read function codes.
+func (m *ModbusTCPPacket) ReadResponse() ([]byte, error) {
+	if !m.isRead() {
+		return nil, IncorrectPacket
+	}
+	if len(m.Data) < 1 || len(m.Data) < int(m.Data[0])+1 {
+		return nil, InsufficientLength
+	}
+
+	return m.Data[1 : int(m.Data[0])+1], nil
+}
+
+// Registers decodes a read holding registers or read input registers response into the register
+// values.
+func (m *ModbusTCPPacket) Registers() ([]uint16, error) {
+	if m.FunctionCode != MODBUS_READ_HOLDING_REGISTERS && m.FunctionCode != MODBUS_READ_INPUT_REGISTERS {
+		return nil, IncorrectPacket
+	}
+
+	values, err := m.ReadResponse()
+	if err != nil {
+		return nil, err
+	}
+
+	registers := make([]uint16, len(values)/2)
+	for i := range registers {
+		registers[i] = binary.BigEndian.Uint16(values[i*2:])
+	}
+
+	return registers, nil
+}
+
+// Coils decodes a read coils or read discrete inputs response into the requested number of bit
+// values. The quantity isn't carried in the response, so must be taken from the matching request.
+func (m *ModbusTCPPacket) Coils(quantity uint16) ([]bool, error) {
+	if m.FunctionCode != MODBUS_READ_COILS && m.FunctionCode != MODBUS_READ_DISCRETE_INPUTS {
+		return nil, IncorrectPacket
+	}
+
+	values, err := m.ReadResponse()
+	if err != nil {
+		return nil, err
+	}
+	if len(values)*8 < int(quantity) {
+		return nil, InsufficientLength
+	}
+
+	// Coils are packed least significant bit first.
+	coils := make([]bool, quantity)
+	for i := range coils {
+		coils[i] = values[i/8]&(1<<uint(i%8)) != 0
+	}
+
+	return coils, nil
+}
+
+// WriteSingle decodes a write single coil or write single register request (or its response,
+// which echoes the request) into the address and the value written. A coil is on if the value
+// is 0xFF00.
+func (m *ModbusTCPPacket) WriteSingle() (address, value uint16, err error) {
+	if m.FunctionCode != MODBUS_WRITE_SINGLE_COIL && m.FunctionCode != MODBUS_WRITE_SINGLE_REGISTER {
+		return 0, 0, IncorrectPacket
+	}
+	if len(m.Data) < 4 {
+		return 0, 0, InsufficientLength
+	}
+
+	address = binary.BigEndian.Uint16(m.Data[0:2])
+	value = binary.BigEndian.Uint16(m.Data[2:4])
+
+	return address, value, nil
+}
+
+// WriteMultiple decodes a write multiple coils or write multiple registers request into the
+// starting address, the number of items written, and the raw values. The response to these
+// requests carries only the address and quantity, in which case the values are nil.
+func (m *ModbusTCPPacket) WriteMultiple() (address, quantity uint16, values []byte, err error) {
+	if m.FunctionCode != MODBUS_WRITE_MULTIPLE_COILS && m.FunctionCode != MODBUS_WRITE_MULTIPLE_REGISTERS {
+		return 0, 0, nil, IncorrectPacket
+	}
+	if len(m.Data) < 4 {
+		return 0, 0, nil, InsufficientLength
+	}
+
+	address = binary.BigEndian.Uint16(m.Data[0:2])
+	quantity = binary.BigEndian.Uint16(m.Data[2:4])
+
+	// A request has a byte count followed by the values.
+	if len(m.Data) > 4 {
+		count := int(m.Data[4])
+		if len(m.Data) < count+5 {
+			return 0, 0, nil, InsufficientLength
+		}
+		values = m.Data[5 : count+5]
+	}
+
+	return address, quantity, values, nil
+}
+
+// isRead returns whether the function code is one of the four read function codes.
+func (m *ModbusTCPPacket) isRead() bool {
+	switch m.FunctionCode {
+	case MODBUS_READ_COILS, MODBUS_READ_DISCRETE_INPUTS, MODBUS_READ_HOLDING_REGISTERS, MODBUS_READ_INPUT_REGISTERS:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,83 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestModbusReadHoldingRegisters(t *testing.T) {
+	// A Read Holding Registers request for three registers starting at 107.
+	data := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x11, 0x03, 0x00, 0x6B, 0x00, 0x03}
+	pkt := new(ModbusTCPPacket)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if pkt.TransactionID != uint16(1) {
+		t.Errorf("Unexpected transaction ID: expected %v, got %v", 1, pkt.TransactionID)
+	}
+	if pkt.ProtocolID != uint16(0) {
+		t.Errorf("Unexpected protocol ID: expected %v, got %v", 0, pkt.ProtocolID)
+	}
+	if pkt.Length != uint16(6) {
+		t.Errorf("Unexpected length: expected %v, got %v", 6, pkt.Length)
+	}
+	if pkt.UnitID != uint8(0x11) {
+		t.Errorf("Unexpected unit ID: expected %v, got %v", 0x11, pkt.UnitID)
+	}
+	if pkt.FunctionCode != MODBUS_READ_HOLDING_REGISTERS {
+		t.Errorf("Unexpected function code: expected %v, got %v", MODBUS_READ_HOLDING_REGISTERS, pkt.FunctionCode)
+	}
+	if pkt.IsException() {
+		t.Errorf("Unexpectedly decoded as an exception.")
+	}
+
+	address, quantity, err := pkt.ReadRequest()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if address != uint16(107) {
+		t.Errorf("Unexpected address: expected %v, got %v", 107, address)
+	}
+	if quantity != uint16(3) {
+		t.Errorf("Unexpected quantity: expected %v, got %v", 3, quantity)
+	}
+	if _, _, err := pkt.WriteSingle(); err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
+
+func TestModbusReadHoldingRegistersResponse(t *testing.T) {
+	data := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x09, 0x11, 0x03, 0x06, 0x02, 0x2B, 0x00, 0x00, 0x00, 0x64}
+	expected := []uint16{555, 0, 100}
+	pkt := new(ModbusTCPPacket)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	registers, err := pkt.Registers()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(registers) != len(expected) {
+		t.Fatalf("Unexpected number of registers: expected %v, got %v", len(expected), len(registers))
+	}
+	for i, register := range registers {
+		if register != expected[i] {
+			t.Errorf("Unexpected register %v: expected %v, got %v", i, expected[i], register)
+		}
+	}
+}
+
+func TestModbusTruncated(t *testing.T) {
+	data := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x11, 0x03, 0x00}
+	pkt := new(ModbusTCPPacket)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+}
@@ -0,0 +1,295 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// The well-known TCP ports for MQTT. MQTT over TLS uses MQTTTLSPort.
+const (
+	MQTTPort    uint16 = 1883
+	MQTTTLSPort uint16 = 8883
+)
+
+// mqttMaxLengthBytes is the most bytes the remaining length of a packet can be encoded in.
+const mqttMaxLengthBytes = 4
+
+// The bits of the CONNECT flags.
+const (
+	mqttConnectUsername   uint8 = 0x80
+	mqttConnectPassword   uint8 = 0x40
+	mqttConnectWillRetain uint8 = 0x20
+	mqttConnectWillQoS    uint8 = 0x18
+	mqttConnectWill       uint8 = 0x04
+	mqttConnectClean      uint8 = 0x02
+)
+
+//-----------------------------------------------------------------------------
+// MQTTPacket
+//-----------------------------------------------------------------------------
+
+// MQTTPacket represents a single MQTT 3.1.1 control packet. MQTT runs over TCP, so packets are not
+// aligned to segments: read them from a reassembled stream (for example, from PcapFile.TCPStream)
+// using ReadFrom or ReadMQTTPackets. Exactly one of Connect, Publish and Subscribe is set for those
+// packet types, and the rest of the packet is left in Data for the other types.
+type MQTTPacket struct {
+	Type            MQTTPacketType
+	Flags           uint8  // The low four bits of the first byte.
+	RemainingLength uint32 // The length of the packet after the fixed header.
+	Connect         *MQTTConnect
+	Publish         *MQTTPublish
+	Subscribe       *MQTTSubscribe
+	Data            []byte // The undecoded variable header and payload.
+}
+
+// MQTTConnect represents the body of a CONNECT packet. The will, username and password are only
+// present if the matching connect flag is set.
+type MQTTConnect struct {
+	ProtocolName  string // "MQTT", or "MQIsdp" for MQTT 3.1.
+	ProtocolLevel uint8  // 4 for MQTT 3.1.1.
+	ConnectFlags  uint8
+	KeepAlive     uint16 // In seconds.
+	ClientID      string
+	WillTopic     string
+	WillMessage   []byte
+	Username      string
+	Password      []byte
+}
+
+// MQTTPublish represents the body of a PUBLISH packet, along with the flags from its fixed header.
+type MQTTPublish struct {
+	Dup      bool
+	QoS      uint8
+	Retain   bool
+	Topic    string
+	PacketID uint16 // QoS 1 and 2 only.
+	Payload  []byte
+}
+
+// MQTTSubscribe represents the body of a SUBSCRIBE packet.
+type MQTTSubscribe struct {
+	PacketID      uint16
+	Subscriptions []MQTTSubscription
+}
+
+// MQTTSubscription represents a single topic filter from a SUBSCRIBE packet, and the maximum QoS
+// the client asked for.
+type MQTTSubscription struct {
+	TopicFilter string
+	QoS         uint8
+}
+
+// ReadFrom reads a single MQTT packet from the source, leaving it positioned at the start of the
+// next packet.
+func (m *MQTTPacket) ReadFrom(src io.Reader) error {
+	var first uint8
+	err := readFields(src, networkByteOrder, []interface{}{&first})
+	if err != nil {
+		return err
+	}
+
+	m.Type = MQTTPacketType(first >> 4)
+	m.Flags = first & 0x0F
+
+	m.RemainingLength, err = readMQTTLength(src)
+	if err != nil {
+		return err
+	}
+
+	// The length comes from the packet, so the buffer only grows as far as the data that's there.
+	m.Data, err = readFull(src, nil, int(m.RemainingLength))
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	switch m.Type {
+	case MQTT_CONNECT:
+		m.Connect = new(MQTTConnect)
+		err = m.Connect.readFrom(m.Data)
+	case MQTT_PUBLISH:
+		m.Publish = &MQTTPublish{
+			Dup:    m.Flags&0x08 != 0,
+			QoS:    (m.Flags >> 1) & 0x03,
+			Retain: m.Flags&0x01 != 0,
+		}
+		err = m.Publish.readFrom(m.Data)
+	case MQTT_SUBSCRIBE:
+		m.Subscribe = new(MQTTSubscribe)
+		err = m.Subscribe.readFrom(m.Data)
+	}
+
+	return err
+}
+
+// ReadMQTTPackets reads every MQTT packet from one direction of a reassembled TCP stream. If the
+// stream ends part way through a packet, the complete packets are returned along with
+// InsufficientLength.
+func ReadMQTTPackets(data []byte) ([]MQTTPacket, error) {
+	packets := make([]MQTTPacket, 0)
+	src := bytes.NewReader(data)
+
+	for src.Len() > 0 {
+		pkt := new(MQTTPacket)
+		err := pkt.ReadFrom(src)
+		if err != nil {
+			return packets, err
+		}
+		packets = append(packets, *pkt)
+	}
+
+	return packets, nil
+}
+
+// readMQTTLength reads the remaining length from the fixed header. It's encoded seven bits at a
+// time, least significant first, with the top bit of each byte set if another byte follows.
+func readMQTTLength(src io.Reader) (uint32, error) {
+	var length uint32
+	b := make([]byte, 1)
+
+	for i := 0; i < mqttMaxLengthBytes; i++ {
+		_, err := io.ReadFull(src, b)
+		if err == io.EOF {
+			return 0, InsufficientLength
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		length |= uint32(b[0]&0x7F) << (7 * uint(i))
+		if b[0]&0x80 == 0 {
+			return length, nil
+		}
+	}
+
+	return 0, IncorrectPacket
+}
+
+func (c *MQTTConnect) readFrom(data []byte) error {
+	var err error
+
+	c.ProtocolName, data, err = readMQTTString(data)
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 {
+		return InsufficientLength
+	}
+
+	c.ProtocolLevel = data[0]
+	c.ConnectFlags = data[1]
+	c.KeepAlive = binary.BigEndian.Uint16(data[2:4])
+
+	c.ClientID, data, err = readMQTTString(data[4:])
+	if err != nil {
+		return err
+	}
+
+	if c.ConnectFlags&mqttConnectWill != 0 {
+		c.WillTopic, data, err = readMQTTString(data)
+		if err != nil {
+			return err
+		}
+		c.WillMessage, data, err = readMQTTBytes(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.ConnectFlags&mqttConnectUsername != 0 {
+		c.Username, data, err = readMQTTString(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.ConnectFlags&mqttConnectPassword != 0 {
+		c.Password, _, err = readMQTTBytes(data)
+	}
+
+	return err
+}
+
+// CleanSession returns whether the client asked the server to discard any previous session.
+func (c *MQTTConnect) CleanSession() bool {
+	return c.ConnectFlags&mqttConnectClean != 0
+}
+
+// WillQoS returns the QoS level for publishing the will message.
+func (c *MQTTConnect) WillQoS() uint8 {
+	return (c.ConnectFlags & mqttConnectWillQoS) >> 3
+}
+
+// WillRetain returns whether the will message is to be retained when it's published.
+func (c *MQTTConnect) WillRetain() bool {
+	return c.ConnectFlags&mqttConnectWillRetain != 0
+}
+
+func (p *MQTTPublish) readFrom(data []byte) error {
+	var err error
+
+	p.Topic, data, err = readMQTTString(data)
+	if err != nil {
+		return err
+	}
+
+	// Only packets that are acknowledged carry a packet identifier.
+	if p.QoS > 0 {
+		if len(data) < 2 {
+			return InsufficientLength
+		}
+		p.PacketID = binary.BigEndian.Uint16(data[0:2])
+		data = data[2:]
+	}
+
+	p.Payload = data
+	return nil
+}
+
+func (s *MQTTSubscribe) readFrom(data []byte) error {
+	if len(data) < 2 {
+		return InsufficientLength
+	}
+	s.PacketID = binary.BigEndian.Uint16(data[0:2])
+	data = data[2:]
+
+	s.Subscriptions = make([]MQTTSubscription, 0)
+	for len(data) > 0 {
+		topic, rest, err := readMQTTString(data)
+		if err != nil {
+			return err
+		}
+		if len(rest) < 1 {
+			return InsufficientLength
+		}
+
+		s.Subscriptions = append(s.Subscriptions, MQTTSubscription{TopicFilter: topic, QoS: rest[0] & 0x03})
+		data = rest[1:]
+	}
+
+	return nil
+}
+
+// readMQTTBytes reads a field prefixed by its two-byte length, returning it and the data after it.
+func readMQTTBytes(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, InsufficientLength
+	}
+
+	length := int(binary.BigEndian.Uint16(data[0:2]))
+	if len(data) < 2+length {
+		return nil, nil, InsufficientLength
+	}
+
+	return data[2 : 2+length], data[2+length:], nil
+}
+
+// readMQTTString reads a UTF-8 string prefixed by its two-byte length, returning it and the data
+// after it.
+func readMQTTString(data []byte) (string, []byte, error) {
+	value, rest, err := readMQTTBytes(data)
+	return string(value), rest, err
+}
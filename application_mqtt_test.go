@@ -0,0 +1,166 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMQTTConnectAndPublish(t *testing.T) {
+	client := [4]byte{10, 0, 0, 1}
+	broker := [4]byte{10, 0, 0, 2}
+
+	// A clean-session CONNECT for client "sensor-1" with username "alice", keep alive 60s.
+	connect := []byte{
+		0x10, 0x1B,
+		0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x82, 0x00, 0x3C,
+		0x00, 0x08, 's', 'e', 'n', 's', 'o', 'r', '-', '1',
+		0x00, 0x05, 'a', 'l', 'i', 'c', 'e',
+	}
+	// A retained QoS 1 PUBLISH of "21.5" to "home/temp", packet ID 7.
+	publish := []byte{
+		0x33, 0x11,
+		0x00, 0x09, 'h', 'o', 'm', 'e', '/', 't', 'e', 'm', 'p', 0x00, 0x07,
+		'2', '1', '.', '5',
+	}
+
+	// The CONNECT is split across two segments, and the PUBLISH shares the second one.
+	second := append(append([]byte{}, connect[10:]...), publish...)
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, broker, 40000, MQTTPort, 1000, 0, "S", nil),
+		tcpTestPacket(1, broker, client, MQTTPort, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, client, broker, 40000, MQTTPort, 1001, 5001, "A", nil),
+		tcpTestPacket(3, client, broker, 40000, MQTTPort, 1001, 5001, "PA", connect[:10]),
+		tcpTestPacket(4, client, broker, 40000, MQTTPort, 1011, 5001, "PA", second),
+	}}
+
+	tuple := Tuple{
+		SourceAddress:      mappedIPv4(client),
+		DestinationAddress: mappedIPv4(broker),
+		SourcePort:         40000,
+		DestinationPort:    MQTTPort,
+		Protocol:           IPP_TCP,
+	}
+	stream, _, err := file.TCPStream(tuple)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	packets, err := ReadMQTTPackets(stream)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(packets) != 2 {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v", 2, len(packets))
+	}
+
+	pkt := packets[0]
+	if pkt.Type != MQTT_CONNECT {
+		t.Errorf("Unexpected packet type: expected %v, got %v", MQTT_CONNECT, pkt.Type)
+	}
+	if pkt.RemainingLength != uint32(len(connect)-2) {
+		t.Errorf("Unexpected remaining length: expected %v, got %v", len(connect)-2, pkt.RemainingLength)
+	}
+	if pkt.Connect == nil {
+		t.Fatalf("Missing CONNECT body.")
+	}
+	if pkt.Connect.ProtocolName != "MQTT" || pkt.Connect.ProtocolLevel != uint8(4) {
+		t.Errorf("Unexpected protocol: %v %v", pkt.Connect.ProtocolName, pkt.Connect.ProtocolLevel)
+	}
+	if !pkt.Connect.CleanSession() {
+		t.Errorf("Clean session flag not set.")
+	}
+	if pkt.Connect.KeepAlive != uint16(60) {
+		t.Errorf("Unexpected keep alive: expected %v, got %v", 60, pkt.Connect.KeepAlive)
+	}
+	if pkt.Connect.ClientID != "sensor-1" {
+		t.Errorf("Unexpected client ID: expected %v, got %v", "sensor-1", pkt.Connect.ClientID)
+	}
+	if pkt.Connect.Username != "alice" || pkt.Connect.Password != nil {
+		t.Errorf("Unexpected credentials: %v %v", pkt.Connect.Username, pkt.Connect.Password)
+	}
+
+	pkt = packets[1]
+	if pkt.Type != MQTT_PUBLISH {
+		t.Errorf("Unexpected packet type: expected %v, got %v", MQTT_PUBLISH, pkt.Type)
+	}
+	if pkt.Publish == nil {
+		t.Fatalf("Missing PUBLISH body.")
+	}
+	if pkt.Publish.Dup || pkt.Publish.QoS != uint8(1) || !pkt.Publish.Retain {
+		t.Errorf("Unexpected publish flags: %v %v %v", pkt.Publish.Dup, pkt.Publish.QoS, pkt.Publish.Retain)
+	}
+	if pkt.Publish.Topic != "home/temp" {
+		t.Errorf("Unexpected topic: expected %v, got %v", "home/temp", pkt.Publish.Topic)
+	}
+	if pkt.Publish.PacketID != uint16(7) {
+		t.Errorf("Unexpected packet ID: expected %v, got %v", 7, pkt.Publish.PacketID)
+	}
+	if string(pkt.Publish.Payload) != "21.5" {
+		t.Errorf("Unexpected payload: expected %v, got %v", "21.5", string(pkt.Publish.Payload))
+	}
+}
+
+func TestMQTTSubscribe(t *testing.T) {
+	data := []byte{
+		0x82, 0x0F, 0x00, 0x01,
+		0x00, 0x06, 'h', 'o', 'm', 'e', '/', '#', 0x01,
+		0x00, 0x01, '+', 0x00,
+	}
+	pkt := new(MQTTPacket)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pkt.Subscribe == nil {
+		t.Fatalf("Missing SUBSCRIBE body.")
+	}
+	if pkt.Subscribe.PacketID != uint16(1) {
+		t.Errorf("Unexpected packet ID: expected %v, got %v", 1, pkt.Subscribe.PacketID)
+	}
+
+	expected := []MQTTSubscription{{"home/#", 1}, {"+", 0}}
+	if len(pkt.Subscribe.Subscriptions) != len(expected) {
+		t.Fatalf("Unexpected subscriptions: expected %v, got %v", expected, pkt.Subscribe.Subscriptions)
+	}
+	for i, sub := range pkt.Subscribe.Subscriptions {
+		if sub != expected[i] {
+			t.Errorf("Unexpected subscription %v: expected %v, got %v", i, expected[i], sub)
+		}
+	}
+}
+
+func TestMQTTRemainingLength(t *testing.T) {
+	// A QoS 0 PUBLISH with a 200-byte payload needs two bytes of remaining length: 211 is 0xD3 0x01.
+	data := append([]byte{0x30, 0xD3, 0x01, 0x00, 0x09, 'h', 'o', 'm', 'e', '/', 'd', 'a', 't', 'a'}, make([]byte, 200)...)
+	pkt := new(MQTTPacket)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pkt.RemainingLength != uint32(211) {
+		t.Errorf("Unexpected remaining length: expected %v, got %v", 211, pkt.RemainingLength)
+	}
+	if len(pkt.Publish.Payload) != 200 {
+		t.Errorf("Unexpected payload length: expected %v, got %v", 200, len(pkt.Publish.Payload))
+	}
+
+	// The remaining length may take at most four bytes.
+	err = new(MQTTPacket).ReadFrom(bytes.NewReader([]byte{0x30, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}))
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+
+	// The largest remaining length, 256 MiB, with only a few bytes following it.
+	allocated := allocatedBy(func() {
+		err = new(MQTTPacket).ReadFrom(bytes.NewReader([]byte{0x30, 0xFF, 0xFF, 0xFF, 0x7F, 0x00, 0x09, 'h', 'o', 'm', 'e'}))
+	})
+
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if allocated > 16<<20 {
+		t.Errorf("Unexpected allocation for a corrupt remaining length: %v bytes", allocated)
+	}
+}
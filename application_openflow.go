@@ -0,0 +1,289 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// The well-known TCP ports for OpenFlow: the port IANA assigned, and the port used before then.
+const (
+	OpenFlowPort       uint16 = 6653
+	OpenFlowLegacyPort uint16 = 6633
+)
+
+// openFlowHeaderLength is the length of the header every OpenFlow message starts with.
+const openFlowHeaderLength = 8
+
+// The lengths of the fixed parts of the message bodies decoded, which differ between versions.
+const (
+	openFlow10FeaturesLength  = 24
+	openFlow10PacketInLength  = 10
+	openFlow10PacketOutLength = 8
+	openFlow13FeaturesLength  = 24
+	openFlow13PacketInLength  = 20 // Up to the end of the match header.
+	openFlow13PacketOutLength = 16
+)
+
+// The OXM class and field of the input port in an OpenFlow 1.3 match.
+const (
+	openFlowOXMClassBasic uint16 = 0x8000
+	openFlowOXMInPort     uint8  = 0
+)
+
+//-----------------------------------------------------------------------------
+// OpenFlowMessage
+//-----------------------------------------------------------------------------
+
+// OpenFlowMessage represents a single OpenFlow message between a switch and its controller.
+// OpenFlow runs over TCP, so messages are not aligned to segments: read them from a reassembled
+// stream (for example, from PcapFile.TCPStream) using ReadOpenFlowMessages. The body of every
+// message is kept in Body. The bodies of FEATURES_REPLY, PACKET_IN and PACKET_OUT messages are also
+// decoded for OpenFlow 1.0 and 1.3, the versions most switches speak; the layouts of the other
+// versions differ, so their bodies are only kept raw. HELLO and FEATURES_REQUEST messages need no
+// decoding beyond the header.
+type OpenFlowMessage struct {
+	Version   OpenFlowVersion
+	Type      OpenFlowType
+	Length    uint16 // The length of the message, including the header.
+	XID       uint32 // The transaction ID, which a reply shares with its request.
+	Body      []byte
+	Features  *OpenFlowFeatures  // FEATURES_REPLY only.
+	PacketIn  *OpenFlowPacketIn  // PACKET_IN only.
+	PacketOut *OpenFlowPacketOut // PACKET_OUT only.
+}
+
+// OpenFlowFeatures represents the body of a FEATURES_REPLY, in which a switch describes itself.
+type OpenFlowFeatures struct {
+	DatapathID   uint64
+	Buffers      uint32 // The number of packets the switch can buffer.
+	Tables       uint8
+	AuxiliaryID  uint8 // OpenFlow 1.3 only.
+	Capabilities uint32
+	Actions      uint32 // OpenFlow 1.0 only. The actions the switch supports.
+	Ports        []byte // OpenFlow 1.0 only. Later versions describe the ports in separate messages.
+}
+
+// OpenFlowPacketIn represents the body of a PACKET_IN, in which a switch sends a packet it received
+// to the controller. Data holds as much of the packet as the switch included, which can be decoded
+// with Frame.
+type OpenFlowPacketIn struct {
+	BufferID    uint32 // The ID of the switch's buffer holding the packet, or 0xFFFFFFFF if it isn't buffered.
+	TotalLength uint16 // The length of the whole packet, of which Data may only hold part.
+	InPort      uint32 // In OpenFlow 1.3, taken from Match. Zero if the match doesn't have it.
+	Reason      uint8
+	TableID     uint8  // OpenFlow 1.3 only.
+	Cookie      uint64 // OpenFlow 1.3 only.
+	Match       []byte // OpenFlow 1.3 only. The raw OXM fields of the match.
+	Data        []byte
+}
+
+// OpenFlowPacketOut represents the body of a PACKET_OUT, in which the controller tells a switch to
+// send a packet. The packet is either one the switch buffered, or is carried in Data, which can be
+// decoded with Frame.
+type OpenFlowPacketOut struct {
+	BufferID uint32
+	InPort   uint32
+	Actions  []byte // The raw list of actions to apply to the packet.
+	Data     []byte
+}
+
+// ReadFrom reads a single OpenFlow message from the source, leaving it positioned at the start of
+// the next message.
+func (m *OpenFlowMessage) ReadFrom(src io.Reader) error {
+	var header [openFlowHeaderLength]byte
+	_, err := io.ReadFull(src, header[:])
+	if err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	m.Version = OpenFlowVersion(header[0])
+	m.Type = OpenFlowType(header[1])
+	m.Length = binary.BigEndian.Uint16(header[2:4])
+	m.XID = binary.BigEndian.Uint32(header[4:8])
+
+	if m.Length < openFlowHeaderLength {
+		return IncorrectPacket
+	}
+
+	m.Body = make([]byte, m.Length-openFlowHeaderLength)
+	_, err = io.ReadFull(src, m.Body)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	switch m.Version {
+	case OPENFLOW_1_0:
+		return m.decode10()
+	case OPENFLOW_1_3:
+		return m.decode13()
+	}
+	return nil
+}
+
+// decode10 decodes the body of an OpenFlow 1.0 message.
+func (m *OpenFlowMessage) decode10() error {
+	body := m.Body
+
+	switch m.Type {
+	case OPENFLOW_FEATURES_REPLY:
+		if len(body) < openFlow10FeaturesLength {
+			return IncorrectPacket
+		}
+		m.Features = &OpenFlowFeatures{
+			DatapathID:   binary.BigEndian.Uint64(body[0:8]),
+			Buffers:      binary.BigEndian.Uint32(body[8:12]),
+			Tables:       body[12],
+			Capabilities: binary.BigEndian.Uint32(body[16:20]),
+			Actions:      binary.BigEndian.Uint32(body[20:24]),
+			Ports:        body[openFlow10FeaturesLength:],
+		}
+	case OPENFLOW_PACKET_IN:
+		if len(body) < openFlow10PacketInLength {
+			return IncorrectPacket
+		}
+		m.PacketIn = &OpenFlowPacketIn{
+			BufferID:    binary.BigEndian.Uint32(body[0:4]),
+			TotalLength: binary.BigEndian.Uint16(body[4:6]),
+			InPort:      uint32(binary.BigEndian.Uint16(body[6:8])),
+			Reason:      body[8],
+			Data:        body[openFlow10PacketInLength:],
+		}
+	case OPENFLOW_PACKET_OUT:
+		if len(body) < openFlow10PacketOutLength {
+			return IncorrectPacket
+		}
+		actionsEnd := openFlow10PacketOutLength + int(binary.BigEndian.Uint16(body[6:8]))
+		if len(body) < actionsEnd {
+			return IncorrectPacket
+		}
+		m.PacketOut = &OpenFlowPacketOut{
+			BufferID: binary.BigEndian.Uint32(body[0:4]),
+			InPort:   uint32(binary.BigEndian.Uint16(body[4:6])),
+			Actions:  body[openFlow10PacketOutLength:actionsEnd],
+			Data:     body[actionsEnd:],
+		}
+	}
+	return nil
+}
+
+// decode13 decodes the body of an OpenFlow 1.3 message.
+func (m *OpenFlowMessage) decode13() error {
+	body := m.Body
+
+	switch m.Type {
+	case OPENFLOW_FEATURES_REPLY:
+		if len(body) < openFlow13FeaturesLength {
+			return IncorrectPacket
+		}
+		m.Features = &OpenFlowFeatures{
+			DatapathID:   binary.BigEndian.Uint64(body[0:8]),
+			Buffers:      binary.BigEndian.Uint32(body[8:12]),
+			Tables:       body[12],
+			AuxiliaryID:  body[13],
+			Capabilities: binary.BigEndian.Uint32(body[16:20]),
+		}
+	case OPENFLOW_PACKET_IN:
+		// The match starts after the cookie, and is padded to a multiple of eight bytes. Two more
+		// bytes of padding come before the packet.
+		if len(body) < openFlow13PacketInLength {
+			return IncorrectPacket
+		}
+		matchLength := int(binary.BigEndian.Uint16(body[18:20]))
+		matchEnd := 16 + (matchLength+7)/8*8
+		if matchLength < 4 || len(body) < matchEnd+2 {
+			return IncorrectPacket
+		}
+		m.PacketIn = &OpenFlowPacketIn{
+			BufferID:    binary.BigEndian.Uint32(body[0:4]),
+			TotalLength: binary.BigEndian.Uint16(body[4:6]),
+			Reason:      body[6],
+			TableID:     body[7],
+			Cookie:      binary.BigEndian.Uint64(body[8:16]),
+			Match:       body[20 : 16+matchLength],
+			Data:        body[matchEnd+2:],
+		}
+		m.PacketIn.InPort = openFlowMatchInPort(m.PacketIn.Match)
+	case OPENFLOW_PACKET_OUT:
+		if len(body) < openFlow13PacketOutLength {
+			return IncorrectPacket
+		}
+		actionsEnd := openFlow13PacketOutLength + int(binary.BigEndian.Uint16(body[8:10]))
+		if len(body) < actionsEnd {
+			return IncorrectPacket
+		}
+		m.PacketOut = &OpenFlowPacketOut{
+			BufferID: binary.BigEndian.Uint32(body[0:4]),
+			InPort:   binary.BigEndian.Uint32(body[4:8]),
+			Actions:  body[openFlow13PacketOutLength:actionsEnd],
+			Data:     body[actionsEnd:],
+		}
+	}
+	return nil
+}
+
+// openFlowMatchInPort finds the input port among the OXM fields of an OpenFlow 1.3 match, returning
+// zero if it isn't there.
+func openFlowMatchInPort(fields []byte) uint32 {
+	for len(fields) >= 4 {
+		class := binary.BigEndian.Uint16(fields[0:2])
+		field := fields[2] >> 1
+		length := int(fields[3])
+		if len(fields) < 4+length {
+			break
+		}
+		if class == openFlowOXMClassBasic && field == openFlowOXMInPort && length == 4 {
+			return binary.BigEndian.Uint32(fields[4:8])
+		}
+		fields = fields[4+length:]
+	}
+	return 0
+}
+
+// ReadOpenFlowMessages reads every OpenFlow message from one direction of a reassembled TCP
+// stream. If the stream ends part way through a message, the complete messages are returned along
+// with InsufficientLength.
+func ReadOpenFlowMessages(data []byte) ([]OpenFlowMessage, error) {
+	messages := make([]OpenFlowMessage, 0)
+	src := bytes.NewReader(data)
+
+	for src.Len() > 0 {
+		msg := new(OpenFlowMessage)
+		err := msg.ReadFrom(src)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, nil
+}
+
+// Frame decodes the packet carried by a PACKET_IN as an Ethernet frame. Switches send the packet
+// as they received it, which for OpenFlow is always Ethernet.
+func (p *OpenFlowPacketIn) Frame() (*EthernetFrame, error) {
+	return openFlowFrame(p.Data)
+}
+
+// Frame decodes the packet carried by a PACKET_OUT as an Ethernet frame. It returns
+// InsufficientLength if there's no packet, because the switch is sending one it buffered.
+func (p *OpenFlowPacketOut) Frame() (*EthernetFrame, error) {
+	return openFlowFrame(p.Data)
+}
+
+// openFlowFrame decodes the Ethernet frame carried by a message.
+func openFlowFrame(data []byte) (*EthernetFrame, error) {
+	if len(data) == 0 {
+		return nil, InsufficientLength
+	}
+
+	frame := new(EthernetFrame)
+	err := frame.ReadFrom(bytes.NewReader(data))
+	return frame, err
+}
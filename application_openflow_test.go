@@ -0,0 +1,156 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// openFlowTestMessage builds an OpenFlow message with the given header fields and body.
+func openFlowTestMessage(version OpenFlowVersion, msgType OpenFlowType, xid uint32, body []byte) []byte {
+	msg := make([]byte, openFlowHeaderLength, openFlowHeaderLength+len(body))
+	msg[0] = uint8(version)
+	msg[1] = uint8(msgType)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(openFlowHeaderLength+len(body)))
+	binary.BigEndian.PutUint32(msg[4:8], xid)
+	return append(msg, body...)
+}
+
+// openFlowTestFrame is an Ethernet frame carrying an IPv4 echo request, for switches to send to
+// their controller.
+var openFlowTestFrame = []byte{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x08, 0x00,
+	0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00, 0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01,
+	0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+}
+
+func TestOpenFlow13Session(t *testing.T) {
+	switchAddr := [4]byte{10, 0, 0, 2}
+	controller := [4]byte{10, 0, 0, 1}
+
+	features := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0xfe, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x4f, 0x00, 0x00, 0x00, 0x00,
+	}
+	// Not buffered, from table 0 with cookie 1, matching input port 3. The match is padded from
+	// twelve bytes to sixteen, and two more bytes of padding precede the frame.
+	packetIn := append([]byte{
+		0xff, 0xff, 0xff, 0xff, 0x00, 0x2e, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x01, 0x00, 0x0c, 0x80, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00,
+	}, openFlowTestFrame...)
+	// Sent from the controller, with a single action outputting to port 1.
+	packetOut := append([]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfd, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x01, 0xff, 0xe5, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}, openFlowTestFrame...)
+
+	fromSwitch := bytes.Join([][]byte{
+		openFlowTestMessage(OPENFLOW_1_3, OPENFLOW_HELLO, 1, nil),
+		openFlowTestMessage(OPENFLOW_1_3, OPENFLOW_FEATURES_REPLY, 2, features),
+		openFlowTestMessage(OPENFLOW_1_3, OPENFLOW_PACKET_IN, 0, packetIn),
+	}, nil)
+	fromController := bytes.Join([][]byte{
+		openFlowTestMessage(OPENFLOW_1_3, OPENFLOW_HELLO, 1, nil),
+		openFlowTestMessage(OPENFLOW_1_3, OPENFLOW_FEATURES_REQUEST, 2, nil),
+		openFlowTestMessage(OPENFLOW_1_3, OPENFLOW_PACKET_OUT, 3, packetOut),
+	}, nil)
+
+	// The switch's PACKET_IN is split across two segments.
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, switchAddr, controller, 40000, OpenFlowPort, 1000, 0, "S", nil),
+		tcpTestPacket(1, controller, switchAddr, OpenFlowPort, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, switchAddr, controller, 40000, OpenFlowPort, 1001, 5001, "PA", fromSwitch[:60]),
+		tcpTestPacket(3, switchAddr, controller, 40000, OpenFlowPort, 1061, 5001, "PA", fromSwitch[60:]),
+		tcpTestPacket(4, controller, switchAddr, OpenFlowPort, 40000, 5001, uint32(1001+len(fromSwitch)), "PA", fromController),
+	}}
+
+	tuple, _ := file.Packets[0].FiveTuple()
+	switchToController, controllerToSwitch, err := file.TCPStream(tuple)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	messages, err := ReadOpenFlowMessages(switchToController)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("Unexpected number of messages: expected %v, got %v", 3, len(messages))
+	}
+	if messages[0].Version != OPENFLOW_1_3 || messages[0].Type != OPENFLOW_HELLO || messages[0].Length != 8 || messages[0].XID != 1 {
+		t.Errorf("Unexpected HELLO: %+v", messages[0])
+	}
+
+	reply := messages[1].Features
+	if reply == nil || reply.DatapathID != 1 || reply.Buffers != 256 || reply.Tables != 254 || reply.Capabilities != 0x4f {
+		t.Errorf("Unexpected FEATURES_REPLY: %+v", reply)
+	}
+
+	in := messages[2].PacketIn
+	if in == nil {
+		t.Fatalf("Unexpected message: expected a PACKET_IN, got %+v", messages[2])
+	}
+	if in.BufferID != 0xffffffff || in.TotalLength != 46 || in.Cookie != 1 || in.InPort != 3 {
+		t.Errorf("Unexpected PACKET_IN: %+v", in)
+	}
+	if !bytes.Equal(in.Data, openFlowTestFrame) {
+		t.Errorf("Unexpected PACKET_IN data: expected %x, got %x", openFlowTestFrame, in.Data)
+	}
+
+	// The embedded frame decodes like any other Ethernet frame.
+	frame, err := in.Frame()
+	if err != nil {
+		t.Fatalf("Unexpected error decoding frame: %v", err)
+	}
+	ip, isIPv4 := frame.LinkData().(*IPv4Packet)
+	if !isIPv4 || ip.SourceAddress != [4]byte{192, 168, 1, 2} {
+		t.Fatalf("Unexpected embedded packet: %+v", frame.LinkData())
+	}
+	icmp, isICMP := ip.InternetData().(*ICMPSegment)
+	if !isICMP || !icmp.IsEchoRequest() || string(icmp.TransportData()) != "abcd" {
+		t.Errorf("Unexpected embedded transport layer: %+v", ip.InternetData())
+	}
+
+	messages, err = ReadOpenFlowMessages(controllerToSwitch)
+	if err != nil || len(messages) != 3 {
+		t.Fatalf("Unexpected controller messages: %v, %v", len(messages), err)
+	}
+	if messages[1].Type != OPENFLOW_FEATURES_REQUEST || messages[1].XID != 2 || len(messages[1].Body) != 0 {
+		t.Errorf("Unexpected FEATURES_REQUEST: %+v", messages[1])
+	}
+	out := messages[2].PacketOut
+	if out == nil || out.InPort != 0xfffffffd || len(out.Actions) != 16 || !bytes.Equal(out.Data, openFlowTestFrame) {
+		t.Errorf("Unexpected PACKET_OUT: %+v", out)
+	}
+	if frame, err := out.Frame(); err != nil || frame.EtherType != ETHERTYPE_IPV4 {
+		t.Errorf("Unexpected PACKET_OUT frame: %+v, %v", frame, err)
+	}
+}
+
+func TestOpenFlow10PacketIn(t *testing.T) {
+	// Buffered as 0x100, received on port 7 with no matching flow.
+	body := append([]byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x2e, 0x00, 0x07, 0x00, 0x00}, openFlowTestFrame...)
+	stream := append(openFlowTestMessage(OPENFLOW_1_0, OPENFLOW_PACKET_IN, 0, body), 0x01, 0x00, 0x00)
+
+	messages, err := ReadOpenFlowMessages(stream)
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(messages) != 1 || messages[0].PacketIn == nil {
+		t.Fatalf("Unexpected messages: %+v", messages)
+	}
+
+	in := messages[0].PacketIn
+	if in.BufferID != 0x100 || in.TotalLength != 46 || in.InPort != 7 || in.Reason != 0 {
+		t.Errorf("Unexpected PACKET_IN: %+v", in)
+	}
+	if frame, err := in.Frame(); err != nil || frame.MACSource != [6]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55} {
+		t.Errorf("Unexpected frame: %+v, %v", frame, err)
+	}
+
+	// A length shorter than the header is malformed.
+	if _, err := ReadOpenFlowMessages([]byte{0x01, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00}); err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
@@ -0,0 +1,162 @@
+package gopcap
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// The well-known TCP port for Redis.
+const RedisPort uint16 = 6379
+
+// respMaxDepth is the deepest nesting of arrays decoded, so that a corrupt stream can't recurse
+// without bound.
+const respMaxDepth = 32
+
+//-----------------------------------------------------------------------------
+// RESPValue
+//-----------------------------------------------------------------------------
+
+// RESPValue represents a single value in the Redis serialization protocol. Commands are sent as
+// arrays of bulk strings, and replies may be any type. Redis runs over TCP, so values are not
+// aligned to segments: read them from a reassembled stream (for example, from PcapFile.TCPStream)
+// using ReadRESPValues. Inline commands, sent as bare lines of text, aren't decoded.
+type RESPValue struct {
+	Type    RESPType
+	Null    bool   // Whether a bulk string or array is null, rather than empty.
+	Data    []byte // Simple strings, errors and bulk strings.
+	Integer int64  // Integers only.
+	Array   []RESPValue
+}
+
+// ReadRESPValues reads every RESP value from one direction of a reassembled TCP stream. If the
+// stream ends part way through a value, the complete values are returned along with
+// InsufficientLength.
+func ReadRESPValues(data []byte) ([]RESPValue, error) {
+	values := make([]RESPValue, 0)
+
+	for len(data) > 0 {
+		value, rest, err := readRESPValue(data, 0)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+		data = rest
+	}
+
+	return values, nil
+}
+
+// readRESPValue reads a single value from the start of data, returning it along with the data
+// following it.
+func readRESPValue(data []byte, depth int) (RESPValue, []byte, error) {
+	var value RESPValue
+
+	line, rest, err := readRESPLine(data)
+	if err != nil {
+		return value, nil, err
+	}
+	if len(line) == 0 {
+		return value, nil, IncorrectPacket
+	}
+	value.Type = RESPType(line[0])
+	line = line[1:]
+
+	switch value.Type {
+	case RESP_SIMPLE_STRING, RESP_ERROR:
+		value.Data = line
+	case RESP_INTEGER:
+		value.Integer, err = strconv.ParseInt(string(line), 10, 64)
+		if err != nil {
+			return value, nil, IncorrectPacket
+		}
+	case RESP_BULK_STRING:
+		length, err := readRESPLength(line)
+		if err != nil || length < 0 {
+			value.Null = true
+			return value, rest, err
+		}
+		// The string is followed by its own CRLF. The length is compared this way round so that a huge
+		// one can't overflow.
+		if length > len(rest)-2 {
+			return value, nil, InsufficientLength
+		}
+		if rest[length] != '\r' || rest[length+1] != '\n' {
+			return value, nil, IncorrectPacket
+		}
+		value.Data = rest[:length]
+		rest = rest[length+2:]
+	case RESP_ARRAY:
+		length, err := readRESPLength(line)
+		if err != nil || length < 0 {
+			value.Null = true
+			return value, rest, err
+		}
+		if depth >= respMaxDepth {
+			return value, nil, IncorrectPacket
+		}
+		value.Array = make([]RESPValue, 0)
+		for i := 0; i < length; i++ {
+			var element RESPValue
+			element, rest, err = readRESPValue(rest, depth+1)
+			if err != nil {
+				return value, nil, err
+			}
+			value.Array = append(value.Array, element)
+		}
+	default:
+		return value, nil, IncorrectPacket
+	}
+
+	return value, rest, nil
+}
+
+// readRESPLine returns the line at the start of data, without its CRLF, and the data following it.
+func readRESPLine(data []byte) ([]byte, []byte, error) {
+	end := bytes.Index(data, []byte("\r\n"))
+	if end < 0 {
+		return nil, nil, InsufficientLength
+	}
+	return data[:end], data[end+2:], nil
+}
+
+// readRESPLength parses the length of a bulk string or array. A length of -1 means null.
+func readRESPLength(line []byte) (int, error) {
+	length, err := strconv.Atoi(string(line))
+	if err != nil || length < -1 {
+		return 0, IncorrectPacket
+	}
+	return length, nil
+}
+
+// String returns the value of a simple string, error or bulk string as a string.
+func (v *RESPValue) String() string {
+	return string(v.Data)
+}
+
+// Command returns the words of a command, which clients send as an array of bulk strings, e.g.
+// ["SET", "key", "value"]. It returns nil if the value isn't an array of strings.
+func (v *RESPValue) Command() []string {
+	if v.Type != RESP_ARRAY || v.Null {
+		return nil
+	}
+
+	words := make([]string, 0, len(v.Array))
+	for _, element := range v.Array {
+		if element.Type != RESP_BULK_STRING && element.Type != RESP_SIMPLE_STRING {
+			return nil
+		}
+		words = append(words, element.String())
+	}
+	return words
+}
+
+// CommandName returns the name of a command in upper case, e.g. "SET", or "" if the value isn't a
+// command.
+func (v *RESPValue) CommandName() string {
+	words := v.Command()
+	if len(words) == 0 {
+		return ""
+	}
+	return strings.ToUpper(words[0])
+}
@@ -0,0 +1,106 @@
+package gopcap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedisSetCommand(t *testing.T) {
+	client := [4]byte{192, 168, 0, 1}
+	server := [4]byte{192, 168, 0, 2}
+	command := "*3\r\n$3\r\nset\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+	reply := "+OK\r\n"
+
+	// The command is split part way through a bulk string.
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, RedisPort, 1000, 0, "S", nil),
+		tcpTestPacket(1, server, client, RedisPort, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, client, server, 40000, RedisPort, 1001, 5001, "A", nil),
+		tcpTestPacket(3, client, server, 40000, RedisPort, 1001, 5001, "PA", []byte(command[:20])),
+		tcpTestPacket(4, client, server, 40000, RedisPort, 1021, 5001, "PA", []byte(command[20:])),
+		tcpTestPacket(5, server, client, RedisPort, 40000, 5001, uint32(1001+len(command)), "PA", []byte(reply)),
+	}}
+
+	tuple := Tuple{
+		SourceAddress:      mappedIPv4(client),
+		DestinationAddress: mappedIPv4(server),
+		SourcePort:         40000,
+		DestinationPort:    RedisPort,
+		Protocol:           IPP_TCP,
+	}
+	clientToServer, serverToClient, err := file.TCPStream(tuple)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	commands, err := ReadRESPValues(clientToServer)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(commands) != 1 {
+		t.Fatalf("Unexpected number of commands: expected %v, got %v", 1, len(commands))
+	}
+	if commands[0].Type != RESP_ARRAY || len(commands[0].Array) != 3 {
+		t.Errorf("Unexpected command: %+v", commands[0])
+	}
+
+	expected := []string{"set", "key", "value"}
+	if words := commands[0].Command(); !reflect.DeepEqual(words, expected) {
+		t.Errorf("Unexpected command words: expected %v, got %v", expected, words)
+	}
+	if name := commands[0].CommandName(); name != "SET" {
+		t.Errorf("Unexpected command name: expected %v, got %v", "SET", name)
+	}
+
+	replies, err := ReadRESPValues(serverToClient)
+	if err != nil || len(replies) != 1 {
+		t.Fatalf("Unexpected replies: %v, %v", replies, err)
+	}
+	if replies[0].Type != RESP_SIMPLE_STRING || replies[0].String() != "OK" {
+		t.Errorf("Unexpected reply: %+v", replies[0])
+	}
+}
+
+func TestRESPValueTypes(t *testing.T) {
+	stream := "-ERR unknown command\r\n:1000\r\n$-1\r\n*2\r\n*1\r\n:1\r\n$0\r\n\r\n*-1\r\n$5\r\nhel"
+
+	values, err := ReadRESPValues([]byte(stream))
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(values) != 5 {
+		t.Fatalf("Unexpected number of values: expected %v, got %v", 5, len(values))
+	}
+
+	if values[0].Type != RESP_ERROR || values[0].String() != "ERR unknown command" {
+		t.Errorf("Unexpected error value: %+v", values[0])
+	}
+	if values[1].Type != RESP_INTEGER || values[1].Integer != 1000 {
+		t.Errorf("Unexpected integer value: %+v", values[1])
+	}
+	if values[2].Type != RESP_BULK_STRING || !values[2].Null {
+		t.Errorf("Unexpected null bulk string: %+v", values[2])
+	}
+
+	nested := values[3]
+	if nested.Type != RESP_ARRAY || len(nested.Array) != 2 {
+		t.Fatalf("Unexpected nested array: %+v", nested)
+	}
+	if len(nested.Array[0].Array) != 1 || nested.Array[0].Array[0].Integer != 1 {
+		t.Errorf("Unexpected inner array: %+v", nested.Array[0])
+	}
+	if nested.Array[1].Null || len(nested.Array[1].Data) != 0 {
+		t.Errorf("Unexpected empty bulk string: %+v", nested.Array[1])
+	}
+	if values[4].Type != RESP_ARRAY || !values[4].Null || values[4].Command() != nil {
+		t.Errorf("Unexpected null array: %+v", values[4])
+	}
+
+	if _, err := ReadRESPValues([]byte("PING\r\n")); err != IncorrectPacket {
+		t.Errorf("Unexpected error for inline command: expected %v, got %v", IncorrectPacket, err)
+	}
+
+	if _, err := ReadRESPValues([]byte("$9223372036854775807\r\nabc")); err != InsufficientLength {
+		t.Errorf("Unexpected error for huge bulk string: expected %v, got %v", InsufficientLength, err)
+	}
+}
@@ -0,0 +1,179 @@
+package gopcap
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The well-known ports for SIP. SIP over TLS uses SIPTLSPort.
+const (
+	SIPPort    uint16 = 5060
+	SIPTLSPort uint16 = 5061
+)
+
+// sipCompactHeaders maps the single-letter compact header names to their full names.
+var sipCompactHeaders = map[string]string{
+	"i": "call-id",
+	"m": "contact",
+	"e": "content-encoding",
+	"l": "content-length",
+	"c": "content-type",
+	"f": "from",
+	"s": "subject",
+	"k": "supported",
+	"t": "to",
+	"v": "via",
+}
+
+// sipListHeaders are the headers whose values may be comma-separated lists, which are split into
+// separate values.
+var sipListHeaders = map[string]bool{
+	"via":          true,
+	"contact":      true,
+	"route":        true,
+	"record-route": true,
+}
+
+//-----------------------------------------------------------------------------
+// SIPMessage
+//-----------------------------------------------------------------------------
+
+// SIPMessage represents a single Session Initiation Protocol request or response. Headers are keyed
+// by their lower-case full name, so compact headers such as "v" are stored under "via". A header
+// that appears more than once, or that holds a comma-separated list, has one value per entry.
+// SIP runs over both UDP and TCP, so the message is parsed from the transport data rather than
+// from a transport-layer type.
+type SIPMessage struct {
+	Method     string // Requests only.
+	RequestURI string // Requests only.
+	StatusCode int    // Responses only.
+	Reason     string // Responses only.
+	Version    string
+	Headers    map[string][]string
+	Body       []byte
+}
+
+// ParseSIP parses a single SIP message. If the message has a Content-Length header, the body is
+// limited to that length; otherwise it's everything after the headers.
+func ParseSIP(data []byte) (*SIPMessage, error) {
+	m := &SIPMessage{Headers: make(map[string][]string)}
+
+	startLine, headers, body := splitHTTPMessage(data)
+	start, err := parseHTTPStartLine(startLine, "SIP/")
+	if err != nil {
+		return nil, err
+	}
+	m.Method, m.RequestURI, m.Version = start.Method, start.RequestURI, start.Version
+	m.StatusCode, m.Reason = start.StatusCode, start.Reason
+
+	for _, line := range headers {
+		name, value, err := parseHTTPHeader(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if full, isCompact := sipCompactHeaders[name]; isCompact {
+			name = full
+		}
+
+		if sipListHeaders[name] {
+			m.Headers[name] = append(m.Headers[name], splitSIPList(value)...)
+		} else {
+			m.Headers[name] = append(m.Headers[name], value)
+		}
+	}
+
+	// Use the content length to find the end of the body, if we have it.
+	m.Body = body
+	if length := m.Header("content-length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 {
+			return nil, IncorrectPacket
+		}
+		if n > len(body) {
+			return m, InsufficientLength
+		}
+		m.Body = body[:n]
+	}
+
+	return m, nil
+}
+
+// splitSIPList splits a comma-separated header value, ignoring commas inside quoted strings and
+// angle-bracketed URIs.
+func splitSIPList(value string) []string {
+	values := make([]string, 0)
+	quoted, bracketed := false, false
+	start := 0
+
+	for i, c := range value {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '<' && !quoted:
+			bracketed = true
+		case c == '>' && !quoted:
+			bracketed = false
+		case c == ',' && !quoted && !bracketed:
+			values = append(values, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(values, strings.TrimSpace(value[start:]))
+}
+
+// IsRequest returns whether the message is a request rather than a response.
+func (m *SIPMessage) IsRequest() bool {
+	return m.Method != ""
+}
+
+// Header returns the first value of the named header, or "" if it isn't present. The name is
+// case-insensitive, and may be given in its compact form.
+func (m *SIPMessage) Header(name string) string {
+	name = strings.ToLower(name)
+	if full, isCompact := sipCompactHeaders[name]; isCompact {
+		name = full
+	}
+
+	values := m.Headers[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// CallID returns the Call-ID header, which identifies the call or registration.
+func (m *SIPMessage) CallID() string {
+	return m.Header("call-id")
+}
+
+// From returns the From header.
+func (m *SIPMessage) From() string {
+	return m.Header("from")
+}
+
+// To returns the To header.
+func (m *SIPMessage) To() string {
+	return m.Header("to")
+}
+
+// Via returns every Via header entry, in order. The first entry is the most recent hop.
+func (m *SIPMessage) Via() []string {
+	return m.Headers["via"]
+}
+
+// CSeq returns the sequence number and method from the CSeq header.
+func (m *SIPMessage) CSeq() (uint32, string, error) {
+	parts := strings.Fields(m.Header("cseq"))
+	if len(parts) != 2 {
+		return 0, "", IncorrectPacket
+	}
+
+	sequence, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, "", IncorrectPacket
+	}
+
+	return uint32(sequence), parts[1], nil
+}
@@ -0,0 +1,96 @@
+package gopcap
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSIPInvite(t *testing.T) {
+	body := "v=0\r\no=alice 2890844526 2890844526 IN IP4 client.atlanta.example.com\r\ns=-\r\n"
+	message := strings.Join([]string{
+		"INVITE sip:bob@biloxi.example.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.example.com;branch=z9hG4bK776asdhds",
+		"v: SIP/2.0/UDP proxy.example.com;branch=z9hG4bK4b43c2ff8.1,",
+		" SIP/2.0/UDP edge.example.com;branch=z9hG4bK77ef4c2312983.1",
+		"Max-Forwards: 70",
+		"To: Bob <sip:bob@biloxi.example.com>",
+		"f: \"Alice, A.\" <sip:alice@atlanta.example.com>;tag=1928301774",
+		"i: a84b4c76e66710@pc33.atlanta.example.com",
+		"CSeq: 314159 INVITE",
+		"Contact: <sip:alice@pc33.atlanta.example.com>",
+		"Content-Type: application/sdp",
+		"Content-Length: " + strconv.Itoa(len(body)),
+		"",
+		body,
+	}, "\r\n")
+
+	m, err := ParseSIP([]byte(message))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !m.IsRequest() {
+		t.Errorf("Expected a request.")
+	}
+	if m.Method != "INVITE" {
+		t.Errorf("Unexpected method: expected %v, got %v", "INVITE", m.Method)
+	}
+	if m.RequestURI != "sip:bob@biloxi.example.com" {
+		t.Errorf("Unexpected request URI: got %v", m.RequestURI)
+	}
+	if m.Version != "SIP/2.0" {
+		t.Errorf("Unexpected version: expected %v, got %v", "SIP/2.0", m.Version)
+	}
+	if m.CallID() != "a84b4c76e66710@pc33.atlanta.example.com" {
+		t.Errorf("Unexpected Call-ID: got %v", m.CallID())
+	}
+	if m.From() != "\"Alice, A.\" <sip:alice@atlanta.example.com>;tag=1928301774" {
+		t.Errorf("Unexpected From: got %v", m.From())
+	}
+	if m.To() != "Bob <sip:bob@biloxi.example.com>" {
+		t.Errorf("Unexpected To: got %v", m.To())
+	}
+	if m.Header("F") != m.From() {
+		t.Errorf("Compact header lookup failed: got %v", m.Header("F"))
+	}
+
+	sequence, method, err := m.CSeq()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if sequence != uint32(314159) || method != "INVITE" {
+		t.Errorf("Unexpected CSeq: got %v %v", sequence, method)
+	}
+
+	via := m.Via()
+	if len(via) != 3 {
+		t.Fatalf("Unexpected number of Via entries: expected %v, got %v", 3, len(via))
+	}
+	if via[2] != "SIP/2.0/UDP edge.example.com;branch=z9hG4bK77ef4c2312983.1" {
+		t.Errorf("Unexpected Via entry: got %v", via[2])
+	}
+	if string(m.Body) != body {
+		t.Errorf("Unexpected body: expected %q, got %q", body, string(m.Body))
+	}
+}
+
+func TestSIPResponse(t *testing.T) {
+	message := "SIP/2.0 180 Ringing\r\nCall-ID: a84b4c76e66710\r\nCSeq: 314159 INVITE\r\nContent-Length: 0\r\n\r\n"
+
+	m, err := ParseSIP([]byte(message))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.IsRequest() {
+		t.Errorf("Expected a response.")
+	}
+	if m.StatusCode != 180 || m.Reason != "Ringing" {
+		t.Errorf("Unexpected status line: got %v %v", m.StatusCode, m.Reason)
+	}
+	if len(m.Body) != 0 {
+		t.Errorf("Unexpected body: %v", m.Body)
+	}
+	if _, err := ParseSIP([]byte("not a sip message\r\n\r\n")); err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
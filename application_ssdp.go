@@ -0,0 +1,111 @@
+package gopcap
+
+import (
+	"strings"
+)
+
+// The well-known UDP port for SSDP. Requests are usually multicast to 239.255.255.250 or
+// ff02::c, while responses to M-SEARCH are unicast back from this port.
+const SSDPPort uint16 = 1900
+
+//-----------------------------------------------------------------------------
+// SSDPMessage
+//-----------------------------------------------------------------------------
+
+// SSDPMessage represents a single Simple Service Discovery Protocol message, as used by UPnP. SSDP
+// uses HTTP's message format over UDP: devices announce themselves with NOTIFY requests, control
+// points search with M-SEARCH requests, and devices answer searches with ordinary HTTP responses.
+// Headers are keyed by their lower-case name.
+type SSDPMessage struct {
+	Method     string // Requests only.
+	RequestURI string // Requests only.
+	StatusCode int    // Responses only.
+	Reason     string // Responses only.
+	Version    string
+	Headers    map[string][]string
+}
+
+// ParseSSDP parses a single SSDP message. SSDP messages have no body, so anything after the
+// headers is ignored.
+func ParseSSDP(data []byte) (*SSDPMessage, error) {
+	m := &SSDPMessage{Headers: make(map[string][]string)}
+
+	startLine, headers, _ := splitHTTPMessage(data)
+	start, err := parseHTTPStartLine(startLine, "HTTP/")
+	if err != nil {
+		return nil, err
+	}
+	m.Method, m.RequestURI, m.Version = start.Method, start.RequestURI, start.Version
+	m.StatusCode, m.Reason = start.StatusCode, start.Reason
+
+	for _, line := range headers {
+		name, value, err := parseHTTPHeader(line)
+		if err != nil {
+			return nil, err
+		}
+		m.Headers[name] = append(m.Headers[name], value)
+	}
+
+	return m, nil
+}
+
+// SSDP decodes the datagram's payload as SSDP, if either port is SSDPPort. Datagrams on other ports
+// return IncorrectPacket.
+func (u *UDPDatagram) SSDP() (*SSDPMessage, error) {
+	if u.SourcePort != SSDPPort && u.DestinationPort != SSDPPort {
+		return nil, IncorrectPacket
+	}
+
+	return ParseSSDP(u.data)
+}
+
+// IsRequest returns whether the message is a request rather than a response.
+func (m *SSDPMessage) IsRequest() bool {
+	return m.Method != ""
+}
+
+// IsNotify returns whether the message is a NOTIFY announcement.
+func (m *SSDPMessage) IsNotify() bool {
+	return m.Method == "NOTIFY"
+}
+
+// IsSearch returns whether the message is an M-SEARCH request.
+func (m *SSDPMessage) IsSearch() bool {
+	return m.Method == "M-SEARCH"
+}
+
+// Header returns the first value of the named header, or "" if it isn't present. The name is
+// case-insensitive.
+func (m *SSDPMessage) Header(name string) string {
+	values := m.Headers[strings.ToLower(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// NT returns the notification type of a NOTIFY announcement.
+func (m *SSDPMessage) NT() string {
+	return m.Header("nt")
+}
+
+// NTS returns the notification subtype of a NOTIFY announcement, such as "ssdp:alive" or
+// "ssdp:byebye".
+func (m *SSDPMessage) NTS() string {
+	return m.Header("nts")
+}
+
+// ST returns the search target of an M-SEARCH request or its response.
+func (m *SSDPMessage) ST() string {
+	return m.Header("st")
+}
+
+// USN returns the unique service name of the announced or found service.
+func (m *SSDPMessage) USN() string {
+	return m.Header("usn")
+}
+
+// Location returns the URL of the device's description.
+func (m *SSDPMessage) Location() string {
+	return m.Header("location")
+}
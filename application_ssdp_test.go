@@ -0,0 +1,80 @@
+package gopcap
+
+import (
+	"testing"
+)
+
+func TestSSDPNotify(t *testing.T) {
+	data := "NOTIFY * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"CACHE-CONTROL: max-age=1800\r\n" +
+		"LOCATION: http://192.168.1.1:49152/description.xml\r\n" +
+		"NT: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"NTS: ssdp:alive\r\n" +
+		"SERVER: Linux/2.6 UPnP/1.0 router/1.0\r\n" +
+		"USN: uuid:2fac1234-31f8-11b4-a222-08002b34c003::urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"\r\n"
+	udp := &UDPDatagram{SourcePort: 1900, DestinationPort: SSDPPort, data: []byte(data)}
+	m, err := udp.SSDP()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !m.IsRequest() || !m.IsNotify() || m.IsSearch() {
+		t.Errorf("Unexpected method: %v", m.Method)
+	}
+	if m.RequestURI != "*" {
+		t.Errorf("Unexpected request URI: expected %v, got %v", "*", m.RequestURI)
+	}
+	if m.Version != "HTTP/1.1" {
+		t.Errorf("Unexpected version: expected %v, got %v", "HTTP/1.1", m.Version)
+	}
+	if m.NT() != "urn:schemas-upnp-org:device:InternetGatewayDevice:1" {
+		t.Errorf("Unexpected NT: %v", m.NT())
+	}
+	if m.NTS() != "ssdp:alive" {
+		t.Errorf("Unexpected NTS: expected %v, got %v", "ssdp:alive", m.NTS())
+	}
+	if m.USN() != "uuid:2fac1234-31f8-11b4-a222-08002b34c003::urn:schemas-upnp-org:device:InternetGatewayDevice:1" {
+		t.Errorf("Unexpected USN: %v", m.USN())
+	}
+	if m.Location() != "http://192.168.1.1:49152/description.xml" {
+		t.Errorf("Unexpected location: %v", m.Location())
+	}
+	if m.Header("Cache-Control") != "max-age=1800" {
+		t.Errorf("Unexpected cache control: %v", m.Header("Cache-Control"))
+	}
+}
+
+func TestSSDPSearchResponse(t *testing.T) {
+	data := "HTTP/1.1 200 OK\r\n" +
+		"CACHE-CONTROL: max-age=120\r\n" +
+		"ST: upnp:rootdevice\r\n" +
+		"USN: uuid:2fac1234-31f8-11b4-a222-08002b34c003::upnp:rootdevice\r\n" +
+		"EXT:\r\n" +
+		"LOCATION: http://192.168.1.1:49152/description.xml\r\n" +
+		"\r\n"
+	m, err := ParseSSDP([]byte(data))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.IsRequest() {
+		t.Errorf("Response decoded as a request.")
+	}
+	if m.StatusCode != 200 || m.Reason != "OK" {
+		t.Errorf("Unexpected status: %v %v", m.StatusCode, m.Reason)
+	}
+	if m.ST() != "upnp:rootdevice" {
+		t.Errorf("Unexpected ST: expected %v, got %v", "upnp:rootdevice", m.ST())
+	}
+	if values, present := m.Headers["ext"]; !present || values[0] != "" {
+		t.Errorf("Unexpected EXT header: %v", values)
+	}
+
+	// Other ports aren't recognised.
+	udp := &UDPDatagram{SourcePort: 1234, DestinationPort: 5678, data: []byte(data)}
+	if _, err := udp.SSDP(); err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
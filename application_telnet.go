@@ -0,0 +1,129 @@
+package gopcap
+
+// The well-known TCP port for Telnet.
+const TelnetPort uint16 = 23
+
+//-----------------------------------------------------------------------------
+// TelnetStream
+//-----------------------------------------------------------------------------
+
+// TelnetStream represents one direction of a Telnet session, with the IAC command sequences
+// separated from the terminal data they're interleaved with. Telnet runs over TCP, so commands
+// are not aligned to segments: decode a reassembled stream (for example, from PcapFile.TCPStream)
+// using ReadTelnetStream.
+type TelnetStream struct {
+	Data     []byte // The terminal data, with commands removed and escaped IAC bytes unescaped.
+	Commands []TelnetCommandSequence
+}
+
+// TelnetCommandSequence represents a single command in a Telnet stream. Option is set for option
+// negotiations (DO, DONT, WILL and WONT) and subnegotiations (SB), and Parameters holds the body of
+// a subnegotiation, unescaped. Offset is the position in the stream's Data at which the command
+// was sent, so commands can be placed relative to the terminal data around them.
+type TelnetCommandSequence struct {
+	Offset     int
+	Command    TelnetCommand
+	Option     TelnetOption
+	Parameters []byte
+}
+
+// ReadTelnetStream separates the commands in one direction of a reassembled Telnet stream from
+// its terminal data. If the stream ends part way through a command, the data and commands before
+// it are returned along with InsufficientLength.
+func ReadTelnetStream(data []byte) (TelnetStream, error) {
+	stream := TelnetStream{Data: make([]byte, 0, len(data)), Commands: make([]TelnetCommandSequence, 0)}
+
+	for i := 0; i < len(data); {
+		if TelnetCommand(data[i]) != TELNET_IAC {
+			stream.Data = append(stream.Data, data[i])
+			i++
+			continue
+		}
+		if i+1 >= len(data) {
+			return stream, InsufficientLength
+		}
+
+		command := TelnetCommandSequence{Offset: len(stream.Data), Command: TelnetCommand(data[i+1])}
+		switch command.Command {
+		case TELNET_IAC:
+			// An escaped 0xFF data byte.
+			stream.Data = append(stream.Data, data[i+1])
+			i += 2
+			continue
+		case TELNET_DO, TELNET_DONT, TELNET_WILL, TELNET_WONT:
+			if i+2 >= len(data) {
+				return stream, InsufficientLength
+			}
+			command.Option = TelnetOption(data[i+2])
+			i += 3
+		case TELNET_SB:
+			if i+2 >= len(data) {
+				return stream, InsufficientLength
+			}
+			command.Option = TelnetOption(data[i+2])
+			parameters, length, err := readTelnetSubnegotiation(data[i+3:])
+			if err != nil {
+				return stream, err
+			}
+			command.Parameters = parameters
+			i += 3 + length
+		default:
+			i += 2
+		}
+		stream.Commands = append(stream.Commands, command)
+	}
+
+	return stream, nil
+}
+
+// readTelnetSubnegotiation reads the body of a subnegotiation up to the IAC SE that ends it,
+// returning the unescaped parameters and the number of bytes consumed, including the IAC SE.
+func readTelnetSubnegotiation(data []byte) ([]byte, int, error) {
+	parameters := make([]byte, 0)
+
+	for i := 0; i < len(data); i++ {
+		if TelnetCommand(data[i]) != TELNET_IAC {
+			parameters = append(parameters, data[i])
+			continue
+		}
+		if i+1 >= len(data) {
+			return nil, 0, InsufficientLength
+		}
+		i++
+		switch TelnetCommand(data[i]) {
+		case TELNET_SE:
+			return parameters, i + 1, nil
+		case TELNET_IAC:
+			parameters = append(parameters, data[i])
+		default:
+			// Only SE and an escaped IAC may follow an IAC in a subnegotiation.
+			return nil, 0, IncorrectPacket
+		}
+	}
+
+	return nil, 0, InsufficientLength
+}
+
+// Negotiations returns the option negotiations in the stream: its DO, DONT, WILL and WONT
+// commands.
+func (s *TelnetStream) Negotiations() []TelnetCommandSequence {
+	negotiations := make([]TelnetCommandSequence, 0)
+	for _, command := range s.Commands {
+		switch command.Command {
+		case TELNET_DO, TELNET_DONT, TELNET_WILL, TELNET_WONT:
+			negotiations = append(negotiations, command)
+		}
+	}
+	return negotiations
+}
+
+// Subnegotiations returns the subnegotiations in the stream.
+func (s *TelnetStream) Subnegotiations() []TelnetCommandSequence {
+	subnegotiations := make([]TelnetCommandSequence, 0)
+	for _, command := range s.Commands {
+		if command.Command == TELNET_SB {
+			subnegotiations = append(subnegotiations, command)
+		}
+	}
+	return subnegotiations
+}
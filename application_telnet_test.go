@@ -0,0 +1,111 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTelnetNegotiation(t *testing.T) {
+	client := [4]byte{192, 168, 0, 1}
+	server := [4]byte{192, 168, 0, 2}
+
+	// The server asks the client to enable the terminal type option and suppresses go-ahead, then
+	// prompts for a login. The client agrees, reports its terminal type, and types its username.
+	serverData := []byte{
+		0xff, 0xfd, 0x18, 0xff, 0xfb, 0x03,
+		'l', 'o', 'g', 'i', 'n', ':', ' ',
+	}
+	clientData := []byte{
+		0xff, 0xfb, 0x18,
+		0xff, 0xfa, 0x18, 0x00, 'X', 'T', 'E', 'R', 'M', 0xff, 0xf0,
+		'r', 'o', 'o', 't', '\r', '\n',
+	}
+
+	// The client's subnegotiation is split across two segments.
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, TelnetPort, 1000, 0, "S", nil),
+		tcpTestPacket(1, server, client, TelnetPort, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, client, server, 40000, TelnetPort, 1001, 5001, "A", nil),
+		tcpTestPacket(3, server, client, TelnetPort, 40000, 5001, 1001, "PA", serverData),
+		tcpTestPacket(4, client, server, 40000, TelnetPort, 1001, uint32(5001+len(serverData)), "PA", clientData[:8]),
+		tcpTestPacket(5, client, server, 40000, TelnetPort, 1009, uint32(5001+len(serverData)), "PA", clientData[8:]),
+	}}
+
+	tuple, _ := file.Packets[0].FiveTuple()
+	clientToServer, serverToClient, err := file.TCPStream(tuple)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fromServer, err := ReadTelnetStream(serverToClient)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if string(fromServer.Data) != "login: " {
+		t.Errorf("Unexpected server data: expected %q, got %q", "login: ", fromServer.Data)
+	}
+	expected := []TelnetCommandSequence{
+		{Offset: 0, Command: TELNET_DO, Option: TELNET_OPTION_TERMINAL_TYPE},
+		{Offset: 0, Command: TELNET_WILL, Option: TELNET_OPTION_SUPPRESS_GO_AHEAD},
+	}
+	negotiations := fromServer.Negotiations()
+	if len(negotiations) != len(expected) {
+		t.Fatalf("Unexpected number of negotiations: expected %v, got %v", len(expected), len(negotiations))
+	}
+	for i, negotiation := range negotiations {
+		if negotiation.Offset != expected[i].Offset || negotiation.Command != expected[i].Command || negotiation.Option != expected[i].Option {
+			t.Errorf("Unexpected negotiation %v: expected %+v, got %+v", i, expected[i], negotiation)
+		}
+	}
+
+	fromClient, err := ReadTelnetStream(clientToServer)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if string(fromClient.Data) != "root\r\n" {
+		t.Errorf("Unexpected client data: expected %q, got %q", "root\r\n", fromClient.Data)
+	}
+	if len(fromClient.Commands) != 2 {
+		t.Fatalf("Unexpected number of commands: expected %v, got %v", 2, len(fromClient.Commands))
+	}
+	subnegotiations := fromClient.Subnegotiations()
+	if len(subnegotiations) != 1 {
+		t.Fatalf("Unexpected number of subnegotiations: expected %v, got %v", 1, len(subnegotiations))
+	}
+	if subnegotiations[0].Option != TELNET_OPTION_TERMINAL_TYPE || !bytes.Equal(subnegotiations[0].Parameters, []byte("\x00XTERM")) {
+		t.Errorf("Unexpected subnegotiation: %+v", subnegotiations[0])
+	}
+}
+
+func TestTelnetEscapesAndTruncation(t *testing.T) {
+	// An escaped 0xFF data byte, an Are You There command, a subnegotiation containing an escaped
+	// IAC, and finally a DO command cut off before its option.
+	data := []byte{
+		'a', 0xff, 0xff, 'b', 0xff, 0xf6, 'c',
+		0xff, 0xfa, 0x1f, 0x00, 0xff, 0xff, 0x00, 0x18, 0xff, 0xf0,
+		'd', 0xff, 0xfd,
+	}
+
+	stream, err := ReadTelnetStream(data)
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if !bytes.Equal(stream.Data, []byte{'a', 0xff, 'b', 'c', 'd'}) {
+		t.Errorf("Unexpected data: %q", stream.Data)
+	}
+	if len(stream.Commands) != 2 {
+		t.Fatalf("Unexpected number of commands: expected %v, got %v", 2, len(stream.Commands))
+	}
+	if stream.Commands[0].Command != TELNET_AYT || stream.Commands[0].Offset != 3 {
+		t.Errorf("Unexpected first command: %+v", stream.Commands[0])
+	}
+	naws := stream.Commands[1]
+	if naws.Command != TELNET_SB || naws.Option != TELNET_OPTION_NAWS || naws.Offset != 4 || !bytes.Equal(naws.Parameters, []byte{0x00, 0xff, 0x00, 0x18}) {
+		t.Errorf("Unexpected subnegotiation: %+v", naws)
+	}
+
+	// Anything other than SE or IAC after an IAC inside a subnegotiation is malformed.
+	if _, err := ReadTelnetStream([]byte{0xff, 0xfa, 0x18, 0xff, 0xf1}); err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
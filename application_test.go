@@ -0,0 +1,52 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testEchoApp is a trivial application layer that keeps a copy of its payload.
+type testEchoApp struct {
+	Payload []byte
+}
+
+func (a *testEchoApp) FromBytes(data []byte) error {
+	a.Payload = append([]byte(nil), data...)
+	return nil
+}
+
+func TestRegisterApplicationParser(t *testing.T) {
+	data := []byte{0x04, 0xD2, 0x00, 0x07, 0x00, 0x0C, 0x00, 0x00, 0x70, 0x69, 0x6E, 0x67}
+
+	dgram := new(UDPDatagram)
+	dgram.ReadFrom(bytes.NewReader(data))
+	if dgram.ApplicationData() != nil {
+		t.Errorf("Unexpected application layer before registration: %v", dgram.ApplicationData())
+	}
+
+	RegisterApplicationParser(IPP_UDP, 7, func() ApplicationLayer { return new(testEchoApp) })
+	defer func() {
+		delete(applicationParsers, applicationPort{IPP_UDP, 7})
+	}()
+
+	dgram = new(UDPDatagram)
+	err := dgram.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	app, isEcho := dgram.ApplicationData().(*testEchoApp)
+	if !isEcho {
+		t.Fatalf("Unexpected application layer: %T", dgram.ApplicationData())
+	}
+	if string(app.Payload) != "ping" {
+		t.Errorf("Unexpected payload: expected %q, got %q", "ping", string(app.Payload))
+	}
+
+	// The registration is specific to UDP.
+	segment := &TCPSegment{}
+	tcp := []byte{0x04, 0xD2, 0x00, 0x07, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x50, 0x18, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x70, 0x69, 0x6E, 0x67}
+	segment.ReadFrom(bytes.NewReader(tcp))
+	if segment.ApplicationData() != nil {
+		t.Errorf("Unexpected application layer on TCP: %v", segment.ApplicationData())
+	}
+}
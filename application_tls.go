@@ -0,0 +1,237 @@
+package gopcap
+
+import (
+	"encoding/binary"
+)
+
+// The well-known TCP port for HTTPS, the most common use of TLS.
+const TLSPort uint16 = 443
+
+// The TLS record and handshake values needed to find a ClientHello.
+const (
+	tlsRecordHeaderLength    = 5
+	tlsHandshakeHeaderLength = 4
+	tlsRecordHandshake       = 22
+	tlsHandshakeClientHello  = 1
+	tlsExtensionServerName   = 0
+	tlsServerNameHost        = 0
+)
+
+//-----------------------------------------------------------------------------
+// TLSClientHello
+//-----------------------------------------------------------------------------
+
+// TLSClientHello represents the ClientHello message that opens a TLS handshake. It's the last
+// handshake message sent in the clear that says anything about where the client is connecting, so
+// only the fields useful for identifying the connection are decoded. ServerName holds the host name
+// from the server name indication (SNI) extension, or "" if the client didn't send one.
+type TLSClientHello struct {
+	Version            uint16 // The legacy version field. TLS 1.3 still claims 1.2 here.
+	Random             [32]byte
+	SessionID          []byte
+	CipherSuites       []uint16
+	CompressionMethods []byte
+	Extensions         []TLSExtension
+	ServerName         string
+}
+
+// TLSExtension represents a single extension from a ClientHello.
+type TLSExtension struct {
+	Type uint16
+	Data []byte
+}
+
+// ParseTLSClientHello parses the ClientHello from the start of the client's side of a TLS
+// connection. The ClientHello may be split across several TLS records, and data is expected to be
+// the reassembled stream (for example, from PcapFile.TCPStream) rather than a single segment. If
+// the stream ends before the ClientHello does, InsufficientLength is returned; if it doesn't start
+// with a ClientHello, IncorrectPacket is returned.
+func ParseTLSClientHello(data []byte) (*TLSClientHello, error) {
+	handshake, err := readTLSHandshake(data)
+	if err != nil {
+		return nil, err
+	}
+	if handshake[0] != tlsHandshakeClientHello {
+		return nil, IncorrectPacket
+	}
+
+	hello := new(TLSClientHello)
+	err = hello.readFrom(handshake[tlsHandshakeHeaderLength:])
+	if err != nil {
+		return nil, err
+	}
+	return hello, nil
+}
+
+// readTLSHandshake gathers the first handshake message from the start of a stream of TLS records,
+// joining together the fragments carried in each record.
+func readTLSHandshake(data []byte) ([]byte, error) {
+	handshake := make([]byte, 0)
+
+	for {
+		if len(handshake) >= tlsHandshakeHeaderLength {
+			length := tlsHandshakeHeaderLength + int(uint32(handshake[1])<<16|uint32(handshake[2])<<8|uint32(handshake[3]))
+			if len(handshake) >= length {
+				return handshake[:length], nil
+			}
+		}
+
+		if len(data) < tlsRecordHeaderLength {
+			return nil, InsufficientLength
+		}
+		if data[0] != tlsRecordHandshake || data[1] != 3 {
+			return nil, IncorrectPacket
+		}
+
+		length := tlsRecordHeaderLength + int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < length {
+			return nil, InsufficientLength
+		}
+
+		handshake = append(handshake, data[tlsRecordHeaderLength:length]...)
+		data = data[length:]
+	}
+}
+
+func (h *TLSClientHello) readFrom(data []byte) error {
+	if len(data) < 35 {
+		return InsufficientLength
+	}
+	h.Version = binary.BigEndian.Uint16(data[0:2])
+	copy(h.Random[:], data[2:34])
+
+	var err error
+	h.SessionID, data, err = readTLSVector(data[34:], 1)
+	if err != nil {
+		return err
+	}
+
+	suites, data, err := readTLSVector(data, 2)
+	if err != nil {
+		return err
+	}
+	h.CipherSuites = make([]uint16, len(suites)/2)
+	for i := range h.CipherSuites {
+		h.CipherSuites[i] = binary.BigEndian.Uint16(suites[2*i:])
+	}
+
+	h.CompressionMethods, data, err = readTLSVector(data, 1)
+	if err != nil {
+		return err
+	}
+
+	// Extensions are optional, although every modern client sends them.
+	h.Extensions = make([]TLSExtension, 0)
+	if len(data) == 0 {
+		return nil
+	}
+
+	extensions, _, err := readTLSVector(data, 2)
+	if err != nil {
+		return err
+	}
+	for len(extensions) > 0 {
+		if len(extensions) < 2 {
+			return InsufficientLength
+		}
+		extension := TLSExtension{Type: binary.BigEndian.Uint16(extensions[0:2])}
+
+		extension.Data, extensions, err = readTLSVector(extensions[2:], 2)
+		if err != nil {
+			return err
+		}
+		h.Extensions = append(h.Extensions, extension)
+
+		if extension.Type == tlsExtensionServerName {
+			h.ServerName, err = readTLSServerName(extension.Data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readTLSServerName returns the host name from the data of a server name extension.
+func readTLSServerName(data []byte) (string, error) {
+	names, _, err := readTLSVector(data, 2)
+	if err != nil {
+		return "", err
+	}
+
+	for len(names) > 0 {
+		nameType := names[0]
+
+		var name []byte
+		name, names, err = readTLSVector(names[1:], 2)
+		if err != nil {
+			return "", err
+		}
+		if nameType == tlsServerNameHost {
+			return string(name), nil
+		}
+	}
+
+	return "", nil
+}
+
+// readTLSVector reads a field prefixed by its length, which takes the given number of bytes. It
+// returns the field and the data after it.
+func readTLSVector(data []byte, lengthBytes int) ([]byte, []byte, error) {
+	if len(data) < lengthBytes {
+		return nil, nil, InsufficientLength
+	}
+
+	length := 0
+	for _, b := range data[:lengthBytes] {
+		length = length<<8 | int(b)
+	}
+	if len(data) < lengthBytes+length {
+		return nil, nil, InsufficientLength
+	}
+
+	return data[lengthBytes : lengthBytes+length], data[lengthBytes+length:], nil
+}
+
+// ExtractSNIs returns the server names requested by every TLS ClientHello in the capture, in the
+// order the connections started. Each direction of each TCP connection is reassembled, so a
+// ClientHello split across segments is still found. Connections that don't start with a
+// ClientHello, and ClientHellos without a server name, are skipped.
+func ExtractSNIs(f PcapFile) []string {
+	streams := make(map[Tuple]*tcpStreamBuilder)
+	order := make([]Tuple, 0)
+
+	for i := range f.Packets {
+		tuple, ok := f.Packets[i].FiveTuple()
+		if !ok || tuple.Protocol != IPP_TCP {
+			continue
+		}
+		segment, ok := f.Packets[i].Data.LinkData().InternetData().(*TCPSegment)
+		if !ok {
+			continue
+		}
+
+		stream, ok := streams[tuple]
+		if !ok {
+			stream = new(tcpStreamBuilder)
+			streams[tuple] = stream
+			order = append(order, tuple)
+		}
+		stream.add(segment)
+	}
+
+	names := make([]string, 0)
+	for _, tuple := range order {
+		// A gap later in the stream doesn't matter if the ClientHello made it in.
+		data, _ := streams[tuple].bytes()
+
+		hello, err := ParseTLSClientHello(data)
+		if err != nil || hello.ServerName == "" {
+			continue
+		}
+		names = append(names, hello.ServerName)
+	}
+
+	return names
+}
@@ -0,0 +1,88 @@
+package gopcap
+
+import (
+	"testing"
+)
+
+// tlsTestHandshake builds a ClientHello handshake message for the given server name, with a single
+// cipher suite and an empty session ID.
+func tlsTestHandshake(serverName string) []byte {
+	name := []byte(serverName)
+	sni := []byte{0x00, byte(len(name) + 3), tlsServerNameHost, 0x00, byte(len(name))}
+	sni = append(sni, name...)
+
+	extensions := []byte{0x00, tlsExtensionServerName, 0x00, byte(len(sni))}
+	extensions = append(extensions, sni...)
+	// An empty renegotiation info extension.
+	extensions = append(extensions, 0xFF, 0x01, 0x00, 0x01, 0x00)
+
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0x00, 0x00, 0x02, 0x13, 0x01, 0x01, 0x00, 0x00, byte(len(extensions)))
+	body = append(body, extensions...)
+
+	return append([]byte{tlsHandshakeClientHello, 0x00, 0x00, byte(len(body))}, body...)
+}
+
+// tlsTestRecord wraps a handshake fragment in a TLS record.
+func tlsTestRecord(fragment []byte) []byte {
+	return append([]byte{tlsRecordHandshake, 0x03, 0x01, 0x00, byte(len(fragment))}, fragment...)
+}
+
+func TestParseTLSClientHello(t *testing.T) {
+	hello, err := ParseTLSClientHello(tlsTestRecord(tlsTestHandshake("example.com")))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if hello.Version != uint16(0x0303) {
+		t.Errorf("Unexpected version: expected %v, got %v", 0x0303, hello.Version)
+	}
+	if len(hello.CipherSuites) != 1 || hello.CipherSuites[0] != uint16(0x1301) {
+		t.Errorf("Unexpected cipher suites: %v", hello.CipherSuites)
+	}
+	if len(hello.Extensions) != 2 {
+		t.Errorf("Unexpected number of extensions: expected %v, got %v", 2, len(hello.Extensions))
+	}
+	if hello.ServerName != "example.com" {
+		t.Errorf("Unexpected server name: expected %v, got %v", "example.com", hello.ServerName)
+	}
+
+	_, err = ParseTLSClientHello([]byte("GET / HTTP/1.1\r\n\r\n"))
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
+
+func TestExtractSNIs(t *testing.T) {
+	client := [4]byte{10, 0, 0, 1}
+	server := [4]byte{10, 0, 0, 2}
+
+	// The first ClientHello is in a single record split across two segments. The second is split
+	// across two records in the same segment.
+	first := tlsTestRecord(tlsTestHandshake("example.com"))
+	handshake := tlsTestHandshake("mail.example.org")
+	second := append(tlsTestRecord(handshake[:20]), tlsTestRecord(handshake[20:])...)
+	plain := []byte("GET / HTTP/1.1\r\nHost: example.net\r\n\r\n")
+
+	file := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, TLSPort, 1000, 0, "S", nil),
+		tcpTestPacket(1, server, client, TLSPort, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(2, client, server, 40000, TLSPort, 1001, 5001, "PA", first[:30]),
+		tcpTestPacket(3, client, server, 40001, 80, 2000, 6000, "PA", plain),
+		tcpTestPacket(4, client, server, 40000, TLSPort, 1031, 5001, "PA", first[30:]),
+		tcpTestPacket(5, client, server, 40002, TLSPort, 3000, 7000, "PA", second),
+	}}
+
+	names := ExtractSNIs(file)
+
+	expected := []string{"example.com", "mail.example.org"}
+	if len(names) != len(expected) {
+		t.Fatalf("Unexpected server names: expected %v, got %v", expected, names)
+	}
+	for i, name := range names {
+		if name != expected[i] {
+			t.Errorf("Unexpected server name %v: expected %v, got %v", i, expected[i], name)
+		}
+	}
+}
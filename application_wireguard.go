@@ -0,0 +1,104 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// The UDP port WireGuard listens on by default. It's only a convention, so many tunnels use other
+// ports.
+const WireGuardPort uint16 = 51820
+
+// The lengths of the encrypted fields of each WireGuard message type, apart from transport data,
+// whose length varies with the packet it carries.
+const (
+	wireGuardInitiationEncryptedLength = 48 + 28 // The static key and the timestamp.
+	wireGuardResponseEncryptedLength   = 16      // An empty message, which is just its tag.
+	wireGuardCookieEncryptedLength     = 32
+)
+
+//-----------------------------------------------------------------------------
+// WireGuardPacket
+//-----------------------------------------------------------------------------
+
+// WireGuardPacket represents a single WireGuard message. Everything past the handshake is
+// encrypted, so only the fields sent in the clear are decoded: the session indices, the ephemeral
+// public key and MACs of handshake messages, the nonce of cookie replies, and the counter of
+// transport data. The encrypted fields are left in Data. Unlike most protocols, WireGuard's
+// integers are little-endian.
+type WireGuardPacket struct {
+	Type          WireGuardMessageType
+	SenderIndex   uint32   // Handshake messages only.
+	ReceiverIndex uint32   // Every type except handshake initiations.
+	Ephemeral     [32]byte // Handshake messages only.
+	MAC1          [16]byte // Handshake messages only.
+	MAC2          [16]byte // Handshake messages only. All zeroes unless the sender had a cookie.
+	Nonce         [24]byte // Cookie replies only.
+	Counter       uint64   // Transport data only.
+	Data          []byte   // The encrypted fields.
+}
+
+func (w *WireGuardPacket) ReadFrom(src io.Reader) error {
+	// The type is followed by three reserved bytes, which are always zero.
+	var header [4]byte
+	err := readFields(src, binary.LittleEndian, []interface{}{&header})
+	if err != nil {
+		return shortReadError(err)
+	}
+
+	w.Type = WireGuardMessageType(header[0])
+	if header[1] != 0 || header[2] != 0 || header[3] != 0 {
+		return IncorrectPacket
+	}
+
+	var fields []interface{}
+	switch w.Type {
+	case WIREGUARD_HANDSHAKE_INITIATION:
+		w.Data = make([]byte, wireGuardInitiationEncryptedLength)
+		fields = []interface{}{&w.SenderIndex, &w.Ephemeral, w.Data, &w.MAC1, &w.MAC2}
+	case WIREGUARD_HANDSHAKE_RESPONSE:
+		w.Data = make([]byte, wireGuardResponseEncryptedLength)
+		fields = []interface{}{&w.SenderIndex, &w.ReceiverIndex, &w.Ephemeral, w.Data, &w.MAC1, &w.MAC2}
+	case WIREGUARD_COOKIE_REPLY:
+		w.Data = make([]byte, wireGuardCookieEncryptedLength)
+		fields = []interface{}{&w.ReceiverIndex, &w.Nonce, w.Data}
+	case WIREGUARD_TRANSPORT_DATA:
+		fields = []interface{}{&w.ReceiverIndex, &w.Counter}
+	default:
+		return IncorrectPacket
+	}
+
+	err = readFields(src, binary.LittleEndian, fields)
+	if err != nil {
+		return shortReadError(err)
+	}
+
+	rest, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	// Only transport data has a variable length.
+	if w.Type == WIREGUARD_TRANSPORT_DATA {
+		w.Data = rest
+	} else if len(rest) != 0 {
+		return IncorrectPacket
+	}
+
+	return nil
+}
+
+// WireGuard decodes the datagram's payload as WireGuard, if either port is WireGuardPort. Datagrams
+// on other ports return IncorrectPacket, so WireGuard running on a non-standard port has to be
+// decoded directly with WireGuardPacket.ReadFrom.
+func (u *UDPDatagram) WireGuard() (*WireGuardPacket, error) {
+	if u.SourcePort != WireGuardPort && u.DestinationPort != WireGuardPort {
+		return nil, IncorrectPacket
+	}
+
+	pkt := new(WireGuardPacket)
+	err := pkt.ReadFrom(bytes.NewReader(u.data))
+	return pkt, err
+}
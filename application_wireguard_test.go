@@ -0,0 +1,87 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWireGuardHandshakeInitiation(t *testing.T) {
+	// UDP header, from port 40000 to the WireGuard port.
+	data := []byte{0x9C, 0x40, 0xCA, 0x6C, 0x00, 0x9C, 0x00, 0x00}
+	// Handshake initiation from sender index 0x04030201, which is sent little-endian.
+	data = append(data, 0x01, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04)
+	data = append(data, bytes.Repeat([]byte{0x11}, 32)...)
+	data = append(data, bytes.Repeat([]byte{0xEE}, 76)...)
+	data = append(data, bytes.Repeat([]byte{0xAA}, 16)...)
+	data = append(data, make([]byte, 16)...)
+
+	udp := new(UDPDatagram)
+	err := udp.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pkt, err := udp.WireGuard()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pkt.Type != WIREGUARD_HANDSHAKE_INITIATION {
+		t.Errorf("Unexpected message type: expected %v, got %v", WIREGUARD_HANDSHAKE_INITIATION, pkt.Type)
+	}
+	if pkt.SenderIndex != uint32(0x04030201) {
+		t.Errorf("Unexpected sender index: expected %#x, got %#x", 0x04030201, pkt.SenderIndex)
+	}
+	if pkt.ReceiverIndex != 0 {
+		t.Errorf("Unexpected receiver index: %v", pkt.ReceiverIndex)
+	}
+	if !bytes.Equal(pkt.Ephemeral[:], bytes.Repeat([]byte{0x11}, 32)) {
+		t.Errorf("Unexpected ephemeral key: %v", pkt.Ephemeral)
+	}
+	if !bytes.Equal(pkt.Data, bytes.Repeat([]byte{0xEE}, 76)) {
+		t.Errorf("Unexpected encrypted data: %v", pkt.Data)
+	}
+	if !bytes.Equal(pkt.MAC1[:], bytes.Repeat([]byte{0xAA}, 16)) || pkt.MAC2 != [16]byte{} {
+		t.Errorf("Unexpected MACs: %v %v", pkt.MAC1, pkt.MAC2)
+	}
+
+	// A handshake initiation has a fixed length.
+	err = new(WireGuardPacket).ReadFrom(bytes.NewReader(data[8:100]))
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+}
+
+func TestWireGuardTransportData(t *testing.T) {
+	data := []byte{
+		0x04, 0x00, 0x00, 0x00, 0x78, 0x56, 0x34, 0x12,
+		0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xDE, 0xAD, 0xBE, 0xEF,
+	}
+	pkt := new(WireGuardPacket)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pkt.Type != WIREGUARD_TRANSPORT_DATA {
+		t.Errorf("Unexpected message type: expected %v, got %v", WIREGUARD_TRANSPORT_DATA, pkt.Type)
+	}
+	if pkt.ReceiverIndex != uint32(0x12345678) {
+		t.Errorf("Unexpected receiver index: expected %#x, got %#x", 0x12345678, pkt.ReceiverIndex)
+	}
+	if pkt.Counter != uint64(5) {
+		t.Errorf("Unexpected counter: expected %v, got %v", 5, pkt.Counter)
+	}
+	if !bytes.Equal(pkt.Data, []byte{0xDE, 0xAD, 0xBE, 0xEF}) {
+		t.Errorf("Unexpected encrypted data: %v", pkt.Data)
+	}
+}
+
+func TestWireGuardWrongPort(t *testing.T) {
+	udp := &UDPDatagram{SourcePort: 40000, DestinationPort: 53}
+
+	_, err := udp.WireGuard()
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
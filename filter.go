@@ -0,0 +1,343 @@
+package gopcap
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Filter decides whether a packet is kept. See ParseFilter and CompileFilter.
+type Filter func(pkt Packet) bool
+
+// ParseFilter behaves like Parse, but only keeps the packets that match the filter, so that the
+// rest of a large capture doesn't have to be held in memory. Filters can be written in Go, or
+// compiled from a tcpdump-style expression with CompileFilter. As with Parse, parsing stops at the
+// first packet that can't be decoded, which is returned along with the error whether it matches or
+// not.
+func ParseFilter(src io.Reader, filter Filter) (PcapFile, error) {
+	return Parser{}.ParseFilter(src, filter)
+}
+
+// ParseFilter behaves like the package's ParseFilter, reading the source with the parser's
+// options.
+func (p Parser) ParseFilter(src io.Reader, filter Filter) (PcapFile, error) {
+	r, err := p.NewReader(src)
+	if err != nil {
+		return PcapFile{}, err
+	}
+
+	file := r.Header()
+	file.Packets = make([]Packet, 0)
+
+	for {
+		pkt, err := r.Next()
+		if err == io.EOF {
+			return file, nil
+		}
+		if pkt != nil && (err != nil || filter(*pkt)) {
+			file.Packets = append(file.Packets, *pkt)
+		}
+		if err != nil {
+			return file, err
+		}
+	}
+}
+
+// FilterError records why a filter expression couldn't be compiled, and where in it the problem
+// was found.
+type FilterError struct {
+	Offset  int // The offset in the expression of the word at fault, or its length if it ended too soon.
+	Message string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("Invalid filter at offset %v: %v", e.Offset, e.Message)
+}
+
+// CompileFilter compiles a filter from an expression in a subset of tcpdump's syntax:
+//
+//	host ADDRESS        packets to or from an IPv4 or IPv6 address, including ARP packets
+//	net ADDRESS/BITS    packets to or from a subnet
+//	port NUMBER         TCP, UDP, UDP-Lite or SCTP packets to or from a port
+//	tcp, udp, sctp      packets carrying a transport protocol...
+//	icmp, icmp6         ...or ICMP
+//	ip, ip6, arp        packets with an internet-layer protocol
+//
+// Host, net and port can be qualified by src or dst, to only match the source or destination;
+// otherwise either matches. A transport protocol can be followed by a port, as in "tcp dst port
+// 80", to only match ports of that protocol. Primitives are combined with and, or and not, which
+// can also be written &&, || and !, and grouped with parentheses. Not binds tightest, while and and
+// or have the same precedence and are applied left to right, as in tcpdump, so "host a or host b
+// and port 80" means "(host a or host b) and port 80". An expression that can't be compiled
+// returns a *FilterError.
+func CompileFilter(expression string) (Filter, error) {
+	c := &filterCompiler{tokens: tokenizeFilter(expression), length: len(expression)}
+	filter, err := c.expression()
+	if err != nil {
+		return nil, err
+	}
+	if c.next < len(c.tokens) {
+		return nil, c.errorf("unexpected %q", c.tokens[c.next].text)
+	}
+	return filter, nil
+}
+
+// filterToken is a word of a filter expression, and where it starts.
+type filterToken struct {
+	text   string
+	offset int
+}
+
+// tokenizeFilter splits an expression into words, with parentheses, ! and the symbolic operators
+// as words of their own even when they aren't separated by spaces.
+func tokenizeFilter(expression string) []filterToken {
+	tokens := make([]filterToken, 0)
+	start := -1
+	end := func(i int) {
+		if start >= 0 {
+			tokens = append(tokens, filterToken{expression[start:i], start})
+			start = -1
+		}
+	}
+
+	for i := 0; i < len(expression); i++ {
+		switch c := expression[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			end(i)
+		case c == '(' || c == ')' || c == '!':
+			end(i)
+			tokens = append(tokens, filterToken{expression[i : i+1], i})
+		case (c == '&' || c == '|') && i+1 < len(expression) && expression[i+1] == c:
+			end(i)
+			tokens = append(tokens, filterToken{expression[i : i+2], i})
+			i++
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	end(len(expression))
+	return tokens
+}
+
+// filterCompiler compiles a filter by recursive descent, with a method for each level of
+// precedence.
+type filterCompiler struct {
+	tokens []filterToken
+	next   int
+	length int // The length of the expression, where errors about it ending too soon are reported.
+}
+
+// peek returns the next word, or "" at the end of the expression.
+func (c *filterCompiler) peek() string {
+	if c.next >= len(c.tokens) {
+		return ""
+	}
+	return c.tokens[c.next].text
+}
+
+// errorf returns a FilterError at the next word.
+func (c *filterCompiler) errorf(format string, args ...interface{}) error {
+	offset := c.length
+	if c.next < len(c.tokens) {
+		offset = c.tokens[c.next].offset
+	}
+	return &FilterError{Offset: offset, Message: fmt.Sprintf(format, args...)}
+}
+
+// expression compiles terms joined by and and or. As in tcpdump, they have the same precedence and
+// are applied left to right.
+func (c *filterCompiler) expression() (Filter, error) {
+	left, err := c.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var combine func(left, right Filter) Filter
+		switch c.peek() {
+		case "and", "&&":
+			combine = andFilter
+		case "or", "||":
+			combine = orFilter
+		default:
+			return left, nil
+		}
+		c.next++
+
+		right, err := c.not()
+		if err != nil {
+			return nil, err
+		}
+		left = combine(left, right)
+	}
+}
+
+func (c *filterCompiler) not() (Filter, error) {
+	switch c.peek() {
+	case "not", "!":
+		c.next++
+		filter, err := c.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(pkt Packet) bool { return !filter(pkt) }, nil
+	case "(":
+		c.next++
+		filter, err := c.expression()
+		if err != nil {
+			return nil, err
+		}
+		if c.peek() != ")" {
+			return nil, c.errorf("expected )")
+		}
+		c.next++
+		return filter, nil
+	default:
+		return c.primitive()
+	}
+}
+
+// primitive compiles a single test, such as "src port 53" or "tcp".
+func (c *filterCompiler) primitive() (Filter, error) {
+	word := c.peek()
+	switch word {
+	case "tcp", "udp", "sctp":
+		c.next++
+		protocols := map[string]IPProtocol{"tcp": IPP_TCP, "udp": IPP_UDP, "sctp": IPP_SCTP}
+		filter := protocolFilter(protocols[word])
+
+		// A transport protocol can qualify the port that follows it.
+		if next := c.peek(); next == "port" || next == "src" || next == "dst" {
+			port, err := c.primitive()
+			if err != nil {
+				return nil, err
+			}
+			filter = andFilter(filter, port)
+		}
+		return filter, nil
+	case "icmp":
+		c.next++
+		return protocolFilter(IPP_ICMP), nil
+	case "icmp6":
+		c.next++
+		return protocolFilter(IPP_IPV6_ICMP), nil
+	case "ip":
+		c.next++
+		return func(pkt Packet) bool { _, ok := pkt.Network().(*IPv4Packet); return ok }, nil
+	case "ip6":
+		c.next++
+		return func(pkt Packet) bool { _, ok := pkt.Network().(*IPv6Packet); return ok }, nil
+	case "arp":
+		c.next++
+		return func(pkt Packet) bool { _, ok := pkt.Network().(*ARPPacket); return ok }, nil
+	}
+
+	src, dst := true, true
+	switch word {
+	case "src":
+		c.next++
+		dst = false
+	case "dst":
+		c.next++
+		src = false
+	}
+
+	kind := c.peek()
+	if kind == "" {
+		return nil, c.errorf("expression ended too soon")
+	}
+	if kind != "host" && kind != "net" && kind != "port" {
+		return nil, c.errorf("unknown primitive %q", kind)
+	}
+	c.next++
+
+	value := c.peek()
+	if value == "" {
+		return nil, c.errorf("expected a value after %v", kind)
+	}
+
+	switch kind {
+	case "host":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, c.errorf("invalid address %q", value)
+		}
+		c.next++
+		return addressFilter(func(addr net.IP) bool { return addr.Equal(ip) }, src, dst), nil
+	case "net":
+		_, subnet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, c.errorf("invalid subnet %q", value)
+		}
+		c.next++
+		return addressFilter(subnet.Contains, src, dst), nil
+	default:
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, c.errorf("invalid port %q", value)
+		}
+		c.next++
+		return portFilter(uint16(port), src, dst), nil
+	}
+}
+
+func andFilter(left, right Filter) Filter {
+	return func(pkt Packet) bool { return left(pkt) && right(pkt) }
+}
+
+func orFilter(left, right Filter) Filter {
+	return func(pkt Packet) bool { return left(pkt) || right(pkt) }
+}
+
+// protocolFilter matches IP packets carrying the protocol.
+func protocolFilter(protocol IPProtocol) Filter {
+	return func(pkt Packet) bool {
+		switch network := pkt.Network().(type) {
+		case *IPv4Packet:
+			return network.Protocol == protocol
+		case *IPv6Packet:
+			return network.NextHeader == protocol
+		default:
+			return false
+		}
+	}
+}
+
+// addressFilter matches packets whose source or destination address, as chosen, matches.
+func addressFilter(matches func(net.IP) bool, src, dst bool) Filter {
+	return func(pkt Packet) bool {
+		source, destination := packetAddresses(&pkt)
+		return (src && source != nil && matches(source)) || (dst && destination != nil && matches(destination))
+	}
+}
+
+// packetAddresses returns the source and destination addresses of an IP packet, or the sender and
+// target protocol addresses of an ARP packet.
+func packetAddresses(pkt *Packet) (net.IP, net.IP) {
+	switch network := pkt.Network().(type) {
+	case IPLayer:
+		return network.Source(), network.Destination()
+	case *ARPPacket:
+		return arpAddress(network.SenderProtocolAddress), arpAddress(network.TargetProtocolAddress)
+	default:
+		return nil, nil
+	}
+}
+
+// arpAddress returns an ARP protocol address as an IP address, or nil if it isn't one.
+func arpAddress(addr []byte) net.IP {
+	if len(addr) != net.IPv4len && len(addr) != net.IPv6len {
+		return nil
+	}
+	return net.IP(addr)
+}
+
+// portFilter matches packets whose source or destination port, as chosen, is port.
+func portFilter(port uint16, src, dst bool) Filter {
+	return func(pkt Packet) bool {
+		tuple, ok := pkt.FiveTuple()
+		return ok && ((src && tuple.SourcePort == port) || (dst && tuple.DestinationPort == port))
+	}
+}
@@ -0,0 +1,164 @@
+package gopcap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCompileFilter(t *testing.T) {
+	data, err := ioutil.ReadFile("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	parsed, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	// Predicates written by hand, to check the compiled filters against.
+	router := [4]byte{192, 168, 1, 1}
+	count := func(predicate func(pkt *Packet) bool) int {
+		n := 0
+		for i := range parsed.Packets {
+			if predicate(&parsed.Packets[i]) {
+				n++
+			}
+		}
+		return n
+	}
+	fromRouter := count(func(pkt *Packet) bool {
+		switch network := pkt.Network().(type) {
+		case *IPv4Packet:
+			return network.SourceAddress == router || network.DestAddress == router
+		case *ARPPacket:
+			return bytes.Equal(network.SenderProtocolAddress, router[:]) || bytes.Equal(network.TargetProtocolAddress, router[:])
+		}
+		return false
+	})
+	dns := count(func(pkt *Packet) bool {
+		datagram, ok := pkt.Transport().(*UDPDatagram)
+		return ok && (datagram.SourcePort == 53 || datagram.DestinationPort == 53)
+	})
+	toDNS := count(func(pkt *Packet) bool {
+		ip, ok := pkt.Network().(*IPv4Packet)
+		datagram, isUDP := pkt.Transport().(*UDPDatagram)
+		return ok && isUDP && ip.SourceAddress == [4]byte{192, 168, 1, 2} && datagram.DestinationPort == 53
+	})
+	local := count(func(pkt *Packet) bool {
+		ip, ok := pkt.Network().(*IPv4Packet)
+		return ok && ip.SourceAddress[0] == 192 && ip.SourceAddress[1] == 168 && ip.SourceAddress[2] == 1
+	})
+	routerDNS := count(func(pkt *Packet) bool {
+		ip, isIPv4 := pkt.Network().(*IPv4Packet)
+		tuple, ok := pkt.FiveTuple()
+		fromRouter := isIPv4 && (ip.SourceAddress == router || ip.DestAddress == router)
+		return ok && (tuple.SourcePort == 53 || tuple.DestinationPort == 53) && (fromRouter || tuple.Protocol == IPP_TCP)
+	})
+	if fromRouter == 0 || dns == 0 || toDNS == 0 || local == 0 || routerDNS == 0 {
+		t.Fatalf("Unexpected counts: %v, %v, %v, %v, %v", fromRouter, dns, toDNS, local, routerDNS)
+	}
+
+	cases := []struct {
+		expression string
+		expected   int
+	}{
+		{"tcp", 1150},
+		{"udp", 1072},
+		{"icmp", 23},
+		{"arp", 10},
+		{"tcp or udp", 2222},
+		{"not ip", 16},
+		{"ip and not (tcp || udp)", 25},
+		{"!ip&&!arp", 6},
+		{"host 192.168.1.1", fromRouter},
+		{"udp port 53", dns},
+		{"src host 192.168.1.2 and udp dst port 53", toDNS},
+		{"src net 192.168.1.0/24 and ip", local},
+		{"tcp and udp", 0},
+
+		// And and or have the same precedence, and are applied left to right.
+		{"udp or tcp and tcp", 1150},
+		{"host 192.168.1.1 or tcp and port 53", routerDNS},
+	}
+	for _, c := range cases {
+		filter, err := CompileFilter(c.expression)
+		if err != nil {
+			t.Errorf("Unexpected error compiling %q: %v", c.expression, err)
+			continue
+		}
+		matched := count(func(pkt *Packet) bool { return filter(*pkt) })
+		if matched != c.expected {
+			t.Errorf("Unexpected matches for %q: expected %v, got %v", c.expression, c.expected, matched)
+		}
+	}
+
+	errors := []struct {
+		expression string
+		offset     int
+	}{
+		{"", 0},
+		{"tcp and", 7},
+		{"host nope", 5},
+		{"(tcp", 4},
+		{"port 70000", 5},
+		{"tcp foo", 4},
+		{"src tcp", 4},
+		{"net 10.0.0.1", 4},
+	}
+	for _, e := range errors {
+		_, err := CompileFilter(e.expression)
+		filterErr, ok := err.(*FilterError)
+		if !ok {
+			t.Errorf("Unexpected error compiling %q: expected a *FilterError, got %v", e.expression, err)
+			continue
+		}
+		if filterErr.Offset != e.offset {
+			t.Errorf("Unexpected offset for %q: expected %v, got %v (%v)", e.expression, e.offset, filterErr.Offset, err)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	data, err := ioutil.ReadFile("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+
+	filter, err := CompileFilter("icmp")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parsed, err := ParseFilter(bytes.NewReader(data), filter)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	if len(parsed.Packets) != 23 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v", 23, len(parsed.Packets))
+	}
+	for i := range parsed.Packets {
+		if _, ok := parsed.Packets[i].Transport().(*ICMPSegment); !ok {
+			t.Errorf("Unexpected packet %v: %v", i, parsed.Packets[i].Summary())
+		}
+	}
+
+	// Go predicates work as well.
+	parsed, err = ParseFilter(bytes.NewReader(data), func(pkt Packet) bool { return pkt.IncludedLen > 1000 })
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	for _, pkt := range parsed.Packets {
+		if pkt.IncludedLen <= 1000 {
+			t.Errorf("Unexpected packet of %v bytes", pkt.IncludedLen)
+		}
+	}
+
+	// A packet that can't be decoded is returned with the error, whether it matches or not.
+	parsed, err = ParseFilter(bytes.NewReader(data[:len(data)-1]), func(Packet) bool { return false })
+	if len(parsed.Packets) != 1 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v", 1, len(parsed.Packets))
+	}
+	if err == nil {
+		t.Errorf("Missing error for truncated capture")
+	}
+}
@@ -0,0 +1,148 @@
+package gopcap
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// Index records where each packet of a capture starts, so that packets can be read in any order,
+// such as by a viewer jumping around a large capture, without parsing the file from the start each
+// time. Build one with BuildIndex, which only reads the packet headers. Its offsets are into the
+// uncompressed file, so a gzip-compressed capture must be decompressed before it's read with
+// ReadPacketAt. An Index can be cached between runs with MarshalBinary and UnmarshalBinary.
+type Index struct {
+	Entries []IndexEntry
+}
+
+// IndexEntry is the position and timestamp of a single packet.
+type IndexEntry struct {
+	Offset    int64 // The offset of the packet's header from the start of the file.
+	Timestamp time.Duration
+	Header    int64 // The offset of the file header the packet is read with: zero unless files were concatenated.
+}
+
+// BuildIndex scans a pcap file once, recording the offset and timestamp of each packet. The packets'
+// data is skipped without being decoded. Like Parse, gzip-compressed sources are decompressed as
+// they're read. If a packet is cut short, the packets before it are returned along with a
+// *ParseError.
+func BuildIndex(src io.Reader) (*Index, error) {
+	return Parser{}.BuildIndex(src)
+}
+
+// BuildIndex behaves like the package's BuildIndex, reading the source with the parser's options.
+func (p Parser) BuildIndex(src io.Reader) (*Index, error) {
+	r, err := p.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &Index{Entries: make([]IndexEntry, 0)}
+	for {
+		pkt, err := r.skip()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return index, err
+		}
+
+		// The reader has moved past the packet, and any file header before it.
+		offset := r.offset - r.file.packetHeaderSize() - int64(pkt.IncludedLen)
+		index.Entries = append(index.Entries, IndexEntry{Offset: offset, Timestamp: pkt.Timestamp, Header: r.section})
+	}
+}
+
+// ReadPacket reads and decodes packet n of the file the index was built from. Errors are returned
+// as a *ParseError, as Parse returns them. See ReadPacketAt.
+func (index *Index) ReadPacket(r io.ReaderAt, n int) (Packet, error) {
+	if n < 0 || n >= len(index.Entries) {
+		return Packet{}, InvalidIndex
+	}
+
+	entry := index.Entries[n]
+	pkt, err := readPacketAt(r, entry.Header, entry.Offset)
+	if err != nil {
+		err = &ParseError{Index: n, Offset: entry.Offset, Err: err}
+	}
+	return pkt, err
+}
+
+// ReadPacketAt reads and decodes the packet whose header starts at offset, typically taken from an
+// Index. The file header is read first, for the byte ordering, timestamp resolution and link type.
+// If the packet can't be decoded, it's returned, decoded as far as possible, along with the error.
+// A packet cut short by the end of the file returns InsufficientLength, and an offset at the end of
+// the file returns io.EOF. If files were concatenated, the packet is read with the first file's
+// header; Index.ReadPacket reads each packet with the header of the file it's in.
+func ReadPacketAt(r io.ReaderAt, offset int64) (Packet, error) {
+	return readPacketAt(r, 0, offset)
+}
+
+// readPacketAt reads the packet at offset with the file header at header.
+func readPacketAt(r io.ReaderAt, header, offset int64) (Packet, error) {
+	var file PcapFile
+	_, err := file.readHeader(io.NewSectionReader(r, header, fileHeaderLength))
+	if err != nil {
+		return Packet{}, err
+	}
+
+	var pkt Packet
+	src := io.NewSectionReader(r, offset, math.MaxInt64-offset)
+	_, err = file.nextPacketHeader(&pkt, src)
+	if err == nil {
+		err = pkt.readData(src, file.order, file.LinkType, 0)
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = InsufficientLength
+	}
+	return pkt, err
+}
+
+// indexMagic starts every serialized index, so that other data isn't mistaken for one.
+var indexMagic = []byte{'g', 'p', 'i', 'x'}
+
+// indexEntryLength is the length of a serialized IndexEntry: its offset, timestamp and header
+// offset, as 64-bit integers.
+const indexEntryLength = 24
+
+// MarshalBinary serializes the index, so that it can be cached alongside its capture and restored
+// with UnmarshalBinary. The index is written as a magic number and the number of entries, followed
+// by the offset, timestamp and header offset of each, all in network byte order.
+func (index *Index) MarshalBinary() ([]byte, error) {
+	data := make([]byte, len(indexMagic)+8, len(indexMagic)+8+indexEntryLength*len(index.Entries))
+	copy(data, indexMagic)
+	networkByteOrder.PutUint64(data[len(indexMagic):], uint64(len(index.Entries)))
+
+	var entry [indexEntryLength]byte
+	for _, e := range index.Entries {
+		networkByteOrder.PutUint64(entry[0:8], uint64(e.Offset))
+		networkByteOrder.PutUint64(entry[8:16], uint64(e.Timestamp))
+		networkByteOrder.PutUint64(entry[16:24], uint64(e.Header))
+		data = append(data, entry[:]...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores an index serialized by MarshalBinary. Data that isn't a serialized
+// index, or whose length doesn't match its number of entries, returns InvalidIndex.
+func (index *Index) UnmarshalBinary(data []byte) error {
+	header := len(indexMagic) + 8
+	if len(data) < header || string(data[:len(indexMagic)]) != string(indexMagic) {
+		return InvalidIndex
+	}
+
+	count := networkByteOrder.Uint64(data[len(indexMagic):header])
+	data = data[header:]
+	if count != uint64(len(data)/indexEntryLength) || len(data)%indexEntryLength != 0 {
+		return InvalidIndex
+	}
+
+	index.Entries = make([]IndexEntry, count)
+	for i := range index.Entries {
+		entry := data[i*indexEntryLength:]
+		index.Entries[i].Offset = int64(networkByteOrder.Uint64(entry[0:8]))
+		index.Entries[i].Timestamp = time.Duration(networkByteOrder.Uint64(entry[8:16]))
+		index.Entries[i].Header = int64(networkByteOrder.Uint64(entry[16:24]))
+	}
+	return nil
+}
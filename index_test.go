@@ -0,0 +1,99 @@
+package gopcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	data, err := ioutil.ReadFile("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+
+	parsed, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	index, err := BuildIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	if len(index.Entries) != len(parsed.Packets) {
+		t.Fatalf("Unexpected number of entries: expected %v, got %v", len(parsed.Packets), len(index.Entries))
+	}
+	if index.Entries[0].Offset != fileHeaderLength {
+		t.Errorf("Unexpected offset: expected %v, got %v", fileHeaderLength, index.Entries[0].Offset)
+	}
+	expectedOffset := int64(fileHeaderLength+packetHeaderLength) + int64(parsed.Packets[0].IncludedLen)
+	if index.Entries[1].Offset != expectedOffset {
+		t.Errorf("Unexpected offset: expected %v, got %v", expectedOffset, index.Entries[1].Offset)
+	}
+
+	// Packets can be read in any order.
+	src := bytes.NewReader(data)
+	for _, i := range []int{2262, 0, 17, 1000} {
+		if index.Entries[i].Timestamp != parsed.Packets[i].Timestamp {
+			t.Errorf("Unexpected timestamp for packet %v: expected %v, got %v", i, parsed.Packets[i].Timestamp, index.Entries[i].Timestamp)
+		}
+		pkt, err := index.ReadPacket(src, i)
+		if err != nil {
+			t.Errorf("Unexpected error reading packet %v: %v", i, err)
+		}
+		if packetSummary(&pkt) != packetSummary(&parsed.Packets[i]) || !bytes.Equal(pkt.Raw, parsed.Packets[i].Raw) {
+			t.Errorf("Unexpected packet %v: expected %v, got %v", i, packetSummary(&parsed.Packets[i]), packetSummary(&pkt))
+		}
+		if !pkt.Time().Equal(parsed.Packets[i].Time()) {
+			t.Errorf("Unexpected time for packet %v: expected %v, got %v", i, parsed.Packets[i].Time(), pkt.Time())
+		}
+	}
+
+	if _, err := index.ReadPacket(src, len(index.Entries)); err != InvalidIndex {
+		t.Errorf("Unexpected error: expected %v, got %v", InvalidIndex, err)
+	}
+	if _, err := ReadPacketAt(src, int64(len(data))); err != io.EOF {
+		t.Errorf("Unexpected error: expected %v, got %v", io.EOF, err)
+	}
+	if _, err := ReadPacketAt(bytes.NewReader(data[:len(data)-1]), index.Entries[2262].Offset); err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+
+	// A truncated file is indexed up to the packet that was cut short.
+	truncated, err := BuildIndex(bytes.NewReader(data[:index.Entries[2].Offset+20]))
+	if !errors.Is(err, InsufficientLength) {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(truncated.Entries) != 2 {
+		t.Errorf("Unexpected number of entries: expected %v, got %v", 2, len(truncated.Entries))
+	}
+}
+
+func TestIndexMarshalBinary(t *testing.T) {
+	index := &Index{Entries: []IndexEntry{{Offset: 24, Timestamp: 1156534266654692000}, {Offset: 0x5c, Timestamp: 1, Header: 0x40}}}
+
+	data, err := index.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data) != 12+2*24 {
+		t.Errorf("Unexpected length: expected %v, got %v", 12+2*24, len(data))
+	}
+
+	restored := new(Index)
+	err = restored.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(restored.Entries) != 2 || restored.Entries[0] != index.Entries[0] || restored.Entries[1] != index.Entries[1] {
+		t.Errorf("Unexpected entries: expected %v, got %v", index.Entries, restored.Entries)
+	}
+
+	for _, bad := range [][]byte{nil, data[:len(data)-1], append([]byte("pcap"), data[4:]...)} {
+		if err := new(Index).UnmarshalBinary(bad); err != InvalidIndex {
+			t.Errorf("Unexpected error for %x: expected %v, got %v", bad, InvalidIndex, err)
+		}
+	}
+}
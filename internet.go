@@ -2,7 +2,15 @@ package gopcap
 
 import (
 	"bytes"
+	"encoding/binary"
 	"io"
+	"net"
+)
+
+// Both versions of IP can be handled as an IPLayer.
+var (
+	_ IPLayer = (*IPv4Packet)(nil)
+	_ IPLayer = (*IPv6Packet)(nil)
 )
 
 //-------------------------------------------------------------------------------------------
@@ -24,6 +32,11 @@ func (u *UnknownINet) ReadFrom(src io.Reader) error {
 	return u.data.ReadFrom(src)
 }
 
+// Serialize returns the packet as it was read.
+func (u *UnknownINet) Serialize() ([]byte, error) {
+	return serializeLayer(u.data)
+}
+
 //-------------------------------------------------------------------------------------------
 // IPv4
 //-------------------------------------------------------------------------------------------
@@ -52,31 +65,164 @@ func (p *IPv4Packet) InternetData() TransportLayer {
 	return p.data
 }
 
-func (p *IPv4Packet) ReadFrom(src io.Reader) error {
-	// The IPv4 header is full of crazy non-aligned fields that I've expanded in the structure.
-	// This makes this function a total nightmare. My apologies in advance.
+// Version returns the IP version of the packet, which is always 4.
+func (p *IPv4Packet) Version() uint8 {
+	return 4
+}
 
-	var versionIHL uint8
-	var DSCPECN uint8
-	var flagsFragment [2]byte
+// Source returns the source address. It refers to the packet's SourceAddress.
+func (p *IPv4Packet) Source() net.IP {
+	return net.IP(p.SourceAddress[:])
+}
 
-	err := readFields(src, networkByteOrder, []interface{}{
-		&versionIHL,
-		&DSCPECN,
-		&p.TotalLength,
-		&p.ID,
-		&flagsFragment,
-		&p.TTL,
-		&p.Protocol,
-		&p.Checksum,
-		&p.SourceAddress,
-		&p.DestAddress,
-	})
+// Destination returns the destination address. It refers to the packet's DestAddress.
+func (p *IPv4Packet) Destination() net.IP {
+	return net.IP(p.DestAddress[:])
+}
+
+// martianSourceNetworks are the IPv4 networks that should never be seen as the source of a packet:
+// this network, loopback, link-local, the documentation networks, multicast and the reserved
+// range, which includes the broadcast address.
+var martianSourceNetworks = []struct {
+	address [4]byte
+	prefix  uint
+}{
+	{[4]byte{0, 0, 0, 0}, 8},
+	{[4]byte{127, 0, 0, 0}, 8},
+	{[4]byte{169, 254, 0, 0}, 16},
+	{[4]byte{192, 0, 2, 0}, 24},
+	{[4]byte{198, 51, 100, 0}, 24},
+	{[4]byte{203, 0, 113, 0}, 24},
+	{[4]byte{224, 0, 0, 0}, 4},
+	{[4]byte{240, 0, 0, 0}, 4},
+}
 
+// HasMartianSource returns whether the source address is in a range that should never be seen as
+// a source on the wire, which suggests the packet is spoofed or malformed. 0.0.0.0 itself is
+// allowed, as DHCP clients send from it before they have an address.
+func (p *IPv4Packet) HasMartianSource() bool {
+	source := binary.BigEndian.Uint32(p.SourceAddress[:])
+	if source == 0 {
+		return false
+	}
+
+	for _, network := range martianSourceNetworks {
+		mask := ^uint32(0) << (32 - network.prefix)
+		if source&mask == binary.BigEndian.Uint32(network.address[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipv4HeaderLength is the length of an IPv4 header without options.
+const ipv4HeaderLength = 20
+
+func (p *IPv4Packet) ReadFrom(src io.Reader) error {
+	var header [ipv4HeaderLength]byte
+	_, err := io.ReadFull(src, header[:])
 	if err != nil {
 		return err
 	}
 
+	err = p.decodeHeader(header[:])
+	if err != nil {
+		return err
+	}
+
+	// If IHL is more than 5, we have (IHL - 5) * 4 bytes of options.
+	if p.IHL > 5 {
+		optionLength := uint16(p.IHL-5) * 4
+		p.Options = make([]byte, optionLength)
+		readCount, err := io.ReadFull(src, p.Options)
+		if uint16(readCount) < optionLength {
+			return InsufficientLength
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The data length is the total length, minus the headers. The headers are, for no good
+	// reason, measured in 32-bit words, so the data length is actually:
+	dataLen := p.TotalLength - (uint16(p.IHL) * 4)
+
+	internetData := make([]byte, dataLen)
+	readCount, err := io.ReadFull(src, internetData)
+	if uint16(readCount) < dataLen {
+		return InsufficientLength
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	// Build the transport layer data.
+	return p.readTransportLayer(bytes.NewReader(internetData))
+}
+
+// Serialize returns the header, including any options, followed by the serialized transport layer.
+// The total length and checksum are written as they are, not recomputed.
+func (p *IPv4Packet) Serialize() ([]byte, error) {
+	payload, err := serializeLayer(p.data)
+	if err != nil {
+		return nil, err
+	}
+	return append(p.encodeHeader(len(payload)), payload...), nil
+}
+
+// encodeHeader rebuilds the header, including any options, from its fields, leaving room for a
+// payload of the given length.
+func (p *IPv4Packet) encodeHeader(payloadLength int) []byte {
+	flagsFragment := p.FragmentOffset & 0x1FFF
+	if p.DontFragment {
+		flagsFragment |= 0x4000
+	}
+	if p.MoreFragments {
+		flagsFragment |= 0x2000
+	}
+
+	header := make([]byte, ipv4HeaderLength, ipv4HeaderLength+len(p.Options)+payloadLength)
+	header[0] = 4<<4 | p.IHL&0x0F
+	header[1] = p.DSCP<<2 | p.ECN&0x03
+	networkByteOrder.PutUint16(header[2:4], p.TotalLength)
+	networkByteOrder.PutUint16(header[4:6], p.ID)
+	networkByteOrder.PutUint16(header[6:8], flagsFragment)
+	header[8] = p.TTL
+	header[9] = uint8(p.Protocol)
+	networkByteOrder.PutUint16(header[10:12], p.Checksum)
+	copy(header[12:16], p.SourceAddress[:])
+	copy(header[16:20], p.DestAddress[:])
+
+	return append(header, p.Options...)
+}
+
+// ValidateChecksum recomputes the header checksum, which covers the header and its options but
+// not the data, and returns InvalidChecksum if it doesn't match.
+func (p *IPv4Packet) ValidateChecksum() error {
+	// Summed along with the checksum itself, a correct header sums to all ones.
+	if uint16(onesComplementSum(0, p.encodeHeader(0))) != 0xFFFF {
+		return InvalidChecksum
+	}
+	return nil
+}
+
+// decodeHeader decodes the fixed part of the header, which is followed by any options.
+func (p *IPv4Packet) decodeHeader(header []byte) error {
+	// The IPv4 header is full of crazy non-aligned fields that I've expanded in the structure.
+	// This makes this function a total nightmare. My apologies in advance.
+
+	versionIHL := header[0]
+	DSCPECN := header[1]
+	flagsFragment := header[6:8]
+
+	p.TotalLength = networkByteOrder.Uint16(header[2:4])
+	p.ID = networkByteOrder.Uint16(header[4:6])
+	p.TTL = header[8]
+	p.Protocol = IPProtocol(header[9])
+	p.Checksum = networkByteOrder.Uint16(header[10:12])
+	copy(p.SourceAddress[:], header[12:16])
+	copy(p.DestAddress[:], header[16:20])
+
 	// Check that this actually is an IPv4 packet.
 	if uint8((versionIHL&0xF0)>>4) != uint8(4) {
 		return IncorrectPacket
@@ -102,45 +248,83 @@ func (p *IPv4Packet) ReadFrom(src io.Reader) error {
 
 	// Following from the flag crazy, the fragment offset is the low 13 bits of the 7th
 	// and 8th bytes.
-	p.FragmentOffset = uint16((flagsFragment[0] & 0x1F) << 8)
+	p.FragmentOffset = uint16(flagsFragment[0]&0x1F) << 8
 	p.FragmentOffset += uint16(flagsFragment[1])
 
-	// If IHL is more than 5, we have (IHL - 5) * 4 bytes of options.
+	return nil
+}
+
+// decode decodes the packet from data without copying it, so the options and the transport
+// layer's data refer to data. Packets it can't decode in place are left to ReadFrom. See
+// ParseInto.
+func (p *IPv4Packet) decode(data []byte, layers *packetLayers) error {
+	if len(data) < ipv4HeaderLength {
+		return p.ReadFrom(bytes.NewReader(data))
+	}
+
+	err := p.decodeHeader(data)
+	if err != nil {
+		return err
+	}
+
+	headerLength := int(p.IHL) * 4
+	if headerLength < ipv4HeaderLength || int(p.TotalLength) < headerLength || headerLength > len(data) {
+		return p.ReadFrom(bytes.NewReader(data))
+	}
+
 	if p.IHL > 5 {
-		optionLength := uint16(p.IHL-5) * 4
-		p.Options = make([]byte, optionLength)
-		readCount, err := src.Read(p.Options)
-		if uint16(readCount) < optionLength {
-			return InsufficientLength
-		}
-		if err != nil {
-			return err
-		}
+		p.Options = data[ipv4HeaderLength:headerLength]
 	}
 
-	// The data length is the total length, minus the headers. The headers are, for no good
-	// reason, measured in 32-bit words, so the data length is actually:
-	dataLen := p.TotalLength - (uint16(p.IHL) * 4)
+	// A packet cut short still has its transport layer decoded as far as it goes, so that its
+	// header is available, but the packet is reported as short, as ReadFrom would.
+	end := int(p.TotalLength)
+	if end > len(data) {
+		end = len(data)
+	}
 
-	internetData := make([]byte, dataLen)
-	readCount, err := src.Read(internetData)
-	if uint16(readCount) < dataLen {
-		return InsufficientLength
+	payload := data[headerLength:end]
+	switch p.Protocol {
+	case IPP_TCP:
+		t := layers.tcpSegment()
+		p.data = t
+		err = t.decode(payload)
+	case IPP_UDP:
+		u := layers.udpDatagram()
+		p.data = u
+		err = u.decode(payload)
+	default:
+		err = p.readTransportLayer(bytes.NewReader(payload))
 	}
-	if err != nil && err != io.EOF {
-		return err
+	if err == nil && end < int(p.TotalLength) {
+		return InsufficientLength
 	}
+	return err
+}
 
-	// Build the transport layer data.
-	return p.readTransportLayer(bytes.NewReader(internetData))
+// PseudoHeader builds the IPv4 pseudo-header used when computing TCP and UDP checksums, for a
+// transport-layer segment of the given protocol and length (header plus data, in bytes).
+func (p *IPv4Packet) PseudoHeader(protocol IPProtocol, length uint16) []byte {
+	header := make([]byte, 12)
+	copy(header[0:4], p.SourceAddress[:])
+	copy(header[4:8], p.DestAddress[:])
+	header[9] = uint8(protocol)
+	networkByteOrder.PutUint16(header[10:12], length)
+	return header
 }
 
 func (p *IPv4Packet) readTransportLayer(src io.Reader) error {
 	switch p.Protocol {
+	case IPP_ICMP:
+		p.data = new(ICMPSegment)
 	case IPP_TCP:
 		p.data = new(TCPSegment)
 	case IPP_UDP:
 		p.data = new(UDPDatagram)
+	case IPP_UDPLITE:
+		p.data = new(UDPLiteDatagram)
+	case IPP_GRE:
+		p.data = new(GREHeader)
 	case IPP_SCTP:
 		p.data = new(SCTPSegment)
 	default:
@@ -153,9 +337,21 @@ func (p *IPv4Packet) readTransportLayer(src io.Reader) error {
 // IPv6
 //-------------------------------------------------------------------------------------------
 
+// FlowLabel is the 20-bit flow label carried in an IPv6 header. The top 12 bits are always zero.
+type FlowLabel uint32
+
+// flowLabelMask covers the 20 bits of a FlowLabel.
+const flowLabelMask uint32 = 0x000FFFFF
+
+// NewFlowLabel builds a FlowLabel from the low 20 bits of the given value.
+func NewFlowLabel(value uint32) FlowLabel {
+	return FlowLabel(value & flowLabelMask)
+}
+
+// IPv6Packet represents an unpacked IPv6 packet.
 type IPv6Packet struct {
 	TrafficClass       uint8
-	FlowLabel          uint32 // This is a huge waste of space for a 20-bit field. Rethink?
+	FlowLabel          FlowLabel
 	Length             uint16
 	NextHeader         IPProtocol
 	HopLimit           uint8
@@ -168,40 +364,143 @@ func (p *IPv6Packet) InternetData() TransportLayer {
 	return p.data
 }
 
-func (p *IPv6Packet) ReadFrom(src io.Reader) error {
+// Version returns the IP version of the packet, which is always 6.
+func (p *IPv6Packet) Version() uint8 {
+	return 6
+}
 
-	var startBytes [4]byte
+// Source returns the source address. It refers to the packet's SourceAddress.
+func (p *IPv6Packet) Source() net.IP {
+	return net.IP(p.SourceAddress[:])
+}
 
-	err := readFields(src, networkByteOrder, []interface{}{
-		&startBytes,
-		&p.Length,
-		&p.NextHeader,
-		&p.HopLimit,
-		&p.SourceAddress,
-		&p.DestinationAddress,
-	})
+// Destination returns the destination address. It refers to the packet's DestinationAddress.
+func (p *IPv6Packet) Destination() net.IP {
+	return net.IP(p.DestinationAddress[:])
+}
+
+// DSCP returns the differentiated services code point: the high six bits of the traffic class.
+func (p *IPv6Packet) DSCP() uint8 {
+	return p.TrafficClass >> 2
+}
+
+// ECN returns the explicit congestion notification bits: the low two bits of the traffic class.
+func (p *IPv6Packet) ECN() uint8 {
+	return p.TrafficClass & 0x03
+}
+
+// ipv6HeaderLength is the length of the fixed IPv6 header.
+const ipv6HeaderLength = 40
 
+func (p *IPv6Packet) ReadFrom(src io.Reader) error {
+	var header [ipv6HeaderLength]byte
+	_, err := io.ReadFull(src, header[:])
 	if err != nil {
 		return err
 	}
 
+	err = p.decodeHeader(header[:])
+	if err != nil {
+		return err
+	}
+
+	// Following the fixed headers are a sequence of extension headers
+	// terminating in the transport data. They end with the payload, so any link-layer padding or
+	// trailer after it isn't taken for transport data.
+	return p.readRemainingHeaders(io.LimitReader(src, int64(p.Length)))
+}
+
+// Serialize returns the fixed header followed by the serialized transport layer. Extension headers
+// aren't decoded, so they're part of the transport layer's data. The payload length is written as
+// it is, not recomputed.
+func (p *IPv6Packet) Serialize() ([]byte, error) {
+	payload, err := serializeLayer(p.data)
+	if err != nil {
+		return nil, err
+	}
+	return append(p.encodeHeader(len(payload)), payload...), nil
+}
+
+// encodeHeader rebuilds the fixed header from its fields, leaving room for a payload of the given
+// length.
+func (p *IPv6Packet) encodeHeader(payloadLength int) []byte {
+	header := make([]byte, ipv6HeaderLength, ipv6HeaderLength+payloadLength)
+	networkByteOrder.PutUint32(header[0:4], 6<<28|uint32(p.TrafficClass)<<20|uint32(p.FlowLabel)&flowLabelMask)
+	networkByteOrder.PutUint16(header[4:6], p.Length)
+	header[6] = uint8(p.NextHeader)
+	header[7] = p.HopLimit
+	copy(header[8:24], p.SourceAddress[:])
+	copy(header[24:40], p.DestinationAddress[:])
+	return header
+}
+
+// decodeHeader decodes the fixed header, which is followed by any extension headers.
+func (p *IPv6Packet) decodeHeader(header []byte) error {
+	versionClassLabel := networkByteOrder.Uint32(header[0:4])
+	p.Length = networkByteOrder.Uint16(header[4:6])
+	p.NextHeader = IPProtocol(header[6])
+	p.HopLimit = header[7]
+	copy(p.SourceAddress[:], header[8:24])
+	copy(p.DestinationAddress[:], header[24:40])
+
 	// Check that this actually is an IPv6 packet.
-	if ((uint8(startBytes[0]) & 0xF0) >> 4) != uint8(6) {
+	if uint8(versionClassLabel>>28) != uint8(6) {
 		return IncorrectPacket
 	}
 
-	// The traffic class is the octet following the version.
-	p.TrafficClass = (uint8(startBytes[0]) & 0x0F) << 4
-	p.TrafficClass += (uint8(startBytes[1]) & 0xF0) >> 4
+	// The traffic class is the octet following the version, and the flow label is the
+	// remaining 20 bits.
+	p.TrafficClass = uint8(versionClassLabel >> 20)
+	p.FlowLabel = NewFlowLabel(versionClassLabel)
 
-	// The flow label is the next 20 bits.
-	p.FlowLabel = (uint32(startBytes[1]) & 0x0F) << 16
-	p.FlowLabel += uint32(startBytes[2]) << 8
-	p.FlowLabel += uint32(startBytes[3])
+	return nil
+}
 
-	// Following the fixed headers are a sequence of extension headers
-	// terminating in the transport data.
-	return p.readRemainingHeaders(src)
+// decode decodes the packet from data without copying it, so the transport layer's data refers
+// to data. Packets it can't decode in place are left to ReadFrom. See ParseInto.
+func (p *IPv6Packet) decode(data []byte, layers *packetLayers) error {
+	if len(data) < ipv6HeaderLength {
+		return p.ReadFrom(bytes.NewReader(data))
+	}
+
+	err := p.decodeHeader(data)
+	if err != nil {
+		return err
+	}
+
+	// Like ReadFrom, the transport layer gets the payload after the fixed header, or as much of it as
+	// was captured.
+	payload := data[ipv6HeaderLength:]
+	if end := ipv6HeaderLength + int(p.Length); end < len(data) {
+		payload = data[ipv6HeaderLength:end]
+	}
+	switch p.NextHeader {
+	case IPP_TCP:
+		t := layers.tcpSegment()
+		p.data = t
+		return t.decode(payload)
+	case IPP_UDP:
+		u := layers.udpDatagram()
+		p.data = u
+		return u.decode(payload)
+	default:
+		return p.readRemainingHeaders(bytes.NewReader(payload))
+	}
+}
+
+// ipv6PseudoHeaderLength is the length of the IPv6 pseudo-header.
+const ipv6PseudoHeaderLength = 40
+
+// PseudoHeader builds the IPv6 pseudo-header used when computing TCP and UDP checksums, for a
+// transport-layer segment of the given protocol and length (header plus data, in bytes). Unlike
+// IPv4, the length is 32 bits and the protocol comes last.
+func (p *IPv6Packet) PseudoHeader(protocol IPProtocol, length uint32) []byte {
+	header := make([]byte, ipv6PseudoHeaderLength)
+	copy(header[0:16], p.SourceAddress[:])
+	copy(header[16:32], p.DestinationAddress[:])
+	networkByteOrder.PutUint32(header[32:36], length)
+	header[39] = uint8(protocol)
+	return header
 }
 
 func (p *IPv6Packet) readRemainingHeaders(src io.Reader) error {
@@ -209,10 +508,16 @@ func (p *IPv6Packet) readRemainingHeaders(src io.Reader) error {
 	// isn't the transport data then give up and interpret it as an unknown
 	// transport type.
 	switch p.NextHeader {
+	case IPP_IPV6_ICMP:
+		p.data = &ICMPSegment{ipv6: true}
 	case IPP_TCP:
 		p.data = new(TCPSegment)
 	case IPP_UDP:
 		p.data = new(UDPDatagram)
+	case IPP_UDPLITE:
+		p.data = new(UDPLiteDatagram)
+	case IPP_GRE:
+		p.data = new(GREHeader)
 	case IPP_SCTP:
 		p.data = new(SCTPSegment)
 	default:
@@ -220,3 +525,208 @@ func (p *IPv6Packet) readRemainingHeaders(src io.Reader) error {
 	}
 	return p.data.ReadFrom(src)
 }
+
+//-------------------------------------------------------------------------------------------
+// ARP
+//-------------------------------------------------------------------------------------------
+
+// ARPPacket represents an Address Resolution Protocol packet. The address fields are sized by the
+// hardware and protocol address lengths in the header, so for Ethernet and IPv4 they hold six and
+// four bytes respectively. ARP doesn't carry a transport layer, so InternetData returns nil.
+type ARPPacket struct {
+	HardwareType          uint16
+	ProtocolType          EtherType
+	HardwareLength        uint8
+	ProtocolLength        uint8
+	Operation             ARPOperation
+	SenderHardwareAddress []byte
+	SenderProtocolAddress []byte
+	TargetHardwareAddress []byte
+	TargetProtocolAddress []byte
+}
+
+func (a *ARPPacket) InternetData() TransportLayer {
+	return nil
+}
+
+func (a *ARPPacket) ReadFrom(src io.Reader) error {
+	err := readFields(src, networkByteOrder, []interface{}{
+		&a.HardwareType,
+		&a.ProtocolType,
+		&a.HardwareLength,
+		&a.ProtocolLength,
+		&a.Operation,
+	})
+
+	if err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	a.SenderHardwareAddress = make([]byte, a.HardwareLength)
+	a.SenderProtocolAddress = make([]byte, a.ProtocolLength)
+	a.TargetHardwareAddress = make([]byte, a.HardwareLength)
+	a.TargetProtocolAddress = make([]byte, a.ProtocolLength)
+
+	for _, addr := range [][]byte{a.SenderHardwareAddress, a.SenderProtocolAddress, a.TargetHardwareAddress, a.TargetProtocolAddress} {
+		_, err = io.ReadFull(src, addr)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return InsufficientLength
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Anything else is padding to the minimum frame size, and is ignored.
+	return nil
+}
+
+// Serialize returns the packet, without any padding it was read with.
+func (a *ARPPacket) Serialize() ([]byte, error) {
+	var packet bytes.Buffer
+	err := writeFields(&packet, networkByteOrder, []interface{}{
+		a.HardwareType,
+		a.ProtocolType,
+		a.HardwareLength,
+		a.ProtocolLength,
+		a.Operation,
+		a.SenderHardwareAddress,
+		a.SenderProtocolAddress,
+		a.TargetHardwareAddress,
+		a.TargetProtocolAddress,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return packet.Bytes(), nil
+}
+
+//-------------------------------------------------------------------------------------------
+// PPPoE
+//-------------------------------------------------------------------------------------------
+
+// PPPoESession represents a PPPoE session stage packet, which carries a single PPP frame. The PPP
+// frame's own network layer is available from Payload, and InternetData passes straight through to
+// its transport layer.
+type PPPoESession struct {
+	Version   uint8
+	Type      uint8
+	Code      uint8
+	SessionID uint16
+	Length    uint16 // The length of the PPP frame, including the protocol field.
+	Protocol  PPPProtocol
+	payload   InternetLayer
+}
+
+// Payload returns the network layer carried in the PPP frame.
+func (p *PPPoESession) Payload() InternetLayer {
+	return p.payload
+}
+
+func (p *PPPoESession) InternetData() TransportLayer {
+	if p.payload == nil {
+		return nil
+	}
+	return p.payload.InternetData()
+}
+
+func (p *PPPoESession) ReadFrom(src io.Reader) error {
+	var versionType uint8
+	err := readFields(src, networkByteOrder, []interface{}{
+		&versionType,
+		&p.Code,
+		&p.SessionID,
+		&p.Length,
+		&p.Protocol,
+	})
+
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	// The version and type share a byte, and are both always 1.
+	p.Version = versionType >> 4
+	p.Type = versionType & 0x0F
+
+	if p.Length < 2 {
+		return IncorrectPacket
+	}
+
+	// The length excludes any padding added to reach the minimum Ethernet frame size.
+	p.payload, err = readPPPPayload(io.LimitReader(src, int64(p.Length-2)), p.Protocol)
+	return err
+}
+
+//-------------------------------------------------------------------------------------------
+// MPLS
+//-------------------------------------------------------------------------------------------
+
+// MPLSLabel represents a single entry in an MPLS label stack.
+type MPLSLabel struct {
+	Label         uint32 // The 20-bit label value.
+	TrafficClass  uint8
+	BottomOfStack bool
+	TTL           uint8
+}
+
+// MPLSPacket represents an MPLS label stack and the packet it carries. MPLS doesn't identify the
+// protocol it carries, so IPv4 and IPv6 are told apart by their version nibble, and anything else
+// (such as a pseudowire) is left as an UnknownINet. The carried packet is available from Payload,
+// and InternetData passes straight through to its transport layer.
+type MPLSPacket struct {
+	Labels  []MPLSLabel // The label stack, outermost first.
+	payload InternetLayer
+}
+
+// Payload returns the network layer carried beneath the label stack.
+func (m *MPLSPacket) Payload() InternetLayer {
+	return m.payload
+}
+
+func (m *MPLSPacket) InternetData() TransportLayer {
+	if m.payload == nil {
+		return nil
+	}
+	return m.payload.InternetData()
+}
+
+func (m *MPLSPacket) ReadFrom(src io.Reader) error {
+	m.Labels = make([]MPLSLabel, 0, 2)
+
+	// Keep reading label entries until one has the bottom of stack bit set.
+	for {
+		var entry uint32
+		err := binary.Read(src, networkByteOrder, &entry)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return InsufficientLength
+		}
+		if err != nil {
+			return err
+		}
+
+		label := MPLSLabel{
+			Label:         entry >> 12,
+			TrafficClass:  uint8(entry>>9) & 0x07,
+			BottomOfStack: entry&0x100 != 0,
+			TTL:           uint8(entry),
+		}
+		m.Labels = append(m.Labels, label)
+
+		if label.BottomOfStack {
+			break
+		}
+	}
+
+	var err error
+	m.payload, err = readIPByVersion(src)
+	if err == UnknownIPVersion {
+		return nil
+	}
+	return err
+}
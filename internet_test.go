@@ -64,6 +64,9 @@ func TestIPv4Good(t *testing.T) {
 	if len(pkt.Options) != 0 {
 		t.Errorf("Shouldn't have any options: got %v", pkt.Options)
 	}
+	if pkt.Version() != uint8(4) {
+		t.Errorf("Unexpected version: expected %v, got %v", 4, pkt.Version())
+	}
 	pkt.InternetData()
 }
 
@@ -81,10 +84,13 @@ func TestIPv6Good(t *testing.T) {
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
+	if pkt.Version() != uint8(6) {
+		t.Errorf("Unexpected version: expected %v, got %v", 6, pkt.Version())
+	}
 	if pkt.TrafficClass != uint8(0) {
 		t.Errorf("Unexpected traffic class: expected %v, got %v", 0, pkt.TrafficClass)
 	}
-	if pkt.FlowLabel != uint32(0) {
+	if pkt.FlowLabel != FlowLabel(0) {
 		t.Errorf("Unexpected flow label: expected %v, got %v", 0, pkt.FlowLabel)
 	}
 	if pkt.Length != uint16(12) {
@@ -106,3 +112,278 @@ func TestIPv6Good(t *testing.T) {
 		t.Errorf("Unexpected transport type: expected UDPDatagram, got %v", reflect.TypeOf(pkt.InternetData()))
 	}
 }
+
+func TestIPv6FlowLabel(t *testing.T) {
+	// A header with traffic class 0xB9 (DSCP 46, ECN 1) and flow label 0xFBEEF.
+	data := []byte{
+		0x6B, 0x9F, 0xBE, 0xEF, 0x00, 0x00, 0x3B, 0x40, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e, 0xff, 0x02,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c,
+	}
+	pkt := new(IPv6Packet)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if pkt.TrafficClass != uint8(0xB9) {
+		t.Errorf("Unexpected traffic class: expected %v, got %v", 0xB9, pkt.TrafficClass)
+	}
+	if pkt.DSCP() != uint8(46) {
+		t.Errorf("Unexpected DSCP: expected %v, got %v", 46, pkt.DSCP())
+	}
+	if pkt.ECN() != uint8(1) {
+		t.Errorf("Unexpected ECN: expected %v, got %v", 1, pkt.ECN())
+	}
+	if pkt.FlowLabel != FlowLabel(0xFBEEF) {
+		t.Errorf("Unexpected flow label: expected %v, got %v", 0xFBEEF, pkt.FlowLabel)
+	}
+	if uint32(pkt.FlowLabel)&^flowLabelMask != 0 {
+		t.Errorf("Flow label has bits set above bit 20: %v", pkt.FlowLabel)
+	}
+	if NewFlowLabel(0xFFFFBEEF) != FlowLabel(0xFBEEF) {
+		t.Errorf("Unexpected masked flow label: expected %v, got %v", 0xFBEEF, NewFlowLabel(0xFFFFBEEF))
+	}
+}
+
+func TestIPv4PseudoHeader(t *testing.T) {
+	pkt := &IPv4Packet{
+		SourceAddress: [4]byte{192, 168, 1, 2},
+		DestAddress:   [4]byte{212, 204, 214, 114},
+	}
+	expected := []byte{192, 168, 1, 2, 212, 204, 214, 114, 0x00, 0x06, 0x00, 0x3E}
+	header := pkt.PseudoHeader(IPP_TCP, 62)
+
+	if !bytes.Equal(header, expected) {
+		t.Errorf("Unexpected pseudo-header: expected %v, got %v", expected, header)
+	}
+}
+
+func TestIPv6PseudoHeader(t *testing.T) {
+	pkt := &IPv6Packet{
+		SourceAddress:      [16]byte{0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e},
+		DestinationAddress: [16]byte{0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c},
+	}
+	expected := []byte{
+		0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x11,
+	}
+	header := pkt.PseudoHeader(IPP_UDP, 12)
+
+	if !bytes.Equal(header, expected) {
+		t.Errorf("Unexpected pseudo-header: expected %v, got %v", expected, header)
+	}
+}
+
+func TestARPReply(t *testing.T) {
+	// An Ethernet frame carrying an ARP reply, padded to the minimum frame size.
+	data := []byte{
+		0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x08, 0x06, 0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x02, 0x00, 0x04,
+		0x76, 0x96, 0x7B, 0xDA, 0xC0, 0xA8, 0x01, 0x01, 0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0xC0, 0xA8, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	expectedSenderMAC := []byte{0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA}
+	expectedSenderIP := []byte{192, 168, 1, 1}
+	expectedTargetMAC := []byte{0x00, 0x16, 0xE3, 0x19, 0x27, 0x15}
+	expectedTargetIP := []byte{192, 168, 1, 2}
+	frame := new(EthernetFrame)
+	err := frame.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	pkt, isARP := frame.LinkData().(*ARPPacket)
+	if !isARP {
+		t.Fatalf("Unexpected internet layer: expected ARPPacket, got %v", reflect.TypeOf(frame.LinkData()))
+	}
+	if pkt.HardwareType != uint16(1) {
+		t.Errorf("Unexpected hardware type: expected %v, got %v", 1, pkt.HardwareType)
+	}
+	if pkt.ProtocolType != ETHERTYPE_IPV4 {
+		t.Errorf("Unexpected protocol type: expected %v, got %v", ETHERTYPE_IPV4, pkt.ProtocolType)
+	}
+	if pkt.HardwareLength != uint8(6) || pkt.ProtocolLength != uint8(4) {
+		t.Errorf("Unexpected address lengths: got %v and %v", pkt.HardwareLength, pkt.ProtocolLength)
+	}
+	if pkt.Operation != ARP_REPLY {
+		t.Errorf("Unexpected operation: expected %v, got %v", ARP_REPLY, pkt.Operation)
+	}
+	if !bytes.Equal(pkt.SenderHardwareAddress, expectedSenderMAC) {
+		t.Errorf("Unexpected sender MAC: expected %v, got %v", expectedSenderMAC, pkt.SenderHardwareAddress)
+	}
+	if !bytes.Equal(pkt.SenderProtocolAddress, expectedSenderIP) {
+		t.Errorf("Unexpected sender IP: expected %v, got %v", expectedSenderIP, pkt.SenderProtocolAddress)
+	}
+	if !bytes.Equal(pkt.TargetHardwareAddress, expectedTargetMAC) {
+		t.Errorf("Unexpected target MAC: expected %v, got %v", expectedTargetMAC, pkt.TargetHardwareAddress)
+	}
+	if !bytes.Equal(pkt.TargetProtocolAddress, expectedTargetIP) {
+		t.Errorf("Unexpected target IP: expected %v, got %v", expectedTargetIP, pkt.TargetProtocolAddress)
+	}
+	if pkt.InternetData() != nil {
+		t.Errorf("Unexpected transport layer: %v", pkt.InternetData())
+	}
+}
+
+func TestPPPoESession(t *testing.T) {
+	// An Ethernet frame carrying a PPPoE session packet with an IPv4 UDP datagram, padded to the
+	// minimum frame size.
+	data := []byte{
+		0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x88, 0x64,
+		0x11, 0x00, 0x00, 0x2A, 0x00, 0x1E, 0x00, 0x21,
+		0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+		0x04, 0xD2, 0x16, 0x2E, 0x00, 0x08, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	frame := new(EthernetFrame)
+	err := frame.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	pkt, isPPPoE := frame.LinkData().(*PPPoESession)
+	if !isPPPoE {
+		t.Fatalf("Unexpected internet layer: expected a PPPoE session, got %T", frame.LinkData())
+	}
+	if pkt.Version != uint8(1) || pkt.Type != uint8(1) {
+		t.Errorf("Unexpected version and type: expected 1 and 1, got %v and %v", pkt.Version, pkt.Type)
+	}
+	if pkt.Code != uint8(0) {
+		t.Errorf("Unexpected code: expected %v, got %v", 0, pkt.Code)
+	}
+	if pkt.SessionID != uint16(0x2A) {
+		t.Errorf("Unexpected session ID: expected %v, got %v", 0x2A, pkt.SessionID)
+	}
+	if pkt.Length != uint16(30) {
+		t.Errorf("Unexpected length: expected %v, got %v", 30, pkt.Length)
+	}
+	if pkt.Protocol != PPP_PROTOCOL_IPV4 {
+		t.Errorf("Unexpected protocol: expected %v, got %v", PPP_PROTOCOL_IPV4, pkt.Protocol)
+	}
+
+	ip, isIPv4 := pkt.Payload().(*IPv4Packet)
+	if !isIPv4 {
+		t.Fatalf("Unexpected payload: expected an IPv4 packet, got %T", pkt.Payload())
+	}
+	if ip.SourceAddress != [4]byte{10, 0, 0, 1} {
+		t.Errorf("Unexpected source address: %v", ip.SourceAddress)
+	}
+	udp, isUDP := pkt.InternetData().(*UDPDatagram)
+	if !isUDP {
+		t.Fatalf("Unexpected transport layer: expected a UDP datagram, got %T", pkt.InternetData())
+	}
+	if udp.SourcePort != uint16(1234) {
+		t.Errorf("Unexpected source port: expected %v, got %v", 1234, udp.SourcePort)
+	}
+}
+
+func TestPPPoESessionLCP(t *testing.T) {
+	// An LCP echo request isn't a network layer protocol, so it's left undecoded.
+	data := []byte{0x11, 0x00, 0x00, 0x2A, 0x00, 0x0A, 0xC0, 0x21, 0x09, 0x01, 0x00, 0x08, 0x01, 0x02, 0x03, 0x04}
+	pkt := new(PPPoESession)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if pkt.Protocol != PPP_PROTOCOL_LCP {
+		t.Errorf("Unexpected protocol: expected %v, got %v", PPP_PROTOCOL_LCP, pkt.Protocol)
+	}
+	if _, isUnknown := pkt.Payload().(*UnknownINet); !isUnknown {
+		t.Errorf("Unexpected payload: expected an unknown packet, got %T", pkt.Payload())
+	}
+}
+
+func TestMPLSTwoLabels(t *testing.T) {
+	// An Ethernet frame carrying two MPLS labels over an IPv4 UDP datagram.
+	data := []byte{
+		0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x88, 0x47,
+		0x00, 0x01, 0x0A, 0x40, 0x00, 0x06, 0x51, 0x3F,
+		0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+		0x04, 0xD2, 0x16, 0x2E, 0x00, 0x08, 0x00, 0x00,
+	}
+	expected := []MPLSLabel{
+		{Label: 16, TrafficClass: 5, BottomOfStack: false, TTL: 64},
+		{Label: 101, TrafficClass: 0, BottomOfStack: true, TTL: 63},
+	}
+	frame := new(EthernetFrame)
+	err := frame.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	pkt, isMPLS := frame.LinkData().(*MPLSPacket)
+	if !isMPLS {
+		t.Fatalf("Unexpected internet layer: expected MPLS, got %T", frame.LinkData())
+	}
+	if !reflect.DeepEqual(pkt.Labels, expected) {
+		t.Errorf("Unexpected labels: expected %v, got %v", expected, pkt.Labels)
+	}
+
+	ip, isIPv4 := pkt.Payload().(*IPv4Packet)
+	if !isIPv4 {
+		t.Fatalf("Unexpected payload: expected an IPv4 packet, got %T", pkt.Payload())
+	}
+	if ip.DestAddress != [4]byte{10, 0, 0, 2} {
+		t.Errorf("Unexpected destination address: %v", ip.DestAddress)
+	}
+	if _, isUDP := pkt.InternetData().(*UDPDatagram); !isUDP {
+		t.Errorf("Unexpected transport layer: expected a UDP datagram, got %T", pkt.InternetData())
+	}
+}
+
+func TestIPv4MartianSource(t *testing.T) {
+	sources := map[[4]byte]bool{
+		{0, 0, 0, 0}:         false,
+		{0, 1, 2, 3}:         true,
+		{127, 0, 0, 1}:       true,
+		{169, 254, 10, 1}:    true,
+		{198, 51, 100, 7}:    true,
+		{224, 0, 0, 251}:     true,
+		{255, 255, 255, 255}: true,
+		{192, 168, 1, 2}:     false,
+		{8, 8, 8, 8}:         false,
+		{128, 0, 0, 1}:       false,
+	}
+
+	for source, martian := range sources {
+		pkt := &IPv4Packet{SourceAddress: source}
+		if pkt.HasMartianSource() != martian {
+			t.Errorf("Unexpected martian check for %v: expected %v, got %v", source, martian, !martian)
+		}
+	}
+}
+
+func TestIPLayer(t *testing.T) {
+	ipv4 := &IPv4Packet{SourceAddress: [4]byte{10, 0, 0, 1}, DestAddress: [4]byte{10, 0, 0, 2}}
+	ipv6 := &IPv6Packet{SourceAddress: [16]byte{0x20, 0x01, 0x0D, 0xB8, 15: 0x01}, DestinationAddress: [16]byte{0x20, 0x01, 0x0D, 0xB8, 15: 0x02}}
+
+	cases := []struct {
+		layer       InternetLayer
+		version     uint8
+		source      string
+		destination string
+	}{
+		{ipv4, 4, "10.0.0.1", "10.0.0.2"},
+		{ipv6, 6, "2001:db8::1", "2001:db8::2"},
+	}
+
+	for _, c := range cases {
+		ip, ok := c.layer.(IPLayer)
+		if !ok {
+			t.Fatalf("Unexpected internet layer: %T isn't an IPLayer", c.layer)
+		}
+		if ip.Version() != c.version {
+			t.Errorf("Unexpected version: expected %v, got %v", c.version, ip.Version())
+		}
+		if ip.Source().String() != c.source || ip.Destination().String() != c.destination {
+			t.Errorf("Unexpected addresses: expected %v > %v, got %v > %v", c.source, c.destination, ip.Source(), ip.Destination())
+		}
+	}
+
+	if _, ok := InternetLayer(new(ARPPacket)).(IPLayer); ok {
+		t.Errorf("Unexpected IPLayer: ARP isn't IP")
+	}
+}
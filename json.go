@@ -0,0 +1,247 @@
+package gopcap
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"time"
+)
+
+// Packets marshal to JSON for use outside Go, for example by analytics tools. Each layer becomes an
+// object whose "type" field says which layer it is, and which holds the layer above it in "data".
+// Addresses are written as strings, flags as booleans, and payloads as base64. Layers without a
+// MarshalJSON method of their own are written with the name of their type and, under "fields",
+// their exported fields. A Packet marshals the same way whether it's a value or a pointer.
+
+// The types of the layers marshalled to JSON.
+const (
+	jsonTypeEthernet = "ethernet"
+	jsonTypeIPv4     = "ipv4"
+	jsonTypeIPv6     = "ipv6"
+	jsonTypeTCP      = "tcp"
+	jsonTypeUDP      = "udp"
+)
+
+func (pkt Packet) MarshalJSON() ([]byte, error) {
+	data, err := layerJSON(pkt.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		Timestamp   time.Time       `json:"timestamp"`
+		IncludedLen uint32          `json:"included_length"`
+		ActualLen   uint32          `json:"actual_length"`
+		Data        json.RawMessage `json:"data"`
+	}{pkt.Time(), pkt.IncludedLen, pkt.ActualLen, data})
+}
+
+func (e *EthernetFrame) MarshalJSON() ([]byte, error) {
+	data, err := layerJSON(e.data)
+	if err != nil {
+		return nil, err
+	}
+
+	type vlanTag struct {
+		TPID   EtherType `json:"tpid"`
+		PCP    uint8     `json:"pcp"`
+		DEI    bool      `json:"dei"`
+		VLANID uint16    `json:"vlan_id"`
+	}
+	tags := make([]vlanTag, len(e.VLANTags))
+	for i, tag := range e.VLANTags {
+		tags[i] = vlanTag(tag)
+	}
+
+	return json.Marshal(struct {
+		Type           string          `json:"type"`
+		MACSource      string          `json:"mac_source"`
+		MACDestination string          `json:"mac_destination"`
+		VLANTags       []vlanTag       `json:"vlan_tags,omitempty"`
+		Length         uint16          `json:"length,omitempty"`
+		EtherType      EtherType       `json:"ethertype"`
+		Truncated      bool            `json:"truncated,omitempty"`
+		Data           json.RawMessage `json:"data"`
+	}{
+		Type:           jsonTypeEthernet,
+		MACSource:      net.HardwareAddr(e.MACSource[:]).String(),
+		MACDestination: net.HardwareAddr(e.MACDestination[:]).String(),
+		VLANTags:       tags,
+		Length:         e.Length,
+		EtherType:      e.EtherType,
+		Truncated:      e.Truncated,
+		Data:           data,
+	})
+}
+
+func (p *IPv4Packet) MarshalJSON() ([]byte, error) {
+	data, err := layerJSON(p.data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		Type           string          `json:"type"`
+		IHL            uint8           `json:"ihl"`
+		DSCP           uint8           `json:"dscp"`
+		ECN            uint8           `json:"ecn"`
+		TotalLength    uint16          `json:"total_length"`
+		ID             uint16          `json:"id"`
+		DontFragment   bool            `json:"dont_fragment"`
+		MoreFragments  bool            `json:"more_fragments"`
+		FragmentOffset uint16          `json:"fragment_offset"`
+		TTL            uint8           `json:"ttl"`
+		Protocol       IPProtocol      `json:"protocol"`
+		Checksum       uint16          `json:"checksum"`
+		SourceAddress  string          `json:"source_address"`
+		DestAddress    string          `json:"destination_address"`
+		Options        []byte          `json:"options,omitempty"`
+		Data           json.RawMessage `json:"data"`
+	}{
+		Type:           jsonTypeIPv4,
+		IHL:            p.IHL,
+		DSCP:           p.DSCP,
+		ECN:            p.ECN,
+		TotalLength:    p.TotalLength,
+		ID:             p.ID,
+		DontFragment:   p.DontFragment,
+		MoreFragments:  p.MoreFragments,
+		FragmentOffset: p.FragmentOffset,
+		TTL:            p.TTL,
+		Protocol:       p.Protocol,
+		Checksum:       p.Checksum,
+		SourceAddress:  net.IP(p.SourceAddress[:]).String(),
+		DestAddress:    net.IP(p.DestAddress[:]).String(),
+		Options:        p.Options,
+		Data:           data,
+	})
+}
+
+func (p *IPv6Packet) MarshalJSON() ([]byte, error) {
+	data, err := layerJSON(p.data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		Type               string          `json:"type"`
+		TrafficClass       uint8           `json:"traffic_class"`
+		FlowLabel          FlowLabel       `json:"flow_label"`
+		Length             uint16          `json:"length"`
+		NextHeader         IPProtocol      `json:"next_header"`
+		HopLimit           uint8           `json:"hop_limit"`
+		SourceAddress      string          `json:"source_address"`
+		DestinationAddress string          `json:"destination_address"`
+		Data               json.RawMessage `json:"data"`
+	}{
+		Type:               jsonTypeIPv6,
+		TrafficClass:       p.TrafficClass,
+		FlowLabel:          p.FlowLabel,
+		Length:             p.Length,
+		NextHeader:         p.NextHeader,
+		HopLimit:           p.HopLimit,
+		SourceAddress:      net.IP(p.SourceAddress[:]).String(),
+		DestinationAddress: net.IP(p.DestinationAddress[:]).String(),
+		Data:               data,
+	})
+}
+
+func (t *TCPSegment) MarshalJSON() ([]byte, error) {
+	type flags struct {
+		NS  bool `json:"ns"`
+		CWR bool `json:"cwr"`
+		ECE bool `json:"ece"`
+		URG bool `json:"urg"`
+		ACK bool `json:"ack"`
+		PSH bool `json:"psh"`
+		RST bool `json:"rst"`
+		SYN bool `json:"syn"`
+		FIN bool `json:"fin"`
+	}
+
+	return json.Marshal(struct {
+		Type            string `json:"type"`
+		SourcePort      uint16 `json:"source_port"`
+		DestinationPort uint16 `json:"destination_port"`
+		SequenceNumber  uint32 `json:"sequence_number"`
+		AckNumber       uint32 `json:"ack_number"`
+		HeaderSize      uint8  `json:"header_size"`
+		Flags           flags  `json:"flags"`
+		WindowSize      uint16 `json:"window_size"`
+		Checksum        uint16 `json:"checksum"`
+		UrgentOffset    uint16 `json:"urgent_offset"`
+		Options         []byte `json:"options,omitempty"`
+		Payload         []byte `json:"payload"`
+	}{
+		Type:            jsonTypeTCP,
+		SourcePort:      t.SourcePort,
+		DestinationPort: t.DestinationPort,
+		SequenceNumber:  t.SequenceNumber,
+		AckNumber:       t.AckNumber,
+		HeaderSize:      t.HeaderSize,
+		Flags: flags{
+			NS:  t.Flags.Has(TCP_FLAG_NS),
+			CWR: t.Flags.Has(TCP_FLAG_CWR),
+			ECE: t.Flags.Has(TCP_FLAG_ECE),
+			URG: t.Flags.Has(TCP_FLAG_URG),
+			ACK: t.Flags.Has(TCP_FLAG_ACK),
+			PSH: t.Flags.Has(TCP_FLAG_PSH),
+			RST: t.Flags.Has(TCP_FLAG_RST),
+			SYN: t.Flags.Has(TCP_FLAG_SYN),
+			FIN: t.Flags.Has(TCP_FLAG_FIN),
+		},
+		WindowSize:   t.WindowSize,
+		Checksum:     t.Checksum,
+		UrgentOffset: t.UrgentOffset,
+		Options:      t.OptionData,
+		Payload:      t.data,
+	})
+}
+
+func (u *UDPDatagram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type            string `json:"type"`
+		SourcePort      uint16 `json:"source_port"`
+		DestinationPort uint16 `json:"destination_port"`
+		Length          uint16 `json:"length"`
+		Checksum        uint16 `json:"checksum"`
+		Payload         []byte `json:"payload"`
+	}{jsonTypeUDP, u.SourcePort, u.DestinationPort, u.Length, u.Checksum, u.data})
+}
+
+// layerJSON marshals a layer to JSON, returning null for a missing layer. A layer that doesn't
+// marshal itself is written with its type's name, and its exported fields kept apart in "fields"
+// so that they can't clash with the type, along with the layer above it.
+func layerJSON(layer interface{}) (json.RawMessage, error) {
+	if value := reflect.ValueOf(layer); !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+		return json.RawMessage("null"), nil
+	}
+	if _, ok := layer.(json.Marshaler); ok {
+		return json.Marshal(layer)
+	}
+
+	generic := struct {
+		Type    string          `json:"type"`
+		Fields  interface{}     `json:"fields"`
+		Data    json.RawMessage `json:"data,omitempty"`
+		Payload []byte          `json:"payload,omitempty"`
+	}{
+		Type:   reflect.Indirect(reflect.ValueOf(layer)).Type().Name(),
+		Fields: layer,
+	}
+
+	// The layer above is unexported, so add it as the layers that marshal themselves do.
+	var err error
+	switch l := layer.(type) {
+	case LinkLayer:
+		generic.Data, err = layerJSON(l.LinkData())
+	case InternetLayer:
+		generic.Data, err = layerJSON(l.InternetData())
+	case TransportLayer:
+		generic.Payload = l.TransportData()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
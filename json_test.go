@@ -0,0 +1,110 @@
+package gopcap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestPacketMarshalJSON(t *testing.T) {
+	pkt := tcpTestPacket(0, [4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, 1234, 80, 1, 0, "SA", []byte("GET /"))
+
+	data, err := json.Marshal(&pkt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var decoded struct {
+		Timestamp string
+		Data      struct {
+			Type      string
+			EtherType EtherType
+			Data      struct {
+				Type          string
+				SourceAddress string `json:"source_address"`
+				Data          struct {
+					Type            string
+					DestinationPort uint16 `json:"destination_port"`
+					Flags           map[string]bool
+					Payload         string
+				}
+			}
+		}
+	}
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding %s: %v", data, err)
+	}
+
+	if decoded.Timestamp != "1970-01-01T00:00:00Z" {
+		t.Errorf("Unexpected timestamp: expected %v, got %v", "1970-01-01T00:00:00Z", decoded.Timestamp)
+	}
+	frame := decoded.Data
+	if frame.Type != "ethernet" || frame.EtherType != ETHERTYPE_IPV4 {
+		t.Errorf("Unexpected link layer: %s", data)
+	}
+	if ip := frame.Data; ip.Type != "ipv4" || ip.SourceAddress != "10.0.0.1" {
+		t.Errorf("Unexpected internet layer: %s", data)
+	}
+	tcp := frame.Data.Data
+	if tcp.Type != "tcp" || tcp.DestinationPort != 80 || !tcp.Flags["syn"] || !tcp.Flags["ack"] || tcp.Flags["fin"] {
+		t.Errorf("Unexpected transport layer: %s", data)
+	}
+	if tcp.Payload != base64.StdEncoding.EncodeToString([]byte("GET /")) {
+		t.Errorf("Unexpected payload: expected %q, got %q", "GET /", tcp.Payload)
+	}
+
+	// A Packet value, such as the one ParseEach passes, marshals the same way.
+	value, err := json.Marshal(pkt)
+	if err != nil || string(value) != string(data) {
+		t.Errorf("Unexpected JSON for a Packet value: expected %s, got %s, %v", data, value, err)
+	}
+}
+
+func TestPacketMarshalJSONOtherLayers(t *testing.T) {
+	// The raw file from TestParseRaw: an IPv4 echo request and an IPv6 UDP datagram.
+	data := []byte{
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00,
+		0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x11, 0x01,
+		0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0xdb, 0x3d, 0x07, 0x6c, 0x00, 0x0c, 0x50, 0x26, 0x01, 0x02, 0x03, 0x04,
+	}
+	parsed, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	// Layers that don't marshal themselves are named by their type, and still carry the layers above.
+	encoded, err := json.Marshal(parsed.Packets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded []struct {
+		Data struct {
+			Type string
+			Data struct {
+				Type               string
+				DestinationAddress string `json:"destination_address"`
+				Data               struct {
+					Type    string
+					Payload []byte
+				}
+			}
+		}
+	}
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil || len(decoded) != 2 {
+		t.Fatalf("Unexpected packets %s: %v", encoded, err)
+	}
+
+	if icmp := decoded[0].Data.Data.Data; decoded[0].Data.Type != "RawLink" || icmp.Type != "ICMPSegment" || string(icmp.Payload) != "abcd" {
+		t.Errorf("Unexpected first packet: %+v", decoded[0])
+	}
+	ip := decoded[1].Data.Data
+	if ip.Type != "ipv6" || ip.DestinationAddress != "ff02::c" || ip.Data.Type != "udp" || !bytes.Equal(ip.Data.Payload, []byte{1, 2, 3, 4}) {
+		t.Errorf("Unexpected second packet: %+v", decoded[1])
+	}
+}
@@ -1,8 +1,10 @@
 package gopcap
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
+	"net"
 )
 
 // The minimum value of the EtherType field. If the value is less than this, it's a length.
@@ -29,6 +31,128 @@ func (u *UnknownLink) ReadFrom(src io.Reader) error {
 	return err
 }
 
+// Serialize returns the packet as it was read.
+func (u *UnknownLink) Serialize() ([]byte, error) {
+	return serializeLayer(u.data)
+}
+
+//-------------------------------------------------------------------------------------------
+// NullLink
+//-------------------------------------------------------------------------------------------
+
+// Address family values for IPv4 and IPv6 in the NULL link-layer header. IPv6 is numbered
+// differently by different operating systems.
+const (
+	nullFamilyIPv4       uint32 = 2
+	nullFamilyIPv6BSD    uint32 = 24
+	nullFamilyIPv6Darwin uint32 = 30
+	nullFamilyIPv6Free   uint32 = 28
+)
+
+// NullLink represents the BSD loopback link-layer header, which is just the address family of the
+// packet. Valid when the LinkType is NULL or LOOP. For NULL the family is written in the byte order
+// of the capturing host, which isn't necessarily the byte order of the file; since the family is
+// always small, the byte order is worked out from which end the value is at.
+type NullLink struct {
+	Family uint32
+	data   InternetLayer
+}
+
+func (n *NullLink) LinkData() InternetLayer {
+	return n.data
+}
+
+func (n *NullLink) ReadFrom(src io.Reader) error {
+	var family [4]byte
+	_, err := io.ReadFull(src, family[:])
+	if err != nil {
+		return err
+	}
+
+	if family[0] == 0 && family[1] == 0 {
+		n.Family = binary.BigEndian.Uint32(family[:])
+	} else {
+		n.Family = binary.LittleEndian.Uint32(family[:])
+	}
+
+	switch n.Family {
+	case nullFamilyIPv4:
+		n.data = new(IPv4Packet)
+	case nullFamilyIPv6BSD, nullFamilyIPv6Darwin, nullFamilyIPv6Free:
+		n.data = new(IPv6Packet)
+	default:
+		n.data = new(UnknownINet)
+	}
+
+	return n.data.ReadFrom(src)
+}
+
+// Serialize returns the header followed by the serialized payload. The family is written big
+// endian, which ReadFrom accepts whatever the byte order of the capturing host.
+func (n *NullLink) Serialize() ([]byte, error) {
+	payload, err := serializeLayer(n.data)
+	if err != nil {
+		return nil, err
+	}
+
+	packet := make([]byte, 4, 4+len(payload))
+	networkByteOrder.PutUint32(packet, n.Family)
+	return append(packet, payload...), nil
+}
+
+//-------------------------------------------------------------------------------------------
+// RawLink
+//-------------------------------------------------------------------------------------------
+
+// RawLink represents a packet with no link-layer header at all, which starts directly with an IP
+// header, as captured from a tun device. Valid when the LinkType is RAW, IPV4 or IPV6. The IP
+// version is taken from the first nibble.
+type RawLink struct {
+	data InternetLayer
+}
+
+func (r *RawLink) LinkData() InternetLayer {
+	return r.data
+}
+
+func (r *RawLink) ReadFrom(src io.Reader) error {
+	var err error
+	r.data, err = readIPByVersion(src)
+	return err
+}
+
+// Serialize returns the serialized IP packet, since there's no header of its own.
+func (r *RawLink) Serialize() ([]byte, error) {
+	return serializeLayer(r.data)
+}
+
+// readIPByVersion reads an IPv4 or IPv6 packet, using the version in the first nibble to decide
+// which. Anything else is read as an UnknownINet, and UnknownIPVersion is returned.
+func readIPByVersion(src io.Reader) (InternetLayer, error) {
+	// Peek at the first byte to find the IP version, then put it back in front of the rest of the
+	// packet so the IP parser sees the whole header.
+	var first [1]byte
+	_, err := io.ReadFull(src, first[:])
+	if err != nil {
+		return nil, err
+	}
+	src = io.MultiReader(bytes.NewReader(first[:]), src)
+
+	var pkt InternetLayer
+	switch first[0] >> 4 {
+	case 4:
+		pkt = new(IPv4Packet)
+	case 6:
+		pkt = new(IPv6Packet)
+	default:
+		pkt = new(UnknownINet)
+		pkt.ReadFrom(src)
+		return pkt, UnknownIPVersion
+	}
+
+	return pkt, pkt.ReadFrom(src)
+}
+
 //-------------------------------------------------------------------------------------------
 // EthernetFrame
 //-------------------------------------------------------------------------------------------
@@ -37,75 +161,613 @@ func (u *UnknownLink) ReadFrom(src io.Reader) error {
 type EthernetFrame struct {
 	MACSource      [6]byte
 	MACDestination [6]byte
-	VLANTag        []byte
+	VLANTag        []byte    // The raw bytes of every VLAN tag, outermost first.
+	VLANTags       []VLANTag // The decoded VLAN tags, outermost first.
+	VLANID         uint16    // The VLAN identifier from the outermost VLAN tag, if present.
+	PCP            uint8     // The priority code point from the outermost VLAN tag, if present.
+	DEI            bool      // The drop eligible indicator from the outermost VLAN tag, if present.
 	Length         uint16
 	EtherType      EtherType
+	Truncated      bool // Whether the frame ended part way through its header.
 	data           InternetLayer
 }
 
+// VLANTag represents a single 802.1Q or 802.1ad VLAN tag.
+type VLANTag struct {
+	TPID   EtherType // The tag protocol identifier: ETHERTYPE_VLAN for a C-tag, ETHERTYPE_QINQ for an S-tag.
+	PCP    uint8
+	DEI    bool
+	VLANID uint16
+}
+
+// isVLANTPID returns whether the value in the EtherType position of a frame marks a VLAN tag.
+func isVLANTPID(value uint16) bool {
+	switch EtherType(value) {
+	case ETHERTYPE_VLAN, ETHERTYPE_QINQ, ETHERTYPE_QINQ_LEGACY:
+		return true
+	default:
+		return false
+	}
+}
+
 func (e *EthernetFrame) LinkData() InternetLayer {
 	return e.data
 }
 
+// Src returns the source MAC address as a net.HardwareAddr.
+func (e *EthernetFrame) Src() net.HardwareAddr {
+	return net.HardwareAddr(append([]byte(nil), e.MACSource[:]...))
+}
+
+// Dst returns the destination MAC address as a net.HardwareAddr.
+func (e *EthernetFrame) Dst() net.HardwareAddr {
+	return net.HardwareAddr(append([]byte(nil), e.MACDestination[:]...))
+}
+
 // Given a series of bytes, populate the EthernetFrame structure.
 func (e *EthernetFrame) ReadFrom(src io.Reader) error {
+	err := e.readHeader(src)
 
-	err := readFields(src, networkByteOrder, []interface{}{
-		&e.MACDestination,
-		&e.MACSource,
-	})
-
+	// A frame cut short by the snaplen, or by a corrupt capture, still has whatever header fields
+	// made it in. Flag it rather than failing, so the rest of the capture can still be parsed.
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		e.Truncated = true
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
+	// Everything else is payload data.
+	e.data, err = e.readPayload(src)
+	return err
+}
+
+// readPayload reads the payload of the frame according to its EtherType. Frames with a length
+// rather than an EtherType are 802.3 frames, whose payload starts with an LLC header; anything
+// following the length is padding.
+func (e *EthernetFrame) readPayload(src io.Reader) (InternetLayer, error) {
+	if e.EtherType != 0 {
+		return readInternetLayer(src, e.EtherType)
+	}
+
+	llc := new(LLCPacket)
+	return llc, llc.ReadFrom(io.LimitReader(src, int64(e.Length)))
+}
+
+// Serialize returns the frame header, including any VLAN tags, followed by the serialized payload.
+// The header is built from VLANTags rather than the raw VLANTag bytes. The length of an 802.3 frame
+// is taken from its payload. A truncated frame returns UnserializableLayer, since it isn't known
+// which of its header fields were read.
+func (e *EthernetFrame) Serialize() ([]byte, error) {
+	if e.Truncated {
+		return nil, UnserializableLayer
+	}
+
+	payload, err := serializeLayer(e.data)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 12, 14+4*len(e.VLANTags)+len(payload))
+	copy(frame[0:6], e.MACDestination[:])
+	copy(frame[6:12], e.MACSource[:])
+
+	var field [2]byte
+	for _, tag := range e.VLANTags {
+		tci := uint16(tag.PCP)<<13 | tag.VLANID&0x0FFF
+		if tag.DEI {
+			tci |= 0x1000
+		}
+		networkByteOrder.PutUint16(field[:], uint16(tag.TPID))
+		frame = append(frame, field[:]...)
+		networkByteOrder.PutUint16(field[:], tci)
+		frame = append(frame, field[:]...)
+	}
+
+	if e.EtherType != 0 {
+		networkByteOrder.PutUint16(field[:], uint16(e.EtherType))
+	} else {
+		networkByteOrder.PutUint16(field[:], uint16(len(payload)))
+	}
+	frame = append(frame, field[:]...)
+
+	return append(frame, payload...), nil
+}
+
+// readHeader reads the MAC addresses, any VLAN tags, and the EtherType or length.
+func (e *EthernetFrame) readHeader(src io.Reader) error {
 	nextValue := uint16(0)
-	err = binary.Read(src, networkByteOrder, &nextValue)
+	err := readFields(src, networkByteOrder, []interface{}{
+		&e.MACDestination,
+		&e.MACSource,
+		&nextValue,
+	})
+
 	if err != nil {
 		return err
 	}
 
-	// Check for a VLAN tag.
-	if nextValue == 0x8100 {
-		vlanTag := make([]byte, 4)
-		vlanTag[0] = 0x81
-		vlanTag[1] = 0x00
-
-		_, err = src.Read(vlanTag[2:])
+	// Check for VLAN tags. Service provider networks stack an outer S-tag on top of the
+	// customer's C-tag, so keep reading tags until we reach the real EtherType.
+	for isVLANTPID(nextValue) {
+		var tci uint16
+		err = readFields(src, networkByteOrder, []interface{}{&tci})
 		if err != nil {
 			return err
 		}
 
-		e.VLANTag = vlanTag
+		e.addVLANTag(nextValue, tci)
 
 		// Re-read the next value
-		err = binary.Read(src, networkByteOrder, &nextValue)
+		err = readFields(src, networkByteOrder, []interface{}{&nextValue})
 		if err != nil {
 			return err
 		}
 	}
 
-	// Read the size or type
-	if nextValue < minEtherType {
-		e.Length = nextValue
-	} else {
-		e.EtherType = EtherType(nextValue)
+	e.setTypeOrLength(nextValue)
+	return nil
+}
+
+// addVLANTag decodes a VLAN tag from its tag protocol identifier and tag control information.
+func (e *EthernetFrame) addVLANTag(tpid, tci uint16) {
+	// The tag control information is three bits of priority, the drop eligible bit, and
+	// twelve bits of VLAN ID.
+	tag := VLANTag{
+		TPID:   EtherType(tpid),
+		PCP:    uint8(tci >> 13),
+		DEI:    tci&0x1000 != 0,
+		VLANID: tci & 0x0FFF,
 	}
 
-	// Everything else is payload data.
-	return e.readInternetLayer(src)
+	if len(e.VLANTags) == 0 {
+		e.PCP = tag.PCP
+		e.DEI = tag.DEI
+		e.VLANID = tag.VLANID
+	}
+	e.VLANTags = append(e.VLANTags, tag)
+	e.VLANTag = append(e.VLANTag, uint8(tpid>>8), uint8(tpid), uint8(tci>>8), uint8(tci))
+}
+
+// setTypeOrLength sets the EtherType or, for values too small to be an EtherType, the length.
+func (e *EthernetFrame) setTypeOrLength(value uint16) {
+	if value < minEtherType {
+		e.Length = value
+	} else {
+		e.EtherType = EtherType(value)
+	}
 }
 
-// buildInternetLayer creates the internet layer sub-data for a link layer datagram.
-func (e *EthernetFrame) readInternetLayer(src io.Reader) error {
+// decode decodes the frame from data without copying it, so the higher layers' data refers to
+// data. Truncated frames are left to ReadFrom. See ParseInto.
+func (e *EthernetFrame) decode(data []byte, layers *packetLayers) error {
+	// Find the end of the header before decoding any of it, so a truncated frame can be handed
+	// to ReadFrom untouched.
+	end := 12
+	for {
+		if len(data) < end+2 {
+			return e.ReadFrom(bytes.NewReader(data))
+		}
+		if !isVLANTPID(networkByteOrder.Uint16(data[end : end+2])) {
+			break
+		}
+		end += 4
+	}
+
+	copy(e.MACDestination[:], data[0:6])
+	copy(e.MACSource[:], data[6:12])
+	for offset := 12; offset < end; offset += 4 {
+		e.addVLANTag(networkByteOrder.Uint16(data[offset:offset+2]), networkByteOrder.Uint16(data[offset+2:offset+4]))
+	}
+	e.setTypeOrLength(networkByteOrder.Uint16(data[end : end+2]))
+
+	payload := data[end+2:]
 	switch e.EtherType {
 	case ETHERTYPE_IPV4:
-		e.data = new(IPv4Packet)
+		p := layers.ipv4Packet()
+		e.data = p
+		return p.decode(payload, layers)
 	case ETHERTYPE_IPV6:
-		e.data = new(IPv6Packet)
+		p := layers.ipv6Packet()
+		e.data = p
+		return p.decode(payload, layers)
 	default:
-		e.data = new(UnknownINet)
+		var err error
+		e.data, err = e.readPayload(bytes.NewReader(payload))
+		return err
+	}
+}
+
+// readInternetLayer creates the internet layer sub-data for a link layer datagram, based on the
+// EtherType of the data.
+func readInternetLayer(src io.Reader, etherType EtherType) (InternetLayer, error) {
+	var pkt InternetLayer
+
+	switch etherType {
+	case ETHERTYPE_IPV4:
+		pkt = new(IPv4Packet)
+	case ETHERTYPE_IPV6:
+		pkt = new(IPv6Packet)
+	case ARP:
+		pkt = new(ARPPacket)
+	case PPPOE_SESSION:
+		pkt = new(PPPoESession)
+	case MPLS_UNICAST, MPLS_MULTICAST:
+		pkt = new(MPLSPacket)
+	default:
+		pkt = new(UnknownINet)
+	}
+
+	err := pkt.ReadFrom(src)
+	return pkt, err
+}
+
+//-------------------------------------------------------------------------------------------
+// LLCPacket
+//-------------------------------------------------------------------------------------------
+
+// llcSAPSNAP is the service access point that marks an LLC header followed by a SNAP header.
+const llcSAPSNAP uint8 = 0xAA
+
+// LLCPacket represents an IEEE 802.2 LLC header, which starts the payload of an 802.3 frame. If it
+// is followed by a SNAP header, the packet the SNAP header's protocol identifies is decoded, as it
+// would be for an EtherType, and is available from Payload. Otherwise the rest of the frame, such
+// as a spanning tree BPDU, is left undecoded.
+type LLCPacket struct {
+	DSAP     uint8
+	SSAP     uint8  // The low bit is the command/response bit.
+	Control  uint16 // One byte for unnumbered frames, two for information and supervisory frames.
+	OUI      [3]byte
+	Protocol EtherType // Only set if IsSNAP, as is OUI.
+	payload  InternetLayer
+	data     TransportLayer
+}
+
+// IsSNAP returns whether the LLC header is followed by a SNAP header.
+func (l *LLCPacket) IsSNAP() bool {
+	return l.DSAP == llcSAPSNAP && l.SSAP&0xFE == llcSAPSNAP
+}
+
+// Payload returns the network layer carried after the SNAP header, or nil if there isn't one.
+func (l *LLCPacket) Payload() InternetLayer {
+	return l.payload
+}
+
+func (l *LLCPacket) InternetData() TransportLayer {
+	if l.payload != nil {
+		return l.payload.InternetData()
 	}
-	return e.data.ReadFrom(src)
+	return l.data
+}
 
+func (l *LLCPacket) ReadFrom(src io.Reader) error {
+	var control uint8
+	err := readFields(src, networkByteOrder, []interface{}{
+		&l.DSAP,
+		&l.SSAP,
+		&control,
+	})
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	// Unnumbered frames have both low bits of the control field set, and only they have a single
+	// byte of control field.
+	l.Control = uint16(control)
+	if control&0x03 != 0x03 {
+		var second uint8
+		err = binary.Read(src, networkByteOrder, &second)
+		if err == io.EOF {
+			return InsufficientLength
+		}
+		if err != nil {
+			return err
+		}
+		l.Control = l.Control<<8 | uint16(second)
+	}
+
+	if !l.IsSNAP() {
+		l.data = new(UnknownTransport)
+		return l.data.ReadFrom(src)
+	}
+
+	err = readFields(src, networkByteOrder, []interface{}{
+		&l.OUI,
+		&l.Protocol,
+	})
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	l.payload, err = readInternetLayer(src, l.Protocol)
+	return err
+}
+
+// Serialize returns the LLC header, and the SNAP header if there is one, followed by the
+// serialized payload. The control field takes one byte if it's an unnumbered frame's, and two
+// otherwise.
+func (l *LLCPacket) Serialize() ([]byte, error) {
+	var payload []byte
+	var err error
+	if l.payload != nil {
+		payload, err = serializeLayer(l.payload)
+	} else {
+		payload, err = serializeLayer(l.data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	packet := []byte{l.DSAP, l.SSAP}
+	if l.Control < 0x100 && l.Control&0x03 == 0x03 {
+		packet = append(packet, uint8(l.Control))
+	} else {
+		packet = append(packet, uint8(l.Control>>8), uint8(l.Control))
+	}
+
+	if l.IsSNAP() {
+		packet = append(packet, l.OUI[:]...)
+		packet = append(packet, uint8(l.Protocol>>8), uint8(l.Protocol))
+	}
+
+	return append(packet, payload...), nil
+}
+
+//-------------------------------------------------------------------------------------------
+// SLLFrame
+//-------------------------------------------------------------------------------------------
+
+// SLLFrame represents a Linux "cooked" capture header, used when capturing on the "any" device or
+// on devices without a real link-layer header. Valid only when the LinkType is LINUX_SLL.
+type SLLFrame struct {
+	PacketType    SLLPacketType
+	ARPHRDType    uint16 // The Linux ARPHRD_ type of the device, e.g. 1 for Ethernet.
+	AddressLength uint16
+	Address       [8]byte // The link-layer source address, padded or truncated to 8 bytes.
+	Protocol      EtherType
+	data          InternetLayer
+}
+
+func (s *SLLFrame) LinkData() InternetLayer {
+	return s.data
+}
+
+func (s *SLLFrame) ReadFrom(src io.Reader) error {
+	err := readFields(src, networkByteOrder, []interface{}{
+		&s.PacketType,
+		&s.ARPHRDType,
+		&s.AddressLength,
+		&s.Address,
+		&s.Protocol,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Everything else is payload data.
+	s.data, err = readInternetLayer(src, s.Protocol)
+	return err
+}
+
+// Serialize returns the header followed by the serialized payload.
+func (s *SLLFrame) Serialize() ([]byte, error) {
+	payload, err := serializeLayer(s.data)
+	if err != nil {
+		return nil, err
+	}
+
+	var packet bytes.Buffer
+	err = writeFields(&packet, networkByteOrder, []interface{}{
+		s.PacketType,
+		s.ARPHRDType,
+		s.AddressLength,
+		s.Address,
+		s.Protocol,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	packet.Write(payload)
+	return packet.Bytes(), nil
+}
+
+//-------------------------------------------------------------------------------------------
+// ERSPANPacket
+//-------------------------------------------------------------------------------------------
+
+// ERSPAN header versions.
+const (
+	erspanTypeII  uint8 = 1
+	erspanTypeIII uint8 = 2
+)
+
+// ERSPANPacket represents an ERSPAN (Encapsulated Remote SPAN) Type II or Type III header and the
+// mirrored Ethernet frame that follows it. ERSPAN is carried over GRE, with the GRE protocol type
+// set to ERSPAN_TYPE_II or ERSPAN_TYPE_III. Only the fields for the version in use are populated.
+type ERSPANPacket struct {
+	Version     uint8 // 1 for Type II, 2 for Type III.
+	VLAN        uint16
+	COS         uint8
+	Encap       uint8 // The encapsulation type for Type II, or the bad/short/oversized bits for Type III.
+	Truncated   bool
+	SessionID   uint16
+	Index       uint32 // Type II only.
+	Timestamp   uint32 // Type III only, in units given by Granularity.
+	SGT         uint16 // Type III only.
+	PDUFrame    bool   // Type III only.
+	FrameType   uint8  // Type III only.
+	HardwareID  uint8  // Type III only.
+	Direction   bool   // Type III only. Set if the frame was mirrored on egress.
+	Granularity uint8  // Type III only.
+	Platform    []byte // Type III only. The optional platform-specific sub-header.
+	frame       *EthernetFrame
+}
+
+func (e *ERSPANPacket) LinkData() InternetLayer {
+	// There's no frame if the header couldn't be read.
+	if e.frame == nil {
+		return nil
+	}
+	return e.frame.LinkData()
+}
+
+// Frame returns the mirrored Ethernet frame.
+func (e *ERSPANPacket) Frame() *EthernetFrame {
+	return e.frame
+}
+
+func (e *ERSPANPacket) ReadFrom(src io.Reader) error {
+	var versionVLAN, cosSession uint16
+
+	err := readFields(src, networkByteOrder, []interface{}{
+		&versionVLAN,
+		&cosSession,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// The version is the top four bits, and the VLAN the rest.
+	e.Version = uint8(versionVLAN >> 12)
+	e.VLAN = versionVLAN & 0x0FFF
+
+	// The class of service, encapsulation, truncation bit and session ID share the next two bytes.
+	e.COS = uint8(cosSession >> 13)
+	e.Encap = uint8(cosSession>>11) & 0x03
+	e.Truncated = cosSession&0x0400 != 0
+	e.SessionID = cosSession & 0x03FF
+
+	switch e.Version {
+	case erspanTypeII:
+		err = e.readTypeII(src)
+	case erspanTypeIII:
+		err = e.readTypeIII(src)
+	default:
+		return IncorrectPacket
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Everything else is the mirrored frame.
+	e.frame = new(EthernetFrame)
+	return e.frame.ReadFrom(src)
+}
+
+// readTypeII reads the remainder of a Type II header: 12 reserved bits and a 20-bit index.
+func (e *ERSPANPacket) readTypeII(src io.Reader) error {
+	var reservedIndex uint32
+
+	err := binary.Read(src, networkByteOrder, &reservedIndex)
+	if err != nil {
+		return err
+	}
+
+	e.Index = reservedIndex & 0x000FFFFF
+	return nil
+}
+
+// readTypeIII reads the remainder of a Type III header, including the optional platform-specific
+// sub-header.
+func (e *ERSPANPacket) readTypeIII(src io.Reader) error {
+	var flags uint16
+
+	err := readFields(src, networkByteOrder, []interface{}{
+		&e.Timestamp,
+		&e.SGT,
+		&flags,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	e.PDUFrame = flags&0x8000 != 0
+	e.FrameType = uint8(flags>>10) & 0x1F
+	e.HardwareID = uint8(flags>>4) & 0x3F
+	e.Direction = flags&0x0008 != 0
+	e.Granularity = uint8(flags>>1) & 0x03
+
+	// The low bit indicates that the platform-specific sub-header is present.
+	if flags&0x0001 != 0 {
+		e.Platform = make([]byte, 8)
+		_, err = io.ReadFull(src, e.Platform)
+	}
+
+	return err
+}
+
+//-------------------------------------------------------------------------------------------
+// PPPFrame
+//-------------------------------------------------------------------------------------------
+
+// PPPFrame represents a single PPP frame, as carried inside tunnels such as L2TP. The address and
+// control fields are often omitted, in which case they are left as zero, and the protocol field
+// may be compressed to a single byte.
+type PPPFrame struct {
+	Address  uint8
+	Control  uint8
+	Protocol PPPProtocol
+	data     InternetLayer
+}
+
+func (p *PPPFrame) LinkData() InternetLayer {
+	return p.data
+}
+
+func (p *PPPFrame) ReadFrom(src io.Reader) error {
+	var first uint8
+	err := binary.Read(src, networkByteOrder, &first)
+	if err != nil {
+		return err
+	}
+
+	// The address field is always 0xFF, which can never start a protocol field.
+	if first == 0xFF {
+		p.Address = first
+		err = readFields(src, networkByteOrder, []interface{}{&p.Control, &first})
+		if err != nil {
+			return err
+		}
+	}
+
+	// A compressed protocol field is a single byte, marked by having its low bit set.
+	if first&0x01 != 0 {
+		p.Protocol = PPPProtocol(first)
+	} else {
+		var second uint8
+		err = binary.Read(src, networkByteOrder, &second)
+		if err != nil {
+			return err
+		}
+		p.Protocol = PPPProtocol(first)<<8 | PPPProtocol(second)
+	}
+
+	p.data, err = readPPPPayload(src, p.Protocol)
+	return err
+}
+
+// readPPPPayload reads the network layer carried by a PPP frame with the given protocol.
+func readPPPPayload(src io.Reader, protocol PPPProtocol) (InternetLayer, error) {
+	switch protocol {
+	case PPP_PROTOCOL_IPV4:
+		return readInternetLayer(src, ETHERTYPE_IPV4)
+	case PPP_PROTOCOL_IPV6:
+		return readInternetLayer(src, ETHERTYPE_IPV6)
+	default:
+		pkt := new(UnknownINet)
+		err := pkt.ReadFrom(src)
+		return pkt, err
+	}
 }
@@ -2,6 +2,8 @@ package gopcap
 
 import (
 	"bytes"
+	"encoding/binary"
+	"reflect"
 	"testing"
 )
 
@@ -36,4 +38,348 @@ func TestEthernetFrameGood(t *testing.T) {
 	if frame.EtherType != EtherType(2048) {
 		t.Errorf("Unexpected EtherType: expected %v, got %v", 2048, frame.EtherType)
 	}
+	if frame.Src().String() != "00:04:76:96:7b:da" {
+		t.Errorf("Unexpected source address: expected %v, got %v", "00:04:76:96:7b:da", frame.Src())
+	}
+	if frame.Dst().String() != "00:16:e3:19:27:15" {
+		t.Errorf("Unexpected destination address: expected %v, got %v", "00:16:e3:19:27:15", frame.Dst())
+	}
+
+	// The accessors return copies, so changing them leaves the frame alone.
+	frame.Src()[0] = 0xFF
+	if frame.MACSource[0] != 0x00 {
+		t.Errorf("Modifying the source address changed the frame: %v", frame.MACSource)
+	}
+}
+
+func TestERSPANTypeII(t *testing.T) {
+	// An ERSPAN Type II header for VLAN 100, session 5 and index 7, mirroring an Ethernet frame.
+	data := []byte{
+		0x10, 0x64, 0x00, 0x05, 0x00, 0x00, 0x00, 0x07, 0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x08, 0x00, 0x45, 0x00,
+		0x00, 0x52, 0x76, 0xED, 0x40, 0x00, 0x40, 0x06, 0x56, 0xCF, 0xC0, 0xA8, 0x01, 0x02, 0xD4, 0xCC, 0xD6, 0x72, 0x0B, 0x20, 0x1A, 0x0B, 0x4D, 0xC8,
+		0x4E, 0xED, 0x54, 0xF1, 0x10, 0x72, 0x80, 0x18, 0x1F, 0x4B, 0x6D, 0x2E, 0x00, 0x00, 0x01, 0x01, 0x08, 0x0A, 0x00, 0xD8, 0xEA, 0x48, 0x82, 0xE4,
+		0xDA, 0xB0, 0x49, 0x53, 0x4F, 0x4E, 0x20, 0x54, 0x68, 0x75, 0x6E, 0x66, 0x69, 0x73, 0x63, 0x68, 0x20, 0x53, 0x6D, 0x69, 0x6C, 0x65, 0x79, 0x20,
+		0x53, 0x6D, 0x69, 0x6C, 0x65, 0x79, 0x47, 0x0A,
+	}
+	expectedSrc := []byte{0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA}
+	pkt := new(ERSPANPacket)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if pkt.Version != uint8(1) {
+		t.Errorf("Unexpected version: expected %v, got %v", 1, pkt.Version)
+	}
+	if pkt.VLAN != uint16(100) {
+		t.Errorf("Unexpected VLAN: expected %v, got %v", 100, pkt.VLAN)
+	}
+	if pkt.SessionID != uint16(5) {
+		t.Errorf("Unexpected session ID: expected %v, got %v", 5, pkt.SessionID)
+	}
+	if pkt.Index != uint32(7) {
+		t.Errorf("Unexpected index: expected %v, got %v", 7, pkt.Index)
+	}
+	if pkt.Truncated {
+		t.Errorf("Unexpectedly marked as truncated.")
+	}
+	if !bytes.Equal(pkt.Frame().MACSource[:], expectedSrc) {
+		t.Errorf("Unexpected source MAC: expected %v, got %v", expectedSrc, pkt.Frame().MACSource)
+	}
+	if _, isIPv4 := pkt.LinkData().(*IPv4Packet); !isIPv4 {
+		t.Errorf("Unexpected internet layer: expected IPv4Packet, got %v", pkt.LinkData())
+	}
+
+	// A header cut short has no frame, and so no internet layer.
+	pkt = new(ERSPANPacket)
+	err = pkt.ReadFrom(bytes.NewReader([]byte{0x4F}))
+	if err == nil {
+		t.Errorf("Expected an error reading a truncated header.")
+	}
+	if pkt.LinkData() != nil {
+		t.Errorf("Unexpected internet layer: %v", pkt.LinkData())
+	}
+}
+
+func TestRawLinkIPv4(t *testing.T) {
+	data := []byte{
+		0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00, 0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A,
+		0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+	}
+	expectedSrc := []byte{192, 168, 1, 2}
+	link := new(RawLink)
+	err := link.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	pkt, isIPv4 := link.LinkData().(*IPv4Packet)
+	if !isIPv4 {
+		t.Fatalf("Unexpected internet layer: expected IPv4Packet, got %v", reflect.TypeOf(link.LinkData()))
+	}
+	if pkt.IHL != uint8(5) {
+		t.Errorf("Unexpected IHL: expected %v, got %v", 5, pkt.IHL)
+	}
+	if !bytes.Equal(pkt.SourceAddress[:], expectedSrc) {
+		t.Errorf("Unexpected source address: expected %v, got %v", expectedSrc, pkt.SourceAddress)
+	}
+	if _, isICMP := pkt.InternetData().(*ICMPSegment); !isICMP {
+		t.Errorf("Unexpected transport layer: expected ICMPSegment, got %v", reflect.TypeOf(pkt.InternetData()))
+	}
+}
+
+func TestRawLinkIPv6(t *testing.T) {
+	data := []byte{
+		0x60, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x11, 0x01, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e,
+		0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0xdb, 0x3d, 0x07, 0x6c, 0x00, 0x0c, 0x50, 0x26,
+		0x01, 0x02, 0x03, 0x04,
+	}
+	link := new(RawLink)
+	err := link.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	pkt, isIPv6 := link.LinkData().(*IPv6Packet)
+	if !isIPv6 {
+		t.Fatalf("Unexpected internet layer: expected IPv6Packet, got %v", reflect.TypeOf(link.LinkData()))
+	}
+	if pkt.HopLimit != uint8(1) {
+		t.Errorf("Unexpected hop limit: expected %v, got %v", 1, pkt.HopLimit)
+	}
+	if _, isUDP := pkt.InternetData().(*UDPDatagram); !isUDP {
+		t.Errorf("Unexpected transport layer: expected UDPDatagram, got %v", reflect.TypeOf(pkt.InternetData()))
+	}
+}
+
+func TestRawLinkBadVersion(t *testing.T) {
+	data := []byte{0x55, 0x00, 0x00, 0x20, 0x00, 0x01}
+	link := new(RawLink)
+	err := link.ReadFrom(bytes.NewReader(data))
+
+	if err != UnknownIPVersion {
+		t.Errorf("Unexpected error: expected %v, got %v", UnknownIPVersion, err)
+	}
+	if _, isUnknown := link.LinkData().(*UnknownINet); !isUnknown {
+		t.Errorf("Unexpected internet layer: expected UnknownINet, got %v", reflect.TypeOf(link.LinkData()))
+	}
+	if !bytes.Equal(link.LinkData().InternetData().TransportData(), data) {
+		t.Errorf("Unexpected data: expected %v, got %v", data, link.LinkData().InternetData().TransportData())
+	}
+}
+
+func TestEthernetFrameVLAN(t *testing.T) {
+	// A frame tagged with VLAN 291, priority 5 and the drop eligible bit set.
+	data := []byte{
+		0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x81, 0x00, 0xB1, 0x23, 0x08, 0x00, 0x45, 0x00, 0x00, 0x20, 0x00, 0x01,
+		0x00, 0x00, 0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62,
+		0x63, 0x64,
+	}
+	expectedTag := []byte{0x81, 0x00, 0xB1, 0x23}
+	frame := new(EthernetFrame)
+	err := frame.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(frame.VLANTag, expectedTag) {
+		t.Errorf("Unexpected VLAN tag: expected %v, got %v", expectedTag, frame.VLANTag)
+	}
+	if frame.VLANID != uint16(0x123) {
+		t.Errorf("Unexpected VLAN ID: expected %v, got %v", 0x123, frame.VLANID)
+	}
+	if frame.PCP != uint8(5) {
+		t.Errorf("Unexpected PCP: expected %v, got %v", 5, frame.PCP)
+	}
+	if !frame.DEI {
+		t.Errorf("Expected DEI to be set and it wasn't.")
+	}
+	if frame.EtherType != ETHERTYPE_IPV4 {
+		t.Errorf("Unexpected EtherType: expected %v, got %v", ETHERTYPE_IPV4, frame.EtherType)
+	}
+	if _, isIPv4 := frame.LinkData().(*IPv4Packet); !isIPv4 {
+		t.Errorf("Unexpected internet layer: expected IPv4Packet, got %v", reflect.TypeOf(frame.LinkData()))
+	}
+}
+
+func TestEthernetFrameVLANWithLength(t *testing.T) {
+	// An 802.3 frame tagged with VLAN 10, whose 40-byte payload is an LLC/SNAP header carrying an
+	// IPv4 echo request, followed by two bytes of padding.
+	data := []byte{
+		0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x81, 0x00, 0x00, 0x0A, 0x00, 0x28,
+		0xAA, 0xAA, 0x03, 0x00, 0x00, 0x00, 0x08, 0x00,
+		0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00, 0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01,
+		0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+		0x00, 0x00,
+	}
+
+	for name, read := range map[string]func(*EthernetFrame) error{
+		"ReadFrom": func(frame *EthernetFrame) error { return frame.ReadFrom(bytes.NewReader(data)) },
+		"decode":   func(frame *EthernetFrame) error { return frame.decode(data, new(packetLayers)) },
+	} {
+		frame := new(EthernetFrame)
+		err := read(frame)
+
+		if err != nil {
+			t.Errorf("Unexpected error from %v: %v", name, err)
+		}
+		if frame.VLANID != uint16(10) {
+			t.Errorf("Unexpected VLAN ID from %v: expected %v, got %v", name, 10, frame.VLANID)
+		}
+		if frame.Length != uint16(40) || frame.EtherType != 0 {
+			t.Errorf("Unexpected length and EtherType from %v: expected %v and %v, got %v and %v", name, 40, 0, frame.Length, frame.EtherType)
+		}
+
+		llc, isLLC := frame.LinkData().(*LLCPacket)
+		if !isLLC {
+			t.Fatalf("Unexpected internet layer from %v: expected LLCPacket, got %v", name, reflect.TypeOf(frame.LinkData()))
+		}
+		if !llc.IsSNAP() || llc.Control != 0x03 || llc.Protocol != ETHERTYPE_IPV4 {
+			t.Errorf("Unexpected LLC header from %v: %+v", name, llc)
+		}
+		if _, isIPv4 := llc.Payload().(*IPv4Packet); !isIPv4 {
+			t.Errorf("Unexpected payload from %v: expected IPv4Packet, got %v", name, reflect.TypeOf(llc.Payload()))
+		}
+		if _, isICMP := llc.InternetData().(*ICMPSegment); !isICMP {
+			t.Errorf("Unexpected transport layer from %v: expected ICMPSegment, got %v", name, reflect.TypeOf(llc.InternetData()))
+		}
+	}
+}
+
+func TestLLCWithoutSNAP(t *testing.T) {
+	// The start of a spanning tree BPDU, which isn't decoded.
+	data := []byte{0x42, 0x42, 0x03, 0x00, 0x00, 0x00, 0x00}
+	llc := new(LLCPacket)
+	err := llc.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if llc.IsSNAP() || llc.DSAP != 0x42 || llc.Payload() != nil {
+		t.Errorf("Unexpected LLC header: %+v", llc)
+	}
+	if !bytes.Equal(llc.InternetData().TransportData(), data[3:]) {
+		t.Errorf("Unexpected data: expected %v, got %v", data[3:], llc.InternetData().TransportData())
+	}
+}
+
+func TestEthernetFrameQinQ(t *testing.T) {
+	// A frame with an outer S-tag for VLAN 100 and an inner C-tag for VLAN 200 wrapping IPv4.
+	data := []byte{
+		0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x88, 0xA8, 0x00, 0x64, 0x81, 0x00, 0x60, 0xC8, 0x08, 0x00, 0x45, 0x00,
+		0x00, 0x20, 0x00, 0x01, 0x00, 0x00, 0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34,
+		0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+	}
+	expectedTags := []VLANTag{
+		{TPID: ETHERTYPE_QINQ, PCP: 0, DEI: false, VLANID: 100},
+		{TPID: ETHERTYPE_VLAN, PCP: 3, DEI: false, VLANID: 200},
+	}
+	expectedRaw := []byte{0x88, 0xA8, 0x00, 0x64, 0x81, 0x00, 0x60, 0xC8}
+	frame := new(EthernetFrame)
+	err := frame.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(frame.VLANTags, expectedTags) {
+		t.Errorf("Unexpected VLAN tags: expected %v, got %v", expectedTags, frame.VLANTags)
+	}
+	if !bytes.Equal(frame.VLANTag, expectedRaw) {
+		t.Errorf("Unexpected raw VLAN tags: expected %v, got %v", expectedRaw, frame.VLANTag)
+	}
+	if frame.VLANID != uint16(100) {
+		t.Errorf("Unexpected VLAN ID: expected %v, got %v", 100, frame.VLANID)
+	}
+	if frame.EtherType != ETHERTYPE_IPV4 {
+		t.Errorf("Unexpected EtherType: expected %v, got %v", ETHERTYPE_IPV4, frame.EtherType)
+	}
+	if _, isIPv4 := frame.LinkData().(*IPv4Packet); !isIPv4 {
+		t.Errorf("Unexpected internet layer: expected IPv4Packet, got %v", reflect.TypeOf(frame.LinkData()))
+	}
+}
+
+func TestSLLFrame(t *testing.T) {
+	// An outgoing packet on an Ethernet device, carrying IPv4.
+	data := []byte{
+		0x00, 0x04, 0x00, 0x01, 0x00, 0x06, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x00, 0x00, 0x08, 0x00, 0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00,
+		0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+	}
+	expectedAddress := []byte{0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA}
+	link, err := readLinkData(bytes.NewReader(data), binary.LittleEndian, LINUX_SLL)
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	frame, isSLL := link.(*SLLFrame)
+	if !isSLL {
+		t.Fatalf("Unexpected link layer: expected SLLFrame, got %v", reflect.TypeOf(link))
+	}
+	if frame.PacketType != SLL_OUTGOING {
+		t.Errorf("Unexpected packet type: expected %v, got %v", SLL_OUTGOING, frame.PacketType)
+	}
+	if frame.ARPHRDType != uint16(1) {
+		t.Errorf("Unexpected ARPHRD type: expected %v, got %v", 1, frame.ARPHRDType)
+	}
+	if frame.AddressLength != uint16(6) {
+		t.Errorf("Unexpected address length: expected %v, got %v", 6, frame.AddressLength)
+	}
+	if !bytes.Equal(frame.Address[:frame.AddressLength], expectedAddress) {
+		t.Errorf("Unexpected address: expected %v, got %v", expectedAddress, frame.Address)
+	}
+	if frame.Protocol != ETHERTYPE_IPV4 {
+		t.Errorf("Unexpected protocol: expected %v, got %v", ETHERTYPE_IPV4, frame.Protocol)
+	}
+	if _, isIPv4 := frame.LinkData().(*IPv4Packet); !isIPv4 {
+		t.Errorf("Unexpected internet layer: expected IPv4Packet, got %v", reflect.TypeOf(frame.LinkData()))
+	}
+}
+
+func TestNullLink(t *testing.T) {
+	ipv4 := []byte{
+		0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00, 0x40, 0x01, 0xF6, 0x8C, 0x7F, 0x00, 0x00, 0x01, 0x7F, 0x00, 0x00, 0x01, 0x08, 0x00, 0x4D, 0x5A,
+		0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+	}
+	ipv6 := []byte{
+		0x60, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x11, 0x01, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e,
+		0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0xdb, 0x3d, 0x07, 0x6c, 0x00, 0x0c, 0x50, 0x26,
+		0x01, 0x02, 0x03, 0x04,
+	}
+
+	in := [][]byte{
+		append([]byte{0x02, 0x00, 0x00, 0x00}, ipv4...),
+		append([]byte{0x00, 0x00, 0x00, 0x02}, ipv4...),
+		append([]byte{0x1E, 0x00, 0x00, 0x00}, ipv6...),
+		append([]byte{0x00, 0x00, 0x00, 0x18}, ipv6...),
+		append([]byte{0x1C, 0x00, 0x00, 0x00}, ipv6...),
+	}
+	families := []uint32{2, 2, 30, 24, 28}
+	isIPv4 := []bool{true, true, false, false, false}
+
+	for i, input := range in {
+		link, err := readLinkData(bytes.NewReader(input), binary.LittleEndian, NULL)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		null, isNull := link.(*NullLink)
+		if !isNull {
+			t.Fatalf("Unexpected link layer: expected NullLink, got %v", reflect.TypeOf(link))
+		}
+		if null.Family != families[i] {
+			t.Errorf("Unexpected family: expected %v, got %v", families[i], null.Family)
+		}
+
+		if isIPv4[i] {
+			if _, ok := null.LinkData().(*IPv4Packet); !ok {
+				t.Errorf("Unexpected internet layer: expected IPv4Packet, got %v", reflect.TypeOf(null.LinkData()))
+			}
+		} else {
+			if _, ok := null.LinkData().(*IPv6Packet); !ok {
+				t.Errorf("Unexpected internet layer: expected IPv6Packet, got %v", reflect.TypeOf(null.LinkData()))
+			}
+		}
+	}
 }
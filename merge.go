@@ -0,0 +1,53 @@
+package gopcap
+
+import (
+	"sort"
+	"time"
+)
+
+// Merge interleaves the packets of several captures in the order they were captured, as mergecap
+// does, such as to combine captures taken on several hosts into one timeline. Packets captured at
+// the same time are kept in the order of the files they came from, and then of their positions
+// within them.
+//
+// The merged file has the header of the first, with the largest MaxLen of them all, and nanosecond
+// timestamps if any of them had them, so that nothing is lost when it's written out. The captures
+// must all have the same link type, or MismatchedLinkTypes is returned. Captures may have different
+// TZCorrection values: each packet's Timestamp is converted to the first file's time zone, so the
+// merged packets can be compared with Since and Duration, and written out, like any others. See
+// Packet.Time.
+func Merge(files ...PcapFile) (PcapFile, error) {
+	if len(files) == 0 {
+		return PcapFile{Packets: make([]Packet, 0)}, nil
+	}
+
+	merged := files[0]
+	count := 0
+	for _, file := range files {
+		if file.LinkType != merged.LinkType {
+			return PcapFile{}, MismatchedLinkTypes
+		}
+		if file.MaxLen > merged.MaxLen {
+			merged.MaxLen = file.MaxLen
+		}
+		if file.TimestampResolution == time.Nanosecond {
+			merged.TimestampResolution = time.Nanosecond
+			merged.timestamps = file.timestamps
+		}
+		count += len(file.Packets)
+	}
+
+	merged.Packets = make([]Packet, 0, count)
+	for _, file := range files {
+		merged.Packets = append(merged.Packets, file.Packets...)
+	}
+	for i := range merged.Packets {
+		pkt := &merged.Packets[i]
+		pkt.Timestamp += time.Duration(merged.TZCorrection-pkt.tzCorrection) * time.Second
+		pkt.tzCorrection = merged.TZCorrection
+	}
+	sort.SliceStable(merged.Packets, func(i, j int) bool {
+		return merged.Packets[i].Timestamp < merged.Packets[j].Timestamp
+	})
+	return merged, nil
+}
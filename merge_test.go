@@ -0,0 +1,111 @@
+package gopcap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	a := [4]byte{192, 168, 1, 2}
+	b := [4]byte{10, 0, 0, 1}
+
+	first := PcapFile{LinkType: ETHERNET, MaxLen: 1500, TimestampResolution: time.Microsecond, Packets: []Packet{
+		tcpTestPacket(1*time.Second, a, b, 40000, 80, 1, 0, "S", nil),
+		tcpTestPacket(3*time.Second, a, b, 40000, 80, 2, 0, "A", nil),
+		tcpTestPacket(5*time.Second, a, b, 40000, 80, 3, 0, "A", nil),
+	}}
+	second := PcapFile{LinkType: ETHERNET, MaxLen: 65535, TimestampResolution: time.Nanosecond, Packets: []Packet{
+		tcpTestPacket(2*time.Second, b, a, 80, 40000, 11, 0, "SA", nil),
+		tcpTestPacket(3*time.Second, b, a, 80, 40000, 12, 0, "A", nil),
+		tcpTestPacket(6*time.Second, b, a, 80, 40000, 13, 0, "A", nil),
+	}}
+
+	merged, err := Merge(first, second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if merged.LinkType != ETHERNET || merged.MaxLen != 65535 || merged.TimestampResolution != time.Nanosecond {
+		t.Errorf("Unexpected header: %+v", merged)
+	}
+
+	// Ties are broken by the order of the files.
+	expected := []uint32{1, 11, 2, 12, 3, 13}
+	if len(merged.Packets) != len(expected) {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v", len(expected), len(merged.Packets))
+	}
+	for i, seq := range expected {
+		segment := merged.Packets[i].Transport().(*TCPSegment)
+		if segment.SequenceNumber != seq {
+			t.Errorf("Unexpected packet %v: expected sequence number %v, got %v", i, seq, segment.SequenceNumber)
+		}
+	}
+
+	// The inputs are left as they were.
+	if first.Packets[1].Timestamp != 3*time.Second || len(first.Packets) != 3 {
+		t.Errorf("Unexpected change to input: %v", first.Packets)
+	}
+
+	_, err = Merge(first, PcapFile{LinkType: RAW})
+	if err != MismatchedLinkTypes {
+		t.Errorf("Unexpected error: expected %v, got %v", MismatchedLinkTypes, err)
+	}
+
+	empty, err := Merge()
+	if err != nil || len(empty.Packets) != 0 {
+		t.Errorf("Unexpected result of merging nothing: %v (%v)", empty, err)
+	}
+}
+
+func TestMergeTimeZones(t *testing.T) {
+	a := [4]byte{192, 168, 1, 2}
+	b := [4]byte{10, 0, 0, 1}
+
+	// The first capture's local time is an hour ahead of UTC, so its packets were captured at 2s
+	// and 4s UTC, while the second capture's were captured at 1s and 3s.
+	first := PcapFile{LinkType: ETHERNET, TZCorrection: 3600, Packets: []Packet{
+		tcpTestPacket(time.Hour+2*time.Second, a, b, 40000, 80, 1, 0, "S", nil),
+		tcpTestPacket(time.Hour+4*time.Second, a, b, 40000, 80, 2, 0, "A", nil),
+	}}
+	second := PcapFile{LinkType: ETHERNET, Packets: []Packet{
+		tcpTestPacket(1*time.Second, b, a, 80, 40000, 11, 0, "SA", nil),
+		tcpTestPacket(3*time.Second, b, a, 80, 40000, 12, 0, "A", nil),
+	}}
+	for i := range first.Packets {
+		first.Packets[i].tzCorrection = first.TZCorrection
+	}
+
+	merged, err := Merge(first, second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []uint32{11, 1, 12, 2}
+	if len(merged.Packets) != len(expected) {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v", len(expected), len(merged.Packets))
+	}
+	for i, seq := range expected {
+		segment := merged.Packets[i].Transport().(*TCPSegment)
+		if segment.SequenceNumber != seq {
+			t.Errorf("Unexpected packet %v: expected sequence number %v, got %v", i, seq, segment.SequenceNumber)
+		}
+		if want := time.Unix(int64(i+1), 0); !merged.Packets[i].Time().Equal(want) {
+			t.Errorf("Unexpected time of packet %v: expected %v, got %v", i, want.UTC(), merged.Packets[i].Time())
+		}
+	}
+
+	// The timestamps are all in the first file's time zone, so they can be compared directly.
+	if merged.TZCorrection != 3600 || merged.Packets[1].Timestamp != time.Hour+2*time.Second {
+		t.Errorf("Unexpected time zone: %v, with timestamp %v", merged.TZCorrection, merged.Packets[1].Timestamp)
+	}
+	if since := merged.Packets[1].Since(merged.Packets[0]); since != time.Second {
+		t.Errorf("Unexpected time between packets: expected %v, got %v", time.Second, since)
+	}
+	if duration := merged.Duration(); duration != 3*time.Second {
+		t.Errorf("Unexpected duration: expected %v, got %v", 3*time.Second, duration)
+	}
+
+	// The inputs are left as they were.
+	if second.Packets[0].Timestamp != time.Second || second.Packets[0].tzCorrection != 0 {
+		t.Errorf("Unexpected change to input: %v", second.Packets[0])
+	}
+}
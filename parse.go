@@ -3,63 +3,220 @@ package gopcap
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"sync"
 	"time"
 )
 
 var magic = []byte{0xa1, 0xb2, 0xc3, 0xd4}
 var magic_reverse = []byte{0xd4, 0xc3, 0xb2, 0xa1}
+var magic_nanosecond = []byte{0xa1, 0xb2, 0x3c, 0x4d}
+var magic_nanosecond_reverse = []byte{0x4d, 0x3c, 0xb2, 0xa1}
+var magic_modified = []byte{0xa1, 0xb2, 0xcd, 0x34}
+var magic_modified_reverse = []byte{0x34, 0xcd, 0xb2, 0xa1}
 
 // checkMagicNum checks the first four bytes of a pcap file, searching for the magic number
-// and checking the byte order. Returns three values: whether the file is a pcap file, whether
-// the byte order needs flipping, and any error that was encountered. If error is returned,
-// the other values are invalid.
-func checkMagicNum(src io.Reader) (bool, binary.ByteOrder, error) {
+// and checking the byte order. Returns four values: the resolution of the file's timestamps,
+// which is zero if it isn't a pcap file, whether the byte order needs flipping, whether the file
+// is in the modified format, and any error that was encountered. If error is returned, the other
+// values are invalid.
+func checkMagicNum(src io.Reader) (time.Duration, binary.ByteOrder, bool, error) {
 	// These magic numbers form the header of a pcap file.
 
 	buffer := make([]byte, len(magic))
-	readCount, err := src.Read(buffer)
+	readCount, err := io.ReadFull(src, buffer)
 
 	switch {
 	case readCount != len(magic):
 		// Failed to read enough bytes for the magic number
-		return false, nil, InsufficientLength
+		return 0, nil, false, InsufficientLength
 	case err != nil && err != io.EOF:
 		// Unexpected error
-		return false, nil, err
+		return 0, nil, false, err
+	}
+
+	resolution, order, modified := magicNumOrder(buffer)
+	if order == nil {
+		// Unrecognised magic number
+		return 0, nil, false, NotAPcapFile
+	}
+	return resolution, order, modified, nil
+}
+
+// magicNumOrder returns the timestamp resolution and byte order that a magic number stands for, or
+// a nil byte order if it isn't one, and whether it's the modified format's.
+func magicNumOrder(buffer []byte) (time.Duration, binary.ByteOrder, bool) {
+	switch {
 	case bytes.Equal(buffer, magic):
 		// Big endian
-		return true, binary.BigEndian, nil
+		return time.Microsecond, binary.BigEndian, false
 	case bytes.Equal(buffer, magic_reverse):
 		// Little endian
-		return true, binary.LittleEndian, nil
+		return time.Microsecond, binary.LittleEndian, false
+	case bytes.Equal(buffer, magic_nanosecond):
+		// Big endian, with nanosecond timestamps
+		return time.Nanosecond, binary.BigEndian, false
+	case bytes.Equal(buffer, magic_nanosecond_reverse):
+		// Little endian, with nanosecond timestamps
+		return time.Nanosecond, binary.LittleEndian, false
+	case bytes.Equal(buffer, magic_modified):
+		// Big endian, in the modified format
+		return time.Microsecond, binary.BigEndian, true
+	case bytes.Equal(buffer, magic_modified_reverse):
+		// Little endian, in the modified format
+		return time.Microsecond, binary.LittleEndian, true
 	default:
-		// Unrecognised magic number
-		return false, nil, NotAPcapFile
+		return 0, nil, false
 	}
 }
 
+// timestampDecoder builds a packet's timestamp from the seconds and fractional seconds fields of
+// its packet header. Capture formats disagree on the units of the fractional part, so each format
+// supplies its own decoder.
+type timestampDecoder interface {
+	decode(seconds, fraction uint32) time.Duration
+}
+
+// microsecondTimestamps decodes timestamps from classic pcap files, where the fractional part is
+// in microseconds.
+type microsecondTimestamps struct{}
+
+func (microsecondTimestamps) decode(seconds, fraction uint32) time.Duration {
+	return (time.Duration(seconds) * time.Second) + (time.Duration(fraction) * time.Microsecond)
+}
+
+// nanosecondTimestamps decodes timestamps where the fractional part is in nanoseconds.
+type nanosecondTimestamps struct{}
+
+func (nanosecondTimestamps) decode(seconds, fraction uint32) time.Duration {
+	return (time.Duration(seconds) * time.Second) + (time.Duration(fraction) * time.Nanosecond)
+}
+
+// timestampsWithResolution returns the decoder for timestamps whose fractional part is in units of
+// resolution.
+func timestampsWithResolution(resolution time.Duration) timestampDecoder {
+	if resolution == time.Nanosecond {
+		return nanosecondTimestamps{}
+	}
+	return microsecondTimestamps{}
+}
+
+// DeepestLayer returns the innermost layer of the packet that was decoded: the application message
+// if there is one, otherwise the transport layer, and so on down to the link layer. Layers gopcap
+// didn't understand, such as an UnknownTransport, don't count, so a packet with an unknown
+// transport protocol returns its internet layer. It returns nil if not even the link layer was
+// understood.
+func (pkt *Packet) DeepestLayer() interface{} {
+	var deepest interface{}
+
+	link := pkt.Data
+	if link == nil {
+		return nil
+	}
+	if _, unknown := link.(*UnknownLink); unknown {
+		return nil
+	}
+	deepest = link
+
+	internet := link.LinkData()
+	if internet == nil {
+		return deepest
+	}
+	if _, unknown := internet.(*UnknownINet); unknown {
+		return deepest
+	}
+	deepest = internet
+
+	transport := internet.InternetData()
+	if transport == nil {
+		return deepest
+	}
+	if _, unknown := transport.(*UnknownTransport); unknown {
+		return deepest
+	}
+	deepest = transport
+
+	if carrier, ok := transport.(interface{ ApplicationData() ApplicationLayer }); ok {
+		if app := carrier.ApplicationData(); app != nil {
+			deepest = app
+		}
+	}
+	return deepest
+}
+
+// ReadFrom reads a single packet from a classic pcap file, with microsecond timestamps.
 func (pkt *Packet) ReadFrom(src io.Reader, order binary.ByteOrder, linkType Link) error {
+	return pkt.readFrom(src, order, linkType, microsecondTimestamps{})
+}
 
-	err := pkt.readPacketHeader(src, order)
+// readFrom reads a single packet, using the given decoder to build its timestamp.
+func (pkt *Packet) readFrom(src io.Reader, order binary.ByteOrder, linkType Link, timestamps timestampDecoder) error {
+
+	err := pkt.readPacketHeader(src, order, timestamps)
 
 	if err != nil {
 		return err
 	}
 
-	packetReader := io.LimitReader(src, int64(pkt.IncludedLen))
+	return pkt.readData(src, order, linkType, 0)
+}
 
-	pkt.Data, err = readLinkData(packetReader, order, linkType)
+// readData reads the packet's data, following its header, and decodes it. The data is read into a
+// buffer of its own, which becomes Raw, and the layers that ParseInto decodes without copying refer
+// to it rather than to copies of their own, so every packet costs one buffer however many layers it
+// has. The buffer belongs to the packet, so the packet can be kept for as long as it's needed.
+//
+// If limit is set, only that many bytes of the packet are read and decoded, and the rest is
+// skipped, as if the packet had been cut short by the snaplen.
+func (pkt *Packet) readData(src io.Reader, order binary.ByteOrder, linkType Link, limit uint32) error {
+	length := pkt.IncludedLen
+	if limit > 0 && length > limit {
+		length = limit
+	}
 
-	// Read any remaining data in the packet that wasn't parsed.
-	ioutil.ReadAll(packetReader)
+	// The length comes from the file, so the buffer grows as the data is read rather than being
+	// allocated up front, in case the file is corrupt.
+	data, err := readFull(src, nil, int(length))
+	n := len(data)
+	if err == nil && length < pkt.IncludedLen {
+		_, err = io.CopyN(ioutil.Discard, src, int64(pkt.IncludedLen-length))
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
 
+	// A packet cut short by the end of the file is decoded as far as it goes, as the layers would
+	// decode one cut short by the snaplen.
+	err = pkt.decode(data[:n], order, linkType, nil)
+
+	// One cut short by the limit was cut deliberately, so it being short isn't an error.
+	if err == InsufficientLength && n == int(length) && length < pkt.IncludedLen {
+		return nil
+	}
+	return err
+}
+
+// readHeader reads everything before the first packet: the magic number, which says whether this
+// is a pcap file at all and if so what byte ordering and timestamp resolution it has, and then the
+// file header. It returns the byte ordering.
+func (file *PcapFile) readHeader(src io.Reader) (binary.ByteOrder, error) {
+	resolution, order, modified, err := checkMagicNum(src)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	err = file.readFileHeader(src, order)
+	if err != nil {
+		return nil, err
+	}
+
+	file.TimestampResolution = resolution
+	file.timestamps = timestampsWithResolution(resolution)
+	file.order = order
+	file.modified = modified
+	return order, nil
 }
 
 // readFileHeader reads the next 20 bytes out of the .pcap file and uses it to populate the
@@ -75,17 +232,49 @@ func (file *PcapFile) readFileHeader(src io.Reader, order binary.ByteOrder) erro
 	})
 }
 
+// fileHeaderLength is the length of the file header, including the magic number.
+const fileHeaderLength = 24
+
+// packetHeaderLength is the length of the header in front of each packet.
+const packetHeaderLength = 16
+
+// modifiedPacketHeaderLength is the length of the header in front of each packet in the modified
+// format, which follows the usual fields with the interface index, protocol and packet type, and a
+// byte of padding.
+const modifiedPacketHeaderLength = packetHeaderLength + 8
+
+// packetHeaderSize returns the length of the header in front of each of the file's packets.
+func (file *PcapFile) packetHeaderSize() int64 {
+	if file.modified {
+		return modifiedPacketHeaderLength
+	}
+	return packetHeaderLength
+}
+
+// ParseError records a packet that couldn't be parsed, and where in the file it starts. Unwrap
+// returns the underlying error, so errors.Is still matches errors such as InsufficientLength.
+type ParseError struct {
+	Index  int   // The index of the packet in the file.
+	Offset int64 // The offset of the packet's header from the start of the file, once decompressed.
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Packet %v at offset %#x: %v", e.Index, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 // readPacketHeader reads the next 16 bytes out of the file and builds it into a
 // packet header.
-func (pkt *Packet) readPacketHeader(src io.Reader, order binary.ByteOrder) error {
-	var ts_seconds, ts_micros uint32
-
-	err := readFields(src, order, []interface{}{
-		&ts_seconds,
-		&ts_micros,
-		&pkt.IncludedLen,
-		&pkt.ActualLen,
-	})
+func (pkt *Packet) readPacketHeader(src io.Reader, order binary.ByteOrder, timestamps timestampDecoder) error {
+	buf := fieldBuffers.Get().(*[fieldBufferLength]byte)
+	defer fieldBuffers.Put(buf)
+	header := buf[:packetHeaderLength]
+
+	_, err := io.ReadFull(src, header)
 
 	if err == io.ErrUnexpectedEOF {
 		return InsufficientLength
@@ -94,10 +283,110 @@ func (pkt *Packet) readPacketHeader(src io.Reader, order binary.ByteOrder) error
 		return err
 	}
 
+	pkt.decodeHeader(header, order, timestamps)
+	return nil
+}
+
+// nextPacketHeader reads the header of the next packet into pkt. Captures are sometimes joined by
+// concatenating their files, so what would be a packet header may instead be the magic number and
+// header of another file. If so, that header replaces the file's, so that the packets after it are
+// read with its byte ordering, timestamp resolution and link type, and the packet header following
+// it is read instead. It returns the length of the file headers read, so that offsets can be kept.
+func (file *PcapFile) nextPacketHeader(pkt *Packet, src io.Reader) (int64, error) {
+	buf := fieldBuffers.Get().(*[fieldBufferLength]byte)
+	defer fieldBuffers.Put(buf)
+	header := buf[:packetHeaderLength]
+
+	var skipped int64
+	for {
+		_, err := io.ReadFull(src, header)
+		if err == io.ErrUnexpectedEOF {
+			return skipped, InsufficientLength
+		}
+		if err != nil {
+			return skipped, err
+		}
+		if !isFileHeader(header) {
+			break
+		}
+
+		// The file header is longer than a packet header, so the rest of it follows.
+		_, err = file.readHeader(io.MultiReader(bytes.NewReader(header), src))
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return skipped, InsufficientLength
+		}
+		if err != nil {
+			return skipped, err
+		}
+		skipped += fileHeaderLength
+	}
+
+	pkt.decodeHeader(header, file.order, file.timestamps)
+	pkt.tzCorrection = file.TZCorrection
+
+	if !file.modified {
+		return skipped, nil
+	}
+
+	extra := buf[packetHeaderLength:modifiedPacketHeaderLength]
+	_, err := io.ReadFull(src, extra)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return skipped, InsufficientLength
+	}
+	if err != nil {
+		return skipped, err
+	}
+	pkt.decodeModifiedHeader(extra, file.order)
+	return skipped, nil
+}
+
+// isFileHeader reports whether a packet header is instead the start of a file header. As well as
+// the magic number, the major version must be 2, as it is for every pcap file, so that a packet
+// whose timestamp happens to match a magic number isn't mistaken for one.
+func isFileHeader(header []byte) bool {
+	_, order, _ := magicNumOrder(header[:len(magic)])
+	return order != nil && order.Uint16(header[4:6]) == 2
+}
+
+// decodeHeader builds the packet header from its 16 bytes.
+func (pkt *Packet) decodeHeader(header []byte, order binary.ByteOrder, timestamps timestampDecoder) {
+	ts_seconds := order.Uint32(header[0:4])
+	ts_fraction := order.Uint32(header[4:8])
+	pkt.IncludedLen = order.Uint32(header[8:12])
+	pkt.ActualLen = order.Uint32(header[12:16])
+
 	// Construct the timestamp
-	pkt.Timestamp = (time.Duration(ts_seconds) * time.Second) + (time.Duration(ts_micros) * time.Microsecond)
+	pkt.Timestamp = timestamps.decode(ts_seconds, ts_fraction)
+}
 
-	return err
+// decodeModifiedHeader decodes the fields the modified format adds to the packet header. The
+// protocol is copied from the kernel as it is, so it's in network byte order whatever the order of
+// the file.
+func (pkt *Packet) decodeModifiedHeader(extra []byte, order binary.ByteOrder) {
+	pkt.InterfaceIndex = int32(order.Uint32(extra[0:4]))
+	pkt.Protocol = EtherType(networkByteOrder.Uint16(extra[4:6]))
+	pkt.PacketType = extra[6]
+}
+
+// Time returns the packet's timestamp as an absolute time. Timestamps are recorded in the capture's
+// local time, which is TZCorrection seconds east of UTC; the returned time is in that zone, and is
+// in UTC if there's no correction.
+func (pkt *Packet) Time() time.Time {
+	t := time.Unix(0, int64(pkt.Timestamp))
+	if pkt.tzCorrection == 0 {
+		return t.UTC()
+	}
+
+	offset := int(pkt.tzCorrection)
+	return t.Add(-time.Duration(offset) * time.Second).In(time.FixedZone("", offset))
+}
+
+// Since returns how long after other the packet was captured, such as the delta between consecutive
+// packets, or with the first packet of the capture as other, the time since the capture started
+// that Wireshark shows. If the packet was captured before other, as happens when a capture's
+// packets are out of order, the result is negative.
+func (pkt *Packet) Since(other Packet) time.Duration {
+	return pkt.Timestamp - other.Timestamp
 }
 
 // readLinkData takes the data buffer containing the full link-layer packet (or equivalent, e.g.
@@ -108,10 +397,126 @@ func readLinkData(src io.Reader, order binary.ByteOrder, linkType Link) (LinkLay
 	switch linkType {
 	case ETHERNET:
 		pkt = new(EthernetFrame)
+	case NULL, LOOP:
+		pkt = new(NullLink)
+	case RAW, IPV4, IPV6:
+		pkt = new(RawLink)
+	case LINUX_SLL:
+		pkt = new(SLLFrame)
 	default:
-		pkt = new(UnknownLink)
+		pkt = registeredLinkParser(linkType)
 	}
 
 	err := pkt.ReadFrom(src)
 	return pkt, err
 }
+
+// linkParsers holds the parsers registered for link types gopcap doesn't handle itself.
+var (
+	linkParsers     = make(map[Link]func() LinkLayer)
+	linkParsersLock sync.RWMutex
+)
+
+// RegisterLinkParser registers a parser for a link type that gopcap doesn't understand natively.
+// The factory is called once per packet of that link type, and must return a fresh LinkLayer
+// for the packet data to be read into. Link types gopcap already parses can't be overridden.
+// Registering a second factory for the same link type replaces the first. It is safe to call
+// from init(), and concurrently with parsing.
+func RegisterLinkParser(l Link, factory func() LinkLayer) {
+	linkParsersLock.Lock()
+	defer linkParsersLock.Unlock()
+	linkParsers[l] = factory
+}
+
+// registeredLinkParser builds the link layer for a link type gopcap doesn't parse natively,
+// falling back to UnknownLink if nothing has been registered for it.
+func registeredLinkParser(linkType Link) LinkLayer {
+	linkParsersLock.RLock()
+	factory, ok := linkParsers[linkType]
+	linkParsersLock.RUnlock()
+
+	if !ok {
+		return new(UnknownLink)
+	}
+	return factory()
+}
+
+//-------------------------------------------------------------------------------------------
+// Layer reuse
+//-------------------------------------------------------------------------------------------
+
+// packetLayers holds the layers ParseInto decodes packets into. Ethernet, IPv4, IPv6, TCP and UDP
+// are decoded straight from the packet bytes into the layer of that type here, so a capture that
+// switches between protocols doesn't allocate either. Everything else is read from the bytes as
+// ReadFrom would read it. A nil *packetLayers allocates new layers instead, for packets that are
+// kept, while still decoding without copying.
+type packetLayers struct {
+	ethernet EthernetFrame
+	ipv4     IPv4Packet
+	ipv6     IPv6Packet
+	tcp      TCPSegment
+	udp      UDPDatagram
+}
+
+// decode decodes the packet data into the reusable layers where it can. The layers refer to data
+// rather than copying it.
+func (pkt *Packet) decode(data []byte, order binary.ByteOrder, linkType Link, layers *packetLayers) error {
+	pkt.Raw = data
+
+	if linkType != ETHERNET {
+		var err error
+		pkt.Data, err = readLinkData(bytes.NewReader(data), order, linkType)
+		return err
+	}
+
+	e := layers.ethernetFrame()
+	pkt.Data = e
+	return e.decode(data, layers)
+}
+
+// ethernetFrame resets the EthernetFrame to its zero value and returns it. The VLAN tag slices
+// keep their storage.
+func (l *packetLayers) ethernetFrame() *EthernetFrame {
+	if l == nil {
+		return new(EthernetFrame)
+	}
+	l.ethernet = EthernetFrame{VLANTag: l.ethernet.VLANTag[:0], VLANTags: l.ethernet.VLANTags[:0]}
+	return &l.ethernet
+}
+
+// ipv4Packet resets the IPv4Packet to its zero value and returns it.
+func (l *packetLayers) ipv4Packet() *IPv4Packet {
+	if l == nil {
+		return new(IPv4Packet)
+	}
+	l.ipv4 = IPv4Packet{}
+	return &l.ipv4
+}
+
+// ipv6Packet resets the IPv6Packet to its zero value and returns it.
+func (l *packetLayers) ipv6Packet() *IPv6Packet {
+	if l == nil {
+		return new(IPv6Packet)
+	}
+	l.ipv6 = IPv6Packet{}
+	return &l.ipv6
+}
+
+// tcpSegment resets the TCPSegment to its zero value and returns it. The options slice keeps its
+// storage.
+func (l *packetLayers) tcpSegment() *TCPSegment {
+	if l == nil {
+		return new(TCPSegment)
+	}
+	l.tcp = TCPSegment{Options: l.tcp.Options[:0]}
+	return &l.tcp
+}
+
+// udpDatagram resets the UDPDatagram to its zero value and returns it.
+func (l *packetLayers) udpDatagram() *UDPDatagram {
+	if l == nil {
+		return new(UDPDatagram)
+	}
+	l.udp = UDPDatagram{}
+	return &l.udp
+}
@@ -3,6 +3,7 @@ package gopcap
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 	"testing"
 	"time"
 )
@@ -11,22 +12,31 @@ func TestCheckMagicNum(t *testing.T) {
 	in := [][]byte{
 		{0xa1, 0xb2, 0xc3, 0xd4},
 		{0xd4, 0xc3, 0xb2, 0xa1},
+		{0xa1, 0xb2, 0x3c, 0x4d},
+		{0x4d, 0x3c, 0xb2, 0xa1},
+		{0xa1, 0xb2, 0xcd, 0x34},
+		{0x34, 0xcd, 0xb2, 0xa1},
 		{0xd4, 0xc3, 0xb2, 0xa0},
 		{0xd4, 0xc3, 0xb2},
 	}
 
-	first := []bool{true, true, false, false}
+	first := []time.Duration{time.Microsecond, time.Microsecond, time.Nanosecond, time.Nanosecond, time.Microsecond, time.Microsecond, 0, 0}
 	second := []binary.ByteOrder{
+		binary.BigEndian,
+		binary.LittleEndian,
+		binary.BigEndian,
+		binary.LittleEndian,
 		binary.BigEndian,
 		binary.LittleEndian,
 		nil,
 		nil,
 	}
-	third := []error{nil, nil, NotAPcapFile, InsufficientLength}
+	third := []bool{false, false, false, false, true, true, false, false}
+	fourth := []error{nil, nil, nil, nil, nil, nil, NotAPcapFile, InsufficientLength}
 
 	for i, input := range in {
 		reader := bytes.NewReader(input)
-		out1, out2, out3 := checkMagicNum(reader)
+		out1, out2, out3, out4 := checkMagicNum(reader)
 
 		if out1 != first[i] {
 			t.Errorf("Unexpected first return val: expected %v, got %v.", first[i], out1)
@@ -39,13 +49,17 @@ func TestCheckMagicNum(t *testing.T) {
 		if out3 != third[i] {
 			t.Errorf("Unexpected third return val: expected %v, got %v.", third[i], out3)
 		}
+
+		if out4 != fourth[i] {
+			t.Errorf("Unexpected fourth return val: expected %v, got %v.", fourth[i], out4)
+		}
 	}
 }
 
 func TestPopulatePacketHeaderGood(t *testing.T) {
 	in := bytes.NewReader([]byte{0xfa, 0x4f, 0xef, 0x44, 0x64, 0xfd, 0x09, 0x00, 0x60, 0x00, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x00})
 	pkt := new(Packet)
-	err := pkt.readPacketHeader(in, binary.LittleEndian)
+	err := pkt.readPacketHeader(in, binary.LittleEndian, microsecondTimestamps{})
 	correct_ts := 321259*time.Hour + 31*time.Minute + 6*time.Second + 654*time.Millisecond + 692*time.Microsecond
 
 	if err != nil {
@@ -65,7 +79,7 @@ func TestPopulatePacketHeaderGood(t *testing.T) {
 func TestPopulatePacketHeaderErr(t *testing.T) {
 	in := bytes.NewReader([]byte{0xfa})
 	pkt := new(Packet)
-	err := pkt.readPacketHeader(in, binary.LittleEndian)
+	err := pkt.readPacketHeader(in, binary.LittleEndian, microsecondTimestamps{})
 
 	if err != InsufficientLength {
 		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
@@ -109,3 +123,163 @@ func TestPopulateFileHeaderErr(t *testing.T) {
 		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
 	}
 }
+
+func TestTimestampDecoders(t *testing.T) {
+	micros := microsecondTimestamps{}.decode(1156534266, 654692)
+	nanos := nanosecondTimestamps{}.decode(1156534266, 654692123)
+	base := 1156534266 * time.Second
+
+	if micros != base+654692*time.Microsecond {
+		t.Errorf("Incorrect microsecond timestamp: expected %v, got %v", base+654692*time.Microsecond, micros)
+	}
+	if nanos != base+654692123*time.Nanosecond {
+		t.Errorf("Incorrect nanosecond timestamp: expected %v, got %v", base+654692123*time.Nanosecond, nanos)
+	}
+}
+
+// testUserLink is a trivial link layer with a one-byte header, used to test parser registration.
+type testUserLink struct {
+	Header uint8
+	data   InternetLayer
+}
+
+func (l *testUserLink) LinkData() InternetLayer {
+	return l.data
+}
+
+func (l *testUserLink) ReadFrom(src io.Reader) error {
+	err := binary.Read(src, binary.BigEndian, &l.Header)
+	if err != nil {
+		return err
+	}
+
+	l.data, err = readInternetLayer(src, ETHERTYPE_IPV4)
+	return err
+}
+
+func TestRegisterLinkParser(t *testing.T) {
+	userLink := Link(147)
+	data := []byte{0x2A, 0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00,
+		0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02, 0x04, 0xD2, 0x16, 0x2E, 0x00, 0x08, 0x00, 0x00}
+
+	// Before registration the link type isn't understood.
+	pkt, err := readLinkData(bytes.NewReader(data), binary.BigEndian, userLink)
+	if _, ok := pkt.(*UnknownLink); !ok || err != nil {
+		t.Errorf("Unexpected link layer before registration: %T %v", pkt, err)
+	}
+
+	RegisterLinkParser(userLink, func() LinkLayer { return new(testUserLink) })
+	defer func() {
+		delete(linkParsers, userLink)
+		delete(linkParsers, ETHERNET)
+	}()
+
+	pkt, err = readLinkData(bytes.NewReader(data), binary.BigEndian, userLink)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	link, ok := pkt.(*testUserLink)
+	if !ok {
+		t.Fatalf("Unexpected link layer type: %T", pkt)
+	}
+	if link.Header != 0x2A {
+		t.Errorf("Unexpected header: expected %v, got %v", 0x2A, link.Header)
+	}
+	if _, ok := link.LinkData().(*IPv4Packet); !ok {
+		t.Errorf("Unexpected internet layer type: %T", link.LinkData())
+	}
+
+	// Link types parsed natively aren't affected.
+	RegisterLinkParser(ETHERNET, func() LinkLayer { return new(testUserLink) })
+	pkt, _ = readLinkData(bytes.NewReader(data), binary.BigEndian, ETHERNET)
+	if _, ok := pkt.(*EthernetFrame); !ok {
+		t.Errorf("Unexpected link layer type: %T", pkt)
+	}
+}
+
+func TestDeepestLayer(t *testing.T) {
+	tcp := &TCPSegment{SourcePort: 40000, DestinationPort: 80}
+	dns := &DNSMessage{ID: 1}
+	ipWithUnknown := &IPv4Packet{Protocol: 0xFD, data: new(UnknownTransport)}
+	frameWithUnknown := &EthernetFrame{EtherType: 0x88B5, data: new(UnknownINet)}
+	truncated := &EthernetFrame{Truncated: true}
+
+	cases := []struct {
+		name     string
+		pkt      Packet
+		expected interface{}
+	}{
+		{"TCP", Packet{Data: &EthernetFrame{data: &IPv4Packet{data: tcp}}}, tcp},
+		{"DNS", Packet{Data: &EthernetFrame{data: &IPv4Packet{data: &UDPDatagram{app: dns}}}}, dns},
+		{"unknown transport", Packet{Data: &EthernetFrame{data: ipWithUnknown}}, ipWithUnknown},
+		{"unknown internet", Packet{Data: frameWithUnknown}, frameWithUnknown},
+		{"truncated", Packet{Data: truncated}, truncated},
+		{"unknown link", Packet{Data: new(UnknownLink)}, nil},
+		{"empty", Packet{}, nil},
+	}
+
+	for _, c := range cases {
+		if deepest := c.pkt.DeepestLayer(); deepest != c.expected {
+			t.Errorf("Unexpected deepest layer for %v packet: expected %v, got %v", c.name, c.expected, deepest)
+		}
+	}
+}
+
+func TestParseModified(t *testing.T) {
+	// A little-endian capture in the modified format, with two copies of the packet from tcpCapture,
+	// each received on interface 2 as an IPv4 packet for this host.
+	data := []byte{
+		0x34, 0xcd, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+	}
+	packet := tcpCapture(1)[24:]
+	for i := 0; i < 2; i++ {
+		data = append(data, packet[:packetHeaderLength]...)
+		data = append(data, 0x02, 0x00, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00)
+		data = append(data, packet[packetHeaderLength:]...)
+	}
+
+	parsed, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	if len(parsed.Packets) != 2 {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v", 2, len(parsed.Packets))
+	}
+	if parsed.TimestampResolution != time.Microsecond {
+		t.Errorf("Unexpected resolution: expected %v, got %v", time.Microsecond, parsed.TimestampResolution)
+	}
+	for i, pkt := range parsed.Packets {
+		if pkt.IncludedLen != 58 || pkt.ActualLen != 58 {
+			t.Errorf("Unexpected lengths for packet %v: got %v, %v", i, pkt.IncludedLen, pkt.ActualLen)
+		}
+		if pkt.InterfaceIndex != 2 || pkt.Protocol != ETHERTYPE_IPV4 || pkt.PacketType != 0 {
+			t.Errorf("Unexpected modified fields for packet %v: got %v, %v, %v", i, pkt.InterfaceIndex, pkt.Protocol, pkt.PacketType)
+		}
+		if tuple, ok := pkt.FiveTuple(); !ok || tuple.SourcePort != 1234 {
+			t.Errorf("Unexpected tuple for packet %v: %v", i, tuple)
+		}
+	}
+
+	// The other ways of reading a file agree, and count the longer headers in their offsets.
+	count, err := CountPackets(bytes.NewReader(data))
+	if err != nil || count != 2 {
+		t.Errorf("Unexpected count: expected %v, got %v (%v)", 2, count, err)
+	}
+	index, err := BuildIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	if offset := int64(fileHeaderLength + modifiedPacketHeaderLength + 58); index.Entries[1].Offset != offset {
+		t.Errorf("Unexpected offset: expected %v, got %v", offset, index.Entries[1].Offset)
+	}
+	pkt, err := index.ReadPacket(bytes.NewReader(data), 1)
+	if err != nil || packetSummary(&pkt) != packetSummary(&parsed.Packets[1]) || pkt.InterfaceIndex != 2 {
+		t.Errorf("Unexpected packet: %v (%v)", packetSummary(&pkt), err)
+	}
+
+	// A packet cut short in its extra fields is too short.
+	_, err = Parse(bytes.NewReader(data[:fileHeaderLength+packetHeaderLength+4]))
+	if parseErr, ok := err.(*ParseError); !ok || parseErr.Err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+}
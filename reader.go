@@ -0,0 +1,302 @@
+package gopcap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// HeadersLength is how much of each packet a Reader set to HeadersOnly reads: enough for an Ethernet
+// header with two VLAN tags, followed by IPv4 and TCP headers with as many options as they can hold.
+const HeadersLength = 14 + 8 + 60 + 60
+
+// Reader reads a pcap file one packet at a time, so that captures of any size can be processed
+// without holding them in memory. Unlike ParseInto, each packet is decoded into new values, so
+// packets can be kept for as long as they're needed. Like Parse, gzip-compressed sources are
+// decompressed as they're read, unless the Reader is made by a Parser with DisableDecompression set.
+type Reader struct {
+	file    PcapFile
+	src     io.Reader
+	index   int    // The index of the next packet.
+	offset  int64  // The offset of the next packet's header.
+	section int64  // The offset of the file header the packets are being read with.
+	limit   uint32 // The most of each packet to read, or zero to read all of it. See HeadersOnly.
+}
+
+// NewReader reads the file header from the source, leaving it positioned at the first packet. If
+// the source isn't a pcap file, or the header is cut short, an error is returned.
+func NewReader(src io.Reader) (*Reader, error) {
+	return Parser{}.NewReader(src)
+}
+
+// NewReader behaves like the package's NewReader, reading the source with the parser's options.
+func (p Parser) NewReader(src io.Reader) (*Reader, error) {
+	src, err := p.source(src)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{src: src, offset: fileHeaderLength}
+	_, err = r.file.readHeader(r.src)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// HeadersOnly sets whether the reader skips the payloads of packets, for passes over a capture
+// that only need the headers, such as indexing it by time and five-tuple. Only the first
+// HeadersLength bytes of each packet are read, which is enough for the link, internet and transport
+// headers of almost every packet, and the rest is skipped without being kept. Each packet is
+// decoded as if it had been cut short by the snaplen: its lengths are as they were, but Raw and
+// its payload stop at HeadersLength bytes.
+func (r *Reader) HeadersOnly(headersOnly bool) {
+	r.limit = 0
+	if headersOnly {
+		r.limit = HeadersLength
+	}
+}
+
+// Header returns the file header. If files have been concatenated, it's the header of the one
+// being read, which changes as each one is reached. The returned PcapFile has no Packets.
+func (r *Reader) Header() PcapFile {
+	return r.file
+}
+
+// Next reads and decodes the next packet. At the end of the file it returns io.EOF. If the packet
+// can't be decoded, it's returned, decoded as far as possible, along with the error; the reader
+// moves on past it, so Next can be called again to carry on with the packet after. A packet too
+// short for its headers, including one cut short by the end of the file, returns
+// InsufficientLength. As with Parse, errors are returned as a *ParseError.
+func (r *Reader) Next() (*Packet, error) {
+	pkt := new(Packet)
+	err := r.nextPacketHeader(pkt)
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, r.parseError(err)
+	}
+
+	// Running out of data now means the packet was too short, not that the file has ended.
+	err = pkt.readData(r.src, r.file.order, r.file.LinkType, r.limit)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = InsufficientLength
+	}
+	if err != nil {
+		err = r.parseError(err)
+	}
+
+	r.index++
+	r.offset += r.file.packetHeaderSize() + int64(pkt.IncludedLen)
+	return pkt, err
+}
+
+// skip reads the next packet's header and skips its data without decoding it, returning the packet
+// with only its header fields set. At the end of the file it returns io.EOF, and otherwise errors
+// are returned as a *ParseError, as Next returns them.
+func (r *Reader) skip() (Packet, error) {
+	var pkt Packet
+	err := r.nextPacketHeader(&pkt)
+	if err == io.EOF {
+		return pkt, err
+	}
+	if err != nil {
+		return pkt, r.parseError(err)
+	}
+
+	// CopyN returns io.EOF if the data runs out, which here means the packet was too short.
+	_, err = io.CopyN(ioutil.Discard, r.src, int64(pkt.IncludedLen))
+	if err == io.EOF {
+		err = InsufficientLength
+	}
+	if err != nil {
+		return pkt, r.parseError(err)
+	}
+
+	r.index++
+	r.offset += r.file.packetHeaderSize() + int64(pkt.IncludedLen)
+	return pkt, nil
+}
+
+// nextPacketHeader reads the next packet's header, moving on to the next file if files have been
+// concatenated. See PcapFile.nextPacketHeader.
+func (r *Reader) nextPacketHeader(pkt *Packet) error {
+	skipped, err := r.file.nextPacketHeader(pkt, r.src)
+	if skipped > 0 {
+		r.section = r.offset + skipped - fileHeaderLength
+		r.offset += skipped
+	}
+	return err
+}
+
+// parseError wraps an error reading the next packet.
+func (r *Reader) parseError(err error) error {
+	return &ParseError{Index: r.index, Offset: r.offset, Err: err}
+}
+
+// NextContext behaves like Next, but first checks whether the context is done, returning its error
+// if so. A read that's already waiting on the source isn't interrupted, so a source that can block,
+// such as a network connection, should also have a deadline of its own.
+func (r *Reader) NextContext(ctx context.Context) (*Packet, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	return r.Next()
+}
+
+// ParseEach reads a pcap file packet by packet, calling fn with each one without keeping them, for
+// work such as counting that only needs one packet at a time. Unlike ParseInto, each packet is
+// decoded into new values, so fn may keep them. Like Parse, gzip-compressed sources are
+// decompressed as they're read. Parsing stops at the first packet that can't be decoded, or the
+// first error returned by fn, and that error is returned.
+func ParseEach(src io.Reader, fn func(Packet) error) error {
+	return Parser{}.ParseEach(src, fn)
+}
+
+// ParseEach behaves like the package's ParseEach, reading the source with the parser's options.
+func (p Parser) ParseEach(src io.Reader, fn func(Packet) error) error {
+	r, err := p.NewReader(src)
+	if err != nil {
+		return err
+	}
+
+	for {
+		pkt, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = fn(*pkt)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// CountPackets counts the packets in a pcap file, reading only their headers and skipping their
+// data, which is much faster than Parse when only the count is needed, such as for a progress bar.
+// Like Parse, gzip-compressed sources are decompressed as they're read. If a packet is cut short,
+// the packets before it are counted and a *ParseError is returned.
+func CountPackets(src io.Reader) (int, error) {
+	return Parser{}.CountPackets(src)
+}
+
+// CountPackets behaves like the package's CountPackets, reading the source with the parser's
+// options.
+func (p Parser) CountPackets(src io.Reader) (int, error) {
+	r, err := p.NewReader(src)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		_, err := r.skip()
+		if err == io.EOF {
+			return r.index, nil
+		}
+		if err != nil {
+			return r.index, err
+		}
+	}
+}
+
+// ParseContext behaves like Parse, but checks the context between packets. Once the context is
+// done, parsing stops, and the packets parsed so far are returned along with the context's error.
+// See Reader.NextContext.
+func ParseContext(ctx context.Context, src io.Reader) (PcapFile, error) {
+	return Parser{}.ParseContext(ctx, src)
+}
+
+// ParseContext behaves like the package's ParseContext, reading the source with the parser's
+// options.
+func (p Parser) ParseContext(ctx context.Context, src io.Reader) (PcapFile, error) {
+	r, err := p.NewReader(src)
+	if err != nil {
+		return PcapFile{}, err
+	}
+	return r.readAll(ctx)
+}
+
+// ParseHeaders behaves like Parse, but skips the payloads of packets. See Reader.HeadersOnly.
+func ParseHeaders(src io.Reader) (PcapFile, error) {
+	return Parser{}.ParseHeaders(src)
+}
+
+// ParseHeaders behaves like the package's ParseHeaders, reading the source with the parser's
+// options.
+func (p Parser) ParseHeaders(src io.Reader) (PcapFile, error) {
+	r, err := p.NewReader(src)
+	if err != nil {
+		return PcapFile{}, err
+	}
+	r.HeadersOnly(true)
+	return r.readAll(context.Background())
+}
+
+// readAll reads the rest of the packets, stopping at the first error as Parse does.
+func (r *Reader) readAll(ctx context.Context) (PcapFile, error) {
+	file := r.Header()
+	file.Packets = make([]Packet, 0)
+
+	for {
+		pkt, err := r.NextContext(ctx)
+		if pkt != nil {
+			file.Packets = append(file.Packets, *pkt)
+		}
+		if err == io.EOF {
+			return file, nil
+		}
+		if err != nil {
+			return file, err
+		}
+	}
+}
+
+// ParseLenient behaves like Parse, but carries on past packets that can't be decoded instead of
+// stopping at the first one. Each packet header says how long its packet is, so the packet after a
+// bad one can still be found. Bad packets are kept, decoded as far as possible, so the Index of
+// each error is also the packet's index in Packets. The errors for the bad packets are returned
+// in order; the final error is only for a file that can't be read at all, such as one that isn't
+// a pcap file, or a source that fails part way through.
+func ParseLenient(src io.Reader) (PcapFile, []*ParseError, error) {
+	return Parser{}.ParseLenient(src)
+}
+
+// ParseLenient behaves like the package's ParseLenient, reading the source with the parser's
+// options.
+func (p Parser) ParseLenient(src io.Reader) (PcapFile, []*ParseError, error) {
+	r, err := p.NewReader(src)
+	if err != nil {
+		return PcapFile{}, nil, err
+	}
+
+	file := r.Header()
+	file.Packets = make([]Packet, 0)
+	failures := make([]*ParseError, 0)
+
+	for {
+		pkt, err := r.Next()
+		if err == io.EOF {
+			return file, failures, nil
+		}
+		var failure *ParseError
+		if errors.As(err, &failure) {
+			failures = append(failures, failure)
+		} else if err != nil {
+			return file, failures, err
+		}
+
+		// Without a packet header there's no way to find the next packet.
+		if pkt == nil {
+			return file, failures, nil
+		}
+
+		file.Packets = append(file.Packets, *pkt)
+	}
+}
@@ -0,0 +1,424 @@
+package gopcap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	expected, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	_, err = src.Seek(0, 0)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	reader, err := NewReader(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	header := reader.Header()
+	if header.LinkType != ETHERNET || header.MaxLen != 65535 || header.TimestampResolution != time.Microsecond {
+		t.Errorf("Unexpected file header: %+v", header)
+	}
+
+	count := 0
+	for {
+		pkt, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error reading packet %v: %v", count, err)
+		}
+		if packetSummary(pkt) != packetSummary(&expected.Packets[count]) {
+			t.Errorf("Unexpected packet %v: expected %v, got %v", count, packetSummary(&expected.Packets[count]), packetSummary(pkt))
+		}
+		if pkt.Timestamp != expected.Packets[count].Timestamp {
+			t.Errorf("Unexpected timestamp for packet %v: expected %v, got %v", count, expected.Packets[count].Timestamp, pkt.Timestamp)
+		}
+		count++
+	}
+
+	if count != 2263 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v", 2263, count)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Unexpected error after the end: expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestReaderContinuesAfterBadPacket(t *testing.T) {
+	data := []byte{
+		// File header: version 2.4, snaplen 65535, link type RAW.
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+		// A packet claiming to be IP version 5.
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x50, 0x00, 0x00, 0x00,
+		// An IPv4 echo request.
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00,
+		0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+		// A packet header promising more data than the file holds.
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x45, 0x00,
+	}
+
+	reader, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	pkt, err := reader.Next()
+	if !errors.Is(err, UnknownIPVersion) || pkt == nil {
+		t.Errorf("Unexpected first packet: %v, %v", pkt, err)
+	}
+
+	pkt, err = reader.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, isICMP := pkt.Data.LinkData().InternetData().(*ICMPSegment); !isICMP || pkt.Timestamp != time.Second {
+		t.Errorf("Unexpected second packet: %+v", pkt)
+	}
+
+	_, err = reader.Next()
+	if parseErr, ok := err.(*ParseError); !ok || parseErr.Err != InsufficientLength || parseErr.Index != 2 || parseErr.Offset != 0x5c {
+		t.Errorf("Unexpected error: expected packet 2 at offset 0x5c to be too short, got %v", err)
+	}
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("Unexpected error: expected %v, got %v", io.EOF, err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(data[:10])); err != UnexpectedEOF {
+		t.Errorf("Unexpected error: expected %v, got %v", UnexpectedEOF, err)
+	}
+	if _, err := NewReader(bytes.NewReader([]byte{0x01, 0x02, 0x03, 0x04})); err != NotAPcapFile {
+		t.Errorf("Unexpected error: expected %v, got %v", NotAPcapFile, err)
+	}
+}
+
+func TestParseEach(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	count := 0
+	var total uint64
+	err = ParseEach(src, func(pkt Packet) error {
+		count++
+		total += uint64(pkt.ActualLen)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Received unexpected error: %v", err)
+	}
+	if count != 2263 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v", 2263, count)
+	}
+	if total != 384637 {
+		t.Errorf("Unexpected total size: expected %v, got %v", 384637, total)
+	}
+
+	// An error from fn stops parsing.
+	_, err = src.Seek(0, 0)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	count = 0
+	err = ParseEach(src, func(pkt Packet) error {
+		count++
+		if count == 10 {
+			return IncorrectPacket
+		}
+		return nil
+	})
+	if err != IncorrectPacket || count != 10 {
+		t.Errorf("Unexpected result: %v packets, %v", count, err)
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	file, err := ParseContext(context.Background(), src)
+	if err != nil {
+		t.Errorf("Received unexpected error: %v", err)
+	}
+	if file.LinkType != ETHERNET || len(file.Packets) != 2263 {
+		t.Errorf("Unexpected file: link type %v with %v packets", file.LinkType, len(file.Packets))
+	}
+
+	// Cancel the context once ten packets have been read.
+	_, err = src.Seek(0, 0)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reader, err := NewReader(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	count := 0
+	for ; ; count++ {
+		if count == 10 {
+			cancel()
+		}
+		_, err = reader.NextContext(ctx)
+		if err != nil {
+			break
+		}
+	}
+	if err != context.Canceled || count != 10 {
+		t.Errorf("Unexpected result: %v packets, %v", count, err)
+	}
+
+	// A context that's already done returns the header with no packets.
+	_, err = src.Seek(0, 0)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	file, err = ParseContext(ctx, src)
+	if err != context.Canceled {
+		t.Errorf("Unexpected error: expected %v, got %v", context.Canceled, err)
+	}
+	if file.LinkType != ETHERNET || len(file.Packets) != 0 {
+		t.Errorf("Unexpected file: link type %v with %v packets", file.LinkType, len(file.Packets))
+	}
+}
+
+func TestParseLenient(t *testing.T) {
+	// Five packets of 74 bytes each, the second claiming to be IP version 5, the fourth with the URG
+	// flag set but no urgent pointer, which decodes and so isn't an error, and the last cut short.
+	capture := tcpCapture(5)
+	capture[fileHeaderLength+74+packetHeaderLength+14] = 0x55
+	capture[fileHeaderLength+3*74+packetHeaderLength+14+20+13] |= 0x20
+	data := capture[:len(capture)-5]
+
+	parsed, failures, err := ParseLenient(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	if len(parsed.Packets) != 5 {
+		t.Errorf("Unexpected number of packets: expected %v, got %v", 5, len(parsed.Packets))
+	}
+	if len(failures) != 2 {
+		t.Fatalf("Unexpected number of errors: expected %v, got %v", 2, len(failures))
+	}
+	if failures[0].Index != 1 || failures[0].Err != IncorrectPacket {
+		t.Errorf("Unexpected first error: %v", failures[0])
+	}
+	if failures[1].Index != 4 || failures[1].Err != InsufficientLength {
+		t.Errorf("Unexpected second error: %v", failures[1])
+	}
+	for _, i := range []int{0, 2, 3} {
+		if _, isTCP := parsed.Packets[i].Transport().(*TCPSegment); !isTCP {
+			t.Errorf("Unexpected packet %v: %v", i, parsed.Packets[i].Transport())
+		}
+	}
+
+	// A packet header cut short ends the file, with an error.
+	parsed, failures, err = ParseLenient(bytes.NewReader(capture[:fileHeaderLength+74+4]))
+	if err != nil || len(parsed.Packets) != 1 || len(failures) != 1 || failures[0].Index != 1 {
+		t.Errorf("Unexpected result: %v packets, %v, %v", len(parsed.Packets), failures, err)
+	}
+
+	if _, _, err := ParseLenient(bytes.NewReader([]byte{0x01, 0x02, 0x03, 0x04})); err != NotAPcapFile {
+		t.Errorf("Unexpected error: expected %v, got %v", NotAPcapFile, err)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	data, err := ioutil.ReadFile("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+
+	full, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	headers, err := ParseHeaders(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	if len(headers.Packets) != len(full.Packets) {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v", len(full.Packets), len(headers.Packets))
+	}
+
+	// Every packet keeps its timestamp, lengths and tuple, but no more than HeadersLength bytes.
+	for i := range full.Packets {
+		expected, pkt := &full.Packets[i], &headers.Packets[i]
+		if pkt.Timestamp != expected.Timestamp || pkt.IncludedLen != expected.IncludedLen || pkt.ActualLen != expected.ActualLen {
+			t.Errorf("Unexpected header for packet %v: expected %+v, got %+v", i, expected, pkt)
+		}
+		expectedTuple, expectedOK := expected.FiveTuple()
+		tuple, ok := pkt.FiveTuple()
+		if tuple != expectedTuple || ok != expectedOK {
+			t.Errorf("Unexpected tuple for packet %v: expected %v, got %v", i, expectedTuple, tuple)
+		}
+		if len(pkt.Raw) > HeadersLength || !bytes.Equal(pkt.Raw, expected.Raw[:len(pkt.Raw)]) {
+			t.Errorf("Unexpected raw bytes for packet %v: %x", i, pkt.Raw)
+		}
+	}
+
+	// The streaming reader skips payloads too.
+	reader, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	reader.HeadersOnly(true)
+	for i := 0; i < 10; i++ {
+		pkt, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error reading packet %v: %v", i, err)
+		}
+		if packetSummary(pkt) != packetSummary(&headers.Packets[i]) {
+			t.Errorf("Unexpected packet %v: expected %v, got %v", i, packetSummary(&headers.Packets[i]), packetSummary(pkt))
+		}
+	}
+}
+
+func TestCountPackets(t *testing.T) {
+	data, err := ioutil.ReadFile("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+
+	count, err := CountPackets(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if count != 2263 {
+		t.Errorf("Unexpected count: expected %v, got %v", 2263, count)
+	}
+
+	// A packet cut short isn't counted.
+	count, err = CountPackets(bytes.NewReader(data[:len(data)-1]))
+	if !errors.Is(err, InsufficientLength) {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if count != 2262 {
+		t.Errorf("Unexpected count: expected %v, got %v", 2262, count)
+	}
+
+	_, err = CountPackets(bytes.NewReader([]byte("not a pcap file at all.")))
+	if err != NotAPcapFile {
+		t.Errorf("Unexpected error: expected %v, got %v", NotAPcapFile, err)
+	}
+}
+
+// rawCapture builds a big-endian capture with nanosecond timestamps and a RAW link type, holding
+// count copies of the IPv4 packet from tcpCapture.
+func rawCapture(count int) []byte {
+	capture := []byte{
+		// File header: version 2.4, snaplen 65535, link type RAW.
+		0xa1, 0xb2, 0x3c, 0x4d, 0x00, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x00, 0x65,
+	}
+	packet := append([]byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x2C, 0x00, 0x00, 0x00, 0x2C}, tcpCapture(1)[24+16+14:]...)
+
+	for i := 0; i < count; i++ {
+		capture = append(capture, packet...)
+	}
+	return capture
+}
+
+func TestParseConcatenated(t *testing.T) {
+	data := append(append(tcpCapture(3), rawCapture(2)...), tcpCapture(0)...)
+
+	parsed, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	if len(parsed.Packets) != 5 {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v", 5, len(parsed.Packets))
+	}
+
+	// The first file's header is the one returned, but each packet is read with its own.
+	if parsed.LinkType != ETHERNET {
+		t.Errorf("Unexpected link type: expected %v, got %v", ETHERNET, parsed.LinkType)
+	}
+	for i, pkt := range parsed.Packets {
+		tuple, ok := pkt.FiveTuple()
+		if !ok || tuple.SourcePort != 1234 || tuple.DestinationPort != 6667 {
+			t.Errorf("Unexpected tuple for packet %v: %v", i, tuple)
+		}
+	}
+	if _, ok := parsed.Packets[3].Data.(*RawLink); !ok {
+		t.Errorf("Unexpected link layer: expected RawLink, got %T", parsed.Packets[3].Data)
+	}
+	if parsed.Packets[4].Timestamp != time.Second+2*time.Nanosecond {
+		t.Errorf("Unexpected timestamp: expected %v, got %v", time.Second+2*time.Nanosecond, parsed.Packets[4].Timestamp)
+	}
+
+	// The other ways of reading a file agree.
+	count, err := CountPackets(bytes.NewReader(data))
+	if err != nil || count != 5 {
+		t.Errorf("Unexpected count: expected %v, got %v (%v)", 5, count, err)
+	}
+
+	reader, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	for i := range parsed.Packets {
+		pkt, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error reading packet %v: %v", i, err)
+		}
+		if packetSummary(pkt) != packetSummary(&parsed.Packets[i]) {
+			t.Errorf("Unexpected packet %v: expected %v, got %v", i, packetSummary(&parsed.Packets[i]), packetSummary(pkt))
+		}
+	}
+	if reader.Header().LinkType != RAW {
+		t.Errorf("Unexpected link type: expected %v, got %v", RAW, reader.Header().LinkType)
+	}
+
+	var summaries []string
+	_, err = ParseInto(bytes.NewReader(data), nil, func(pkt *Packet) error {
+		summaries = append(summaries, packetSummary(pkt))
+		return nil
+	})
+	if err != nil || len(summaries) != 5 || summaries[3] != packetSummary(&parsed.Packets[3]) {
+		t.Errorf("Unexpected packets from ParseInto: %v (%v)", summaries, err)
+	}
+
+	index, err := BuildIndex(bytes.NewReader(data))
+	if err != nil || len(index.Entries) != 5 {
+		t.Fatalf("Unexpected index: %v (%v)", index, err)
+	}
+	expectedHeader := int64(len(tcpCapture(3)))
+	if index.Entries[3].Header != expectedHeader || index.Entries[3].Offset != expectedHeader+fileHeaderLength {
+		t.Errorf("Unexpected entry: %+v", index.Entries[3])
+	}
+	pkt, err := index.ReadPacket(bytes.NewReader(data), 4)
+	if err != nil || packetSummary(&pkt) != packetSummary(&parsed.Packets[4]) {
+		t.Errorf("Unexpected packet: %v (%v)", packetSummary(&pkt), err)
+	}
+
+	// A file header cut short is reported where it starts.
+	_, err = Parse(bytes.NewReader(data[:expectedHeader+20]))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Err != InsufficientLength || parseErr.Offset != expectedHeader {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package gopcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// Replayer writes packets out as a pcap file, pausing between them to reproduce the gaps between
+// their timestamps, so that a test harness reading the file sees the packets arrive as they were
+// captured. Each packet is flushed as soon as it's written. Packets are written as WriteTo writes
+// them.
+type Replayer struct {
+	dst        *bufio.Writer
+	order      binary.ByteOrder
+	resolution time.Duration
+	speed      float64
+
+	started bool
+	first   time.Duration // The timestamp of the first packet written.
+	start   time.Time     // When the first packet was written.
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewReplayer writes the file header from header, whose Packets are ignored, and returns a Replayer
+// for the packets that follow. Packets are paused between at the given speed: 1 reproduces the
+// original gaps, 2 halves them and so on, while 0 writes the packets as fast as possible.
+func NewReplayer(w io.Writer, header PcapFile, speed float64) (*Replayer, error) {
+	r := &Replayer{
+		dst:        bufio.NewWriterSize(w, DefaultBufferSize),
+		order:      binary.LittleEndian,
+		resolution: header.writeResolution(),
+		speed:      speed,
+		now:        time.Now,
+		sleep:      time.Sleep,
+	}
+
+	err := header.writeFileHeader(r.dst, r.order)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.dst.Flush()
+}
+
+// WritePacket waits until the packet is due and then writes it. Each packet is due its timestamp's
+// distance from the first packet's, divided by the speed, after the first packet was written, so
+// time spent between calls, or writing, doesn't accumulate. A packet that's already due, such as
+// one timestamped before the packet written before it, is written straight away. A packet with no
+// data is skipped.
+func (r *Replayer) WritePacket(pkt *Packet) error {
+	if pkt.Data == nil {
+		return nil
+	}
+
+	if !r.started {
+		r.started = true
+		r.first = pkt.Timestamp
+		r.start = r.now()
+	} else if r.speed > 0 {
+		due := r.start.Add(time.Duration(float64(pkt.Timestamp-r.first) / r.speed))
+		wait := due.Sub(r.now())
+		if wait > 0 {
+			r.sleep(wait)
+		}
+	}
+
+	err := pkt.writeTo(r.dst, r.order, r.resolution)
+	if err != nil {
+		return err
+	}
+	return r.dst.Flush()
+}
+
+// Replay writes the file to w with a Replayer, reproducing the timing of its packets at the given
+// speed. See NewReplayer.
+func Replay(w io.Writer, file *PcapFile, speed float64) error {
+	r, err := NewReplayer(w, *file, speed)
+	if err != nil {
+		return err
+	}
+
+	for i := range file.Packets {
+		err = r.WritePacket(&file.Packets[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
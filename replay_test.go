@@ -0,0 +1,81 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	client := [4]byte{192, 168, 1, 2}
+	server := [4]byte{10, 0, 0, 1}
+
+	// The fourth packet is out of order.
+	file := &PcapFile{LinkType: ETHERNET, MaxLen: 65535, Packets: []Packet{
+		tcpTestPacket(0, client, server, 40000, 80, 1000, 0, "S", nil),
+		tcpTestPacket(time.Second, server, client, 80, 40000, 5000, 1001, "SA", nil),
+		tcpTestPacket(3*time.Second, client, server, 40000, 80, 1001, 5001, "PA", []byte("GET /")),
+		tcpTestPacket(2*time.Second, client, server, 40000, 80, 1001, 5001, "A", nil),
+		{Timestamp: 4 * time.Second},
+		tcpTestPacket(5*time.Second, server, client, 80, 40000, 5001, 1006, "A", nil),
+	}}
+
+	var expected bytes.Buffer
+	if _, err := file.WriteTo(&expected); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		speed  float64
+		sleeps []time.Duration
+	}{
+		{1, []time.Duration{time.Second, 2 * time.Second, 2 * time.Second}},
+		{2, []time.Duration{500 * time.Millisecond, time.Second, time.Second}},
+		{0, nil},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		r, err := NewReplayer(&buf, *file, c.speed)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// A clock that only moves when the replayer sleeps.
+		clock := time.Unix(0, 0)
+		var sleeps []time.Duration
+		r.now = func() time.Time { return clock }
+		r.sleep = func(d time.Duration) {
+			sleeps = append(sleeps, d)
+			clock = clock.Add(d)
+		}
+
+		for i := range file.Packets {
+			if err := r.WritePacket(&file.Packets[i]); err != nil {
+				t.Fatalf("Unexpected error writing packet %v: %v", i, err)
+			}
+		}
+
+		if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+			t.Errorf("Unexpected output at speed %v: expected %x, got %x", c.speed, expected.Bytes(), buf.Bytes())
+		}
+		if len(sleeps) != len(c.sleeps) {
+			t.Errorf("Unexpected sleeps at speed %v: expected %v, got %v", c.speed, c.sleeps, sleeps)
+			continue
+		}
+		for i := range sleeps {
+			if sleeps[i] != c.sleeps[i] {
+				t.Errorf("Unexpected sleeps at speed %v: expected %v, got %v", c.speed, c.sleeps, sleeps)
+				break
+			}
+		}
+	}
+
+	// Replay at full speed writes the same file.
+	var buf bytes.Buffer
+	if err := Replay(&buf, file, 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+		t.Errorf("Unexpected output: expected %x, got %x", expected.Bytes(), buf.Bytes())
+	}
+}
@@ -0,0 +1,96 @@
+package gopcap
+
+import (
+	"fmt"
+	"net"
+)
+
+// Summary describes the packet in a single line, in the style of tcpdump, e.g.
+// "19:31:06.654692 IP 192.168.1.2.2848 > 212.204.214.114.6667: Flags [P.], seq 1304973037:1304973067,
+// ack 1425084530, win 8011, length 30". The time is the time of day in the capture's time zone, and
+// sequence numbers are absolute rather than relative to the start of the connection. TCP, UDP and
+// ICMP over IPv4 and IPv6, and ARP, are described in full; anything else by its protocol number
+// and length.
+func (pkt *Packet) Summary() string {
+	return pkt.Time().Format("15:04:05.000000") + " " + pkt.summarizeNetwork()
+}
+
+// summarizeNetwork describes the internet layer of the packet and everything above it.
+func (pkt *Packet) summarizeNetwork() string {
+	var version string
+	var src, dst net.IP
+	var protocol IPProtocol
+
+	switch ip := pkt.Network().(type) {
+	case *IPv4Packet:
+		version, src, dst, protocol = "IP", ip.SourceAddress[:], ip.DestAddress[:], ip.Protocol
+	case *IPv6Packet:
+		version, src, dst, protocol = "IP6", ip.SourceAddress[:], ip.DestinationAddress[:], ip.NextHeader
+	case *ARPPacket:
+		return summarizeARP(ip, pkt.ActualLen)
+	default:
+		if frame, isEthernet := pkt.Data.(*EthernetFrame); isEthernet && !frame.Truncated {
+			return fmt.Sprintf("ethertype 0x%04x, length %v", uint16(frame.EtherType), pkt.ActualLen)
+		}
+		return fmt.Sprintf("length %v", pkt.ActualLen)
+	}
+
+	return version + " " + summarizeTransport(pkt.Transport(), src, dst, protocol)
+}
+
+// summarizeTransport describes a transport-layer segment sent between two addresses.
+func summarizeTransport(transport TransportLayer, src, dst net.IP, protocol IPProtocol) string {
+	switch t := transport.(type) {
+	case *TCPSegment:
+		summary := fmt.Sprintf("%v.%v > %v.%v: Flags %v, seq %v", src, t.SourcePort, dst, t.DestinationPort, t.Flags, t.SequenceNumber)
+		if len(t.data) > 0 {
+			summary += fmt.Sprintf(":%v", t.SequenceNumber+uint32(len(t.data)))
+		}
+		if t.Flags.Has(TCP_FLAG_ACK) {
+			summary += fmt.Sprintf(", ack %v", t.AckNumber)
+		}
+		return summary + fmt.Sprintf(", win %v, length %v", t.WindowSize, len(t.data))
+	case *UDPDatagram:
+		return fmt.Sprintf("%v.%v > %v.%v: UDP, length %v", src, t.SourcePort, dst, t.DestinationPort, len(t.data))
+	case *ICMPSegment:
+		return fmt.Sprintf("%v > %v: %v", src, dst, summarizeICMP(t))
+	case nil:
+		return fmt.Sprintf("%v > %v: ip-proto-%v", src, dst, uint8(protocol))
+	}
+	return fmt.Sprintf("%v > %v: ip-proto-%v, length %v", src, dst, uint8(protocol), len(transport.TransportData()))
+}
+
+// summarizeICMP describes an ICMP message, giving its length including the ICMP header.
+func summarizeICMP(icmp *ICMPSegment) string {
+	name := "ICMP"
+	if icmp.IsIPv6() {
+		name = "ICMP6"
+	}
+	length := 8 + len(icmp.data)
+
+	switch {
+	case icmp.IsEchoRequest(), icmp.IsEchoReply():
+		kind := "request"
+		if icmp.IsEchoReply() {
+			kind = "reply"
+		}
+		id, sequence, _ := icmp.Echo()
+		return fmt.Sprintf("%v echo %v, id %v, seq %v, length %v", name, kind, id, sequence, length)
+	case icmp.IsDestinationUnreachable():
+		return fmt.Sprintf("%v destination unreachable, length %v", name, length)
+	case icmp.IsTimeExceeded():
+		return fmt.Sprintf("%v time exceeded, length %v", name, length)
+	}
+	return fmt.Sprintf("%v type %v, code %v, length %v", name, uint8(icmp.Type), icmp.Code, length)
+}
+
+// summarizeARP describes an ARP request or reply.
+func summarizeARP(arp *ARPPacket, length uint32) string {
+	switch arp.Operation {
+	case ARP_REQUEST:
+		return fmt.Sprintf("ARP, Request who-has %v tell %v, length %v", net.IP(arp.TargetProtocolAddress), net.IP(arp.SenderProtocolAddress), length)
+	case ARP_REPLY:
+		return fmt.Sprintf("ARP, Reply %v is-at %v, length %v", net.IP(arp.SenderProtocolAddress), net.HardwareAddr(arp.SenderHardwareAddress), length)
+	}
+	return fmt.Sprintf("ARP, operation %v, length %v", uint16(arp.Operation), length)
+}
@@ -0,0 +1,62 @@
+package gopcap
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestPacketSummary(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	expected := map[int]string{
+		0:   "19:31:06.654692 IP 192.168.1.2.2848 > 212.204.214.114.6667: Flags [P.], seq 1304973037:1304973067, ack 1425084530, win 8011, length 30",
+		1:   "19:31:06.780544 IP 212.204.214.114.6667 > 192.168.1.2.2848: Flags [.], seq 1425084530, ack 1304973067, win 57890, length 0",
+		36:  "19:31:17.304853 ethertype 0x88a2, length 32",
+		37:  "19:31:19.548699 IP 86.128.100.24.2029 > 192.168.1.2.135: Flags [S], seq 3432940731, win 53760, length 0",
+		173: "19:32:05.504879 ARP, Request who-has 192.168.1.2 tell 192.168.1.1, length 60",
+		214: "19:32:12.904073 IP 165.124.253.241.15294 > 192.168.1.2.35990: UDP, length 11",
+		286: "19:32:19.907356 IP 217.47.73.141 > 192.168.1.2: ICMP time exceeded, length 36",
+	}
+	for i, summary := range expected {
+		if got := parsed.Packets[i].Summary(); got != summary {
+			t.Errorf("Unexpected summary of packet %v:\nexpected %v\ngot      %v", i, summary, got)
+		}
+	}
+
+	// The raw file from TestParseRaw: an IPv4 echo request and an IPv6 UDP datagram.
+	data := []byte{
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00,
+		0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x11, 0x01,
+		0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0xdb, 0x3d, 0x07, 0x6c, 0x00, 0x0c, 0x50, 0x26, 0x01, 0x02, 0x03, 0x04,
+	}
+	parsed, err = Parse(bytes.NewReader(data))
+	if err != nil || len(parsed.Packets) != 2 {
+		t.Fatalf("Unexpected file: %v packets, %v", len(parsed.Packets), err)
+	}
+
+	summary := "00:00:00.000000 IP 192.168.1.2 > 192.168.1.1: ICMP echo request, id 4660, seq 1, length 12"
+	if got := parsed.Packets[0].Summary(); got != summary {
+		t.Errorf("Unexpected summary:\nexpected %v\ngot      %v", summary, got)
+	}
+	summary = "00:00:01.000000 IP6 fe80::4054:df2d:246b:280e.56125 > ff02::c.1900: UDP, length 4"
+	if got := parsed.Packets[1].Summary(); got != summary {
+		t.Errorf("Unexpected summary:\nexpected %v\ngot      %v", summary, got)
+	}
+
+	if got := new(Packet).Summary(); got != "00:00:00.000000 length 0" {
+		t.Errorf("Unexpected summary of an empty packet: %v", got)
+	}
+}
@@ -25,3 +25,8 @@ func (u *UnknownTransport) ReadFrom(src io.Reader) error {
 	u.data, err = ioutil.ReadAll(src)
 	return err
 }
+
+// Serialize returns the data as it was read.
+func (u *UnknownTransport) Serialize() ([]byte, error) {
+	return u.data, nil
+}
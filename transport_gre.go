@@ -0,0 +1,138 @@
+package gopcap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// The bits of the GRE flags and version field.
+const (
+	greFlagChecksum     uint16 = 0x8000
+	greFlagKey          uint16 = 0x2000
+	greFlagSequence     uint16 = 0x1000
+	greFlagAcknowledged uint16 = 0x0080
+	greVersionMask      uint16 = 0x0007
+)
+
+//-----------------------------------------------------------------------------
+// GREHeader
+//-----------------------------------------------------------------------------
+
+// GREHeader represents a Generic Routing Encapsulation header and the packet it carries. GRE is
+// carried directly over IP, so it fills the transport layer, but its payload is another network
+// layer or a whole link-layer frame. The payload is decoded according to the protocol type: IP
+// and other network protocols are available from Inner, while mirrored or bridged frames (ERSPAN,
+// transparent Ethernet bridging and PPP) are available from Frame, and Inner returns the network
+// layer inside them. The optional fields are only meaningful if their flag is set.
+type GREHeader struct {
+	ChecksumPresent       bool
+	KeyPresent            bool
+	SequencePresent       bool
+	AcknowledgmentPresent bool // Version 1 (PPTP) only.
+	Version               uint8
+	Protocol              EtherType
+	Checksum              uint16
+	Key                   uint32 // For version 1, the payload length and call ID.
+	SequenceNumber        uint32
+	AckNumber             uint32 // Version 1 (PPTP) only.
+	data                  []byte
+	frame                 LinkLayer
+	inner                 InternetLayer
+}
+
+func (g *GREHeader) TransportData() []byte {
+	return g.data
+}
+
+// Inner returns the network layer carried by the GRE packet.
+func (g *GREHeader) Inner() InternetLayer {
+	return g.inner
+}
+
+// Frame returns the link-layer frame carried by the GRE packet, or nil if it carries a network
+// layer directly.
+func (g *GREHeader) Frame() LinkLayer {
+	return g.frame
+}
+
+func (g *GREHeader) ReadFrom(src io.Reader) error {
+	var flags uint16
+	err := readFields(src, networkByteOrder, []interface{}{
+		&flags,
+		&g.Protocol,
+	})
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	g.ChecksumPresent = flags&greFlagChecksum != 0
+	g.KeyPresent = flags&greFlagKey != 0
+	g.SequencePresent = flags&greFlagSequence != 0
+	g.AcknowledgmentPresent = flags&greFlagAcknowledged != 0
+	g.Version = uint8(flags & greVersionMask)
+
+	// The checksum is followed by two reserved bytes.
+	var reserved uint16
+	fields := make([]interface{}, 0, 5)
+	if g.ChecksumPresent {
+		fields = append(fields, &g.Checksum, &reserved)
+	}
+	if g.KeyPresent {
+		fields = append(fields, &g.Key)
+	}
+	if g.SequencePresent {
+		fields = append(fields, &g.SequenceNumber)
+	}
+	if g.AcknowledgmentPresent {
+		fields = append(fields, &g.AckNumber)
+	}
+
+	err = readFields(src, networkByteOrder, fields)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	g.data, err = ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	return g.readPayload(bytes.NewReader(g.data))
+}
+
+// readPayload decodes the encapsulated packet.
+func (g *GREHeader) readPayload(src io.Reader) error {
+	switch g.Protocol {
+	case ERSPAN_TYPE_II, ERSPAN_TYPE_III:
+		// ERSPAN Type I shares its protocol type with Type II, but has no ERSPAN header and
+		// doesn't use sequence numbers.
+		if g.Protocol == ERSPAN_TYPE_II && !g.SequencePresent {
+			g.frame = new(EthernetFrame)
+		} else {
+			g.frame = new(ERSPANPacket)
+		}
+	case ETHERTYPE_TEB:
+		g.frame = new(EthernetFrame)
+	case ETHERTYPE_PPP:
+		g.frame = new(PPPFrame)
+	default:
+		var err error
+		g.inner, err = readInternetLayer(src, g.Protocol)
+		return err
+	}
+
+	err := g.frame.ReadFrom(src)
+	if err != nil {
+		return err
+	}
+
+	g.inner = g.frame.LinkData()
+	return nil
+}
@@ -0,0 +1,114 @@
+package gopcap
+
+import (
+	"bytes"
+	"testing"
+)
+
+// greTestInner is an IPv4 UDP datagram used as the payload of the GRE tests.
+var greTestInner = []byte{
+	0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+	0x04, 0xD2, 0x16, 0x2E, 0x00, 0x08, 0x00, 0x00,
+}
+
+func TestGREIPv4(t *testing.T) {
+	// An outer IPv4 packet carrying GRE with no optional fields.
+	data := []byte{
+		0x45, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x00, 0x40, 0x2F, 0x00, 0x00, 0xC0, 0xA8, 0x01, 0x01, 0xC0, 0xA8, 0x02, 0x01,
+		0x00, 0x00, 0x08, 0x00,
+	}
+	data = append(data, greTestInner...)
+	pkt := new(IPv4Packet)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	gre, isGRE := pkt.InternetData().(*GREHeader)
+	if !isGRE {
+		t.Fatalf("Unexpected transport layer: expected GRE, got %T", pkt.InternetData())
+	}
+	if gre.ChecksumPresent || gre.KeyPresent || gre.SequencePresent {
+		t.Errorf("Unexpected optional fields: %v %v %v", gre.ChecksumPresent, gre.KeyPresent, gre.SequencePresent)
+	}
+	if gre.Version != uint8(0) {
+		t.Errorf("Unexpected version: expected %v, got %v", 0, gre.Version)
+	}
+	if gre.Protocol != ETHERTYPE_IPV4 {
+		t.Errorf("Unexpected protocol: expected %v, got %v", ETHERTYPE_IPV4, gre.Protocol)
+	}
+	if !bytes.Equal(gre.TransportData(), greTestInner) {
+		t.Errorf("Unexpected payload: expected %v, got %v", greTestInner, gre.TransportData())
+	}
+	if gre.Frame() != nil {
+		t.Errorf("Unexpected frame: %v", gre.Frame())
+	}
+
+	inner, isIPv4 := gre.Inner().(*IPv4Packet)
+	if !isIPv4 {
+		t.Fatalf("Unexpected inner packet: expected IPv4, got %T", gre.Inner())
+	}
+	if inner.DestAddress != [4]byte{10, 0, 0, 2} {
+		t.Errorf("Unexpected inner destination: %v", inner.DestAddress)
+	}
+	if _, isUDP := inner.InternetData().(*UDPDatagram); !isUDP {
+		t.Errorf("Unexpected inner transport layer: expected UDP, got %T", inner.InternetData())
+	}
+}
+
+func TestGREOptionalFields(t *testing.T) {
+	data := []byte{0xA0, 0x00, 0x08, 0x00, 0x12, 0x34, 0x00, 0x00, 0xDE, 0xAD, 0xBE, 0xEF}
+	data = append(data, greTestInner...)
+	gre := new(GREHeader)
+	err := gre.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !gre.ChecksumPresent || !gre.KeyPresent || gre.SequencePresent {
+		t.Errorf("Unexpected optional fields: %v %v %v", gre.ChecksumPresent, gre.KeyPresent, gre.SequencePresent)
+	}
+	if gre.Checksum != uint16(0x1234) {
+		t.Errorf("Unexpected checksum: expected %v, got %v", 0x1234, gre.Checksum)
+	}
+	if gre.Key != uint32(0xDEADBEEF) {
+		t.Errorf("Unexpected key: expected %v, got %v", uint32(0xDEADBEEF), gre.Key)
+	}
+	if _, isIPv4 := gre.Inner().(*IPv4Packet); !isIPv4 {
+		t.Errorf("Unexpected inner packet: expected IPv4, got %T", gre.Inner())
+	}
+}
+
+func TestGREERSPAN(t *testing.T) {
+	// GRE with a sequence number, carrying ERSPAN Type II mirroring an Ethernet frame.
+	data := []byte{
+		0x10, 0x00, 0x88, 0xBE, 0x00, 0x00, 0x00, 0x2A,
+		0x10, 0x64, 0x00, 0x05, 0x00, 0x00, 0x00, 0x07,
+	}
+	data = append(data, 0x00, 0x16, 0xE3, 0x19, 0x27, 0x15, 0x00, 0x04, 0x76, 0x96, 0x7B, 0xDA, 0x08, 0x00)
+	data = append(data, greTestInner...)
+	gre := new(GREHeader)
+	err := gre.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !gre.SequencePresent || gre.SequenceNumber != uint32(42) {
+		t.Errorf("Unexpected sequence number: expected %v, got %v", 42, gre.SequenceNumber)
+	}
+
+	erspan, isERSPAN := gre.Frame().(*ERSPANPacket)
+	if !isERSPAN {
+		t.Fatalf("Unexpected frame: expected ERSPAN, got %T", gre.Frame())
+	}
+	if erspan.SessionID != uint16(5) {
+		t.Errorf("Unexpected session ID: expected %v, got %v", 5, erspan.SessionID)
+	}
+	if erspan.Frame().Src().String() != "00:04:76:96:7b:da" {
+		t.Errorf("Unexpected mirrored source: %v", erspan.Frame().Src())
+	}
+	if _, isIPv4 := gre.Inner().(*IPv4Packet); !isIPv4 {
+		t.Errorf("Unexpected inner packet: expected IPv4, got %T", gre.Inner())
+	}
+}
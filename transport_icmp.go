@@ -0,0 +1,134 @@
+package gopcap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+//-----------------------------------------------------------------------------
+// ICMPSegment
+//-----------------------------------------------------------------------------
+
+// ICMPSegment represents a single ICMP or ICMPv6 message. The four bytes following the checksum
+// have a different meaning depending on the message type, so they're kept uninterpreted in
+// RestOfHeader and decoded by the helper methods below. Whether the message is ICMPv6 depends on
+// the enclosing IP packet, and determines how the message type is interpreted.
+type ICMPSegment struct {
+	Type         ICMPType
+	Code         uint8
+	Checksum     uint16
+	RestOfHeader [4]byte
+	data         []byte
+	ipv6         bool
+}
+
+func (i *ICMPSegment) TransportData() []byte {
+	return i.data
+}
+
+func (i *ICMPSegment) ReadFrom(src io.Reader) error {
+	err := readFields(src, networkByteOrder, []interface{}{
+		&i.Type,
+		&i.Code,
+		&i.Checksum,
+		&i.RestOfHeader,
+	})
+
+	if err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	// All that remains is the message body.
+	i.data, err = ioutil.ReadAll(src)
+
+	return err
+}
+
+// Serialize returns the header followed by the message body. The checksum is written as it is,
+// not recomputed.
+func (i *ICMPSegment) Serialize() ([]byte, error) {
+	segment := make([]byte, 8, 8+len(i.data))
+	segment[0] = uint8(i.Type)
+	segment[1] = i.Code
+	networkByteOrder.PutUint16(segment[2:4], i.Checksum)
+	copy(segment[4:8], i.RestOfHeader[:])
+	return append(segment, i.data...), nil
+}
+
+// IsIPv6 returns whether this is an ICMPv6 message.
+func (i *ICMPSegment) IsIPv6() bool {
+	return i.ipv6
+}
+
+// IsEchoRequest returns whether this is an echo request (ping).
+func (i *ICMPSegment) IsEchoRequest() bool {
+	if i.ipv6 {
+		return i.Type == ICMPV6_ECHO_REQUEST
+	}
+	return i.Type == ICMP_ECHO_REQUEST
+}
+
+// IsEchoReply returns whether this is an echo reply.
+func (i *ICMPSegment) IsEchoReply() bool {
+	if i.ipv6 {
+		return i.Type == ICMPV6_ECHO_REPLY
+	}
+	return i.Type == ICMP_ECHO_REPLY
+}
+
+// IsDestinationUnreachable returns whether this is a destination unreachable message.
+func (i *ICMPSegment) IsDestinationUnreachable() bool {
+	if i.ipv6 {
+		return i.Type == ICMPV6_DEST_UNREACHABLE
+	}
+	return i.Type == ICMP_DEST_UNREACHABLE
+}
+
+// IsTimeExceeded returns whether this is a time exceeded message.
+func (i *ICMPSegment) IsTimeExceeded() bool {
+	if i.ipv6 {
+		return i.Type == ICMPV6_TIME_EXCEEDED
+	}
+	return i.Type == ICMP_TIME_EXCEEDED
+}
+
+// Echo returns the identifier and sequence number of an echo request or reply. The echo data is
+// the transport data.
+func (i *ICMPSegment) Echo() (id, sequence uint16, err error) {
+	if !i.IsEchoRequest() && !i.IsEchoReply() {
+		return 0, 0, IncorrectPacket
+	}
+
+	id = networkByteOrder.Uint16(i.RestOfHeader[0:2])
+	sequence = networkByteOrder.Uint16(i.RestOfHeader[2:4])
+
+	return id, sequence, nil
+}
+
+// OriginalDatagram returns the IP packet that caused a destination unreachable or time exceeded
+// message. The quoted packet is usually truncated (ICMP only guarantees the IP header and the
+// first eight bytes of its payload), in which case the IP header is still populated and the error
+// is InsufficientLength. The raw quoted bytes are available from TransportData.
+func (i *ICMPSegment) OriginalDatagram() (InternetLayer, error) {
+	if !i.IsDestinationUnreachable() && !i.IsTimeExceeded() {
+		return nil, IncorrectPacket
+	}
+
+	var original InternetLayer
+	if i.ipv6 {
+		original = new(IPv6Packet)
+	} else {
+		original = new(IPv4Packet)
+	}
+
+	err := original.ReadFrom(bytes.NewReader(i.data))
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = InsufficientLength
+	}
+
+	return original, err
+}
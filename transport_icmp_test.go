@@ -0,0 +1,125 @@
+package gopcap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestICMPEchoRequest(t *testing.T) {
+	// An IPv4 packet carrying an echo request with ID 0x1234 and sequence number 1.
+	data := []byte{
+		0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00, 0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A,
+		0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+	}
+	pkt := new(IPv4Packet)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	icmp, isICMP := pkt.InternetData().(*ICMPSegment)
+	if !isICMP {
+		t.Fatalf("Unexpected transport type: expected ICMPSegment, got %v", reflect.TypeOf(pkt.InternetData()))
+	}
+	if icmp.Type != ICMP_ECHO_REQUEST {
+		t.Errorf("Unexpected type: expected %v, got %v", ICMP_ECHO_REQUEST, icmp.Type)
+	}
+	if icmp.Code != uint8(0) {
+		t.Errorf("Unexpected code: expected %v, got %v", 0, icmp.Code)
+	}
+	if icmp.Checksum != uint16(0x4D5A) {
+		t.Errorf("Unexpected checksum: expected %v, got %v", 0x4D5A, icmp.Checksum)
+	}
+	if !icmp.IsEchoRequest() || icmp.IsEchoReply() {
+		t.Errorf("Expected an echo request.")
+	}
+
+	id, sequence, err := icmp.Echo()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if id != uint16(0x1234) {
+		t.Errorf("Unexpected ID: expected %v, got %v", 0x1234, id)
+	}
+	if sequence != uint16(1) {
+		t.Errorf("Unexpected sequence number: expected %v, got %v", 1, sequence)
+	}
+	if !bytes.Equal(icmp.TransportData(), []byte("abcd")) {
+		t.Errorf("Unexpected echo data: got %v", icmp.TransportData())
+	}
+	if _, err := icmp.OriginalDatagram(); err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
+
+func TestICMPTimeExceeded(t *testing.T) {
+	// A time exceeded message quoting the header and first eight bytes of a UDP probe.
+	data := []byte{
+		0x0B, 0x00, 0xF4, 0xFF, 0x00, 0x00, 0x00, 0x00, 0x45, 0x00, 0x00, 0x3C, 0xAB, 0xCD, 0x00, 0x00, 0x01, 0x11, 0x00, 0x00, 0xC0, 0xA8, 0x01, 0x02,
+		0x08, 0x08, 0x08, 0x08, 0x82, 0x9B, 0x82, 0x9B, 0x00, 0x28, 0x00, 0x00,
+	}
+	expectedDst := []byte{8, 8, 8, 8}
+	icmp := new(ICMPSegment)
+	err := icmp.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !icmp.IsTimeExceeded() {
+		t.Errorf("Expected a time exceeded message.")
+	}
+
+	original, err := icmp.OriginalDatagram()
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+
+	ip, isIPv4 := original.(*IPv4Packet)
+	if !isIPv4 {
+		t.Fatalf("Unexpected original datagram: expected IPv4Packet, got %v", reflect.TypeOf(original))
+	}
+	if ip.Protocol != IPP_UDP {
+		t.Errorf("Unexpected protocol: expected %v, got %v", IPP_UDP, ip.Protocol)
+	}
+	if ip.TTL != uint8(1) {
+		t.Errorf("Unexpected TTL: expected %v, got %v", 1, ip.TTL)
+	}
+	if !bytes.Equal(ip.DestAddress[:], expectedDst) {
+		t.Errorf("Unexpected destination address: expected %v, got %v", expectedDst, ip.DestAddress)
+	}
+}
+
+func TestICMPv6EchoReply(t *testing.T) {
+	// An IPv6 packet carrying an echo reply.
+	data := []byte{
+		0x60, 0x00, 0x00, 0x00, 0x00, 0x08, 0x3A, 0x40, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e,
+		0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x81, 0x00, 0x00, 0x00, 0x00, 0x07, 0x00, 0x02,
+	}
+	pkt := new(IPv6Packet)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	icmp, isICMP := pkt.InternetData().(*ICMPSegment)
+	if !isICMP {
+		t.Fatalf("Unexpected transport type: expected ICMPSegment, got %v", reflect.TypeOf(pkt.InternetData()))
+	}
+	if !icmp.IsIPv6() {
+		t.Errorf("Expected an ICMPv6 message.")
+	}
+	if !icmp.IsEchoReply() {
+		t.Errorf("Expected an echo reply.")
+	}
+	if icmp.IsTimeExceeded() {
+		t.Errorf("Unexpectedly decoded as time exceeded.")
+	}
+
+	id, sequence, err := icmp.Echo()
+	if err != nil || id != uint16(7) || sequence != uint16(2) {
+		t.Errorf("Unexpected echo fields: got %v, %v, %v", id, sequence, err)
+	}
+}
@@ -1,7 +1,9 @@
 package gopcap
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
 )
 
 //-----------------------------------------------------------------------------
@@ -44,13 +46,14 @@ func (s *SCTPSegment) ReadFrom(src io.Reader) error {
 		return err
 	}
 
-	// Read the chunks from the rest of the request
-	chunks, err := readSCTPChunks(src)
+	// Read the chunks from the rest of the segment. The segment length isn't carried in the
+	// header, so read the remaining data to find out how much there is.
+	data, err := ioutil.ReadAll(src)
 	if err != nil {
 		return err
 	}
 
-	s.Chunks = chunks
+	s.Chunks, err = readSCTPChunks(bytes.NewReader(data), int64(len(data)))
 
-	return nil
+	return err
 }
@@ -0,0 +1,56 @@
+package gopcap
+
+// sctpPPIDApps maps the payload protocol identifiers carried in DATA chunks to the names of the
+// applications they identify.
+var sctpPPIDApps = map[uint32]string{
+	1:  "IUA",
+	2:  "M2UA",
+	3:  "M3UA",
+	4:  "SUA",
+	5:  "M2PA",
+	18: "S1AP",
+	27: "X2AP",
+	46: "DIAMETER",
+	47: "DIAMETER",
+	60: "NGAP",
+	61: "XnAP",
+	62: "F1AP",
+}
+
+// sctpPortApps maps the well-known SCTP ports to the names of the applications that use them.
+var sctpPortApps = map[uint16]string{
+	2904:  "M2UA",
+	2905:  "M3UA",
+	3565:  "M2PA",
+	3868:  "DIAMETER",
+	5868:  "DIAMETER",
+	9900:  "IUA",
+	14001: "SUA",
+	36412: "S1AP",
+	36422: "X2AP",
+	38412: "NGAP",
+	38422: "XnAP",
+	38472: "F1AP",
+}
+
+// ClassifyApp returns the name of the application carried by the segment, such as "M3UA" or
+// "DIAMETER", or "" if it isn't recognised. The payload protocol identifier of the first DATA
+// chunk that sets one is the most reliable indication, so it's checked first. Segments without
+// one, such as those only carrying control chunks, are classified by their destination port and
+// then their source port.
+func (s *SCTPSegment) ClassifyApp() string {
+	for _, chunk := range s.Chunks {
+		data, isData := chunk.(*SCTPChunkData)
+		if !isData || data.PayloadProtocolIdentifier == 0 {
+			continue
+		}
+		if app, known := sctpPPIDApps[data.PayloadProtocolIdentifier]; known {
+			return app
+		}
+	}
+
+	if app, known := sctpPortApps[s.DestinationPort]; known {
+		return app
+	}
+	return sctpPortApps[s.SourcePort]
+}
@@ -56,38 +56,64 @@ func (h *SCTPChunkHeader) setHeader(header *SCTPChunkHeader) {
 	h.Length = header.Length
 }
 
-// Parse the supplied data as a sequence of SCTP Chunks
-func readSCTPChunks(src io.Reader) ([]SCTPChunk, error) {
+// Parse the supplied data as a sequence of SCTP Chunks. The length is the number of bytes remaining
+// in the segment: no chunk is allowed to read past it, whatever length the chunk claims to have.
+func readSCTPChunks(src io.Reader, length int64) ([]SCTPChunk, error) {
 	chunks := make([]SCTPChunk, 0)
-
-	var err error = nil
+	headerSize := int64(binary.Size(SCTPChunkHeader{}))
 
 	// Parse the chunks one at a time until there is no data left
-	for err != nil {
+	for length >= headerSize {
 
 		// Parse the common header so we know the type and length of the chunk.
 		header := SCTPChunkHeader{}
 		err := header.ReadFrom(src)
 		if err != nil {
-			return nil, err
+			return chunks, err
 		}
+		length -= headerSize
 
-		// The actual length of the chunk is always a multiple of 4
-		actualLength := int64(header.Length + (4-(header.Length%4))%4)
+		if int64(header.Length) < headerSize {
+			return chunks, IncorrectPacket
+		}
 
-		chunkReader := io.LimitReader(src, actualLength-int64(binary.Size(header)))
+		// Bound the chunk body by the end of the segment.
+		bodyLength := int64(header.Length) - headerSize
+		truncated := bodyLength > length
+		if truncated {
+			bodyLength = length
+		}
+
+		chunkReader := io.LimitReader(src, bodyLength)
 
 		// Parse this chunk.
-		chunk, err := readSCTPChunk(&header, src)
+		chunk, err := readSCTPChunk(&header, chunkReader)
+
+		if truncated {
+			if chunk != nil {
+				chunks = append(chunks, chunk)
+			}
+			return chunks, InsufficientLength
+		}
 
 		if err != nil && err != io.EOF {
-			return nil, err
+			return chunks, err
 		}
 
 		// Read any remaining data that the chunk didn't read.
 		ioutil.ReadAll(chunkReader)
+		length -= bodyLength
 
 		chunks = append(chunks, chunk)
+
+		// The actual length of the chunk is always a multiple of 4, but the padding isn't
+		// included in the chunk length and may be left off the last chunk in the segment.
+		padding := (4 - int64(header.Length)%4) % 4
+		if padding > length {
+			padding = length
+		}
+		io.CopyN(ioutil.Discard, src, padding)
+		length -= padding
 	}
 
 	return chunks, nil
@@ -121,6 +147,10 @@ func readSCTPChunk(header *SCTPChunkHeader, src io.Reader) (SCTPChunk, error) {
 		chunk = new(SCTPChunkCookieEcho)
 	case SCTP_CHUNK_COOKIE_ACK:
 		chunk = new(SCTPChunkCookieAck)
+	case SCTP_CHUNK_ECNE:
+		chunk = new(SCTPChunkECNE)
+	case SCTP_CHUNK_CWR:
+		chunk = new(SCTPChunkCWR)
 	case SCTP_CHUNK_SHUTDOWN_COMPLETE:
 		chunk = new(SCTPChunkShutdownComplete)
 	default:
@@ -176,8 +206,18 @@ func (c *SCTPChunkData) readBodyFrom(src io.Reader) error {
 		&c.PayloadProtocolIdentifier,
 	})
 
-	c.Data = make([]byte, c.Length-uint16(binary.Size(c.SCTPChunkHeader)))
-	_, err = src.Read(c.Data)
+	if err != nil {
+		return err
+	}
+
+	// The data is whatever follows the fixed fields.
+	fixedLength := uint16(binary.Size(c.SCTPChunkHeader)) + 12
+	if c.Length < fixedLength {
+		return IncorrectPacket
+	}
+
+	c.Data = make([]byte, c.Length-fixedLength)
+	_, err = io.ReadFull(src, c.Data)
 
 	return err
 }
@@ -231,6 +271,8 @@ func getSCTPInitChunkParameter(header *SCTPChunkParameterHeader) SCTPChunkParame
 		parameter = new(SCTPChunkParameterIPv4Sender)
 	case SCTP_CHUNK_PARAMETER_IPV6_SENDER:
 		parameter = new(SCTPChunkParameterIPv6Sender)
+	case SCTP_CHUNK_PARAMETER_STATE_COOKIE:
+		parameter = new(SCTPChunkParameterStateCookie)
 	case SCTP_CHUNK_PARAMETER_COOKIE_LIFESPAN_INCREMENT:
 		parameter = new(SCTPChunkParameterCookieLifespanInc)
 	default:
@@ -250,6 +292,17 @@ type SCTPChunkInitAck struct {
 	SCTPChunkInit
 }
 
+// StateCookie returns the cookie from the chunk's state cookie parameter, and whether it had one.
+// Every INIT ACK should.
+func (c *SCTPChunkInitAck) StateCookie() ([]byte, bool) {
+	for _, parameter := range c.Parameters {
+		if cookie, ok := parameter.(*SCTPChunkParameterStateCookie); ok {
+			return cookie.Cookie, true
+		}
+	}
+	return nil, false
+}
+
 //-----------------------------------------------------------------------------
 // SCTPChunkSack
 //-----------------------------------------------------------------------------
@@ -398,7 +451,7 @@ func (c *SCTPChunkCookieEcho) readBodyFrom(src io.Reader) error {
 	c.Cookie = make([]byte, c.Length-4)
 
 	// Parse the cookie.
-	_, err := src.Read(c.Cookie)
+	_, err := io.ReadFull(src, c.Cookie)
 
 	return err
 }
@@ -412,6 +465,40 @@ type SCTPChunkCookieAck struct {
 	SCTPChunkHeader
 }
 
+//-----------------------------------------------------------------------------
+// SCTPChunkECNE
+//-----------------------------------------------------------------------------
+
+// SCTPChunkECNE represents an ECNE (explicit congestion notification echo) chunk in an SCTP
+// segment, sent by a receiver that saw congestion marked on a DATA chunk.
+type SCTPChunkECNE struct {
+	SCTPChunkHeader
+	LowestTSN uint32 // The lowest TSN received in a packet marked with congestion.
+}
+
+func (c *SCTPChunkECNE) readBodyFrom(src io.Reader) error {
+	return readFields(src, networkByteOrder, []interface{}{
+		&c.LowestTSN,
+	})
+}
+
+//-----------------------------------------------------------------------------
+// SCTPChunkCWR
+//-----------------------------------------------------------------------------
+
+// SCTPChunkCWR represents a CWR (congestion window reduced) chunk in an SCTP segment, sent in
+// response to an ECNE chunk once the sender has reduced its congestion window.
+type SCTPChunkCWR struct {
+	SCTPChunkHeader
+	LowestTSN uint32 // The most recent TSN sent when the congestion window was reduced.
+}
+
+func (c *SCTPChunkCWR) readBodyFrom(src io.Reader) error {
+	return readFields(src, networkByteOrder, []interface{}{
+		&c.LowestTSN,
+	})
+}
+
 //-----------------------------------------------------------------------------
 // SCTPChunkShutdownComplete
 //-----------------------------------------------------------------------------
@@ -6,39 +6,55 @@ import (
 	"io/ioutil"
 )
 
-// Parse the supplied data as a sequence of SCTP Chunk parameters
+// Parse the supplied data as a sequence of SCTP Chunk parameters. The source must end with the
+// chunk the parameters are in.
 func readSCTPChunkParameters(src io.Reader, getParameter SCTPChunkParameterFactory) ([]SCTPChunkParameter, error) {
 	parameters := make([]SCTPChunkParameter, 0)
-
-	var err error = nil
+	headerSize := int64(binary.Size(SCTPChunkParameterHeader{}))
 
 	// Parse the parameters one at a time until there is no data left
-	for err != nil {
+	for {
 
 		// Parse the common header so we know the type and length of the parameter.
 		header := SCTPChunkParameterHeader{}
 		err := header.ReadFrom(src)
+		if err == io.EOF {
+			return parameters, nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return parameters, InsufficientLength
+		}
 		if err != nil {
-			return nil, err
+			return parameters, err
+		}
+
+		if int64(header.Length) < headerSize {
+			return parameters, IncorrectPacket
 		}
 
-		chunkReader := io.LimitReader(src, int64(header.Length)-int64(binary.Size(header)))
+		parameterReader := io.LimitReader(src, int64(header.Length)-headerSize)
 
-		// Parse this chunk.
+		// Parse this parameter.
 		parameter := getParameter(&header)
 		parameter.setHeader(&header)
-		err = parameter.readBodyFrom(src)
-		if err != nil && err != io.EOF {
-			return nil, err
+		err = parameter.readBodyFrom(parameterReader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return parameters, InsufficientLength
+		}
+		if err != nil {
+			return parameters, err
 		}
 
-		// Read any remaining data that the chunk didn't read.
-		ioutil.ReadAll(chunkReader)
+		// Read any remaining data that the parameter didn't read.
+		ioutil.ReadAll(parameterReader)
 
 		parameters = append(parameters, parameter)
-	}
 
-	return parameters, nil
+		// Like chunks, parameters are padded to a multiple of 4 bytes, and the padding isn't
+		// included in the length. The last parameter in a chunk may leave its padding off.
+		padding := (4 - int64(header.Length)%4) % 4
+		io.CopyN(ioutil.Discard, src, padding)
+	}
 }
 
 // Function type for building an SCTP Chunk parameter.
@@ -100,7 +116,7 @@ type SCTPChunkParameterUnknown struct {
 
 func (p *SCTPChunkParameterUnknown) readBodyFrom(src io.Reader) error {
 	p.Data = make([]byte, p.Length-uint16(binary.Size(p.SCTPChunkParameterHeader)))
-	_, err := src.Read(p.Data)
+	_, err := io.ReadFull(src, p.Data)
 	return err
 }
 
@@ -168,7 +184,24 @@ type SCTPChunkParameterHeartbeatInfo struct {
 
 func (p *SCTPChunkParameterHeartbeatInfo) readBodyFrom(src io.Reader) error {
 	p.Info = make([]byte, p.Length-uint16(binary.Size(p.SCTPChunkParameterHeader)))
-	_, err := src.Read(p.Info)
+	_, err := io.ReadFull(src, p.Info)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+// SCTPChunkParameterStateCookie
+//-----------------------------------------------------------------------------
+
+// SCTPChunkParameterStateCookie represents the parameter in an SCTP INIT ACK chunk containing the
+// state cookie, which the peer must send back unchanged in a COOKIE ECHO chunk.
+type SCTPChunkParameterStateCookie struct {
+	SCTPChunkParameterHeader
+	Cookie []byte
+}
+
+func (p *SCTPChunkParameterStateCookie) readBodyFrom(src io.Reader) error {
+	p.Cookie = make([]byte, p.Length-uint16(binary.Size(p.SCTPChunkParameterHeader)))
+	_, err := io.ReadFull(src, p.Cookie)
 	return err
 }
 
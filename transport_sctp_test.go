@@ -0,0 +1,214 @@
+package gopcap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSCTPChunks(t *testing.T) {
+	// A segment with a DATA chunk carrying four bytes, followed by a COOKIE ACK chunk.
+	data := []byte{
+		0x0B, 0x59, 0x0B, 0x59, 0x00, 0x00, 0x0E, 0x50, 0x53, 0x54, 0x2E, 0x90, 0x00, 0x03, 0x00, 0x14, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03, 0x04, 0x0B, 0x00, 0x00, 0x04,
+	}
+	expectedData := []byte{0x01, 0x02, 0x03, 0x04}
+	segment := new(SCTPSegment)
+	err := segment.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if segment.SourcePort != uint16(2905) {
+		t.Errorf("Unexpected source port: expected %v, got %v", 2905, segment.SourcePort)
+	}
+	if len(segment.Chunks) != 2 {
+		t.Fatalf("Unexpected number of chunks: expected %v, got %v", 2, len(segment.Chunks))
+	}
+
+	dataChunk, isData := segment.Chunks[0].(*SCTPChunkData)
+	if !isData {
+		t.Fatalf("Unexpected chunk type: expected SCTPChunkData, got %v", reflect.TypeOf(segment.Chunks[0]))
+	}
+	if dataChunk.TSN != uint32(1) {
+		t.Errorf("Unexpected TSN: expected %v, got %v", 1, dataChunk.TSN)
+	}
+	if dataChunk.PayloadProtocolIdentifier != uint32(3) {
+		t.Errorf("Unexpected PPID: expected %v, got %v", 3, dataChunk.PayloadProtocolIdentifier)
+	}
+	if !bytes.Equal(dataChunk.Data, expectedData) {
+		t.Errorf("Unexpected data: expected %v, got %v", expectedData, dataChunk.Data)
+	}
+	if _, isCookieAck := segment.Chunks[1].(*SCTPChunkCookieAck); !isCookieAck {
+		t.Errorf("Unexpected chunk type: expected SCTPChunkCookieAck, got %v", reflect.TypeOf(segment.Chunks[1]))
+	}
+	if !bytes.Equal(segment.TransportData(), expectedData) {
+		t.Errorf("Unexpected transport data: expected %v, got %v", expectedData, segment.TransportData())
+	}
+}
+
+func TestSCTPChunkLengthExceedsSegment(t *testing.T) {
+	// A COOKIE ACK chunk followed by an unknown chunk claiming 100 bytes when only eight remain.
+	data := []byte{
+		0x0B, 0x59, 0x0B, 0x59, 0x00, 0x00, 0x0E, 0x50, 0x53, 0x54, 0x2E, 0x90, 0x0B, 0x00, 0x00, 0x04, 0xC0, 0x00, 0x00, 0x64, 0xAA, 0xBB, 0xCC, 0xDD,
+	}
+	segment := new(SCTPSegment)
+	err := segment.ReadFrom(bytes.NewReader(data))
+
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if len(segment.Chunks) != 2 {
+		t.Fatalf("Unexpected number of chunks: expected %v, got %v", 2, len(segment.Chunks))
+	}
+
+	unknown, isUnknown := segment.Chunks[1].(*SCTPChunkUnknown)
+	if !isUnknown {
+		t.Fatalf("Unexpected chunk type: expected SCTPChunkUnknown, got %v", reflect.TypeOf(segment.Chunks[1]))
+	}
+	if !bytes.Equal(unknown.Data, []byte{0xAA, 0xBB, 0xCC, 0xDD}) {
+		t.Errorf("Unexpected chunk data: got %v", unknown.Data)
+	}
+}
+
+func TestSCTPFinalChunkWithoutPadding(t *testing.T) {
+	// Two DATA chunks carrying three bytes each. The first is padded to a multiple of four bytes,
+	// but the second ends the segment and leaves its padding off.
+	data := []byte{
+		0x0B, 0x59, 0x0B, 0x59, 0x00, 0x00, 0x0E, 0x50, 0x53, 0x54, 0x2E, 0x90,
+		0x00, 0x03, 0x00, 0x13, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03, 0x00,
+		0x00, 0x03, 0x00, 0x13, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x04, 0x05, 0x06,
+	}
+	segment := new(SCTPSegment)
+	err := segment.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(segment.Chunks) != 2 {
+		t.Fatalf("Unexpected number of chunks: expected %v, got %v", 2, len(segment.Chunks))
+	}
+
+	for i, expected := range [][]byte{{0x01, 0x02, 0x03}, {0x04, 0x05, 0x06}} {
+		chunk, isData := segment.Chunks[i].(*SCTPChunkData)
+		if !isData {
+			t.Fatalf("Unexpected chunk type: expected SCTPChunkData, got %v", reflect.TypeOf(segment.Chunks[i]))
+		}
+		if chunk.TSN != uint32(i+1) {
+			t.Errorf("Unexpected TSN: expected %v, got %v", i+1, chunk.TSN)
+		}
+		if !bytes.Equal(chunk.Data, expected) {
+			t.Errorf("Unexpected data in chunk %v: expected %v, got %v", i, expected, chunk.Data)
+		}
+	}
+}
+
+func TestSCTPChunkECNEAndCWR(t *testing.T) {
+	// An ECNE chunk reporting TSN 0x1234, followed by a CWR chunk for TSN 0x5678.
+	data := []byte{
+		0x0B, 0x59, 0x0B, 0x59, 0x00, 0x00, 0x0E, 0x50, 0x53, 0x54, 0x2E, 0x90,
+		0x0C, 0x00, 0x00, 0x08, 0x00, 0x00, 0x12, 0x34,
+		0x0D, 0x00, 0x00, 0x08, 0x00, 0x00, 0x56, 0x78,
+	}
+	segment := new(SCTPSegment)
+	err := segment.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(segment.Chunks) != 2 {
+		t.Fatalf("Unexpected number of chunks: expected %v, got %v", 2, len(segment.Chunks))
+	}
+
+	ecne, isECNE := segment.Chunks[0].(*SCTPChunkECNE)
+	if !isECNE {
+		t.Fatalf("Unexpected chunk type: expected SCTPChunkECNE, got %v", reflect.TypeOf(segment.Chunks[0]))
+	}
+	if ecne.ChunkType() != SCTP_CHUNK_ECNE || ecne.LowestTSN != uint32(0x1234) {
+		t.Errorf("Unexpected ECNE chunk: %+v", ecne)
+	}
+
+	cwr, isCWR := segment.Chunks[1].(*SCTPChunkCWR)
+	if !isCWR {
+		t.Fatalf("Unexpected chunk type: expected SCTPChunkCWR, got %v", reflect.TypeOf(segment.Chunks[1]))
+	}
+	if cwr.ChunkType() != SCTP_CHUNK_CWR || cwr.LowestTSN != uint32(0x5678) {
+		t.Errorf("Unexpected CWR chunk: %+v", cwr)
+	}
+}
+
+func TestSCTPChunkInitAckParameters(t *testing.T) {
+	// An INIT ACK chunk with an IPv4 address, a five-byte state cookie padded to eight bytes, and a
+	// cookie lifespan increment.
+	data := []byte{
+		0x0B, 0x59, 0x0B, 0x59, 0x00, 0x00, 0x0E, 0x50, 0x53, 0x54, 0x2E, 0x90,
+		0x02, 0x00, 0x00, 0x30, 0x11, 0x22, 0x33, 0x44, 0x00, 0x01, 0x00, 0x00, 0x00, 0x0A, 0x00, 0x0A, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x05, 0x00, 0x08, 0xC0, 0xA8, 0x01, 0x02,
+		0x00, 0x07, 0x00, 0x09, 0xC0, 0x0C, 0x1E, 0xAB, 0xCD, 0x00, 0x00, 0x00,
+		0x00, 0x09, 0x00, 0x08, 0x00, 0x00, 0x03, 0xE8,
+	}
+	segment := new(SCTPSegment)
+	err := segment.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(segment.Chunks) != 1 {
+		t.Fatalf("Unexpected number of chunks: expected %v, got %v", 1, len(segment.Chunks))
+	}
+
+	initAck, isInitAck := segment.Chunks[0].(*SCTPChunkInitAck)
+	if !isInitAck {
+		t.Fatalf("Unexpected chunk type: expected SCTPChunkInitAck, got %v", reflect.TypeOf(segment.Chunks[0]))
+	}
+	if initAck.InitiateTag != uint32(0x11223344) {
+		t.Errorf("Unexpected initiate tag: expected %v, got %v", 0x11223344, initAck.InitiateTag)
+	}
+	if len(initAck.Parameters) != 3 {
+		t.Fatalf("Unexpected number of parameters: expected %v, got %v", 3, len(initAck.Parameters))
+	}
+
+	if sender, ok := initAck.Parameters[0].(*SCTPChunkParameterIPv4Sender); !ok || sender.Address != [4]byte{192, 168, 1, 2} {
+		t.Errorf("Unexpected first parameter: %+v", initAck.Parameters[0])
+	}
+	cookie, ok := initAck.StateCookie()
+	if !ok || !bytes.Equal(cookie, []byte{0xC0, 0x0C, 0x1E, 0xAB, 0xCD}) {
+		t.Errorf("Unexpected state cookie: %v, %v", cookie, ok)
+	}
+	if lifespan, ok := initAck.Parameters[2].(*SCTPChunkParameterCookieLifespanInc); !ok || lifespan.Increment != 1000 {
+		t.Errorf("Unexpected third parameter: %+v", initAck.Parameters[2])
+	}
+}
+
+func TestSCTPClassifyApp(t *testing.T) {
+	// An M3UA ASP Up message on non-standard ports, so only the PPID identifies it.
+	data := []byte{
+		0x1F, 0x40, 0x1F, 0x41, 0x00, 0x00, 0x0E, 0x50, 0x53, 0x54, 0x2E, 0x90, 0x00, 0x03, 0x00, 0x18, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x03, 0x01, 0x00, 0x03, 0x01, 0x00, 0x00, 0x00, 0x08,
+	}
+	segment := new(SCTPSegment)
+	err := segment.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if app := segment.ClassifyApp(); app != "M3UA" {
+		t.Errorf("Unexpected application: expected %v, got %v", "M3UA", app)
+	}
+
+	// Without a PPID, the ports are used instead.
+	tests := []struct {
+		segment  *SCTPSegment
+		expected string
+	}{
+		{&SCTPSegment{SourcePort: 40000, DestinationPort: 3868}, "DIAMETER"},
+		{&SCTPSegment{SourcePort: 2905, DestinationPort: 40000}, "M3UA"},
+		{&SCTPSegment{SourcePort: 40000, DestinationPort: 40001}, ""},
+		{&SCTPSegment{DestinationPort: 36412, Chunks: []SCTPChunk{sctpTestDataChunk(1, 0, 0, "data")}}, "S1AP"},
+	}
+	for _, test := range tests {
+		if app := test.segment.ClassifyApp(); app != test.expected {
+			t.Errorf("Unexpected application for ports %v and %v: expected %q, got %q", test.segment.SourcePort, test.segment.DestinationPort, test.expected, app)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package gopcap
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
 	"io/ioutil"
 )
@@ -17,8 +19,9 @@ type TCPSegment struct {
 	SequenceNumber  uint32
 	AckNumber       uint32
 	HeaderSize      uint8
-	NS              bool // This should be viewed as a temporary solution for flags: it's hugely space-inefficient,
-	CWR             bool // and so I'll probably update the TCPSegment to handle flags differently.
+	Flags           TCPFlags
+	NS              bool // The flags are also available individually, mirroring Flags. Prefer Flags
+	CWR             bool // and its predicates: these fields are kept for compatibility, and will go.
 	ECE             bool
 	URG             bool
 	ACK             bool
@@ -29,43 +32,370 @@ type TCPSegment struct {
 	WindowSize      uint16
 	Checksum        uint16
 	UrgentOffset    uint16
-	OptionData      []byte // This is temporary. We should handle TCP options properly.
+	OptionData      []byte // The raw options. They're also parsed into Options.
+	Options         []TCPOption
 	data            []byte
+	app             ApplicationLayer
 }
 
 func (t *TCPSegment) TransportData() []byte {
 	return t.data
 }
 
+// ApplicationData returns the decoded payload, or nil if no parser is registered for the segment's
+// ports or the payload couldn't be decoded on its own. See RegisterApplicationParser.
+func (t *TCPSegment) ApplicationData() ApplicationLayer {
+	return t.app
+}
+
+// HeaderBytes returns the length of the header, including options, in bytes. HeaderSize is the
+// same length as it appears on the wire, in 32-bit words.
+func (t *TCPSegment) HeaderBytes() int {
+	return int(t.HeaderSize) * 4
+}
+
+// RelativeSequence returns the sequence number relative to the initial sequence number of the
+// direction the segment was sent in, as Wireshark displays it: the SYN is 0, and the first byte of
+// data is 1. Sequence numbers wrap around, and so does the result.
+func (t *TCPSegment) RelativeSequence(isn uint32) uint32 {
+	return t.SequenceNumber - isn
+}
+
+// RelativeAck returns the acknowledgment number relative to the initial sequence number of the
+// other direction, i.e. the sequence number of the SYN being acknowledged, as Wireshark displays it.
+func (t *TCPSegment) RelativeAck(isn uint32) uint32 {
+	return t.AckNumber - isn
+}
+
+// UrgentData returns the portion of the payload covered by the urgent pointer. The urgent pointer
+// is an offset from the start of the payload to the byte following the urgent data. If the URG flag
+// isn't set there is no urgent data, and nil is returned.
+func (t *TCPSegment) UrgentData() []byte {
+	if !t.HasURG() {
+		return nil
+	}
+
+	end := int(t.UrgentOffset)
+	if end > len(t.data) {
+		end = len(t.data)
+	}
+
+	return t.data[:end]
+}
+
+// Validate checks the segment for internal inconsistencies that don't prevent it from being parsed.
+// Currently this checks that the urgent pointer is only set when the URG flag is set, and vice versa.
+func (t *TCPSegment) Validate() error {
+	if t.HasURG() != (t.UrgentOffset != 0) {
+		return InconsistentUrgentPointer
+	}
+
+	return nil
+}
+
+// ValidateChecksum recomputes the checksum over the pseudo-header, the segment's header and its
+// data, and returns InvalidChecksum if it doesn't match. The segment doesn't know the addresses it
+// was sent between, so the pseudo-header must come from the packet carrying it: see
+// IPv4Packet.PseudoHeader and IPv6Packet.PseudoHeader. The length in the pseudo-header is that of
+// the whole segment, header included. Captures taken on the sending host often hold segments
+// whose checksum was left to the network card, and these won't validate.
+func (t *TCPSegment) ValidateChecksum(pseudoHeader []byte) error {
+	// The header is rebuilt from its fields, with the checksum itself counted as zero.
+	header := t.encodeHeader()
+	header[16], header[17] = 0, 0
+
+	sum := onesComplementSum(0, pseudoHeader)
+	sum = onesComplementSum(sum, header)
+	sum = onesComplementSum(sum, t.data)
+
+	if ^uint16(sum) != t.Checksum {
+		return InvalidChecksum
+	}
+	return nil
+}
+
+// Serialize returns the header, including any options, followed by the data. The header is built
+// from Flags rather than the individual flag fields, and the checksum is written as it is, not
+// recomputed.
+func (t *TCPSegment) Serialize() ([]byte, error) {
+	return append(t.encodeHeader(), t.data...), nil
+}
+
+// encodeHeader rebuilds the header, including any options, from its fields.
+func (t *TCPSegment) encodeHeader() []byte {
+	header := make([]byte, tcpHeaderLength, tcpHeaderLength+len(t.OptionData)+len(t.data))
+	networkByteOrder.PutUint16(header[0:2], t.SourcePort)
+	networkByteOrder.PutUint16(header[2:4], t.DestinationPort)
+	networkByteOrder.PutUint32(header[4:8], t.SequenceNumber)
+	networkByteOrder.PutUint32(header[8:12], t.AckNumber)
+	header[12] = t.HeaderSize<<4 | uint8(t.Flags>>8)
+	header[13] = uint8(t.Flags)
+	networkByteOrder.PutUint16(header[14:16], t.WindowSize)
+	networkByteOrder.PutUint16(header[16:18], t.Checksum)
+	networkByteOrder.PutUint16(header[18:20], t.UrgentOffset)
+	return append(header, t.OptionData...)
+}
+
+// tcpFlagLetters are the letters tcpdump uses for each flag, in the order it prints them. ACK is
+// shown as ".".
+var tcpFlagLetters = []struct {
+	flag   TCPFlags
+	letter string
+}{
+	{TCP_FLAG_FIN, "F"},
+	{TCP_FLAG_SYN, "S"},
+	{TCP_FLAG_RST, "R"},
+	{TCP_FLAG_PSH, "P"},
+	{TCP_FLAG_ACK, "."},
+	{TCP_FLAG_URG, "U"},
+	{TCP_FLAG_ECE, "E"},
+	{TCP_FLAG_CWR, "W"},
+	{TCP_FLAG_NS, "N"},
+}
+
+// Has returns whether every one of the given flags is set, so that combinations such as SYN and ACK
+// can be tested at once.
+func (f TCPFlags) Has(flags TCPFlags) bool {
+	return f&flags == flags
+}
+
+// String formats the flags the way tcpdump does, e.g. "[S.]" for SYN and ACK, or "[none]".
+func (f TCPFlags) String() string {
+	letters := ""
+	for _, l := range tcpFlagLetters {
+		if f&l.flag != 0 {
+			letters += l.letter
+		}
+	}
+
+	if letters == "" {
+		letters = "none"
+	}
+	return "[" + letters + "]"
+}
+
+// HasNS returns whether the ECN nonce sum flag is set.
+func (t *TCPSegment) HasNS() bool {
+	return t.Flags.Has(TCP_FLAG_NS)
+}
+
+// HasCWR returns whether the congestion window reduced flag is set.
+func (t *TCPSegment) HasCWR() bool {
+	return t.Flags.Has(TCP_FLAG_CWR)
+}
+
+// HasECE returns whether the ECN echo flag is set.
+func (t *TCPSegment) HasECE() bool {
+	return t.Flags.Has(TCP_FLAG_ECE)
+}
+
+// HasURG returns whether the urgent flag is set.
+func (t *TCPSegment) HasURG() bool {
+	return t.Flags.Has(TCP_FLAG_URG)
+}
+
+// HasACK returns whether the acknowledgment flag is set.
+func (t *TCPSegment) HasACK() bool {
+	return t.Flags.Has(TCP_FLAG_ACK)
+}
+
+// HasPSH returns whether the push flag is set.
+func (t *TCPSegment) HasPSH() bool {
+	return t.Flags.Has(TCP_FLAG_PSH)
+}
+
+// HasRST returns whether the reset flag is set.
+func (t *TCPSegment) HasRST() bool {
+	return t.Flags.Has(TCP_FLAG_RST)
+}
+
+// HasSYN returns whether the synchronize flag is set.
+func (t *TCPSegment) HasSYN() bool {
+	return t.Flags.Has(TCP_FLAG_SYN)
+}
+
+// HasFIN returns whether the finish flag is set.
+func (t *TCPSegment) HasFIN() bool {
+	return t.Flags.Has(TCP_FLAG_FIN)
+}
+
+// TCPOption represents a single TCP option. NOP and EOL options are a single byte, with no length
+// or data.
+type TCPOption struct {
+	Kind TCPOptionKind
+	Data []byte // The option data, following the kind and length bytes.
+}
+
+// TCPSACKBlock represents a single block of data acknowledged by a selective acknowledgment
+// option: the sequence numbers of its first byte and of the byte following it.
+type TCPSACKBlock struct {
+	Left  uint32
+	Right uint32
+}
+
+// parseTCPOptions appends the options in data to options. Parsing stops at an EOL option, which is
+// included, since anything after it is padding. A malformed option also stops parsing, but the
+// options before it are kept, as they're still meaningful.
+func parseTCPOptions(options []TCPOption, data []byte) []TCPOption {
+	for len(data) > 0 {
+		kind := TCPOptionKind(data[0])
+
+		// End of option list and no-operation are the only single-byte options.
+		if kind == TCP_OPTION_EOL {
+			return append(options, TCPOption{Kind: kind})
+		}
+		if kind == TCP_OPTION_NOP {
+			options = append(options, TCPOption{Kind: kind})
+			data = data[1:]
+			continue
+		}
+
+		if len(data) < 2 || data[1] < 2 || len(data) < int(data[1]) {
+			break
+		}
+		options = append(options, TCPOption{Kind: kind, Data: data[2:data[1]]})
+		data = data[data[1]:]
+	}
+
+	return options
+}
+
+// option returns the data of the first option of the given kind, and whether it was present. A
+// segment built by hand may have only OptionData, so that's parsed if there are no Options.
+func (t *TCPSegment) option(kind TCPOptionKind) ([]byte, bool) {
+	options := t.Options
+	if len(options) == 0 {
+		options = parseTCPOptions(nil, t.OptionData)
+	}
+
+	for _, option := range options {
+		if option.Kind == kind {
+			return option.Data, true
+		}
+	}
+	return nil, false
+}
+
+// MSS returns the maximum segment size from the MSS option, and whether the option was present. It
+// is only sent on SYN segments.
+func (t *TCPSegment) MSS() (uint16, bool) {
+	data, ok := t.option(TCP_OPTION_MSS)
+	if !ok || len(data) != 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(data), true
+}
+
+// WindowScale returns the shift count from the window scale option, and whether the option was
+// present. It is only sent on SYN segments, and applies to the window sizes of every later segment
+// sent in the same direction if both ends send it.
+func (t *TCPSegment) WindowScale() (uint8, bool) {
+	data, ok := t.option(TCP_OPTION_WINDOW_SCALE)
+	if !ok || len(data) != 1 {
+		return 0, false
+	}
+	return data[0], true
+}
+
+// SACKPermitted returns whether the segment carries the SACK permitted option.
+func (t *TCPSegment) SACKPermitted() bool {
+	_, ok := t.option(TCP_OPTION_SACK_PERMITTED)
+	return ok
+}
+
+// SACKBlocks returns the blocks from the selective acknowledgment option, or nil if it wasn't
+// present.
+func (t *TCPSegment) SACKBlocks() []TCPSACKBlock {
+	data, ok := t.option(TCP_OPTION_SACK)
+	if !ok {
+		return nil
+	}
+
+	blocks := make([]TCPSACKBlock, len(data)/8)
+	for i := range blocks {
+		blocks[i].Left = binary.BigEndian.Uint32(data[8*i:])
+		blocks[i].Right = binary.BigEndian.Uint32(data[8*i+4:])
+	}
+	return blocks
+}
+
+// Timestamps returns the TSval and TSecr fields of the segment's timestamp option, and whether the
+// option was present. TSecr is only meaningful if the ACK flag is set.
+func (t *TCPSegment) Timestamps() (tsval, tsecr uint32, ok bool) {
+	data, ok := t.option(TCP_OPTION_TIMESTAMPS)
+	if !ok || len(data) != 8 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint32(data[4:8]), true
+}
+
+// tcpHeaderLength is the length of a TCP header without options.
+const tcpHeaderLength = 20
+
 func (t *TCPSegment) ReadFrom(src io.Reader) error {
+	var header [tcpHeaderLength]byte
+	_, err := io.ReadFull(src, header[:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
 
-	var offsetAndFlags [2]byte
+	t.decodeHeader(header[:])
 
-	err := readFields(src, networkByteOrder, []interface{}{
-		&t.SourcePort,
-		&t.DestinationPort,
-		&t.SequenceNumber,
-		&t.AckNumber,
-		&offsetAndFlags,
-		&t.WindowSize,
-		&t.Checksum,
-		&t.UrgentOffset,
-	})
+	// The header size covers at least the fixed header: anything smaller is corrupt, and would
+	// underflow the size of the options.
+	if t.HeaderSize < 5 {
+		return IncorrectPacket
+	}
 
+	// If the header size is larger than 5 (it's measured in 32-bit words for reasons that escape me),
+	// we have some number of extra bytes that form the TCP options.
+	extraBytes := (t.HeaderSize - 5) * 4
+	t.OptionData = make([]byte, extraBytes)
+	_, err = io.ReadFull(src, t.OptionData)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
 	if err != nil {
 		return err
 	}
+	t.Options = parseTCPOptions(t.Options[:0], t.OptionData)
+
+	// All that remains is the contained data.
+	t.data, err = ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	t.app = readApplicationLayer(IPP_TCP, t.SourcePort, t.DestinationPort, t.data)
+	return nil
+}
+
+// decodeHeader decodes the fixed part of the header, which is followed by any options.
+func (t *TCPSegment) decodeHeader(header []byte) {
+	t.SourcePort = networkByteOrder.Uint16(header[0:2])
+	t.DestinationPort = networkByteOrder.Uint16(header[2:4])
+	t.SequenceNumber = networkByteOrder.Uint32(header[4:8])
+	t.AckNumber = networkByteOrder.Uint32(header[8:12])
+	t.WindowSize = networkByteOrder.Uint16(header[14:16])
+	t.Checksum = networkByteOrder.Uint16(header[16:18])
+	t.UrgentOffset = networkByteOrder.Uint16(header[18:20])
 
 	// The header size is the top four bits of the next byte.
-	t.HeaderSize = uint8(offsetAndFlags[0]) >> 4
+	t.HeaderSize = uint8(header[12]) >> 4
+
+	// The NS flag is the low bit of that byte, and the other eight flags make up the next one.
+	t.Flags = TCPFlags(uint16(header[12]&0x01)<<8 | uint16(header[13]))
 
 	// Now we have all the flag fields. First, the NS flag.
-	if (uint8(offsetAndFlags[0]) & 0x01) != 0 {
+	if (uint8(header[12]) & 0x01) != 0 {
 		t.NS = true
 	}
 
 	// The next eight flags are all in the next byte.
-	flags := uint8(offsetAndFlags[1])
+	flags := uint8(header[13])
 	if (flags & 0x80) != 0 {
 		t.CWR = true
 	}
@@ -90,23 +420,24 @@ func (t *TCPSegment) ReadFrom(src io.Reader) error {
 	if (flags & 0x01) != 0 {
 		t.FIN = true
 	}
+}
 
-	// If the header size is larger than 5 (it's measured in 32-bit words for reasons that escape me),
-	// we have some number of extra bytes that form the TCP options.
-	extraBytes := (t.HeaderSize - 5) * 4
-	t.OptionData = make([]byte, extraBytes)
-	readCount, err := src.Read(t.OptionData)
-
-	if readCount < int(extraBytes) {
-		return InsufficientLength
+// decode decodes the segment from data without copying it, so the options and payload refer to
+// data. Segments it can't decode in place are left to ReadFrom. See ParseInto.
+func (t *TCPSegment) decode(data []byte) error {
+	if len(data) < tcpHeaderLength {
+		return t.ReadFrom(bytes.NewReader(data))
 	}
 
-	if err != nil && err != io.EOF {
-		return err
+	t.decodeHeader(data)
+	headerLength := t.HeaderBytes()
+	if headerLength < tcpHeaderLength || headerLength > len(data) {
+		return t.ReadFrom(bytes.NewReader(data))
 	}
 
-	// All that remains is the contained data.
-	t.data, err = ioutil.ReadAll(src)
-
-	return err
+	t.OptionData = data[tcpHeaderLength:headerLength]
+	t.Options = parseTCPOptions(t.Options[:0], t.OptionData)
+	t.data = data[headerLength:]
+	t.app = readApplicationLayer(IPP_TCP, t.SourcePort, t.DestinationPort, t.data)
+	return nil
 }
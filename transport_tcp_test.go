@@ -2,7 +2,9 @@ package gopcap
 
 import (
 	"bytes"
+	"os"
 	"testing"
+	"testing/iotest"
 )
 
 func TestTCPGood(t *testing.T) {
@@ -34,6 +36,9 @@ func TestTCPGood(t *testing.T) {
 	if pkt.HeaderSize != uint8(8) {
 		t.Errorf("Unexpected header size: expected %v, got %v", 8, pkt.HeaderSize)
 	}
+	if pkt.HeaderBytes() != 32 {
+		t.Errorf("Unexpected header bytes: expected %v, got %v", 32, pkt.HeaderBytes())
+	}
 	if pkt.NS {
 		t.Errorf("Expected NS flag not to be set and it was.")
 	}
@@ -77,3 +82,307 @@ func TestTCPGood(t *testing.T) {
 		t.Errorf("Unexpected length of transport data: expected %v, got %v", 30, len(pkt.TransportData()))
 	}
 }
+
+func TestTCPShortReads(t *testing.T) {
+	// A segment with timestamp options and a payload, read a byte at a time.
+	data := []byte{
+		0x0B, 0x20, 0x1A, 0x0B, 0x4D, 0xC8, 0x4E, 0xED, 0x54, 0xF1, 0x10, 0x72, 0x80, 0x18, 0x1F, 0x4B, 0x6D, 0x2E, 0x00, 0x00,
+		0x01, 0x01, 0x08, 0x0A, 0x00, 0xD8, 0xEA, 0x48, 0x82, 0xE4, 0xDA, 0xB0, 0x49, 0x53, 0x4F, 0x4E,
+	}
+	pkt := new(TCPSegment)
+	err := pkt.ReadFrom(iotest.OneByteReader(bytes.NewReader(data)))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(pkt.OptionData, data[20:32]) {
+		t.Errorf("Unexpected options: expected %v, got %v", data[20:32], pkt.OptionData)
+	}
+	if string(pkt.TransportData()) != "ISON" {
+		t.Errorf("Unexpected data: expected %q, got %q", "ISON", pkt.TransportData())
+	}
+
+	// The same segment cut off part way through the header, and part way through the options.
+	for _, length := range []int{10, 26} {
+		pkt = new(TCPSegment)
+		err = pkt.ReadFrom(iotest.OneByteReader(bytes.NewReader(data[:length])))
+		if err != InsufficientLength {
+			t.Errorf("Unexpected error for %v bytes: expected %v, got %v", length, InsufficientLength, err)
+		}
+	}
+}
+
+func TestTCPHeaderSizeTooSmall(t *testing.T) {
+	// A header size of 3 words is smaller than the fixed header, and must not underflow the option
+	// length.
+	data := []byte{
+		0x0B, 0x20, 0x1A, 0x0B, 0x4D, 0xC8, 0x4E, 0xED, 0x54, 0xF1, 0x10, 0x72, 0x30, 0x18, 0x1F, 0x4B,
+		0x6D, 0x2E, 0x00, 0x00, 0x49, 0x53, 0x4F, 0x4E,
+	}
+
+	pkt := new(TCPSegment)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+
+	pkt = new(TCPSegment)
+	err = pkt.decode(data)
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error decoding in place: expected %v, got %v", IncorrectPacket, err)
+	}
+}
+
+func TestTCPUrgent(t *testing.T) {
+	// A segment with the URG flag set and an urgent pointer covering the first three bytes.
+	data := []byte{
+		0x0B, 0x20, 0x1A, 0x0B, 0x4D, 0xC8, 0x4E, 0xED, 0x54, 0xF1, 0x10, 0x72, 0x50, 0x38, 0x1F, 0x4B, 0x00, 0x00, 0x00, 0x03, 0x61, 0x62, 0x63, 0x64,
+		0x65, 0x66,
+	}
+	expectedUrgent := []byte{0x61, 0x62, 0x63}
+	pkt := new(TCPSegment)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !pkt.URG {
+		t.Errorf("Expected URG flag to be set and it wasn't.")
+	}
+	if pkt.UrgentOffset != uint16(3) {
+		t.Errorf("Unexpected urgent offset: expected %v, got %v", 3, pkt.UrgentOffset)
+	}
+	if !bytes.Equal(pkt.UrgentData(), expectedUrgent) {
+		t.Errorf("Unexpected urgent data: expected %v, got %v", expectedUrgent, pkt.UrgentData())
+	}
+	if err := pkt.Validate(); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+
+	// Clearing the flag leaves a dangling urgent pointer.
+	pkt.Flags &^= TCP_FLAG_URG
+	if pkt.UrgentData() != nil {
+		t.Errorf("Expected no urgent data, got %v", pkt.UrgentData())
+	}
+	if err := pkt.Validate(); err != InconsistentUrgentPointer {
+		t.Errorf("Unexpected validation error: expected %v, got %v", InconsistentUrgentPointer, err)
+	}
+
+	// A segment built with only Flags is read through them.
+	built := &TCPSegment{Flags: TCP_FLAG_URG | TCP_FLAG_ACK, UrgentOffset: 3, data: []byte("abcdef")}
+	if !bytes.Equal(built.UrgentData(), expectedUrgent) {
+		t.Errorf("Unexpected urgent data: expected %v, got %v", expectedUrgent, built.UrgentData())
+	}
+	if err := built.Validate(); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+}
+
+func TestTCPOptions(t *testing.T) {
+	data := []byte{
+		// A SYN with eleven words of header.
+		0x9C, 0x40, 0x01, 0xBB, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0xB0, 0x02, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00,
+		// MSS 1460, NOP, window scale 7, SACK permitted, timestamps, then EOL and padding.
+		0x02, 0x04, 0x05, 0xB4, 0x01, 0x03, 0x03, 0x07, 0x04, 0x02,
+		0x08, 0x0A, 0x00, 0x00, 0x00, 0x64, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	pkt := new(TCPSegment)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []TCPOptionKind{TCP_OPTION_MSS, TCP_OPTION_NOP, TCP_OPTION_WINDOW_SCALE, TCP_OPTION_SACK_PERMITTED, TCP_OPTION_TIMESTAMPS, TCP_OPTION_EOL}
+	if len(pkt.Options) != len(expected) {
+		t.Fatalf("Unexpected options: expected kinds %v, got %v", expected, pkt.Options)
+	}
+	for i, option := range pkt.Options {
+		if option.Kind != expected[i] {
+			t.Errorf("Unexpected option %v: expected kind %v, got %v", i, expected[i], option.Kind)
+		}
+	}
+
+	if mss, ok := pkt.MSS(); !ok || mss != uint16(1460) {
+		t.Errorf("Unexpected MSS: expected %v, got %v", 1460, mss)
+	}
+	if scale, ok := pkt.WindowScale(); !ok || scale != uint8(7) {
+		t.Errorf("Unexpected window scale: expected %v, got %v", 7, scale)
+	}
+	if !pkt.SACKPermitted() {
+		t.Errorf("SACK permitted option not found.")
+	}
+	if tsval, tsecr, ok := pkt.Timestamps(); !ok || tsval != uint32(100) || tsecr != 0 {
+		t.Errorf("Unexpected timestamps: %v %v %v", tsval, tsecr, ok)
+	}
+	if pkt.SACKBlocks() != nil {
+		t.Errorf("Unexpected SACK blocks: %v", pkt.SACKBlocks())
+	}
+}
+
+func TestTCPOptionsReuse(t *testing.T) {
+	data := []byte{
+		// A SYN with seven words of header.
+		0x9C, 0x40, 0x01, 0xBB, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x70, 0x02, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00,
+		// MSS 1460, SACK permitted and two NOPs.
+		0x02, 0x04, 0x05, 0xB4, 0x04, 0x02, 0x01, 0x01,
+	}
+
+	// Reading a segment again replaces its options rather than adding to them.
+	pkt := new(TCPSegment)
+	for i := 0; i < 2; i++ {
+		if err := pkt.ReadFrom(bytes.NewReader(data)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(pkt.Options) != 4 {
+			t.Errorf("Unexpected options after ReadFrom %v: expected %v, got %v", i+1, 4, len(pkt.Options))
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := pkt.decode(data); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(pkt.Options) != 4 {
+			t.Errorf("Unexpected options after decode %v: expected %v, got %v", i+1, 4, len(pkt.Options))
+		}
+	}
+}
+
+func TestTCPSACKBlocks(t *testing.T) {
+	pkt := &TCPSegment{OptionData: []byte{
+		0x01, 0x01, 0x05, 0x12,
+		0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x20, 0x00,
+		0x00, 0x00, 0x30, 0x00, 0x00, 0x00, 0x40, 0x00,
+		// A truncated option, which stops parsing.
+		0x02, 0x04, 0x05,
+	}}
+	pkt.Options = parseTCPOptions(nil, pkt.OptionData)
+
+	if len(pkt.Options) != 3 {
+		t.Errorf("Unexpected number of options: expected %v, got %v", 3, len(pkt.Options))
+	}
+	if _, ok := pkt.MSS(); ok {
+		t.Errorf("Unexpected MSS from a truncated option.")
+	}
+
+	expected := []TCPSACKBlock{{0x1000, 0x2000}, {0x3000, 0x4000}}
+	blocks := pkt.SACKBlocks()
+	if len(blocks) != len(expected) {
+		t.Fatalf("Unexpected SACK blocks: expected %v, got %v", expected, blocks)
+	}
+	for i, block := range blocks {
+		if block != expected[i] {
+			t.Errorf("Unexpected SACK block %v: expected %v, got %v", i, expected[i], block)
+		}
+	}
+}
+
+func TestTCPFlags(t *testing.T) {
+	// The flags byte of TestTCPGood's segment, with the NS bit also set.
+	data := []byte{
+		0x0B, 0x20, 0x1A, 0x0B, 0x4D, 0xC8, 0x4E, 0xED, 0x54, 0xF1, 0x10, 0x72, 0x51, 0x18, 0x1F, 0x4B, 0x6D, 0x2E, 0x00, 0x00,
+	}
+	pkt := new(TCPSegment)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if pkt.Flags != TCP_FLAG_NS|TCP_FLAG_PSH|TCP_FLAG_ACK {
+		t.Errorf("Unexpected flags: expected %#x, got %#x", uint16(TCP_FLAG_NS|TCP_FLAG_PSH|TCP_FLAG_ACK), uint16(pkt.Flags))
+	}
+	if !pkt.HasNS() || !pkt.HasPSH() || !pkt.HasACK() || pkt.HasSYN() || pkt.HasFIN() {
+		t.Errorf("Unexpected flag predicates for %v", pkt.Flags)
+	}
+	if !pkt.NS || !pkt.PSH || !pkt.ACK || pkt.SYN || pkt.FIN {
+		t.Errorf("Flag fields don't match %v", pkt.Flags)
+	}
+	if pkt.Flags.Has(TCP_FLAG_SYN | TCP_FLAG_ACK) {
+		t.Errorf("Unexpected SYN and ACK in %v", pkt.Flags)
+	}
+	if !pkt.Flags.Has(TCP_FLAG_PSH | TCP_FLAG_ACK) {
+		t.Errorf("Expected PSH and ACK in %v", pkt.Flags)
+	}
+
+	strings := map[TCPFlags]string{
+		TCP_FLAG_SYN:                "[S]",
+		TCP_FLAG_SYN | TCP_FLAG_ACK: "[S.]",
+		TCP_FLAG_FIN | TCP_FLAG_ACK: "[F.]",
+		pkt.Flags:                   "[P.N]",
+		0:                           "[none]",
+	}
+	for flags, expected := range strings {
+		if flags.String() != expected {
+			t.Errorf("Unexpected string for %#x: expected %v, got %v", uint16(flags), expected, flags.String())
+		}
+	}
+}
+
+func TestTCPValidateChecksum(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	// The capture was taken on 192.168.1.2, which left its checksums to the network card, so only
+	// the segments it received can be checked.
+	checked, odd := 0, 0
+	for _, pkt := range parsed.Packets {
+		if pkt.Data == nil {
+			continue
+		}
+		ip, ok := pkt.Data.LinkData().(*IPv4Packet)
+		if !ok || ip.SourceAddress == [4]byte{192, 168, 1, 2} {
+			continue
+		}
+		segment, ok := ip.InternetData().(*TCPSegment)
+		if !ok {
+			continue
+		}
+
+		length := segment.HeaderBytes() + len(segment.TransportData())
+		pseudoHeader := ip.PseudoHeader(IPP_TCP, uint16(length))
+		if err := segment.ValidateChecksum(pseudoHeader); err != nil {
+			t.Errorf("Unexpected error for segment from %v: %v", segment.SourcePort, err)
+		}
+		checked++
+		if len(segment.TransportData())%2 == 1 {
+			odd++
+		}
+
+		segment.Checksum++
+		if err := segment.ValidateChecksum(pseudoHeader); err != InvalidChecksum {
+			t.Errorf("Unexpected error for corrupted checksum: expected %v, got %v", InvalidChecksum, err)
+		}
+		segment.Checksum--
+	}
+
+	if checked == 0 || odd == 0 {
+		t.Errorf("Unexpected number of segments checked: %v, of which %v had odd lengths", checked, odd)
+	}
+}
+
+func TestTCPRelativeSequence(t *testing.T) {
+	// The client's initial sequence number is near the top of the sequence space, so its data wraps
+	// around to the bottom.
+	syn := &TCPSegment{SequenceNumber: 0xFFFFFFF0}
+	data := &TCPSegment{SequenceNumber: 0x00000010, AckNumber: 5001}
+
+	if seq := syn.RelativeSequence(0xFFFFFFF0); seq != 0 {
+		t.Errorf("Unexpected relative sequence for SYN: expected %v, got %v", 0, seq)
+	}
+	if seq := data.RelativeSequence(0xFFFFFFF0); seq != 32 {
+		t.Errorf("Unexpected relative sequence: expected %v, got %v", 32, seq)
+	}
+	if ack := data.RelativeAck(5000); ack != 1 {
+		t.Errorf("Unexpected relative ack: expected %v, got %v", 1, ack)
+	}
+}
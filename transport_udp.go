@@ -1,7 +1,9 @@
 package gopcap
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
 )
 
 //-----------------------------------------------------------------------------
@@ -16,27 +18,191 @@ type UDPDatagram struct {
 	Length          uint16
 	Checksum        uint16
 	data            []byte
+	app             ApplicationLayer
 }
 
 func (u *UDPDatagram) TransportData() []byte {
 	return u.data
 }
 
+// ApplicationData returns the decoded payload, or nil if no parser is registered for the datagram's
+// ports or the payload couldn't be decoded. See RegisterApplicationParser.
+func (u *UDPDatagram) ApplicationData() ApplicationLayer {
+	return u.app
+}
+
+// ValidateChecksum recomputes the checksum over the pseudo-header, the datagram's header and its
+// data, and returns InvalidChecksum if it doesn't match. The datagram doesn't know the addresses it
+// was sent between, so the pseudo-header must come from the packet carrying it: see
+// IPv4Packet.PseudoHeader and IPv6Packet.PseudoHeader. A zero checksum means the sender didn't
+// compute one, which is only allowed over IPv4: over IPv6, recognised by the length of its
+// pseudo-header, it's invalid.
+func (u *UDPDatagram) ValidateChecksum(pseudoHeader []byte) error {
+	if u.Checksum == 0 {
+		if len(pseudoHeader) == ipv6PseudoHeaderLength {
+			return InvalidChecksum
+		}
+		return nil
+	}
+
+	// The header is rebuilt from its fields, with the checksum itself counted as zero.
+	header := u.encodeHeader()
+	header[6], header[7] = 0, 0
+
+	sum := onesComplementSum(0, pseudoHeader)
+	sum = onesComplementSum(sum, header)
+	sum = onesComplementSum(sum, u.data)
+
+	// A computed checksum of zero is sent as all ones, since zero means there isn't one.
+	checksum := ^uint16(sum)
+	if checksum == 0 {
+		checksum = 0xFFFF
+	}
+
+	if checksum != u.Checksum {
+		return InvalidChecksum
+	}
+	return nil
+}
+
+// udpHeaderLength is the length of a UDP header.
+const udpHeaderLength = 8
+
 func (u *UDPDatagram) ReadFrom(src io.Reader) error {
+	var header [udpHeaderLength]byte
+	_, err := io.ReadFull(src, header[:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+	u.decodeHeader(header[:])
+
+	// The length covers the header, so anything shorter is corrupt, and would underflow the length
+	// of the data.
+	if u.Length < udpHeaderLength {
+		return IncorrectPacket
+	}
+
+	// All that remains is data.
+	length := u.Length - udpHeaderLength
+	u.data = make([]byte, length)
+	n, err := io.ReadFull(src, u.data)
+
+	// A datagram cut short keeps only the data that was actually there.
+	u.data = u.data[:n]
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	if err != nil {
+		return err
+	}
+
+	u.app = readApplicationLayer(IPP_UDP, u.SourcePort, u.DestinationPort, u.data)
+	return nil
+}
+
+// Serialize returns the header followed by the data. The length and checksum are written as they
+// are, not recomputed.
+func (u *UDPDatagram) Serialize() ([]byte, error) {
+	return append(u.encodeHeader(), u.data...), nil
+}
+
+// encodeHeader rebuilds the header from its fields.
+func (u *UDPDatagram) encodeHeader() []byte {
+	header := make([]byte, udpHeaderLength, udpHeaderLength+len(u.data))
+	networkByteOrder.PutUint16(header[0:2], u.SourcePort)
+	networkByteOrder.PutUint16(header[2:4], u.DestinationPort)
+	networkByteOrder.PutUint16(header[4:6], u.Length)
+	networkByteOrder.PutUint16(header[6:8], u.Checksum)
+	return header
+}
+
+// decodeHeader decodes the header, which is followed by the data.
+func (u *UDPDatagram) decodeHeader(header []byte) {
+	u.SourcePort = networkByteOrder.Uint16(header[0:2])
+	u.DestinationPort = networkByteOrder.Uint16(header[2:4])
+	u.Length = networkByteOrder.Uint16(header[4:6])
+	u.Checksum = networkByteOrder.Uint16(header[6:8])
+}
+
+// decode decodes the datagram from data without copying it, so the payload refers to data.
+// Datagrams it can't decode in place are left to ReadFrom. See ParseInto.
+func (u *UDPDatagram) decode(data []byte) error {
+	if len(data) < udpHeaderLength {
+		return u.ReadFrom(bytes.NewReader(data))
+	}
+
+	u.decodeHeader(data)
+	if int(u.Length) < udpHeaderLength || int(u.Length) > len(data) {
+		return u.ReadFrom(bytes.NewReader(data))
+	}
+
+	u.data = data[udpHeaderLength:u.Length]
+	u.app = readApplicationLayer(IPP_UDP, u.SourcePort, u.DestinationPort, u.data)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// UDPLiteDatagram
+//-----------------------------------------------------------------------------
+
+// UDPLiteDatagram represents a single UDP-Lite datagram. The header is laid out like UDP's, but
+// where UDP has the length of the datagram UDP-Lite has the number of bytes covered by the
+// checksum, so that damage to the rest of the payload can be tolerated. The length of the datagram
+// is instead whatever remains of the IP packet.
+type UDPLiteDatagram struct {
+	SourcePort       uint16
+	DestinationPort  uint16
+	ChecksumCoverage uint16 // The number of bytes covered, including the header. Zero covers them all.
+	Checksum         uint16
+	data             []byte
+	app              ApplicationLayer
+}
+
+func (u *UDPLiteDatagram) TransportData() []byte {
+	return u.data
+}
+
+// ApplicationData returns the decoded payload, or nil if no parser is registered for the datagram's
+// ports or the payload couldn't be decoded. Parsers registered for UDP aren't used for UDP-Lite.
+// See RegisterApplicationParser.
+func (u *UDPLiteDatagram) ApplicationData() ApplicationLayer {
+	return u.app
+}
+
+func (u *UDPLiteDatagram) ReadFrom(src io.Reader) error {
 	err := readFields(src, networkByteOrder, []interface{}{
 		&u.SourcePort,
 		&u.DestinationPort,
-		&u.Length,
+		&u.ChecksumCoverage,
 		&u.Checksum,
 	})
-
-	// All that remains is data.
-	length := u.Length - 8
-	u.data = make([]byte, length)
-	readCount, err := src.Read(u.data)
-	if uint16(readCount) < length {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
 		return InsufficientLength
 	}
+	if err != nil {
+		return err
+	}
+
+	// The source is limited to the IP payload, so all that remains is data.
+	u.data, err = ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	u.app = readApplicationLayer(IPP_UDPLITE, u.SourcePort, u.DestinationPort, u.data)
+	return nil
+}
 
-	return err
+// Serialize returns the header followed by the data. The checksum is written as it is, not
+// recomputed.
+func (u *UDPLiteDatagram) Serialize() ([]byte, error) {
+	datagram := make([]byte, udpHeaderLength, udpHeaderLength+len(u.data))
+	networkByteOrder.PutUint16(datagram[0:2], u.SourcePort)
+	networkByteOrder.PutUint16(datagram[2:4], u.DestinationPort)
+	networkByteOrder.PutUint16(datagram[4:6], u.ChecksumCoverage)
+	networkByteOrder.PutUint16(datagram[6:8], u.Checksum)
+	return append(datagram, u.data...), nil
 }
@@ -2,7 +2,9 @@ package gopcap
 
 import (
 	"bytes"
+	"os"
 	"testing"
+	"testing/iotest"
 )
 
 func TestUDPGood(t *testing.T) {
@@ -35,3 +37,167 @@ func TestUDPGood(t *testing.T) {
 		t.Errorf("Unexpected length of contained data: expected %v, got %v", 42, len(dgram.TransportData()))
 	}
 }
+
+func TestUDPShortReads(t *testing.T) {
+	// A datagram with four bytes of data, read a byte at a time, and then cut short.
+	data := []byte{0x0F, 0xA0, 0x13, 0x88, 0x00, 0x0C, 0x00, 0x00, 'a', 'b', 'c', 'd'}
+
+	pkt := new(UDPDatagram)
+	err := pkt.ReadFrom(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if string(pkt.TransportData()) != "abcd" {
+		t.Errorf("Unexpected data: expected %q, got %q", "abcd", pkt.TransportData())
+	}
+
+	pkt = new(UDPDatagram)
+	err = pkt.ReadFrom(iotest.OneByteReader(bytes.NewReader(data[:10])))
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+	if string(pkt.TransportData()) != "ab" {
+		t.Errorf("Unexpected data: expected %q, got %q", "ab", pkt.TransportData())
+	}
+}
+
+func TestUDPTruncatedHeader(t *testing.T) {
+	// Only the ports survive.
+	pkt := new(UDPDatagram)
+	err := pkt.ReadFrom(bytes.NewReader([]byte{0x08, 0x50, 0x00, 0x35}))
+	if err != InsufficientLength {
+		t.Errorf("Unexpected error: expected %v, got %v", InsufficientLength, err)
+	}
+
+	// The length is smaller than the header.
+	pkt = new(UDPDatagram)
+	err = pkt.ReadFrom(bytes.NewReader([]byte{0x08, 0x50, 0x00, 0x35, 0x00, 0x04, 0x00, 0x00, 0x01, 0x02}))
+	if err != IncorrectPacket {
+		t.Errorf("Unexpected error: expected %v, got %v", IncorrectPacket, err)
+	}
+}
+
+func TestUDPValidateChecksum(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	parsed, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	// The capture was taken on 192.168.1.2, which left its checksums to the network card, so only
+	// the datagrams it received can be checked.
+	checked := 0
+	for _, pkt := range parsed.Packets {
+		if pkt.Data == nil {
+			continue
+		}
+		ip, ok := pkt.Data.LinkData().(*IPv4Packet)
+		if !ok || ip.SourceAddress == [4]byte{192, 168, 1, 2} {
+			continue
+		}
+		datagram, ok := ip.InternetData().(*UDPDatagram)
+		if !ok {
+			continue
+		}
+
+		pseudoHeader := ip.PseudoHeader(IPP_UDP, datagram.Length)
+		if err := datagram.ValidateChecksum(pseudoHeader); err != nil {
+			t.Errorf("Unexpected error for datagram from %v: %v", datagram.SourcePort, err)
+		}
+		checked++
+
+		datagram.Checksum++
+		if err := datagram.ValidateChecksum(pseudoHeader); err != InvalidChecksum {
+			t.Errorf("Unexpected error for corrupted checksum: expected %v, got %v", InvalidChecksum, err)
+		}
+		datagram.Checksum--
+	}
+	if checked == 0 {
+		t.Errorf("No datagrams checked.")
+	}
+}
+
+func TestUDPZeroChecksum(t *testing.T) {
+	datagram := &UDPDatagram{SourcePort: 4000, DestinationPort: 5000, Length: 12, data: []byte("abcd")}
+
+	// A zero checksum wasn't computed, which is fine over IPv4 but not over IPv6.
+	ipv4 := &IPv4Packet{SourceAddress: [4]byte{192, 168, 1, 2}, DestAddress: [4]byte{192, 168, 1, 1}}
+	if err := datagram.ValidateChecksum(ipv4.PseudoHeader(IPP_UDP, datagram.Length)); err != nil {
+		t.Errorf("Unexpected error over IPv4: %v", err)
+	}
+
+	ipv6 := &IPv6Packet{}
+	if err := datagram.ValidateChecksum(ipv6.PseudoHeader(IPP_UDP, uint32(datagram.Length))); err != InvalidChecksum {
+		t.Errorf("Unexpected error over IPv6: expected %v, got %v", InvalidChecksum, err)
+	}
+}
+
+func TestUDPLite(t *testing.T) {
+	// An IPv4 packet carrying a UDP-Lite datagram whose checksum only covers its header, followed by
+	// six bytes of data and then two bytes of Ethernet padding beyond the IP total length.
+	data := []byte{
+		0x45, 0x00, 0x00, 0x22, 0x00, 0x01, 0x00, 0x00, 0x40, 0x88, 0x00, 0x00, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01,
+		0x0F, 0xA0, 0x13, 0x88, 0x00, 0x08, 0x12, 0x34, 'a', 'b', 'c', 'd', 'e', 'f',
+		0x00, 0x00,
+	}
+	pkt := new(IPv4Packet)
+	err := pkt.ReadFrom(bytes.NewReader(data))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	datagram, isUDPLite := pkt.InternetData().(*UDPLiteDatagram)
+	if !isUDPLite {
+		t.Fatalf("Unexpected transport layer: expected UDPLiteDatagram, got %v", pkt.InternetData())
+	}
+	if datagram.SourcePort != 4000 || datagram.DestinationPort != 5000 {
+		t.Errorf("Unexpected ports: got %v, %v", datagram.SourcePort, datagram.DestinationPort)
+	}
+	if datagram.ChecksumCoverage != 8 {
+		t.Errorf("Unexpected checksum coverage: expected %v, got %v", 8, datagram.ChecksumCoverage)
+	}
+	if string(datagram.TransportData()) != "abcdef" {
+		t.Errorf("Unexpected data: expected %q, got %q", "abcdef", datagram.TransportData())
+	}
+
+	tuple, ok := (&Packet{Data: &RawLink{data: pkt}}).FiveTuple()
+	if !ok || tuple.Protocol != IPP_UDPLITE || tuple.SourcePort != 4000 {
+		t.Errorf("Unexpected tuple: %v", tuple)
+	}
+}
+
+func TestUDPLiteIPv6(t *testing.T) {
+	// An IPv6 packet carrying a UDP-Lite datagram with six bytes of data, followed by a four-byte
+	// trailer beyond the payload length, such as an Ethernet FCS.
+	data := []byte{
+		0x60, 0x00, 0x00, 0x00, 0x00, 0x0E, 0x88, 0x40,
+		0x20, 0x01, 0x0D, 0xB8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x20, 0x01, 0x0D, 0xB8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x0F, 0xA0, 0x13, 0x88, 0x00, 0x08, 0x12, 0x34, 'a', 'b', 'c', 'd', 'e', 'f',
+		0xDE, 0xAD, 0xBE, 0xEF,
+	}
+
+	read := new(IPv6Packet)
+	if err := read.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	decoded := new(IPv6Packet)
+	if err := decoded.decode(data, new(packetLayers)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	for _, pkt := range []*IPv6Packet{read, decoded} {
+		datagram, isUDPLite := pkt.InternetData().(*UDPLiteDatagram)
+		if !isUDPLite {
+			t.Fatalf("Unexpected transport layer: expected UDPLiteDatagram, got %v", pkt.InternetData())
+		}
+		if string(datagram.TransportData()) != "abcdef" {
+			t.Errorf("Unexpected data: expected %q, got %q", "abcdef", datagram.TransportData())
+		}
+	}
+}
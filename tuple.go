@@ -0,0 +1,95 @@
+package gopcap
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+)
+
+// Tuple identifies the flow a packet belongs to: the source and destination addresses and ports,
+// and the transport protocol. IPv4 addresses are stored in their IPv4-mapped IPv6 form, so that
+// tuples from both IP versions can be used as keys in the same map.
+type Tuple struct {
+	SourceAddress      [16]byte
+	DestinationAddress [16]byte
+	SourcePort         uint16
+	DestinationPort    uint16
+	Protocol           IPProtocol
+}
+
+// Reverse returns the tuple for traffic flowing in the opposite direction.
+func (t Tuple) Reverse() Tuple {
+	return Tuple{
+		SourceAddress:      t.DestinationAddress,
+		DestinationAddress: t.SourceAddress,
+		SourcePort:         t.DestinationPort,
+		DestinationPort:    t.SourcePort,
+		Protocol:           t.Protocol,
+	}
+}
+
+func (t Tuple) String() string {
+	return fmt.Sprintf("%v %v > %v", t.Protocol, net.JoinHostPort(net.IP(t.SourceAddress[:]).String(), fmt.Sprint(t.SourcePort)),
+		net.JoinHostPort(net.IP(t.DestinationAddress[:]).String(), fmt.Sprint(t.DestinationPort)))
+}
+
+// Canonical returns the same tuple for both directions of a flow, by ordering the endpoints so
+// that the lower address (and then port) is the source. Use it to key flows in either direction.
+func (t Tuple) Canonical() Tuple {
+	order := bytes.Compare(t.SourceAddress[:], t.DestinationAddress[:])
+	if order > 0 || (order == 0 && t.SourcePort > t.DestinationPort) {
+		return t.Reverse()
+	}
+	return t
+}
+
+// mappedIPv4 returns the IPv4-mapped IPv6 form of an IPv4 address.
+func mappedIPv4(addr [4]byte) [16]byte {
+	var mapped [16]byte
+	mapped[10] = 0xFF
+	mapped[11] = 0xFF
+	copy(mapped[12:], addr[:])
+	return mapped
+}
+
+// FiveTuple extracts the tuple from a packet, returning false if the packet isn't an IP packet
+// carrying a transport protocol with ports: TCP, UDP, UDP-Lite or SCTP.
+func (pkt *Packet) FiveTuple() (Tuple, bool) {
+	var tuple Tuple
+
+	if pkt.Data == nil {
+		return tuple, false
+	}
+
+	switch ip := pkt.Data.LinkData().(type) {
+	case *IPv4Packet:
+		tuple.SourceAddress = mappedIPv4(ip.SourceAddress)
+		tuple.DestinationAddress = mappedIPv4(ip.DestAddress)
+		tuple.Protocol = ip.Protocol
+	case *IPv6Packet:
+		tuple.SourceAddress = ip.SourceAddress
+		tuple.DestinationAddress = ip.DestinationAddress
+		tuple.Protocol = ip.NextHeader
+	default:
+		return tuple, false
+	}
+
+	switch transport := pkt.Data.LinkData().InternetData().(type) {
+	case *TCPSegment:
+		tuple.SourcePort = transport.SourcePort
+		tuple.DestinationPort = transport.DestinationPort
+	case *UDPDatagram:
+		tuple.SourcePort = transport.SourcePort
+		tuple.DestinationPort = transport.DestinationPort
+	case *UDPLiteDatagram:
+		tuple.SourcePort = transport.SourcePort
+		tuple.DestinationPort = transport.DestinationPort
+	case *SCTPSegment:
+		tuple.SourcePort = transport.SourcePort
+		tuple.DestinationPort = transport.DestinationPort
+	default:
+		return tuple, false
+	}
+
+	return tuple, true
+}
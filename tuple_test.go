@@ -0,0 +1,50 @@
+package gopcap
+
+import (
+	"testing"
+)
+
+func TestFiveTuple(t *testing.T) {
+	client := [4]byte{10, 0, 0, 1}
+	server := [4]byte{10, 0, 0, 2}
+	request := tcpTestPacket(0, client, server, 40000, 80, 1, 0, "S", nil)
+	response := tcpTestPacket(1, server, client, 80, 40000, 100, 2, "SA", nil)
+
+	tuple, ok := request.FiveTuple()
+	if !ok {
+		t.Fatalf("No tuple found for a TCP packet.")
+	}
+	expected := Tuple{
+		SourceAddress:      mappedIPv4(client),
+		DestinationAddress: mappedIPv4(server),
+		SourcePort:         40000,
+		DestinationPort:    80,
+		Protocol:           IPP_TCP,
+	}
+	if tuple != expected {
+		t.Errorf("Unexpected tuple: expected %v, got %v", expected, tuple)
+	}
+	if tuple.String() != "6 10.0.0.1:40000 > 10.0.0.2:80" {
+		t.Errorf("Unexpected string: %v", tuple)
+	}
+
+	// Both directions share a canonical tuple, with the lower address as the source.
+	reverse, _ := response.FiveTuple()
+	if reverse != tuple.Reverse() {
+		t.Errorf("Unexpected reverse tuple: expected %v, got %v", tuple.Reverse(), reverse)
+	}
+	if tuple.Canonical() != expected || reverse.Canonical() != expected {
+		t.Errorf("Unexpected canonical tuples: %v and %v", tuple.Canonical(), reverse.Canonical())
+	}
+
+	// Packets without ports have no tuple.
+	for name, pkt := range map[string]*Packet{
+		"empty": {},
+		"ICMP":  {Data: &RawLink{data: &IPv4Packet{Protocol: IPP_ICMP, data: new(ICMPSegment)}}},
+		"ARP":   {Data: &EthernetFrame{EtherType: ARP, data: new(ARPPacket)}},
+	} {
+		if _, ok := pkt.FiveTuple(); ok {
+			t.Errorf("Unexpected tuple for %v packet", name)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package gopcap
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"io"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // getUint16 takes a two-element byte slice and returns the uint16 contained within it. If flipped
@@ -50,7 +55,48 @@ func getInt32(buf []byte, flipped bool) int32 {
 	return num
 }
 
+// readFields reads each field in turn, as binary.Read would. Fields of the fixed-size types that
+// headers are made of are read together into a single buffer and decoded directly, avoiding the
+// reflection and allocation of binary.Read; if there are any other fields, binary.Read is used for
+// all of them.
 func readFields(src io.Reader, order binary.ByteOrder, fields []interface{}) error {
+	size := 0
+	for _, field := range fields {
+		fieldSize := fixedFieldSize(field)
+		if fieldSize < 0 || size+fieldSize > fieldBufferLength {
+			return readFieldsSlowly(src, order, fields)
+		}
+		size += fieldSize
+	}
+
+	buf := fieldBuffers.Get().(*[fieldBufferLength]byte)
+	defer fieldBuffers.Put(buf)
+
+	n, err := io.ReadFull(src, buf[:size])
+	data := buf[:n]
+
+	// Decode every field that was read in full. Like binary.Read, a field that couldn't be read at
+	// all gives io.EOF, and one that was only partly read gives io.ErrUnexpectedEOF.
+	for _, field := range fields {
+		fieldSize := fixedFieldSize(field)
+		if len(data) < fieldSize {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			if len(data) == 0 {
+				return io.EOF
+			}
+			return io.ErrUnexpectedEOF
+		}
+		decodeField(field, data[:fieldSize], order)
+		data = data[fieldSize:]
+	}
+
+	return nil
+}
+
+// readFieldsSlowly reads each field in turn using binary.Read.
+func readFieldsSlowly(src io.Reader, order binary.ByteOrder, fields []interface{}) error {
 	for _, field := range fields {
 		err := binary.Read(src, order, field)
 		if err != nil {
@@ -61,4 +107,271 @@ func readFields(src io.Reader, order binary.ByteOrder, fields []interface{}) err
 	return nil
 }
 
+// fieldBufferLength is the most readFields will read into a single buffer.
+const fieldBufferLength = 256
+
+// fieldBuffers holds the buffers readFields reads into, so that they don't have to be allocated
+// for every header.
+var fieldBuffers = sync.Pool{
+	New: func() interface{} {
+		return new([fieldBufferLength]byte)
+	},
+}
+
+// fixedFieldSize returns the encoded size of a field that readFields can decode directly, or -1 if
+// binary.Read is needed.
+func fixedFieldSize(field interface{}) int {
+	switch f := field.(type) {
+	case *uint8, *int8, *bool, *IPProtocol, *ICMPType, *TCPOptionKind:
+		return 1
+	case *uint16, *int16, *EtherType, *ARPOperation, *SLLPacketType, *PPPProtocol:
+		return 2
+	case *uint32, *int32, *Link:
+		return 4
+	case *uint64, *int64:
+		return 8
+	case *[4]byte:
+		return 4
+	case *[6]byte:
+		return 6
+	case *[8]byte:
+		return 8
+	case *[16]byte:
+		return 16
+	case []byte:
+		return len(f)
+	}
+	return -1
+}
+
+// decodeField decodes a field of one of the types fixedFieldSize accepts from its encoded bytes.
+func decodeField(field interface{}, data []byte, order binary.ByteOrder) {
+	switch f := field.(type) {
+	case *uint8:
+		*f = data[0]
+	case *int8:
+		*f = int8(data[0])
+	case *bool:
+		*f = data[0] != 0
+	case *IPProtocol:
+		*f = IPProtocol(data[0])
+	case *ICMPType:
+		*f = ICMPType(data[0])
+	case *TCPOptionKind:
+		*f = TCPOptionKind(data[0])
+	case *uint16:
+		*f = order.Uint16(data)
+	case *int16:
+		*f = int16(order.Uint16(data))
+	case *EtherType:
+		*f = EtherType(order.Uint16(data))
+	case *ARPOperation:
+		*f = ARPOperation(order.Uint16(data))
+	case *SLLPacketType:
+		*f = SLLPacketType(order.Uint16(data))
+	case *PPPProtocol:
+		*f = PPPProtocol(order.Uint16(data))
+	case *uint32:
+		*f = order.Uint32(data)
+	case *int32:
+		*f = int32(order.Uint32(data))
+	case *Link:
+		*f = Link(order.Uint32(data))
+	case *uint64:
+		*f = order.Uint64(data)
+	case *int64:
+		*f = int64(order.Uint64(data))
+	case *[4]byte:
+		copy(f[:], data)
+	case *[6]byte:
+		copy(f[:], data)
+	case *[8]byte:
+		copy(f[:], data)
+	case *[16]byte:
+		copy(f[:], data)
+	case []byte:
+		copy(f, data)
+	}
+}
+
+// writeFields is the inverse of readFields, writing each field in turn.
+func writeFields(dst io.Writer, order binary.ByteOrder, fields []interface{}) error {
+	for _, field := range fields {
+		err := binary.Write(dst, order, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// maxPreallocation bounds how much is allocated for data before it's been read, so that a length
+// taken from a corrupt file costs no more memory than the data that actually follows it.
+const maxPreallocation = 256 * 1024
+
+// readFull reads length bytes, as io.ReadFull does, into buf if it's big enough or else into a new
+// buffer. Up to maxPreallocation bytes are allocated up front, and beyond that the buffer grows as
+// the data arrives. It returns the data that was read, which is short if the source ended early.
+func readFull(src io.Reader, buf []byte, length int) ([]byte, error) {
+	if length <= cap(buf) || length <= maxPreallocation {
+		if length > cap(buf) {
+			buf = make([]byte, length)
+		}
+		n, err := io.ReadFull(src, buf[:length])
+		return buf[:n], err
+	}
+
+	buffer := bytes.NewBuffer(buf[:0])
+	buffer.Grow(maxPreallocation)
+	n, err := buffer.ReadFrom(io.LimitReader(src, int64(length)))
+	if err == nil && n < int64(length) {
+		err = io.ErrUnexpectedEOF
+		if n == 0 {
+			err = io.EOF
+		}
+	}
+	return buffer.Bytes(), err
+}
+
 var networkByteOrder binary.ByteOrder = binary.BigEndian
+
+// onesComplementSum adds up data as a sequence of big-endian 16-bit words using ones' complement
+// arithmetic, continuing from sum. Data of odd length is padded with a zero byte, so only the last
+// slice summed may have an odd length.
+func onesComplementSum(sum uint32, data []byte) uint32 {
+	for len(data) > 1 {
+		sum += uint32(data[0])<<8 | uint32(data[1])
+		data = data[2:]
+	}
+	if len(data) == 1 {
+		sum += uint32(data[0]) << 8
+	}
+
+	for sum > 0xFFFF {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return sum
+}
+
+// adjustChecksum updates a checksum for part of the data it covers having changed from old to
+// new, without summing the rest of the data again, as RFC 1624 describes. Both must be the same,
+// even, length.
+func adjustChecksum(checksum uint16, old, new []byte) uint16 {
+	sum := uint32(^checksum)
+	for i := 0; i+1 < len(old); i += 2 {
+		sum += uint32(^networkByteOrder.Uint16(old[i:]))
+		sum += uint32(networkByteOrder.Uint16(new[i:]))
+	}
+
+	for sum > 0xFFFF {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// decodeHexDump decodes the bytes from a hex dump, one line at a time. The first field of a line is
+// an offset if it ends in a colon, as xxd and tcpdump print them, or if it's at least four digits
+// long and matches the number of bytes decoded so far, as Wireshark and hexdump print them. The hex
+// digits end at the first field that isn't an even number of digits, or that's longer than the
+// first group on the line, or at a gap of two or more spaces followed by the ASCII column, which
+// has a character for each byte on the line. A line that doesn't start with hex digits isn't a hex
+// dump at all.
+func decodeHexDump(dump string) ([]byte, error) {
+	data := make([]byte, 0)
+
+	for _, line := range strings.Split(dump, "\n") {
+		// hexdump -C puts the ASCII column between bars, where it may contain spaces.
+		if bar := strings.IndexByte(line, '|'); bar >= 0 {
+			line = line[:bar]
+		}
+
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		if len(fields) > 1 && isHexDumpOffset(fields[0], len(data)) {
+			line = strings.TrimLeft(line[len(fields[0]):], " \t")
+		}
+
+		// The hex is read a run at a time, up to each gap, since some dumps leave a gap half way
+		// along the hex as well as before the ASCII column.
+		group, decoded := 0, 0
+		for line != "" {
+			if decoded > 0 && isHexDumpASCII(line, decoded, group) {
+				break
+			}
+
+			run, rest := line, ""
+			if gap := hexDumpGap(line); gap >= 0 {
+				run, rest = line[:gap], strings.TrimLeft(line[gap:], " \t")
+			}
+
+			for _, field := range strings.Fields(run) {
+				value, err := hex.DecodeString(field)
+				if group == 0 && err != nil {
+					return data, IncorrectPacket
+				}
+				if group == 0 {
+					group = len(field)
+				}
+				if err != nil || len(field) > group {
+					rest = ""
+					break
+				}
+				data = append(data, value...)
+				decoded += len(value)
+			}
+			line = rest
+		}
+	}
+
+	return data, nil
+}
+
+// hexDumpGap returns the index of the first gap of two or more spaces, or of a tab, in a line of a
+// hex dump, or -1 if there isn't one.
+func hexDumpGap(line string) int {
+	gap := strings.Index(line, "  ")
+	if tab := strings.IndexByte(line, '\t'); tab >= 0 && (gap < 0 || tab < gap) {
+		gap = tab
+	}
+	return gap
+}
+
+// isHexDumpASCII returns whether the rest of a line of a hex dump, following a gap, is its ASCII
+// column: it has a character for each of the bytes decoded from the line, and isn't itself more
+// groups of hex digits like the ones before it.
+func isHexDumpASCII(rest string, decoded int, group int) bool {
+	if len(rest) != decoded {
+		return false
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 2 {
+		return true
+	}
+	for _, field := range fields {
+		if _, err := hex.DecodeString(field); err != nil || len(field) != group {
+			return true
+		}
+	}
+	return false
+}
+
+// isHexDumpOffset returns whether the first field of a line of a hex dump is the offset of the
+// line, given how many bytes have been decoded so far.
+func isHexDumpOffset(field string, decoded int) bool {
+	if strings.HasSuffix(field, ":") {
+		return true
+	}
+
+	offset, err := strconv.ParseUint(strings.TrimPrefix(field, "0x"), 16, 32)
+	return err == nil && len(field) >= 4 && offset == uint64(decoded)
+}
+
+// shortReadError converts a short read into InsufficientLength, leaving other errors as they are.
+func shortReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return InsufficientLength
+	}
+	return err
+}
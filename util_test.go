@@ -1,6 +1,22 @@
 package gopcap
 
-import "testing"
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// allocatedBy returns the number of bytes allocated while fn runs, for checking that corrupt
+// lengths can't force large allocations.
+func allocatedBy(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
 
 func TestGetUint16(t *testing.T) {
 	// Prepare some test byte arrays.
@@ -103,3 +119,97 @@ func TestGetInt32(t *testing.T) {
 		}
 	}
 }
+
+// readFieldsTestData is a header of every kind of field readFields decodes directly.
+type readFieldsTestData struct {
+	A uint8
+	B IPProtocol
+	C uint16
+	D EtherType
+	E int32
+	F Link
+	G uint64
+	H [6]byte
+	I [16]byte
+	J []byte
+}
+
+func (d *readFieldsTestData) fields() []interface{} {
+	return []interface{}{&d.A, &d.B, &d.C, &d.D, &d.E, &d.F, &d.G, &d.H, &d.I, d.J}
+}
+
+func TestReadFields(t *testing.T) {
+	data := make([]byte, 48)
+	for i := range data {
+		data[i] = byte(i*7 + 1)
+	}
+
+	// Whether the source is long enough or cut short, the fields read and the error returned
+	// should match those from binary.Read.
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		for length := 0; length <= len(data); length++ {
+			fast := readFieldsTestData{J: make([]byte, 4)}
+			slow := readFieldsTestData{J: make([]byte, 4)}
+
+			fastErr := readFields(bytes.NewReader(data[:length]), order, fast.fields())
+			slowErr := readFieldsSlowly(bytes.NewReader(data[:length]), order, slow.fields())
+
+			if fastErr != slowErr {
+				t.Errorf("Unexpected error reading %v bytes: expected %v, got %v", length, slowErr, fastErr)
+			}
+			if !reflect.DeepEqual(fast, slow) {
+				t.Errorf("Unexpected fields reading %v bytes:\nexpected %+v\ngot      %+v", length, slow, fast)
+			}
+		}
+	}
+
+	// Other types fall back to binary.Read.
+	var pair [2]uint16
+	err := readFields(bytes.NewReader([]byte{0x01, 0x02, 0x03, 0x04}), binary.BigEndian, []interface{}{&pair})
+	if err != nil || pair != [2]uint16{0x0102, 0x0304} {
+		t.Errorf("Unexpected result: %v, %v", pair, err)
+	}
+}
+
+func BenchmarkReadFields(b *testing.B) {
+	data := make([]byte, 48)
+	src := bytes.NewReader(data)
+	fields := readFieldsTestData{J: make([]byte, 4)}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		src.Reset(data)
+		err := readFields(src, binary.BigEndian, fields.fields())
+		if err != nil {
+			b.Fatalf("Received unexpected error: %v", err)
+		}
+	}
+}
+
+func TestDecodeHexDump(t *testing.T) {
+	cases := []struct {
+		dump     string
+		expected []byte
+	}{
+		// A short ASCII column that's also valid hex is still the ASCII column.
+		{"00000000: 6162  ab", []byte{0x61, 0x62}},
+		{"0000   61 62   ab", []byte{0x61, 0x62}},
+		{"0x0000:  4500 0054  E..T", []byte{0x45, 0x00, 0x00, 0x54}},
+		// A gap half way along the hex doesn't end it.
+		{"0000  00 01 02 03 04 05 06 07  08 09   ..........", []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"00000000  00 01 02 03 04 05 06 07  08 09 0a 0b  |............|", []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+		// Without an ASCII column, everything is hex.
+		{"0000  61 62 63 64  65 66", []byte("abcdef")},
+		{"6162 6364", []byte("abcd")},
+	}
+
+	for _, c := range cases {
+		data, err := decodeHexDump(c.dump)
+		if err != nil {
+			t.Errorf("Unexpected error decoding %q: %v", c.dump, err)
+		}
+		if !bytes.Equal(data, c.expected) {
+			t.Errorf("Unexpected data decoding %q: expected %x, got %x", c.dump, c.expected, data)
+		}
+	}
+}
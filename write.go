@@ -0,0 +1,156 @@
+package gopcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// serializer is implemented by the layers that can be turned back into the bytes they were read
+// from.
+type serializer interface {
+	Serialize() ([]byte, error)
+}
+
+// serializeLayer serializes a layer of any kind, returning UnserializableLayer if gopcap doesn't
+// know how to. A nil layer, such as the missing payload of a packet that was cut short, serializes
+// to nothing.
+func serializeLayer(layer interface{}) ([]byte, error) {
+	if layer == nil {
+		return nil, nil
+	}
+
+	s, ok := layer.(serializer)
+	if !ok {
+		return nil, UnserializableLayer
+	}
+	return s.Serialize()
+}
+
+// WriteTo writes the file out as a classic pcap file, so a capture can be saved again after its
+// packets have been filtered or modified, and returns the number of bytes written. The file is
+// little endian, and has the nanosecond magic number if TimestampResolution is time.Nanosecond. A
+// file with no version, such as one built by hand, is written as version 2.4.
+//
+// Each packet is rebuilt from its layers, so IncludedLen is recomputed from the serialized length.
+// If the packet was cut short by the snaplen, ActualLen keeps the number of bytes that were lost;
+// otherwise it's the same as IncludedLen. The header fields of each layer are written as they are:
+// lengths and checksums aren't recomputed, so a layer whose size or contents are changed must
+// have them updated to match. Ethernet padding isn't kept, so padded frames are written without
+// it. Packets with no data, such as zero Packets added by hand, are skipped. Only Ethernet, LLC,
+// SLL, NULL and RAW links, IPv4, IPv6 and ARP, and TCP, UDP, UDP-Lite and ICMP can be serialized,
+// along with the unknown layers. A packet with any other layer, or a truncated Ethernet header, is
+// written from Raw instead, so changes to its layers are lost; if it has no Raw, the write stops
+// with UnserializableLayer.
+func (file *PcapFile) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	dst := bufio.NewWriterSize(counter, DefaultBufferSize)
+	order := binary.LittleEndian
+
+	err := file.writeFileHeader(dst, order)
+	if err != nil {
+		return counter.n, err
+	}
+
+	resolution := file.writeResolution()
+	for i := range file.Packets {
+		err = file.Packets[i].writeTo(dst, order, resolution)
+		if err != nil {
+			return counter.n, err
+		}
+	}
+
+	err = dst.Flush()
+	return counter.n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeResolution returns the resolution the file's timestamps are written with: nanoseconds if
+// the file has them, and otherwise microseconds.
+func (file *PcapFile) writeResolution() time.Duration {
+	if file.TimestampResolution == time.Nanosecond {
+		return time.Nanosecond
+	}
+	return time.Microsecond
+}
+
+// writeTo writes the packet, rebuilt from its layers, along with its header. A packet that can't be
+// rebuilt is written from Raw, and one with no data is skipped. See PcapFile.WriteTo.
+func (pkt *Packet) writeTo(dst io.Writer, order binary.ByteOrder, resolution time.Duration) error {
+	if pkt.Data == nil {
+		return nil
+	}
+
+	data, err := serializeLayer(pkt.Data)
+	if err == UnserializableLayer && pkt.Raw != nil {
+		data, err = pkt.Raw, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = pkt.writePacketHeader(dst, order, resolution, uint32(len(data)))
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(data)
+	return err
+}
+
+// The magic numbers of classic files and of files with nanosecond timestamps. Written in the byte
+// order of the file, they become the byte sequences checkMagicNum looks for.
+const (
+	magicMicrosecond uint32 = 0xa1b2c3d4
+	magicNanosecond  uint32 = 0xa1b23c4d
+)
+
+// writeFileHeader writes the magic number and the file header.
+func (file *PcapFile) writeFileHeader(dst io.Writer, order binary.ByteOrder) error {
+	magicNumber := magicMicrosecond
+	if file.TimestampResolution == time.Nanosecond {
+		magicNumber = magicNanosecond
+	}
+
+	majorVersion, minorVersion := file.MajorVersion, file.MinorVersion
+	if majorVersion == 0 && minorVersion == 0 {
+		majorVersion, minorVersion = 2, 4
+	}
+
+	return writeFields(dst, order, []interface{}{
+		magicNumber,
+		majorVersion,
+		minorVersion,
+		file.TZCorrection,
+		file.SigFigs,
+		file.MaxLen,
+		file.LinkType,
+	})
+}
+
+// writePacketHeader writes the header in front of a packet whose serialized form is length bytes
+// long, with the fractional part of the timestamp in units of resolution.
+func (pkt *Packet) writePacketHeader(dst io.Writer, order binary.ByteOrder, resolution time.Duration, length uint32) error {
+	actualLen := length
+	if pkt.ActualLen > pkt.IncludedLen {
+		actualLen += pkt.ActualLen - pkt.IncludedLen
+	}
+
+	return writeFields(dst, order, []interface{}{
+		uint32(pkt.Timestamp / time.Second),
+		uint32((pkt.Timestamp % time.Second) / resolution),
+		length,
+		actualLen,
+	})
+}
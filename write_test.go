@@ -0,0 +1,163 @@
+package gopcap
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriteToRoundTrip(t *testing.T) {
+	src, err := os.Open("SkypeIRC.cap")
+	if err != nil {
+		t.Fatal("Missing pcap file.")
+	}
+	defer src.Close()
+
+	original, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	var written bytes.Buffer
+	n, err := original.WriteTo(&written)
+	if err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	if n != int64(written.Len()) {
+		t.Errorf("Unexpected number of bytes written: expected %v, got %v", written.Len(), n)
+	}
+
+	reparsed, err := Parse(&written)
+	if err != nil {
+		t.Fatalf("Unexpected error reparsing file: %v", err)
+	}
+	if reparsed.MajorVersion != original.MajorVersion || reparsed.MinorVersion != original.MinorVersion ||
+		reparsed.MaxLen != original.MaxLen || reparsed.LinkType != original.LinkType {
+		t.Errorf("Unexpected file header: expected %+v, got %+v", original, reparsed)
+	}
+	if len(reparsed.Packets) != len(original.Packets) {
+		t.Fatalf("Unexpected number of packets: expected %v, got %v", len(original.Packets), len(reparsed.Packets))
+	}
+
+	for i := range original.Packets {
+		before, after := &original.Packets[i], &reparsed.Packets[i]
+		if before.Data == nil {
+			continue
+		}
+		if after.Timestamp != before.Timestamp {
+			t.Errorf("Unexpected timestamp for packet %v: expected %v, got %v", i, before.Timestamp, after.Timestamp)
+		}
+
+		// Ethernet padding is dropped, so padded frames come back shorter, but otherwise each
+		// packet is written as it was read.
+		if after.IncludedLen > before.IncludedLen || after.ActualLen != after.IncludedLen {
+			t.Errorf("Unexpected lengths for packet %v: expected at most %v, got %v and %v", i, before.IncludedLen, after.IncludedLen, after.ActualLen)
+		}
+
+		first, _ := serializeLayer(before.Data)
+		second, err := serializeLayer(after.Data)
+		if err != nil || !bytes.Equal(first, second) {
+			t.Errorf("Unexpected data for packet %v: expected %x, got %x, %v", i, first, second, err)
+		}
+	}
+}
+
+func TestWriteToExact(t *testing.T) {
+	// The raw file from TestParseRaw, with an IPv4 echo request and an IPv6 UDP datagram, is
+	// written back byte for byte.
+	data := []byte{
+		0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x65, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x45, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00, 0x00,
+		0x40, 0x01, 0xF6, 0x8C, 0xC0, 0xA8, 0x01, 0x02, 0xC0, 0xA8, 0x01, 0x01, 0x08, 0x00, 0x4D, 0x5A, 0x12, 0x34, 0x00, 0x01, 0x61, 0x62, 0x63, 0x64,
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x11, 0x01,
+		0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x54, 0xdf, 0x2d, 0x24, 0x6b, 0x28, 0x0e, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0xdb, 0x3d, 0x07, 0x6c, 0x00, 0x0c, 0x50, 0x26, 0x01, 0x02, 0x03, 0x04,
+	}
+
+	parsed, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+
+	var written bytes.Buffer
+	_, err = parsed.WriteTo(&written)
+	if err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	if !bytes.Equal(written.Bytes(), data) {
+		t.Errorf("Unexpected file:\nexpected %x\ngot      %x", data, written.Bytes())
+	}
+
+	// With nanosecond resolution the magic number changes, and so do the timestamps' units.
+	parsed.TimestampResolution = time.Nanosecond
+	parsed.Packets[1].Timestamp = 2*time.Second + 5*time.Nanosecond
+	written.Reset()
+	_, err = parsed.WriteTo(&written)
+	if err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	if !bytes.Equal(written.Bytes()[:4], []byte{0x4d, 0x3c, 0xb2, 0xa1}) {
+		t.Errorf("Unexpected magic number: %x", written.Bytes()[:4])
+	}
+	reparsed, err := Parse(&written)
+	if err != nil || len(reparsed.Packets) < 2 {
+		t.Fatalf("Unexpected reparsed file: %v packets, %v", len(reparsed.Packets), err)
+	}
+	if reparsed.Packets[1].Timestamp != parsed.Packets[1].Timestamp {
+		t.Errorf("Unexpected timestamp: expected %v, got %v", parsed.Packets[1].Timestamp, reparsed.Packets[1].Timestamp)
+	}
+}
+
+func TestWriteToSnappedPacket(t *testing.T) {
+	// A UDP datagram that lost 100 bytes to the snaplen keeps them in its actual length.
+	file := PcapFile{LinkType: RAW, MaxLen: 28, Packets: []Packet{{
+		IncludedLen: 28,
+		ActualLen:   128,
+		Data: &RawLink{data: &IPv4Packet{IHL: 5, TotalLength: 128, Protocol: IPP_UDP, data: &UDPDatagram{
+			SourcePort: 1, DestinationPort: 2, Length: 108,
+		}}},
+	}}}
+
+	var written bytes.Buffer
+	_, err := file.WriteTo(&written)
+	if err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	reparsed, _ := Parse(&written)
+	if len(reparsed.Packets) < 1 {
+		t.Fatalf("Unexpected number of packets: expected at least %v, got %v", 1, len(reparsed.Packets))
+	}
+	if pkt := reparsed.Packets[0]; pkt.IncludedLen != 28 || pkt.ActualLen != 128 {
+		t.Errorf("Unexpected lengths: expected %v and %v, got %v and %v", 28, 128, pkt.IncludedLen, pkt.ActualLen)
+	}
+}
+
+func TestWriteToUnserializable(t *testing.T) {
+	// A GRE packet can't be rebuilt, so it's written as it was read.
+	raw := []byte{
+		0x45, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x00, 0x40, 0x2F, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x01, 0x0A, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x08, 0x00, 0x01, 0x02, 0x03, 0x04,
+	}
+	file := PcapFile{LinkType: RAW, Packets: []Packet{{
+		Raw:  raw,
+		Data: &RawLink{data: &IPv4Packet{IHL: 5, Protocol: IPP_GRE, data: new(GREHeader)}},
+	}}}
+
+	var written bytes.Buffer
+	n, err := file.WriteTo(&written)
+	if err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	if n != int64(fileHeaderLength+packetHeaderLength+len(raw)) || !bytes.HasSuffix(written.Bytes(), raw) {
+		t.Errorf("Unexpected file: %v bytes, %x", n, written.Bytes())
+	}
+
+	// Without Raw, there's nothing to write it from.
+	file.Packets[0].Raw = nil
+	written.Reset()
+	if _, err := file.WriteTo(&written); err != UnserializableLayer {
+		t.Errorf("Unexpected error: expected %v, got %v", UnserializableLayer, err)
+	}
+}